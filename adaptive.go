@@ -0,0 +1,102 @@
+package sturdyc
+
+import (
+	"context"
+	"errors"
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// adaptiveRefreshSmoothing is the weight that each observed latency is
+	// given in the moving average that the refresh intervals are scaled by.
+	adaptiveRefreshSmoothing = 0.2
+	// The bounds of the factor that the refresh intervals are multiplied by.
+	minAdaptiveRefreshFactor = 0.5
+	maxAdaptiveRefreshFactor = 8
+)
+
+// adaptiveRefresh scales the refresh intervals by how the latency of the
+// fetchFns compares to the target of WithAdaptiveRefresh.
+type adaptiveRefresh struct {
+	sync.Mutex
+	target  time.Duration
+	latency float64
+	factor  atomic.Uint64
+}
+
+func newAdaptiveRefresh(target time.Duration) *adaptiveRefresh {
+	a := &adaptiveRefresh{target: target}
+	a.factor.Store(math.Float64bits(1))
+	return a
+}
+
+// observeFetchLatency adds the latency of a call to a fetchFn to the moving
+// average, and reports the factor of the refresh intervals if it changed.
+func (c *Config) observeFetchLatency(d time.Duration) {
+	a := c.adaptiveRefresh
+	a.Lock()
+	if a.latency == 0 {
+		a.latency = float64(d)
+	} else {
+		a.latency += adaptiveRefreshSmoothing * (float64(d) - a.latency)
+	}
+	factor := min(max(a.latency/float64(a.target), minAdaptiveRefreshFactor), maxAdaptiveRefreshFactor)
+	changed := a.factor.Swap(math.Float64bits(factor)) != math.Float64bits(factor)
+	a.Unlock()
+
+	if recorder, ok := optionalRecorder[AdaptiveRefreshRecorder](c); ok && changed {
+		recorder.RefreshIntervalFactor(factor)
+	}
+}
+
+// observeFetch adds the latency of a call that started at start to the moving
+// average. Only the calls that reached the data source are observed, which
+// are the ones that returned a response or timed out. Errors that are
+// returned right away, such as ErrCircuitOpen, would otherwise shorten the
+// refresh intervals while the data source is struggling.
+func (c *Config) observeFetch(start time.Time, err error) {
+	if err == nil || errors.Is(err, ErrNotFound) || errors.Is(err, context.DeadlineExceeded) {
+		c.observeFetchLatency(c.clock.Since(start))
+	}
+}
+
+// measuredFetch measures the latency of the fetchFn for WithAdaptiveRefresh.
+// It has to wrap the fetchFn directly, so that the records that are served by
+// the distributed storage, or rejected by the circuit breaker, aren't timed.
+func measuredFetch[V any](c *Config, fetchFn FetchFn[V]) FetchFn[V] {
+	if c.adaptiveRefresh == nil {
+		return fetchFn
+	}
+	return func(ctx context.Context) (V, error) {
+		start := c.clock.Now()
+		res, err := fetchFn(ctx)
+		c.observeFetch(start, err)
+		return res, err
+	}
+}
+
+// measuredBatchFetch is the batch equivalent of measuredFetch.
+func measuredBatchFetch[V any](c *Config, fetchFn BatchFetchFn[V]) BatchFetchFn[V] {
+	if c.adaptiveRefresh == nil {
+		return fetchFn
+	}
+	return func(ctx context.Context, ids []string) (map[string]V, error) {
+		start := c.clock.Now()
+		res, err := fetchFn(ctx, ids)
+		c.observeFetch(start, err)
+		return res, err
+	}
+}
+
+// scaleRefreshDelay returns the delay until an entry becomes due for a
+// refresh, adjusted to the latency of the fetchFns.
+func (c *Config) scaleRefreshDelay(delay time.Duration) time.Duration {
+	if c.adaptiveRefresh == nil {
+		return delay
+	}
+	factor := math.Float64frombits(c.adaptiveRefresh.factor.Load())
+	return time.Duration(float64(delay) * factor)
+}
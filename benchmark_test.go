@@ -1,6 +1,9 @@
 package sturdyc_test
 
 import (
+	"context"
+	"strconv"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -97,3 +100,22 @@ func BenchmarkSetConcurrent(b *testing.B) {
 	b.StopTimer()
 	b.ReportMetric(metrics.evictions())
 }
+
+func BenchmarkGetOrFetchConcurrentMissesInOneShard(b *testing.B) {
+	ctx := context.Background()
+	c := sturdyc.New[string](1_000_000, 1, time.Hour, 5,
+		sturdyc.WithNoContinuousEvictions(),
+	)
+	fetchFn := func(_ context.Context) (string, error) {
+		return "value", nil
+	}
+
+	var counter atomic.Int64
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			key := strconv.FormatInt(counter.Add(1), 10)
+			_, _ = sturdyc.GetOrFetch(ctx, c, key, fetchFn)
+		}
+	})
+}
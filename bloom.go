@@ -0,0 +1,100 @@
+package sturdyc
+
+import (
+	"math"
+	"sync/atomic"
+
+	"github.com/cespare/xxhash"
+)
+
+// BloomFilter is a probabilistic set of keys. It never reports that a key is
+// absent if it has been added, but it can report that a key is present even
+// though it hasn't been, at the false-positive rate it was created with. It's
+// safe for concurrent use.
+type BloomFilter struct {
+	bits      []atomic.Uint64
+	numBits   uint64
+	numHashes int
+}
+
+// NewBloomFilter creates a filter that is sized for the expected number of
+// keys. The false-positive rate is only upheld if no more keys than that are
+// added.
+//
+// Parameters:
+//
+//	expectedKeys - The number of keys that the filter is expected to hold.
+//	falsePositiveRate - The probability of reporting a key that hasn't been added. Has to be between 0 and 1.
+//
+// Returns:
+//
+//	A filter without any keys.
+func NewBloomFilter(expectedKeys int, falsePositiveRate float64) *BloomFilter {
+	if expectedKeys < 1 {
+		panic("expectedKeys must be greater than 0")
+	}
+	if falsePositiveRate <= 0 || falsePositiveRate >= 1 {
+		panic("falsePositiveRate must be between 0 and 1")
+	}
+
+	n := float64(expectedKeys)
+	numBits := uint64(math.Ceil(-n * math.Log(falsePositiveRate) / (math.Ln2 * math.Ln2)))
+	numHashes := max(1, int(math.Round(float64(numBits)/n*math.Ln2)))
+	return &BloomFilter{
+		bits:      make([]atomic.Uint64, (numBits+63)/64),
+		numBits:   numBits,
+		numHashes: numHashes,
+	}
+}
+
+// positions derives the bits of the key from two halves of a single hash.
+func (b *BloomFilter) positions(key string, fn func(word int, mask uint64) bool) {
+	h := xxhash.Sum64String(key)
+	h1, h2 := h&math.MaxUint32, h>>32
+	for i := 0; i < b.numHashes; i++ {
+		bit := (h1 + uint64(i)*h2) % b.numBits
+		if !fn(int(bit/64), 1<<(bit%64)) {
+			return
+		}
+	}
+}
+
+// Add adds the key to the filter.
+func (b *BloomFilter) Add(key string) {
+	b.positions(key, func(word int, mask uint64) bool {
+		for {
+			old := b.bits[word].Load()
+			if old&mask != 0 || b.bits[word].CompareAndSwap(old, old|mask) {
+				return true
+			}
+		}
+	})
+}
+
+// MayContain reports whether the key could have been added to the filter.
+// A false return value means that the key has definitely not been added.
+func (b *BloomFilter) MayContain(key string) bool {
+	contains := true
+	b.positions(key, func(word int, mask uint64) bool {
+		contains = b.bits[word].Load()&mask != 0
+		return contains
+	})
+	return contains
+}
+
+// skipDistributedLookup reports whether the negative lookup
+// filter knows that the key is absent from the distributed storage.
+func (c *Config) skipDistributedLookup(key string) bool {
+	return c.negativeLookupFilter != nil && !c.negativeLookupFilter.MayContain(key)
+}
+
+// addToLookupFilter adds the keys that are written to the
+// distributed storage to the negative lookup filter.
+func (c *Config) addToLookupFilter(keys ...string) {
+	if c.negativeLookupFilter == nil {
+		return
+	}
+	for _, key := range keys {
+		c.negativeLookupFilter.Add(key)
+	}
+}
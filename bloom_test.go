@@ -0,0 +1,35 @@
+package sturdyc_test
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/creativecreature/sturdyc"
+)
+
+func TestBloomFilterNeverReportsAddedKeysAsAbsent(t *testing.T) {
+	t.Parallel()
+
+	numKeys := 10_000
+	filter := sturdyc.NewBloomFilter(numKeys, 0.01)
+	for i := 0; i < numKeys; i++ {
+		filter.Add("key-" + strconv.Itoa(i))
+	}
+
+	for i := 0; i < numKeys; i++ {
+		if !filter.MayContain("key-" + strconv.Itoa(i)) {
+			t.Fatalf("expected key-%d to be reported as present", i)
+		}
+	}
+
+	var falsePositives int
+	for i := 0; i < numKeys; i++ {
+		if filter.MayContain("other-" + strconv.Itoa(i)) {
+			falsePositives++
+		}
+	}
+	// We'll allow for some variance from the configured rate of 1%.
+	if rate := float64(falsePositives) / float64(numKeys); rate > 0.02 {
+		t.Errorf("expected a false-positive rate close to 0.01, got %f", rate)
+	}
+}
@@ -0,0 +1,235 @@
+package sturdyc
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// CircuitState is the state of a circuit breaker of WithCircuitBreaker.
+type CircuitState int
+
+const (
+	// CircuitClosed is the state in which the fetches are let through.
+	CircuitClosed CircuitState = iota
+	// CircuitOpen is the state in which the fetches fail fast with
+	// ErrCircuitOpen, without the fetchFn being called.
+	CircuitOpen
+	// CircuitHalfOpen is the state in which a single probe is let
+	// through to find out whether the data source has recovered.
+	CircuitHalfOpen
+)
+
+// String returns the name of the state.
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitClosed:
+		return "closed"
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half_open"
+	}
+	return "unknown"
+}
+
+// errFetchPanicked is recorded as the outcome of a fetch that panicked.
+var errFetchPanicked = errors.New("sturdyc: the fetchFn panicked")
+
+type circuitBreaker struct {
+	state    CircuitState
+	failures int
+	openedAt time.Time
+	probedAt time.Time
+}
+
+// circuitBreakers holds a circuit breaker for each of the fetch targets.
+type circuitBreakers struct {
+	sync.Mutex
+	failureThreshold int
+	openDuration     time.Duration
+	breakers         map[string]*circuitBreaker
+}
+
+func newCircuitBreakers(failureThreshold int, openDuration time.Duration) *circuitBreakers {
+	return &circuitBreakers{
+		failureThreshold: failureThreshold,
+		openDuration:     openDuration,
+		breakers:         make(map[string]*circuitBreaker),
+	}
+}
+
+// breakerTarget returns the fetch target of the key, which is the same
+// for every key unless WithCircuitBreakerTargetFn has been used.
+func (c *Config) breakerTarget(key string) string {
+	if c.circuitBreakerTargetFn == nil {
+		return ""
+	}
+	return c.circuitBreakerTargetFn(key)
+}
+
+// breaker should be called with a lock.
+func (b *circuitBreakers) breaker(target string) *circuitBreaker {
+	breaker, ok := b.breakers[target]
+	if !ok {
+		breaker = &circuitBreaker{}
+		b.breakers[target] = breaker
+	}
+	return breaker
+}
+
+// allowFetch reports whether the fetch for the target is let through. An open
+// breaker becomes half-open once the open duration has elapsed, and it lets
+// a single probe through. Another probe is let through if the previous one
+// hasn't returned within the open duration, which ensures that a probe that
+// hangs can't keep the breaker half-open forever.
+func (c *Config) allowFetch(target string) bool {
+	b := c.circuitBreakers
+	b.Lock()
+	breaker := b.breaker(target)
+	switch breaker.state {
+	case CircuitClosed:
+		b.Unlock()
+		return true
+	case CircuitOpen:
+		if c.clock.Since(breaker.openedAt) < b.openDuration {
+			b.Unlock()
+			return false
+		}
+		breaker.state = CircuitHalfOpen
+		breaker.probedAt = c.clock.Now()
+		b.Unlock()
+		c.reportCircuitStateChange(target, CircuitHalfOpen)
+		return true
+	}
+	// The breaker is half-open, and the probe is already in-flight.
+	if c.clock.Since(breaker.probedAt) >= b.openDuration {
+		breaker.probedAt = c.clock.Now()
+		b.Unlock()
+		return true
+	}
+	b.Unlock()
+	return false
+}
+
+// guardedFetch calls the fetchFn, and records its outcome with the breaker of
+// the target. The outcome is recorded in a defer so that a fetchFn which
+// panics counts as a failure, rather than leaving a probe unaccounted for.
+func guardedFetch[R any](c *Config, target string, fetchFn func() (R, error)) (res R, err error) {
+	panicked := true
+	defer func() {
+		if panicked {
+			err = errFetchPanicked
+		}
+		c.recordFetch(target, err)
+	}()
+	res, err = fetchFn()
+	panicked = false
+	return res, err
+}
+
+// recordFetch updates the breaker of the target with the outcome of a fetch.
+// Records that don't exist, and fetches that were cancelled by the caller,
+// are not counted as failures, since the data source didn't fail.
+func (c *Config) recordFetch(target string, err error) {
+	b := c.circuitBreakers
+	failed := err != nil && !errors.Is(err, ErrNotFound) && !errors.Is(err, context.Canceled)
+
+	b.Lock()
+	breaker := b.breaker(target)
+	previous := breaker.state
+	switch {
+	case !failed:
+		breaker.state = CircuitClosed
+		breaker.failures = 0
+	case previous == CircuitHalfOpen:
+		breaker.state = CircuitOpen
+		breaker.openedAt = c.clock.Now()
+	default:
+		breaker.failures++
+		if breaker.failures >= b.failureThreshold {
+			breaker.state = CircuitOpen
+			breaker.openedAt = c.clock.Now()
+		}
+	}
+	state := breaker.state
+	b.Unlock()
+
+	if state != previous {
+		c.reportCircuitStateChange(target, state)
+	}
+}
+
+func (c *Config) reportCircuitStateChange(target string, state CircuitState) {
+	if state == CircuitOpen {
+		c.log.Warn("sturdyc: the circuit breaker opened", "target", target)
+	} else {
+		c.log.Debug("sturdyc: the circuit breaker changed state", "target", target, "state", state.String())
+	}
+	if recorder, ok := optionalRecorder[CircuitBreakerRecorder](c); ok {
+		recorder.CircuitStateChanged(target, state)
+	}
+}
+
+// breakerFetch guards the fetchFn with the circuit breaker of the target that
+// the key belongs to, if the client has been configured with WithCircuitBreaker.
+// The latency of the fetchFn is measured once the breaker has let it through.
+func breakerFetch[V any](c *Config, key string, fetchFn FetchFn[V]) FetchFn[V] {
+	fetchFn = measuredFetch(c, fetchFn)
+	if c.circuitBreakers == nil {
+		return fetchFn
+	}
+	target := c.breakerTarget(key)
+	return func(ctx context.Context) (V, error) {
+		if !c.allowFetch(target) {
+			var zero V
+			return zero, ErrCircuitOpen
+		}
+		return guardedFetch(c, target, func() (V, error) {
+			return fetchFn(ctx)
+		})
+	}
+}
+
+// breakerBatchFetch is the batch equivalent of breakerFetch. A batch is
+// guarded by the breaker of the target that the key of its first ID belongs to.
+// A partial batch fetch only counts as a failure if every one of its IDs
+// failed, since the data source is up if it was able to return any of them.
+func breakerBatchFetch[V any](c *Config, keyFn KeyFn, fetchFn BatchFetchFn[V]) BatchFetchFn[V] {
+	fetchFn = measuredBatchFetch(c, fetchFn)
+	if c.circuitBreakers == nil {
+		return fetchFn
+	}
+	return func(ctx context.Context, ids []string) (map[string]V, error) {
+		var target string
+		if len(ids) > 0 {
+			target = c.breakerTarget(keyFn(ids[0]))
+		}
+		if !c.allowFetch(target) {
+			return nil, ErrCircuitOpen
+		}
+		var idErrs batchErrors
+		res, err := guardedFetch(c, target, func() (map[string]V, error) {
+			res, err := fetchFn(ctx, ids)
+			if errors.As(err, &idErrs) && !allFailed(ids, idErrs) {
+				return res, nil
+			}
+			return res, err
+		})
+		if err == nil && len(idErrs) > 0 {
+			return res, idErrs
+		}
+		return res, err
+	}
+}
+
+// allFailed returns true if every one of the IDs failed with an error other than ErrNotFound.
+func allFailed(ids []string, idErrs batchErrors) bool {
+	for _, id := range ids {
+		if err, ok := idErrs[id]; !ok || errors.Is(err, ErrNotFound) {
+			return false
+		}
+	}
+	return true
+}
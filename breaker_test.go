@@ -0,0 +1,201 @@
+package sturdyc_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/creativecreature/sturdyc"
+)
+
+type circuitRecorder struct {
+	*TestMetricsRecorder
+	mu     sync.Mutex
+	states []sturdyc.CircuitState
+}
+
+func (r *circuitRecorder) CircuitStateChanged(_ string, state sturdyc.CircuitState) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.states = append(r.states, state)
+}
+
+func TestCircuitBreakerFailsFastOnceTheThresholdHasBeenReached(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	openDuration := time.Minute
+	clock := sturdyc.NewTestClock(time.Now())
+	recorder := &circuitRecorder{TestMetricsRecorder: newTestMetricsRecorder(1)}
+	c := sturdyc.New[string](100, 1, time.Hour, 10,
+		sturdyc.WithNoContinuousEvictions(),
+		sturdyc.WithClock(clock),
+		sturdyc.WithMetrics(recorder),
+		sturdyc.WithCircuitBreaker(2, openDuration),
+	)
+
+	var calls int
+	errUnavailable := errors.New("unavailable")
+	failingFetch := func(context.Context) (string, error) {
+		calls++
+		return "", errUnavailable
+	}
+	for _, key := range []string{"1", "2"} {
+		if _, err := c.GetOrFetch(ctx, key, failingFetch); !errors.Is(err, errUnavailable) {
+			t.Fatalf("expected the error of the fetchFn, got %v", err)
+		}
+	}
+
+	_, err := c.GetOrFetch(ctx, "3", failingFetch)
+	if !errors.Is(err, sturdyc.ErrCircuitOpen) {
+		t.Errorf("expected the breaker to be open, got %v", err)
+	}
+	if calls != 2 {
+		t.Errorf("expected the fetchFn not to be called while the breaker is open, got %d calls", calls)
+	}
+
+	// Once the open duration has elapsed, a probe is let through.
+	clock.Add(openDuration)
+	res, err := c.GetOrFetch(ctx, "3", func(context.Context) (string, error) { return "value", nil })
+	if err != nil || res != "value" {
+		t.Fatalf("expected the probe to succeed, got %q and %v", res, err)
+	}
+
+	recorder.mu.Lock()
+	defer recorder.mu.Unlock()
+	expected := []sturdyc.CircuitState{sturdyc.CircuitOpen, sturdyc.CircuitHalfOpen, sturdyc.CircuitClosed}
+	if len(recorder.states) != len(expected) {
+		t.Fatalf("expected the transitions %v, got %v", expected, recorder.states)
+	}
+	for i, state := range expected {
+		if recorder.states[i] != state {
+			t.Errorf("expected the transitions %v, got %v", expected, recorder.states)
+			break
+		}
+	}
+}
+
+func TestCircuitBreakerTargetsHaveSeparateBreakers(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	c := sturdyc.New[string](100, 1, time.Hour, 10,
+		sturdyc.WithNoContinuousEvictions(),
+		sturdyc.WithCircuitBreaker(1, time.Minute),
+		sturdyc.WithCircuitBreakerTargetFn(func(key string) string {
+			return key[:1]
+		}),
+	)
+
+	_, err := c.GetOrFetch(ctx, "a1", func(context.Context) (string, error) { return "", errors.New("unavailable") })
+	if err == nil {
+		t.Fatal("expected the fetch to fail")
+	}
+	if _, err := c.GetOrFetch(ctx, "a2", func(context.Context) (string, error) { return "value", nil }); !errors.Is(err, sturdyc.ErrCircuitOpen) {
+		t.Errorf("expected the breaker of target a to be open, got %v", err)
+	}
+	if _, err := c.GetOrFetch(ctx, "b1", func(context.Context) (string, error) { return "value", nil }); err != nil {
+		t.Errorf("expected the breaker of target b to be closed, got %v", err)
+	}
+}
+
+func TestCircuitBreakerGuardsThePartialBatchFetches(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	c := sturdyc.New[string](100, 1, time.Hour, 10,
+		sturdyc.WithNoContinuousEvictions(),
+		sturdyc.WithCircuitBreaker(1, time.Minute),
+	)
+	keyFn := c.BatchKeyFn("item")
+
+	var calls int
+	errUnavailable := errors.New("unavailable")
+	fetchFn := func(failing ...string) sturdyc.PartialBatchFetchFn[string] {
+		return func(_ context.Context, ids []string) (map[string]string, map[string]error) {
+			calls++
+			res, errs := make(map[string]string), make(map[string]error)
+			for _, id := range ids {
+				res[id] = "value"
+				for _, failingID := range failing {
+					if id == failingID {
+						delete(res, id)
+						errs[id] = errUnavailable
+					}
+				}
+			}
+			return res, errs
+		}
+	}
+
+	// The breaker stays closed as long as some of the IDs are fetched.
+	if _, errs, _ := c.GetOrFetchBatchWithErrors(ctx, []string{"1", "2"}, keyFn, fetchFn("2")); !errors.Is(errs["2"], errUnavailable) {
+		t.Fatalf("expected the error of the failed ID, got %v", errs)
+	}
+	if _, _, err := c.GetOrFetchBatchWithErrors(ctx, []string{"3", "4"}, keyFn, fetchFn("4")); err != nil {
+		t.Fatalf("expected the breaker to be closed, got %v", err)
+	}
+
+	// A batch where every ID fails trips it.
+	_, _, _ = c.GetOrFetchBatchWithErrors(ctx, []string{"5", "6"}, keyFn, fetchFn("5", "6"))
+	_, _, err := c.GetOrFetchBatchWithErrors(ctx, []string{"7"}, keyFn, fetchFn())
+	if !errors.Is(err, sturdyc.ErrCircuitOpen) {
+		t.Errorf("expected the breaker to be open, got %v", err)
+	}
+	if calls != 3 {
+		t.Errorf("expected the fetchFn not to be called while the breaker is open, got %d calls", calls)
+	}
+}
+
+func TestCircuitBreakerRecoversFromProbesThatPanicOrHang(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	openDuration := time.Minute
+	clock := sturdyc.NewTestClock(time.Now())
+	c := sturdyc.New[string](100, 1, time.Hour, 10,
+		sturdyc.WithNoContinuousEvictions(),
+		sturdyc.WithClock(clock),
+		sturdyc.WithCircuitBreaker(1, openDuration),
+	)
+
+	failingFetch := func(context.Context) (string, error) {
+		return "", errors.New("unavailable")
+	}
+	if _, err := c.GetOrFetch(ctx, "1", failingFetch); err == nil {
+		t.Fatal("expected the fetch to fail")
+	}
+
+	// A probe that panics should count as a failure, and re-open the breaker.
+	clock.Add(openDuration)
+	panickingFetch := func(context.Context) (string, error) {
+		panic("boom")
+	}
+	if _, err := c.GetOrFetch(ctx, "2", panickingFetch); err == nil {
+		t.Fatal("expected the panic to be returned as an error")
+	}
+	if _, err := c.GetOrFetch(ctx, "3", failingFetch); !errors.Is(err, sturdyc.ErrCircuitOpen) {
+		t.Fatalf("expected the breaker to be open, got %v", err)
+	}
+
+	// A probe that hangs shouldn't keep the breaker half-open for longer than the open duration.
+	clock.Add(openDuration)
+	probeStarted, releaseProbe := make(chan struct{}), make(chan struct{})
+	defer close(releaseProbe)
+	go c.GetOrFetch(ctx, "4", func(context.Context) (string, error) {
+		close(probeStarted)
+		<-releaseProbe
+		return "", errors.New("unavailable")
+	})
+	<-probeStarted
+	if _, err := c.GetOrFetch(ctx, "5", failingFetch); !errors.Is(err, sturdyc.ErrCircuitOpen) {
+		t.Fatalf("expected the breaker to be half-open, got %v", err)
+	}
+	clock.Add(openDuration)
+	res, err := c.GetOrFetch(ctx, "5", func(context.Context) (string, error) { return "value", nil })
+	if err != nil || res != "value" {
+		t.Errorf("expected another probe to be let through, got %q and %v", res, err)
+	}
+}
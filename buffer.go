@@ -1,6 +1,7 @@
 package sturdyc
 
 import (
+	"context"
 	"time"
 )
 
@@ -8,17 +9,21 @@ import (
 type buffer struct {
 	channel chan []string
 	ids     []string
+	// requests is the number of refreshes that have added IDs to the buffer.
+	requests int
 }
 
 // createBuffer should be called WITH a lock when a refresh buffer is created.
-func (c *Client[T]) createBuffer(permutation string, ids []string) {
+func (c *Client[T]) createBuffer(permutation string, ids []string) *buffer {
 	bufferIDs := make([]string, 0, c.bufferSize)
 	bufferIDs = append(bufferIDs, ids...)
 	buf := &buffer{
-		channel: make(chan []string),
-		ids:     bufferIDs,
+		channel:  make(chan []string),
+		ids:      bufferIDs,
+		requests: 1,
 	}
 	c.permutationBufferMap[permutation] = buf
+	return buf
 }
 
 // deleteBuffer should be called WITH a lock when a buffer has been processed.
@@ -26,6 +31,19 @@ func (c *Client[T]) deleteBuffer(permutation string) {
 	delete(c.permutationBufferMap, permutation)
 }
 
+// isActiveBuffer should be called WITH a lock. It reports whether the buffer
+// is still the one in use for the permutation. A buffer stops being active if
+// the cache is cleared while it's gathering IDs.
+func (c *Client[T]) isActiveBuffer(permutation string, buf *buffer) bool {
+	return c.permutationBufferMap[permutation] == buf
+}
+
+// clearBuffers should be called WITH a lock. It discards every buffer
+// so that none of the IDs that they have gathered gets refreshed.
+func (c *Client[T]) clearBuffers() {
+	clear(c.permutationBufferMap)
+}
+
 // bufferBatchRefresh will buffer the batch of IDs until the batch size is reached or the buffer duration is exceeded.
 func bufferBatchRefresh[T any](c *Client[T], ids []string, keyFn KeyFn, fetchFn BatchFetchFn[T]) {
 	if len(ids) == 0 {
@@ -34,6 +52,7 @@ func bufferBatchRefresh[T any](c *Client[T], ids []string, keyFn KeyFn, fetchFn
 
 	// If we got a perfect batch size, we can refresh the records immediately.
 	if len(ids) == c.bufferSize {
+		c.reportBatchRefreshCoalesced(1, ids)
 		c.refreshBatch(ids, keyFn, fetchFn)
 		return
 	}
@@ -47,6 +66,7 @@ func bufferBatchRefresh[T any](c *Client[T], ids []string, keyFn KeyFn, fetchFn
 		c.batchMutex.Unlock()
 
 		// These IDs are the size we want, so we'll refresh them immediately.
+		c.reportBatchRefreshCoalesced(1, idsToRefresh)
 		c.safeGo(func() {
 			c.refreshBatch(idsToRefresh, keyFn, fetchFn)
 		})
@@ -82,14 +102,12 @@ func bufferBatchRefresh[T any](c *Client[T], ids []string, keyFn KeyFn, fetchFn
 
 	// There is no existing batch buffering for this permutation
 	// of options. Hence, we'll create a new one.
-	c.createBuffer(permutationString, ids)
+	buf := c.createBuffer(permutationString, ids)
 	c.batchMutex.Unlock()
 
 	c.safeGo(func() {
 		timer, stop := c.clock.NewTimer(c.bufferTimeout)
-		c.batchMutex.Lock()
-		idStream := c.permutationBufferMap[permutationString].channel
-		c.batchMutex.Unlock()
+		idStream := buf.channel
 
 		for {
 			select {
@@ -101,12 +119,16 @@ func bufferBatchRefresh[T any](c *Client[T], ids []string, keyFn KeyFn, fetchFn
 
 				// We reached the deadline for this batch.
 				c.batchMutex.Lock()
-				buffer := c.permutationBufferMap[permutationString]
+				if !c.isActiveBuffer(permutationString, buf) {
+					c.batchMutex.Unlock()
+					return
+				}
 				c.deleteBuffer(permutationString)
 				c.batchMutex.Unlock()
 
+				c.reportBatchRefreshCoalesced(buf.requests, buf.ids)
 				c.safeGo(func() {
-					c.refreshBatch(buffer.ids, keyFn, fetchFn)
+					c.refreshBatch(buf.ids, keyFn, fetchFn)
 				})
 				return
 
@@ -117,11 +139,16 @@ func bufferBatchRefresh[T any](c *Client[T], ids []string, keyFn KeyFn, fetchFn
 
 				// Lock the mutex, and add the additional IDs to the buffer.
 				c.batchMutex.Lock()
-				buffer := c.permutationBufferMap[permutationString]
-				buffer.ids = append(buffer.ids, additionalIDs...)
+				if !c.isActiveBuffer(permutationString, buf) {
+					c.batchMutex.Unlock()
+					stop()
+					return
+				}
+				buf.ids = append(buf.ids, additionalIDs...)
+				buf.requests++
 
 				// If we haven't reached the batch size yet, we'll wait for more ids.
-				if len(buffer.ids) < c.bufferSize {
+				if len(buf.ids) < c.bufferSize {
 					c.batchMutex.Unlock()
 					continue
 				}
@@ -132,12 +159,13 @@ func bufferBatchRefresh[T any](c *Client[T], ids []string, keyFn KeyFn, fetchFn
 				}
 
 				// Grab a reference to the IDs, and then delete the buffer.
-				permIDs := buffer.ids
+				permIDs, requests := buf.ids, buf.requests
 				c.deleteBuffer(permutationString)
 				c.batchMutex.Unlock()
 
 				idsToRefresh := permIDs[:c.bufferSize]
 				overflowingIDs := permIDs[c.bufferSize:]
+				c.reportBatchRefreshCoalesced(requests, idsToRefresh)
 
 				// Refresh the first batch of IDs immediately.
 				c.safeGo(func() {
@@ -155,3 +183,80 @@ func bufferBatchRefresh[T any](c *Client[T], ids []string, keyFn KeyFn, fetchFn
 		}
 	})
 }
+
+// fetchBuffer gathers the cache misses of client.GetOrFetchBatch for a
+// permutation. Every ID that is added to the buffer shares the same call.
+type fetchBuffer[T any] struct {
+	ids  []string
+	call *inFlightCall[map[string]T]
+	full chan struct{}
+}
+
+// bufferBatchFetch should be called WITH the in-flight batch lock. It adds
+// the ids to the fetch buffer of their permutation, and records the call
+// that each of them is going to be retrieved by in callIDs.
+func bufferBatchFetch[V, T any](ctx context.Context, c *Client[T], ids []string, opts callBatchOpts[T, V], callIDs map[*inFlightCall[map[string]T]][]string) {
+	permutationString := extractPermutation(opts.keyFn(ids[0]))
+
+	for len(ids) > 0 {
+		buf, ok := c.fetchBufferMap[permutationString]
+		if !ok {
+			buf = createFetchBuffer(ctx, c, permutationString, opts)
+		}
+
+		chunk := ids[:min(len(ids), c.fetchBufferSize-len(buf.ids))]
+		ids = ids[len(chunk):]
+		for _, id := range chunk {
+			c.inFlightBatchMap[opts.keyFn(id)] = buf.call
+		}
+		buf.ids = append(buf.ids, chunk...)
+		callIDs[buf.call] = append(callIDs[buf.call], chunk...)
+
+		// If the buffer is full, we'll fetch the ids straight away. Any
+		// remaining ids are going to be added to a new buffer.
+		if len(buf.ids) == c.fetchBufferSize {
+			delete(c.fetchBufferMap, permutationString)
+			close(buf.full)
+		}
+	}
+}
+
+// createFetchBuffer should be called WITH the in-flight batch lock. The
+// buffer is fetched once it's full, or when the window has passed. If the
+// client is closed before that, the call ends with ErrClosed instead.
+func createFetchBuffer[V, T any](ctx context.Context, c *Client[T], permutation string, opts callBatchOpts[T, V]) *fetchBuffer[T] {
+	buf := &fetchBuffer[T]{
+		ids:  make([]string, 0, c.fetchBufferSize),
+		call: newInFlightCall[map[string]T](),
+		full: make(chan struct{}),
+	}
+	buf.call.val = make(map[string]T, c.fetchBufferSize)
+	c.fetchBufferMap[permutation] = buf
+
+	timer, stop := c.clock.NewTimer(c.fetchBufferWindow)
+	go func() {
+		closed := false
+		select {
+		case <-timer:
+		case <-buf.full:
+			stop()
+		case <-c.done:
+			stop()
+			closed = true
+		}
+
+		c.inFlightBatchMutex.Lock()
+		if c.fetchBufferMap[permutation] == buf {
+			delete(c.fetchBufferMap, permutation)
+		}
+		c.inFlightBatchMutex.Unlock()
+
+		if closed {
+			buf.call.err = ErrClosed
+			c.endBatchFlight(buf.ids, opts.keyFn, buf.call)
+			return
+		}
+		startBatchCall(ctx, c, buf.ids, opts, buf.call)
+	}()
+	return buf
+}
@@ -468,3 +468,100 @@ func TestValuesAreUpdatedCorrectly(t *testing.T) {
 		t.Errorf("expected 'foo2-1', got '%s'", resTwo["1"].Value)
 	}
 }
+
+func TestBufferedRefreshesAreDiscardedWhenTheCacheIsCleared(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	capacity := 1000
+	ttl := time.Hour
+	numShards := 10
+	evictionPercentage := 10
+	minRefreshDelay := time.Minute * 5
+	maxRefreshDelay := time.Minute * 10
+	refreshRetryInterval := time.Millisecond * 10
+	batchSize := 10
+	batchBufferTimeout := time.Minute
+	clock := sturdyc.NewTestClock(time.Now())
+
+	client := sturdyc.New[string](capacity, numShards, ttl, evictionPercentage,
+		sturdyc.WithNoContinuousEvictions(),
+		sturdyc.WithEarlyRefreshes(minRefreshDelay, maxRefreshDelay, refreshRetryInterval),
+		sturdyc.WithRefreshCoalescing(batchSize, batchBufferTimeout),
+		sturdyc.WithClock(clock),
+	)
+
+	ids := []string{"1", "2", "3"}
+	fetchObserver := NewFetchObserver(1)
+	fetchObserver.BatchResponse(ids)
+	sturdyc.GetOrFetchBatch(ctx, client, ids, client.BatchKeyFn("item"), fetchObserver.FetchBatch)
+	<-fetchObserver.FetchCompleted
+	fetchObserver.AssertFetchCount(t, 1)
+
+	// Request the records again once they are due for a refresh, which should put them in a buffer.
+	clock.Add(maxRefreshDelay + time.Second)
+	sturdyc.GetOrFetchBatch(ctx, client, ids, client.BatchKeyFn("item"), fetchObserver.FetchBatch)
+	time.Sleep(10 * time.Millisecond)
+
+	// Clearing the cache should discard the buffer, so the refresh shouldn't run once the timeout expires.
+	client.Clear()
+	clock.Add(batchBufferTimeout + 1)
+	time.Sleep(10 * time.Millisecond)
+	fetchObserver.AssertFetchCount(t, 1)
+	if client.Size() != 0 {
+		t.Errorf("expected cache size to be 0, got %d", client.Size())
+	}
+}
+
+type coalescingRecorder struct {
+	*TestMetricsRecorder
+	mu        sync.Mutex
+	requests  int
+	uniqueIDs int
+}
+
+func (r *coalescingRecorder) CacheBatchRefreshCoalesced(requests, uniqueIDs int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.requests += requests
+	r.uniqueIDs += uniqueIDs
+}
+
+func TestBatchRefreshCoalescingIsReportedToTheRecorder(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	maxRefreshDelay := time.Minute * 10
+	batchBufferTimeout := time.Minute
+	clock := sturdyc.NewTestClock(time.Now())
+	recorder := &coalescingRecorder{TestMetricsRecorder: newTestMetricsRecorder(1)}
+	client := sturdyc.New[string](1000, 1, time.Hour, 10,
+		sturdyc.WithNoContinuousEvictions(),
+		sturdyc.WithEarlyRefreshes(time.Minute*5, maxRefreshDelay, time.Millisecond*10),
+		sturdyc.WithRefreshCoalescing(10, batchBufferTimeout),
+		sturdyc.WithMetrics(recorder),
+		sturdyc.WithClock(clock),
+	)
+
+	ids := []string{"1", "2", "3", "4", "5"}
+	fetchObserver := NewFetchObserver(1)
+	fetchObserver.BatchResponse(ids)
+	sturdyc.GetOrFetchBatch(ctx, client, ids, client.BatchKeyFn("item"), fetchObserver.FetchBatch)
+	<-fetchObserver.FetchCompleted
+	clock.Add(maxRefreshDelay + time.Second)
+
+	// Three requests should be coalesced into a single batch of five IDs.
+	for _, request := range [][]string{{"1", "2"}, {"3"}, {"4", "5"}} {
+		sturdyc.GetOrFetchBatch(ctx, client, request, client.BatchKeyFn("item"), fetchObserver.FetchBatch)
+		time.Sleep(10 * time.Millisecond)
+	}
+	clock.Add(batchBufferTimeout + 1)
+	<-fetchObserver.FetchCompleted
+	fetchObserver.AssertFetchCount(t, 2)
+
+	recorder.mu.Lock()
+	defer recorder.mu.Unlock()
+	if recorder.requests != 3 || recorder.uniqueIDs != 5 {
+		t.Errorf("expected 3 requests with 5 unique ids, got %d and %d", recorder.requests, recorder.uniqueIDs)
+	}
+}
@@ -0,0 +1,29 @@
+package sturdyc
+
+import "context"
+
+type bypassKey struct{}
+
+// WithBypass returns a context that makes the cache skip the values that it
+// has for the keys, which is useful for requests that should force a reload.
+// client.GetOrFetch, client.GetOrFetchBatch, and their variants then call the
+// fetchFn right away, and overwrite the cached values with the fresh ones.
+// The distributed storage is bypassed in the same way, but it's still written
+// to. The cached values are left intact if the fetchFn returns an error.
+//
+// Parameters:
+//
+//	ctx - The context of the request.
+//
+// Returns:
+//
+//	A context that makes the cache fetch fresh values.
+func WithBypass(ctx context.Context) context.Context {
+	return context.WithValue(ctx, bypassKey{}, true)
+}
+
+// isBypassed returns true if the context was created by WithBypass.
+func isBypassed(ctx context.Context) bool {
+	bypass, _ := ctx.Value(bypassKey{}).(bool)
+	return bypass
+}
@@ -2,8 +2,8 @@ package sturdyc
 
 import (
 	"context"
-	"log/slog"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/cespare/xxhash"
@@ -12,9 +12,19 @@ import (
 // FetchFn Fetch represents a function that can be used to fetch a single record from a data source.
 type FetchFn[T any] func(ctx context.Context) (T, error)
 
+// ArgFetchFn represents a function that can be used to fetch a single record
+// from a data source with an argument that differs from the cache key.
+type ArgFetchFn[T any] func(ctx context.Context, arg string) (T, error)
+
 // BatchFetchFn represents a function that can be used to fetch multiple records from a data source.
 type BatchFetchFn[T any] func(ctx context.Context, ids []string) (map[string]T, error)
 
+// PartialBatchFetchFn represents a function that can be used to fetch
+// multiple records from a data source that is able to fail for some of the
+// IDs while succeeding for others. The IDs that failed are returned in the
+// map of errors.
+type PartialBatchFetchFn[T any] func(ctx context.Context, ids []string) (map[string]T, map[string]error)
+
 type BatchResponse[T any] map[string]T
 
 // KeyFn is called invoked for each record that a batch fetch
@@ -26,26 +36,97 @@ type Config struct {
 	clock                      Clock
 	evictionInterval           time.Duration
 	disableContinuousEvictions bool
+	lazyEviction               bool
+	evictionPolicy             EvictionPolicy
+	evictionHighWatermark      float64
+	sampleEvictions            bool
+	evictionSampleSize         int
+	evictionCallback           any
+	costFn                     any
+	cloneFn                    any
+	versionFn                  any
+	maxCost                    int64
+	hashFn                     func(string) uint64
+	consistentHashing          bool
+	virtualNodes               int
+	shardKeyFn                 func(string) string
+	keyTransform               func(string) string
+	maxKeyLength               int
+	keyValidator               func(string) error
 	metricsRecorder            DistributedMetricsRecorder
 	log                        Logger
+	fetchTimeout               time.Duration
+	circuitBreakers            *circuitBreakers
+	circuitBreakerTargetFn     func(key string) string
+	treatEmptyBatchAsError     bool
 
-	refreshInBackground bool
-	minRefreshTime      time.Duration
-	maxRefreshTime      time.Duration
-	retryBaseDelay      time.Duration
-	storeMissingRecords bool
+	refreshInBackground   bool
+	minRefreshTime        time.Duration
+	maxRefreshTime        time.Duration
+	retryBaseDelay        time.Duration
+	retryMultiplier       float64
+	maxRefreshRetries     int
+	customRefreshRetries  bool
+	refreshJitter         float64
+	refreshAheadThreshold float64
+	adaptiveRefresh       *adaptiveRefresh
+	softExpiry            bool
+	softTTL               time.Duration
+	prefetchFn            func(id string) []string
+	ttlJitter             float64
+	refreshCallback       func(key string, err error, duration time.Duration)
+	refreshContextFn      func() context.Context
+	refreshConcurrency    int
+	refreshSlots          chan struct{}
+	refreshQueueDepth     atomic.Int64
+	storeMissingRecords   bool
+	readOnly              atomic.Bool
 
-	bufferRefreshes      bool
-	batchMutex           sync.Mutex
-	bufferSize           int
-	bufferTimeout        time.Duration
-	permutationBufferMap map[string]*buffer
+	initialShardCapacity int
+
+	passthroughPercentage int
+	maxStaleness          time.Duration
+	slidingExpiration     bool
+	maxPinnedEntries      int
+	fallbackTTL           time.Duration
+
+	missingRecordTTL              time.Duration
+	disableMissingRecordRefreshes bool
+	limitMissingRecords           bool
+	maxMissingRecords             int
+
+	bufferRefreshes bool
+	bufferSize      int
+	bufferTimeout   time.Duration
+
+	bufferFetches     bool
+	fetchBufferSize   int
+	fetchBufferWindow time.Duration
+
+	chunkFetches          bool
+	fetchChunkSize        int
+	fetchChunkParallelism int
 
 	useRelativeTimeKeyFormat bool
 	keyTruncation            time.Duration
 	getSize                  func() int
 
 	distributedStorage              DistributedStorageWithDeletions
+	codec                           Codec
+	compressor                      Compressor
+	negativeLookupFilter            *BloomFilter
+	distributedErrorHandler         func(op, key string, err error)
+	distributedInvalidation         bool
+	useDistributedTTL               bool
+	useWriteBehind                  bool
+	writeBehindBatchSize            int
+	writeBehindInterval             time.Duration
+	reconcileDistributed            bool
+	reconciliationInterval          time.Duration
+	reconciliationSampleSize        int
+	distributedTTL                  time.Duration
+	invalidationSubscriber          InvalidationSubscriber
+	instanceID                      string
 	distributedEarlyRefreshes       bool
 	distributedRefreshAfterDuration time.Duration
 }
@@ -54,11 +135,34 @@ type Config struct {
 type Client[T any] struct {
 	*Config
 	shards             []*shard[T]
+	ring               *hashRing
+	ttl                atomic.Int64
 	nextShard          int
-	inFlightMutex      sync.Mutex
 	inFlightBatchMutex sync.Mutex
-	inFlightMap        map[string]*inFlightCall[T]
 	inFlightBatchMap   map[string]*inFlightCall[map[string]T]
+	fetchBufferMap     map[string]*fetchBuffer[T]
+	closeOnce          *sync.Once
+	closed             *atomic.Bool
+	done               chan struct{}
+
+	// The namespaces are tracked by the root client, which runs the
+	// continuous evictions for its own shards as well as theirs.
+	root           *Client[T]
+	namespaceMutex sync.Mutex
+	namespaces     map[string]*Client[T]
+	evictionShards []*shard[T]
+
+	// numPinned is the number of keys that have been pinned with client.Pin.
+	numPinned atomic.Int64
+
+	// The refresh buffers of WithRefreshCoalescing. They belong to the client
+	// rather than the config, since the permutations of a namespace must not
+	// be merged with those of the client that it was created from.
+	batchMutex           sync.Mutex
+	permutationBufferMap map[string]*buffer
+
+	// writeBehind buffers the writes of WithWriteBehind.
+	writeBehind *writeBehind[T]
 }
 
 // New creates a new Client instance with the specified configuration.
@@ -70,16 +174,26 @@ type Client[T any] struct {
 //	`opts` allows for additional configurations to be applied to the cache client.
 func New[T any](capacity, numShards int, ttl time.Duration, evictionPercentage int, opts ...Option) *Client[T] {
 	client := &Client[T]{
-		inFlightMap:      make(map[string]*inFlightCall[T]),
-		inFlightBatchMap: make(map[string]*inFlightCall[map[string]T]),
+		inFlightBatchMap:     make(map[string]*inFlightCall[map[string]T]),
+		fetchBufferMap:       make(map[string]*fetchBuffer[T]),
+		permutationBufferMap: make(map[string]*buffer),
+		closeOnce:            &sync.Once{},
+		closed:               &atomic.Bool{},
+		done:                 make(chan struct{}),
+		namespaces:           make(map[string]*Client[T]),
 	}
+	client.root = client
+	client.ttl.Store(int64(ttl))
 
 	// Create a default configuration, and then apply the options.
 	cfg := &Config{
 		clock:            NewClock(),
 		evictionInterval: ttl / time.Duration(numShards),
-		getSize:          client.Size,
-		log:              slog.Default(),
+		getSize:          client.totalSize,
+		log:              &NoopLogger{},
+		codec:            JSONCodec{},
+		hashFn:           xxhash.Sum64String,
+		retryMultiplier:  2,
 	}
 	// Apply the options to the configuration.
 	client.Config = cfg
@@ -88,14 +202,70 @@ func New[T any](capacity, numShards int, ttl time.Duration, evictionPercentage i
 	}
 	validateConfig(capacity, numShards, ttl, evictionPercentage, cfg)
 
-	shardSize := capacity / numShards
+	// The options that set the eviction callback, cost, clone and version functions can't be tied
+	// to the type of the client, which is why we have to verify that they match.
+	var onEvict func(key string, value T, reason EvictionReason)
+	if cfg.evictionCallback != nil {
+		var ok bool
+		if onEvict, ok = cfg.evictionCallback.(func(key string, value T, reason EvictionReason)); !ok {
+			panic("evictionCallback must accept the type of values that the cache stores")
+		}
+	}
+
+	var costFn func(T) int64
+	if cfg.costFn != nil {
+		var ok bool
+		if costFn, ok = cfg.costFn.(func(T) int64); !ok {
+			panic("costFn must accept the type of values that the cache stores")
+		}
+	}
+
+	var cloneFn func(T) T
+	if cfg.cloneFn != nil {
+		var ok bool
+		if cloneFn, ok = cfg.cloneFn.(func(T) T); !ok {
+			panic("cloneFn must accept the type of values that the cache stores")
+		}
+	}
+
+	var versionFn func(T) uint64
+	if cfg.versionFn != nil {
+		var ok bool
+		if versionFn, ok = cfg.versionFn.(func(T) uint64); !ok {
+			panic("versionFn must accept the type of values that the cache stores")
+		}
+	}
+
 	shards := make([]*shard[T], numShards)
 	for i := 0; i < numShards; i++ {
-		shards[i] = newShard[T](shardSize, ttl, evictionPercentage, cfg)
+		shards[i] = newShard[T](shardCapacity(capacity, numShards, i), ttl, evictionPercentage, cfg)
+		shards[i].onEvict = onEvict
+		shards[i].costFn = costFn
+		shards[i].cloneFn = cloneFn
+		shards[i].versionFn = versionFn
+		shards[i].maxCost = shardMaxCost(cfg.maxCost, numShards, i)
 	}
 	client.shards = shards
+	client.evictionShards = shards
+	if cfg.consistentHashing {
+		client.ring = newHashRing(numShards, cfg.virtualNodes, cfg.hashFn)
+	}
 	client.nextShard = 0
 
+	if cfg.invalidationSubscriber != nil {
+		cfg.instanceID = newInstanceID()
+		client.subscribeToInvalidations()
+	}
+
+	if cfg.reconcileDistributed {
+		client.reconcileContinuously()
+	}
+
+	if cfg.useWriteBehind {
+		client.writeBehind = newWriteBehind[T](cfg.writeBehindBatchSize, numShards)
+		client.flushWritesContinuously()
+	}
+
 	// Run evictions on the shards in a separate goroutine.
 	if !cfg.disableContinuousEvictions {
 		client.performContinuousEvictions()
@@ -104,23 +274,108 @@ func New[T any](capacity, numShards int, ttl time.Duration, evictionPercentage i
 	return client
 }
 
-// performContinuousEvictions is going to be running in a separate goroutine that we're going to prevent from ever exiting.
+// performContinuousEvictions is going to be running in a separate goroutine until the client is closed.
 func (c *Client[T]) performContinuousEvictions() {
 	go func() {
 		ticker, stop := c.clock.NewTicker(c.evictionInterval)
 		defer stop()
-		for range ticker {
-			c.shards[c.nextShard].evictExpired()
-			c.nextShard = (c.nextShard + 1) % len(c.shards)
+		for {
+			select {
+			case <-c.done:
+				return
+			case <-ticker:
+				c.namespaceMutex.Lock()
+				shards := c.evictionShards
+				c.namespaceMutex.Unlock()
+				shards[c.nextShard].evictExpired()
+				c.nextShard = (c.nextShard + 1) % len(shards)
+				c.reportCacheSize()
+			}
 		}
 	}()
 }
 
+// SetReadOnly toggles the read-only mode of WithReadOnly at runtime. It
+// applies to the namespaces of the client as well.
+//
+// Parameters:
+//
+//	enabled - Whether the client should be read-only.
+func (c *Client[T]) SetReadOnly(enabled bool) {
+	c.readOnly.Store(enabled)
+}
+
+// ReadOnly returns true if the client is in read-only mode.
+func (c *Client[T]) ReadOnly() bool {
+	return c.readOnly.Load()
+}
+
+// Close stops the goroutines that the client runs in the background. The
+// continuous evictions are stopped, no new background refreshes are going to
+// be scheduled, and any refreshes that are being buffered are discarded.
+// Refreshes that are already in-flight are allowed to finish, while the batch
+// fetches that are waiting in a fetch buffer, or for a chunk to be fetched,
+// end with ErrClosed. The entries remain readable so that the client can be
+// drained, but it shouldn't be used for anything else once it has been
+// closed. Calling Close more than once is a no-op.
+//
+// Returns:
+//
+//	An error, which is always nil. It's returned so that the client implements io.Closer.
+func (c *Client[T]) Close() error {
+	c.closeOnce.Do(func() {
+		c.closed.Store(true)
+		close(c.done)
+		if c.writeBehind != nil {
+			c.flushWriteBehind()
+		}
+		if c.bufferRefreshes {
+			clients := []*Client[T]{c.root}
+			c.root.namespaceMutex.Lock()
+			for _, namespace := range c.root.namespaces {
+				clients = append(clients, namespace)
+			}
+			c.root.namespaceMutex.Unlock()
+			for _, client := range clients {
+				client.batchMutex.Lock()
+				client.clearBuffers()
+				client.batchMutex.Unlock()
+			}
+		}
+	})
+	return nil
+}
+
+// shardIndex returns the index of the shard that should be used for the specified key.
+func (c *Client[T]) shardIndex(key string) int {
+	if c.shardKeyFn != nil {
+		return c.shardIndexOf(c.shardKeyFn(key))
+	}
+	return c.shardIndexOf(c.transformKey(key))
+}
+
+// shardIndexOf hashes the string to the index of a shard. It's used directly
+// for keys that have already been transformed, such as those of a snapshot.
+func (c *Client[T]) shardIndexOf(key string) int {
+	hash := c.hashFn(key)
+	if c.ring != nil {
+		return c.ring.shard(hash)
+	}
+	return int(hash % uint64(len(c.shards)))
+}
+
+// transformKey applies the transform of WithKeyTransform to the key.
+func (c *Config) transformKey(key string) string {
+	if c.keyTransform == nil {
+		return key
+	}
+	return c.keyTransform(key)
+}
+
 // getShard returns the shard that should be used for the specified key.
 func (c *Client[T]) getShard(key string) *shard[T] {
-	hash := xxhash.Sum64String(key)
-	shardIndex := hash % uint64(len(c.shards))
-	c.reportShardIndex(int(shardIndex))
+	shardIndex := c.shardIndex(key)
+	c.reportShardIndex(shardIndex)
 	return c.shards[shardIndex]
 }
 
@@ -130,7 +385,7 @@ func (c *Client[T]) getShard(key string) *shard[T] {
 func (c *Client[T]) getWithState(key string) (value T, exists, markedAsMissing, refresh bool) {
 	shard := c.getShard(key)
 	val, exists, markedAsMissing, refresh := shard.get(key)
-	c.reportCacheHits(exists, markedAsMissing, refresh)
+	shard.reportCacheHits(exists, markedAsMissing, refresh)
 	return val, exists, markedAsMissing, refresh
 }
 
@@ -146,10 +401,152 @@ func (c *Client[T]) getWithState(key string) (value T, exists, markedAsMissing,
 func (c *Client[T]) Get(key string) (T, bool) {
 	shard := c.getShard(key)
 	val, ok, markedAsMissing, refresh := shard.get(key)
-	c.reportCacheHits(ok, markedAsMissing, refresh)
+	shard.reportCacheHits(ok, markedAsMissing, refresh)
+	return val, ok && !markedAsMissing
+}
+
+// GetWithAge works like Get, but it also returns the time that has passed
+// since the value was written to the cache, as measured by the clock of the
+// client. Refreshes write the value again, which resets the age, while reads
+// that slide the expiry of WithSlidingExpiration don't. This can be used to
+// bypass values that are too old for the call site.
+//
+// Parameters:
+//
+//	key - The key to be retrieved.
+//
+// Returns:
+//
+//	The value corresponding to the key, its age, and a boolean indicating if the value was found.
+func (c *Client[T]) GetWithAge(key string) (T, time.Duration, bool) {
+	shard := c.getShard(key)
+	val, ok, markedAsMissing, refresh := shard.get(key)
+	shard.reportCacheHits(ok, markedAsMissing, refresh)
+	if !ok || markedAsMissing {
+		return val, 0, false
+	}
+	age, ok := shard.age(key)
+	return val, age, ok
+}
+
+// GetRef retrieves a pointer to a single value in the cache, which avoids
+// copying large values on hot read paths. The entry is guarded from being
+// evicted until the returned release function has been called, and the
+// release function has to be called once the value is no longer needed.
+// The value is shared with every other reader, so it must not be modified.
+// Writes and deletions of the key still take effect while it's referenced,
+// but the pointer keeps referring to the value it was handed out for. A shard
+// where every entry is referenced can temporarily exceed its capacity. A nil
+// pointer and a noop release function is returned if the key wasn't found.
+//
+// Parameters:
+//
+//	key - The key to be retrieved.
+//
+// Returns:
+//
+//	A pointer to the value, a boolean indicating if the value was found, and the function that releases it.
+func (c *Client[T]) GetRef(key string) (*T, bool, func()) {
+	shard := c.getShard(key)
+	e, ok, markedAsMissing := shard.getRef(key)
+	shard.reportCacheHits(ok, markedAsMissing, false)
+	if e == nil {
+		return nil, false, func() {}
+	}
+
+	var once sync.Once
+	return &e.value, true, func() {
+		once.Do(func() { e.refs.Add(-1) })
+	}
+}
+
+// Peek retrieves a single value from the cache without any side effects. It
+// counts as a cache hit or miss like Get, but it never schedules a refresh,
+// and it doesn't affect which entries the eviction policy picks. This makes
+// it suitable for health checks and debugging. Expired entries, and keys that
+// have been marked as missing, are reported as absent.
+//
+// Parameters:
+//
+//	key - The key to be retrieved.
+//
+// Returns:
+//
+//	The value corresponding to the key and a boolean indicating if the value was found.
+func (c *Client[T]) Peek(key string) (T, bool) {
+	shard := c.getShard(key)
+	val, ok, markedAsMissing := shard.peek(key)
+	shard.reportCacheHits(ok, markedAsMissing, false)
 	return val, ok && !markedAsMissing
 }
 
+// TTL returns the remaining time to live for a single value in the cache.
+// Entries that are due for a refresh still report the time until they
+// expire. Looking up the TTL doesn't count as a cache hit or miss.
+//
+// Parameters:
+//
+//	key - The key of the entry.
+//
+// Returns:
+//
+//	The remaining time to live and a boolean indicating if the value was found.
+func (c *Client[T]) TTL(key string) (time.Duration, bool) {
+	shard := c.getShard(key)
+	return shard.remainingTTL(key)
+}
+
+// RefreshDueAt returns the time at which the entry becomes eligible for a
+// background refresh. It's computed when the entry is written, based on the
+// minRefreshTime and maxRefreshTime of WithEarlyRefreshes, as well as any
+// jitter, and it's moved by the retry delay every time a refresh is
+// scheduled. The time is zero for entries that aren't refreshed in the
+// background. Looking up the time doesn't count as a cache hit or miss.
+//
+// Parameters:
+//
+//	key - The key of the entry.
+//
+// Returns:
+//
+//	The time at which the entry becomes due for a refresh and a boolean indicating if the key exists.
+func (c *Client[T]) RefreshDueAt(key string) (time.Time, bool) {
+	shard := c.getShard(key)
+	return shard.refreshDueAt(key)
+}
+
+// Exists checks if the cache has a value for the key that hasn't expired.
+// Keys that have been marked as missing are considered to exist, as the
+// cache has a record for them. Unlike Get, it doesn't count as a cache hit or
+// miss, and it doesn't affect which entries the eviction policy picks.
+//
+// Parameters:
+//
+//	key - The key to look for.
+//
+// Returns:
+//
+//	A boolean indicating if the key exists in the cache.
+func (c *Client[T]) Exists(key string) bool {
+	exists, _ := c.shards[c.shardIndex(key)].exists(key)
+	return exists
+}
+
+// ExistsAsMissing checks if the key has been marked as missing, and if that
+// record hasn't expired. Like Exists, it doesn't count as a cache hit or miss.
+//
+// Parameters:
+//
+//	key - The key to look for.
+//
+// Returns:
+//
+//	A boolean indicating if the key exists as a missing record.
+func (c *Client[T]) ExistsAsMissing(key string) bool {
+	exists, markedAsMissing := c.shards[c.shardIndex(key)].exists(key)
+	return exists && markedAsMissing
+}
+
 // GetMany retrieves multiple values from the cache.
 //
 // Parameters:
@@ -160,20 +557,46 @@ func (c *Client[T]) Get(key string) (T, bool) {
 //
 //	A map of keys to their corresponding values.
 func (c *Client[T]) GetMany(keys []string) map[string]T {
-	records := make(map[string]T, len(keys))
+	records, _ := c.GetManyWithMisses(keys)
+	return records
+}
+
+// GetManyWithMisses retrieves multiple values from the cache, and returns the
+// keys that it couldn't find separately. The keys are grouped by shard so
+// that each shard only has to be locked once, regardless of how many of the
+// keys it holds. Keys that have been marked as missing are returned as misses.
+//
+// Parameters:
+//
+//	keys - The list of keys to be retrieved.
+//
+// Returns:
+//
+//	A map of keys to their corresponding values, and a slice of the keys that weren't found.
+func (c *Client[T]) GetManyWithMisses(keys []string) (hits map[string]T, misses []string) {
+	keysByShard := make([][]string, len(c.shards))
 	for _, key := range keys {
-		if value, ok := c.Get(key); ok {
-			records[key] = value
+		index := c.shardIndex(key)
+		keysByShard[index] = append(keysByShard[index], key)
+	}
+
+	hits = make(map[string]T, len(keys))
+	misses = make([]string, 0)
+	for index, shardKeys := range keysByShard {
+		if len(shardKeys) == 0 {
+			continue
 		}
+		c.reportShardIndex(index)
+		misses = c.shards[index].getMany(shardKeys, hits, misses)
 	}
-	return records
+	return hits, misses
 }
 
 // GetManyKeyFn follows the same API as GetOrFetchBatch and PassthroughBatch.
 // You provide it with a slice of IDs and a keyFn, which is applied to create
 // the cache key. The returned map uses the IDs as keys instead of the cache
 // key. If you've used ScanKeys to retrieve the actual keys, you can retrieve
-// the records using GetMany instead.
+// the records using GetMany instead, unless the client uses WithKeyTransform.
 //
 // Parameters:
 //
@@ -204,18 +627,273 @@ func (c *Client[T]) GetManyKeyFn(ids []string, keyFn KeyFn) map[string]T {
 //
 //	A boolean indicating if the set operation triggered an eviction.
 func (c *Client[T]) Set(key string, value T) bool {
+	if !c.acceptsKey(key) {
+		return false
+	}
+	c.publishWrite(key, value)
+	res := c.getShard(key).setWithResult(key, value)
+	if res.Written {
+		c.bufferWrite(key, value)
+	}
+	return res.Written && res.OverCapacity
+}
+
+// set writes the value without notifying the other instances of the cluster.
+// It's used to write the values that the cache has fetched itself.
+func (c *Client[T]) set(key string, value T) bool {
 	shard := c.getShard(key)
 	return shard.set(key, value, false)
 }
 
+// SetTTL changes the TTL of the entries that are written to the cache from
+// now on. The existing entries keep their expiry unless rebase is true, in
+// which case the expiry of every entry is moved by the difference between the
+// new and the old TTL. That includes the entries that were written with a TTL
+// of their own. This allows the TTL to be tuned at runtime, for example from
+// a control plane, without having to restart the application.
+//
+// Parameters:
+//
+//	ttl - The new TTL. Has to be greater than 0.
+//	rebase - Whether the expiry of the existing entries should be moved.
+func (c *Client[T]) SetTTL(ttl time.Duration, rebase bool) {
+	if ttl < 1 {
+		panic("ttl must be greater than 0")
+	}
+	c.ttl.Store(int64(ttl))
+	for _, shard := range c.shards {
+		shard.setTTL(ttl, rebase)
+	}
+}
+
+// SetEvictionPercentage changes the percentage of entries that are evicted
+// when a shard reaches its capacity. It takes effect for the next eviction.
+//
+// Parameters:
+//
+//	percentage - The new eviction percentage. Has to be between 0 and 100.
+func (c *Client[T]) SetEvictionPercentage(percentage int) {
+	if percentage < 0 || percentage > 100 {
+		panic("evictionPercentage must be between 0 and 100")
+	}
+	for _, shard := range c.shards {
+		shard.setEvictionPercentage(percentage)
+	}
+}
+
+// Resize changes the capacity of the cache at runtime. The capacity is split
+// between the shards, just like it is when the client is created. If
+// the cache has shrunk, each shard evicts the entries that no longer fit
+// straight away, picked by the eviction policy, and the evictions are
+// reported to the eviction callback and the metrics recorder. It's safe to
+// call while the cache is being read from and written to.
+//
+// Parameters:
+//
+//	capacity - The new capacity. Has to be greater than 0.
+func (c *Client[T]) Resize(capacity int) {
+	if capacity < 1 {
+		panic("capacity must be greater than 0")
+	}
+	for i, shard := range c.shards {
+		shard.resize(shardCapacity(capacity, len(c.shards), i))
+	}
+}
+
+// Pin marks the key as non-evictable. The entry is skipped by the continuous
+// evictions, the lazy evictions and the forced evictions that make room for
+// new entries, which allows reference data to stay cached regardless of the
+// pressure on the cache. Pinned entries are still refreshed in the background,
+// but an entry that expires without being refreshed is reported as absent by
+// the reads until it's written again. The pin is tracked by key, and it can be
+// placed before the key has been written. It stays in place until Unpin is
+// called, even if the entry is deleted.
+//
+// Please note that pinning can cause the cache to exceed its capacity, since
+// the writes proceed even if the eviction is unable to free up any room. To
+// guard against pinning everything, the number of pinned keys is limited by
+// WithMaxPinnedEntries, which defaults to the capacity of the cache.
+//
+// Parameters:
+//
+//	key - The key to be pinned.
+//
+// Returns:
+//
+//	A boolean indicating if the key is pinned, which is false if the limit has been reached.
+func (c *Client[T]) Pin(key string) bool {
+	shard := c.getShard(key)
+	if shard.isPinned(key) {
+		return true
+	}
+	if c.numPinned.Add(1) > int64(c.maxPinned()) {
+		c.numPinned.Add(-1)
+		return false
+	}
+	if !shard.pin(key) {
+		// Another goroutine pinned the key while we were reserving room for it.
+		c.numPinned.Add(-1)
+	}
+	return true
+}
+
+// Unpin removes the pin of the key, which allows the entry to be evicted again.
+//
+// Parameters:
+//
+//	key - The key to be unpinned.
+func (c *Client[T]) Unpin(key string) {
+	if c.getShard(key).unpin(key) {
+		c.numPinned.Add(-1)
+	}
+}
+
+// maxPinned returns the number of keys that are allowed to be pinned.
+func (c *Client[T]) maxPinned() int {
+	if c.maxPinnedEntries > 0 {
+		return c.maxPinnedEntries
+	}
+	var capacity int
+	for _, shard := range c.shards {
+		capacity += shard.currentCapacity()
+	}
+	return capacity
+}
+
+// SetResult describes the outcome of a write to the cache.
+type SetResult struct {
+	// Written reports whether the value was written to the cache. It's only
+	// false if the shard is full and the eviction percentage is zero.
+	Written bool
+	// OverCapacity reports whether the shard was full when the value was
+	// written, which forced the cache to evict entries to make room for it.
+	OverCapacity bool
+	// EntriesEvicted is the number of entries that were forcefully evicted.
+	EntriesEvicted int
+}
+
+// SetWithResult writes a single value to the cache. It behaves like Set, but
+// it describes the forced evictions that the write triggered. This can be
+// used to detect that the cache is under-provisioned.
+//
+// Parameters:
+//
+//	key - The key to be set.
+//	value - The value to be associated with the key.
+//
+// Returns:
+//
+//	A SetResult describing the write.
+func (c *Client[T]) SetWithResult(key string, value T) SetResult {
+	if !c.acceptsKey(key) {
+		return SetResult{}
+	}
+	c.publishWrite(key, value)
+	shard := c.getShard(key)
+	res := shard.setWithResult(key, value)
+	if res.Written {
+		c.bufferWrite(key, value)
+	}
+	return res
+}
+
+// Update performs an atomic read-modify-write of the key. The function is
+// called with the current value, and a boolean indicating whether the key
+// exists. The value that it returns is written to the cache, or the key is
+// deleted if it returns false. This can be used to build counters and
+// accumulators on top of the cache. The function is called while the lock
+// of the shard is held, which means that it has to be fast, and that it
+// must not call back into the cache.
+//
+// Parameters:
+//
+//	key - The key to be updated.
+//	fn - Receives the current value and returns the new one.
+//
+// Returns:
+//
+//	The new value, and a boolean indicating whether it was written to the cache.
+func (c *Client[T]) Update(key string, fn func(current T, exists bool) (T, bool)) (T, bool) {
+	if !c.acceptsKey(key) {
+		var zero T
+		return zero, false
+	}
+	c.publishInvalidation(key)
+	shard := c.getShard(key)
+	value, written := shard.update(key, fn)
+	if !written {
+		c.discardWrites(key)
+		return value, false
+	}
+	c.bufferWrite(key, value)
+	return value, true
+}
+
+// SetWithTTL writes a single value to the cache that expires after the given
+// TTL rather than the TTL that the client was configured with. A TTL that is
+// less than or equal to zero makes the entry expire immediately.
+//
+// Parameters:
+//
+//	key - The key to be set.
+//	value - The value to be associated with the key.
+//	ttl - The time to live for the entry.
+//
+// Returns:
+//
+//	A boolean indicating if the set operation triggered an eviction.
+func (c *Client[T]) SetWithTTL(key string, value T, ttl time.Duration) bool {
+	if !c.acceptsKey(key) {
+		return false
+	}
+	c.publishWrite(key, value)
+	shard := c.getShard(key)
+	res := shard.setWithTTL(key, value, ttl, false)
+	if res.Written {
+		c.bufferWrite(key, value)
+	}
+	return res.Written && res.OverCapacity
+}
+
+// SetIfAbsent writes a single value to the cache if it doesn't already have
+// a value for the key. An entry that has expired is considered absent and
+// gets overwritten. The check and the write are performed atomically, which
+// means that only one of several goroutines that are racing to set the same
+// key is going to succeed.
+//
+// Parameters:
+//
+//	key - The key to be set.
+//	value - The value to be associated with the key.
+//
+// Returns:
+//
+//	A boolean indicating if the value was written to the cache.
+func (c *Client[T]) SetIfAbsent(key string, value T) bool {
+	if !c.acceptsKey(key) {
+		return false
+	}
+	shard := c.getShard(key)
+	if !shard.setIfAbsent(key, value) {
+		return false
+	}
+	c.publishWrite(key, value)
+	c.bufferWrite(key, value)
+	return true
+}
+
 // StoreMissingRecord writes a single value to the cache. Returns true if it triggered an eviction.
 func (c *Client[T]) StoreMissingRecord(key string) bool {
+	if !c.acceptsKey(key) {
+		return false
+	}
 	shard := c.getShard(key)
 	var zero T
 	return shard.set(key, zero, true)
 }
 
-// SetMany writes a map of key-value pairs to the cache.
+// SetMany writes a map of key-value pairs to the cache. The records are
+// grouped by shard so that each shard only has to be locked once.
 //
 // Parameters:
 //
@@ -225,14 +903,65 @@ func (c *Client[T]) StoreMissingRecord(key string) bool {
 //
 //	A boolean indicating if any of the set operations triggered an eviction.
 func (c *Client[T]) SetMany(records map[string]T) bool {
-	var triggeredEviction bool
+	c.publishRecordInvalidations(records, nil)
+	evictions, written := c.setMany(records, nil, time.Duration(c.ttl.Load()), true)
+	c.bufferRecords(written)
+	return evictions > 0
+}
+
+// SetManyWithTTL writes a map of key-value pairs that expire after the given
+// TTL to the cache. Like SetMany, it only locks each shard once, which makes
+// it suitable for hydrating the cache with the results of a bulk query.
+//
+// Parameters:
+//
+//	records - A map of keys to values to be set in the cache.
+//	ttl - The time to live for the entries.
+//
+// Returns:
+//
+//	The number of set operations that triggered an eviction.
+func (c *Client[T]) SetManyWithTTL(records map[string]T, ttl time.Duration) int {
+	c.publishRecordInvalidations(records, nil)
+	evictions, written := c.setMany(records, nil, ttl, false)
+	c.bufferRecords(written)
+	return evictions
+}
+
+// setMany groups the records by shard and writes them. The keyFn is
+// applied to the keys of the records if it's not nil, and the TTL is
+// jittered if jitter is true. Returns the number of writes that
+// triggered an eviction, and the records that were written by their keys.
+func (c *Client[T]) setMany(records map[string]T, keyFn KeyFn, ttl time.Duration, jitter bool) (int, map[string]T) {
+	recordsByShard := make([]map[string]T, len(c.shards))
 	for key, value := range records {
-		evicted := c.Set(key, value)
-		if evicted {
-			triggeredEviction = true
+		if keyFn != nil {
+			key = keyFn(key)
+		}
+		if !c.acceptsKey(key) {
+			continue
+		}
+		index := c.shardIndex(key)
+		if recordsByShard[index] == nil {
+			recordsByShard[index] = make(map[string]T)
+		}
+		recordsByShard[index][key] = value
+	}
+
+	var evictions int
+	written := make(map[string]T, len(records))
+	for index, shardRecords := range recordsByShard {
+		if len(shardRecords) == 0 {
+			continue
+		}
+		c.reportShardIndex(index)
+		n, keys := c.shards[index].setMany(shardRecords, ttl, jitter)
+		evictions += n
+		for _, key := range keys {
+			written[key] = shardRecords[key]
 		}
 	}
-	return triggeredEviction
+	return evictions, written
 }
 
 // SetManyKeyFn follows the same API as GetOrFetchBatch and PassthroughBatch.
@@ -248,17 +977,16 @@ func (c *Client[T]) SetMany(records map[string]T) bool {
 //
 //	A boolean indicating if any of the set operations triggered an eviction.
 func (c *Client[T]) SetManyKeyFn(records map[string]T, cacheKeyFn KeyFn) bool {
-	var triggeredEviction bool
-	for id, value := range records {
-		evicted := c.Set(cacheKeyFn(id), value)
-		if evicted {
-			triggeredEviction = true
-		}
-	}
-	return triggeredEviction
+	c.publishRecordInvalidations(records, cacheKeyFn)
+	evictions, written := c.setMany(records, cacheKeyFn, time.Duration(c.ttl.Load()), true)
+	c.bufferRecords(written)
+	return evictions > 0
 }
 
-// ScanKeys returns a list of all keys in the cache.
+// ScanKeys returns a list of all keys in the cache. Expired entries are
+// excluded. The keys are collected one shard at a time, which makes the
+// result a point-in-time view that might be stale as soon as it's returned.
+// With WithKeyTransform, the keys are the transformed ones.
 //
 // Returns:
 //
@@ -271,7 +999,49 @@ func (c *Client[T]) ScanKeys() []string {
 	return keys
 }
 
-// Size returns the number of entries in the cache.
+// ForEachKey calls fn for every key in the cache, and stops as soon as fn
+// returns false. It's the streaming equivalent of ScanKeys, and it only holds
+// the keys of a single shard in memory at a time. The keys of a shard are
+// collected before fn is invoked, which means that fn is free to call back
+// into the cache. Like ScanKeys, it provides a point-in-time view of each
+// shard that might be stale by the time fn is called.
+//
+// Parameters:
+//
+//	fn - The function to be called for each key.
+func (c *Client[T]) ForEachKey(fn func(key string) bool) {
+	for _, shard := range c.shards {
+		for _, key := range shard.keys() {
+			if !fn(key) {
+				return
+			}
+		}
+	}
+}
+
+// ForEach calls fn with every key and value in the cache, and stops as soon
+// as fn returns false. Expired entries and missing records are skipped. This
+// can be used to export the cache to another store, or to compute aggregate
+// statistics. Unlike ForEachKey, fn is invoked while the read lock of the
+// shard is held. Writes to that shard are blocked until fn has been called
+// for all of its entries, which is why fn should return quickly, and it must
+// not call back into the cache. Like ScanKeys, fn receives the transformed
+// keys if the client uses WithKeyTransform.
+//
+// Parameters:
+//
+//	fn - The function to be called for each entry.
+func (c *Client[T]) ForEach(fn func(key string, value T) bool) {
+	for _, shard := range c.shards {
+		if !shard.forEach(fn) {
+			return
+		}
+	}
+}
+
+// Size returns the number of entries in the cache. The entries of the
+// namespaces that were created from the client aren't included, but they
+// are part of the size that is reported to the metrics recorder.
 //
 // Returns:
 //
@@ -292,6 +1062,116 @@ func (c *Client[T]) Size() int {
 func (c *Client[T]) Delete(key string) {
 	shard := c.getShard(key)
 	shard.delete(key)
+	c.discardWrites(key)
+	c.invalidateDistributed([]string{key})
+	c.publishInvalidation(key)
+}
+
+// GetAndDelete retrieves a single value from the cache and deletes it in one
+// atomic operation. This ensures that only one of several consumers that are
+// racing for the same key gets the value, which makes it suitable for one-shot
+// tokens and work queues. It counts as a cache hit or miss like Get, and the
+// eviction callback is invoked with EvictionReasonDeleted. Keys that have been
+// marked as missing are reported as absent, and they're left in the cache.
+//
+// Parameters:
+//
+//	key - The key to be retrieved and deleted.
+//
+// Returns:
+//
+//	The value that was deleted and a boolean indicating if the value was found.
+func (c *Client[T]) GetAndDelete(key string) (T, bool) {
+	shard := c.getShard(key)
+	val, ok, markedAsMissing := shard.getAndDelete(key)
+	shard.reportCacheHits(ok, markedAsMissing, false)
+	if !ok || markedAsMissing {
+		return val, false
+	}
+	c.discardWrites(key)
+	c.invalidateDistributed([]string{key})
+	c.publishInvalidation(key)
+	return val, true
+}
+
+// DeleteMany removes multiple entries from the cache. The keys are grouped
+// by shard so that each shard only has to be locked once. Entries that have
+// been marked as missing records are removed too.
+//
+// Parameters:
+//
+//	keys - The keys of the entries to be removed.
+//
+// Returns:
+//
+//	The number of entries that were removed from the cache.
+func (c *Client[T]) DeleteMany(keys []string) int {
+	shardKeys := make(map[*shard[T]][]string)
+	for _, key := range keys {
+		shard := c.getShard(key)
+		shardKeys[shard] = append(shardKeys[shard], key)
+	}
+
+	var deleted int
+	for shard, keys := range shardKeys {
+		deleted += shard.deleteMany(keys)
+	}
+	c.discardWrites(keys...)
+	c.invalidateDistributed(keys)
+	c.publishInvalidation(keys...)
+	return deleted
+}
+
+// DeleteByPrefix removes every entry whose key starts with the prefix,
+// including entries that have been marked as missing records. This requires
+// a scan of every key in the cache, which makes it an O(n) operation. The
+// shards are locked one at a time, so that only a fraction of the cache is
+// blocked while the scan is in progress.
+//
+// Parameters:
+//
+//	prefix - The prefix of the keys to be removed.
+//
+// Returns:
+//
+//	The number of entries that were removed from the cache.
+func (c *Client[T]) DeleteByPrefix(prefix string) int {
+	var deleted []string
+	for _, shard := range c.shards {
+		keys := shard.deleteByPrefix(prefix)
+		c.publishInvalidation(keys...)
+		deleted = append(deleted, keys...)
+	}
+	c.discardWritesByPrefix(prefix)
+	c.invalidateDistributed(deleted)
+	return len(deleted)
+}
+
+// Clear removes every entry from the cache. Any refreshes that are being
+// buffered are discarded, as are the writes that are waiting to be flushed by
+// WithWriteBehind, and the continuous evictions keep running as usual.
+func (c *Client[T]) Clear() {
+	if c.bufferRefreshes {
+		c.batchMutex.Lock()
+		c.clearBuffers()
+		c.batchMutex.Unlock()
+	}
+
+	for _, shard := range c.shards {
+		shard.clear()
+	}
+	c.discardAllWrites()
+}
+
+// RefreshQueueDepth returns the number of background refreshes that are
+// waiting for a slot. It's always zero unless the client has been configured
+// with WithRefreshConcurrency.
+//
+// Returns:
+//
+//	An integer representing the number of queued refreshes.
+func (c *Client[T]) RefreshQueueDepth() int {
+	return int(c.refreshQueueDepth.Load())
 }
 
 // NumKeysInflight returns the number of keys that are currently being fetched.
@@ -300,9 +1180,11 @@ func (c *Client[T]) Delete(key string) {
 //
 //	An integer representing the total number of keys that are currently being fetched.
 func (c *Client[T]) NumKeysInflight() int {
-	c.inFlightMutex.Lock()
-	defer c.inFlightMutex.Unlock()
+	var sum int
+	for _, shard := range c.shards {
+		sum += shard.numKeysInflight()
+	}
 	c.inFlightBatchMutex.Lock()
 	defer c.inFlightBatchMutex.Unlock()
-	return len(c.inFlightMap) + len(c.inFlightBatchMap)
+	return sum + len(c.inFlightBatchMap)
 }
@@ -1,8 +1,16 @@
 package sturdyc_test
 
 import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"slices"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -77,8 +85,12 @@ func TestTimeBasedEviction(t *testing.T) {
 		c.Set(randKey(12), "value")
 	}
 
-	// Expire all entries.
+	// Expire all entries. The ticker of the eviction job has to exist for the
+	// first tick to be sent, and it has to be received before the next one is
+	// sent, as the test clock drops the ticks that would have to be queued.
+	clock.BlockUntilTickers(1)
 	clock.Add(ttl + 1)
+	clock.Flush()
 
 	// Next, we'll loop through each shard while moving the clock by the evictionInterval. We'll
 	// sleep for a brief duration to allow the goroutines that were waiting for the timer to run.
@@ -353,3 +365,1873 @@ func TestReportsMetricsForHitsAndMisses(t *testing.T) {
 		t.Errorf("expected 1 cache miss, got %d", metricsRecorder.cacheMisses)
 	}
 }
+
+func TestGetReturnsZeroValueForExpiredEntries(t *testing.T) {
+	t.Parallel()
+
+	ttl := time.Minute
+	clock := sturdyc.NewTestClock(time.Now())
+	metricsRecorder := newTestMetricsRecorder(1)
+	client := sturdyc.New[string](100, 1, ttl, 5,
+		sturdyc.WithNoContinuousEvictions(),
+		sturdyc.WithMetrics(metricsRecorder),
+		sturdyc.WithClock(clock),
+	)
+
+	client.Set("key", "value")
+	if value, ok := client.Get("key"); !ok || value != "value" {
+		t.Fatalf("expected the value to be returned, got %q %t", value, ok)
+	}
+
+	clock.Add(ttl + 1)
+	value, ok := client.Get("key")
+	if ok {
+		t.Error("expected the expired entry to be reported as a miss")
+	}
+	if value != "" {
+		t.Errorf("expected the zero value, got %q", value)
+	}
+
+	metricsRecorder.Lock()
+	defer metricsRecorder.Unlock()
+	if metricsRecorder.cacheHits != 1 {
+		t.Errorf("expected 1 cache hit, got %d", metricsRecorder.cacheHits)
+	}
+	if metricsRecorder.cacheMisses != 1 {
+		t.Errorf("expected 1 cache miss, got %d", metricsRecorder.cacheMisses)
+	}
+}
+
+func TestSetReportsWhetherItTriggeredAnEviction(t *testing.T) {
+	t.Parallel()
+
+	client := sturdyc.New[int](2, 1, time.Hour, 50, sturdyc.WithNoContinuousEvictions())
+	if client.Set("1", 1) {
+		t.Error("expected the first write not to trigger an eviction")
+	}
+	if client.Set("2", 2) {
+		t.Error("expected the second write not to trigger an eviction")
+	}
+	if !client.Set("3", 3) {
+		t.Error("expected the write to trigger an eviction when the cache is full")
+	}
+}
+
+func TestSetWithResultDescribesTheForcedEviction(t *testing.T) {
+	t.Parallel()
+
+	client := sturdyc.New[int](2, 1, time.Hour, 50, sturdyc.WithNoContinuousEvictions())
+	client.Set("1", 1)
+	if res := client.SetWithResult("2", 2); res != (sturdyc.SetResult{Written: true}) {
+		t.Errorf("expected a plain write, got %+v", res)
+	}
+
+	res := client.SetWithResult("3", 3)
+	if !res.Written || !res.OverCapacity || res.EntriesEvicted != 1 {
+		t.Errorf("expected the write to evict one entry, got %+v", res)
+	}
+
+	full := sturdyc.New[int](1, 1, time.Hour, 0, sturdyc.WithNoContinuousEvictions())
+	full.Set("1", 1)
+	res = full.SetWithResult("2", 2)
+	if res.Written || !res.OverCapacity || res.EntriesEvicted != 0 {
+		t.Errorf("expected the write to be rejected by the full shard, got %+v", res)
+	}
+}
+
+func TestLRUEvictionKeepsRecentlyUsedEntries(t *testing.T) {
+	t.Parallel()
+
+	capacity := 10
+	metricsRecorder := newTestMetricsRecorder(1)
+	client := sturdyc.New[int](capacity, 1, time.Hour, 10,
+		sturdyc.WithNoContinuousEvictions(),
+		sturdyc.WithEvictionPolicy(sturdyc.EvictionPolicyLRU),
+		sturdyc.WithMetrics(metricsRecorder),
+	)
+
+	for i := 0; i < capacity; i++ {
+		client.Set(strconv.Itoa(i), i)
+	}
+
+	// Reading the first entry should move it to the front,
+	// which makes the second entry the least recently used.
+	if _, ok := client.Get("0"); !ok {
+		t.Fatal("expected key 0 to be in the cache")
+	}
+	client.Set(strconv.Itoa(capacity), capacity)
+
+	if _, ok := client.Get("0"); !ok {
+		t.Error("expected the recently used key 0 to survive the eviction")
+	}
+	if _, ok := client.Get("1"); ok {
+		t.Error("expected the least recently used key 1 to be evicted")
+	}
+	if client.Size() != capacity {
+		t.Errorf("expected cache size to be %d, got %d", capacity, client.Size())
+	}
+
+	metricsRecorder.Lock()
+	defer metricsRecorder.Unlock()
+	if metricsRecorder.evictedEntries != 1 {
+		t.Errorf("expected 1 evicted entry, got %d", metricsRecorder.evictedEntries)
+	}
+}
+
+func TestLFUEvictionKeepsFrequentlyUsedEntries(t *testing.T) {
+	t.Parallel()
+
+	capacity := 10
+	metricsRecorder := newTestMetricsRecorder(1)
+	client := sturdyc.New[int](capacity, 1, time.Hour, 10,
+		sturdyc.WithNoContinuousEvictions(),
+		sturdyc.WithEvictionPolicy(sturdyc.EvictionPolicyLFU),
+		sturdyc.WithMetrics(metricsRecorder),
+	)
+
+	for i := 0; i < capacity; i++ {
+		client.Set(strconv.Itoa(i), i)
+	}
+
+	// Read every entry but the last one three times. The last entry is
+	// the most recently used one, but it's the least frequently used.
+	for i := 0; i < capacity-1; i++ {
+		for j := 0; j < 3; j++ {
+			client.Get(strconv.Itoa(i))
+		}
+	}
+	client.Set(strconv.Itoa(capacity), capacity)
+
+	if _, ok := client.Get(strconv.Itoa(capacity - 1)); ok {
+		t.Error("expected the least frequently used key to be evicted")
+	}
+	for i := 0; i < capacity-1; i++ {
+		if _, ok := client.Get(strconv.Itoa(i)); !ok {
+			t.Errorf("expected the frequently used key %d to survive the eviction", i)
+		}
+	}
+
+	metricsRecorder.Lock()
+	defer metricsRecorder.Unlock()
+	if metricsRecorder.evictedEntries != 1 {
+		t.Errorf("expected 1 evicted entry, got %d", metricsRecorder.evictedEntries)
+	}
+}
+
+func TestLFUKeepsTheAccessFrequencyOfOverwrittenEntries(t *testing.T) {
+	t.Parallel()
+
+	client := sturdyc.New[int](2, 1, time.Hour, 50,
+		sturdyc.WithNoContinuousEvictions(),
+		sturdyc.WithEvictionPolicy(sturdyc.EvictionPolicyLFU),
+	)
+
+	client.Set("hot", 1)
+	for i := 0; i < 100; i++ {
+		client.Get("hot")
+	}
+	// Overwriting the hot key, like a refresh would, shouldn't make it the least frequently used one.
+	client.Set("hot", 2)
+
+	client.Set("cold", 3)
+	for i := 0; i < 5; i++ {
+		client.Get("cold")
+	}
+	client.Set("new", 4)
+
+	if _, ok := client.Get("hot"); !ok {
+		t.Error("expected the overwritten hot key to survive the eviction")
+	}
+	if _, ok := client.Get("cold"); ok {
+		t.Error("expected the cold key to be evicted")
+	}
+}
+
+func TestLFUAccessFrequenciesDecay(t *testing.T) {
+	t.Parallel()
+
+	numShards := 1
+	evictionInterval := time.Second
+	clock := sturdyc.NewTestClock(time.Now())
+	client := sturdyc.New[int](2, numShards, time.Hour, 50,
+		sturdyc.WithClock(clock),
+		sturdyc.WithEvictionInterval(evictionInterval),
+		sturdyc.WithEvictionPolicy(sturdyc.EvictionPolicyLFU),
+	)
+
+	// Give the first key a burst of traffic.
+	client.Set("burst", 1)
+	for i := 0; i < 8; i++ {
+		client.Get("burst")
+	}
+
+	// Let the frequencies decay a couple of times.
+	for i := 0; i < 3; i++ {
+		clock.Add(evictionInterval)
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// The second key is used steadily after the burst.
+	client.Set("steady", 2)
+	for i := 0; i < 4; i++ {
+		client.Get("steady")
+	}
+	client.Set("new", 3)
+
+	if _, ok := client.Get("burst"); ok {
+		t.Error("expected the old burst of traffic to have decayed")
+	}
+	if _, ok := client.Get("steady"); !ok {
+		t.Error("expected the steadily used key to survive the eviction")
+	}
+}
+
+func TestClearRemovesEveryEntry(t *testing.T) {
+	t.Parallel()
+
+	numShards := 10
+	metricsRecorder := newTestMetricsRecorder(numShards)
+	client := sturdyc.New[int](1000, numShards, time.Hour, 5,
+		sturdyc.WithNoContinuousEvictions(),
+		sturdyc.WithMetrics(metricsRecorder),
+	)
+
+	for i := 0; i < 100; i++ {
+		client.Set(strconv.Itoa(i), i)
+	}
+	client.Clear()
+
+	if client.Size() != 0 {
+		t.Errorf("expected cache size to be 0, got %d", client.Size())
+	}
+	if _, ok := client.Get("1"); ok {
+		t.Error("expected the cache to be empty")
+	}
+
+	metricsRecorder.Lock()
+	if metricsRecorder.evictedEntries != 100 {
+		t.Errorf("expected 100 evicted entries, got %d", metricsRecorder.evictedEntries)
+	}
+	metricsRecorder.Unlock()
+
+	// The cache should be usable after it has been cleared.
+	client.Set("1", 1)
+	if value, ok := client.Get("1"); !ok || value != 1 {
+		t.Errorf("expected the value to be returned, got %d %t", value, ok)
+	}
+}
+
+func TestDeleteManyRemovesEntriesAcrossShards(t *testing.T) {
+	t.Parallel()
+
+	client := sturdyc.New[int](1000, 10, time.Hour, 5,
+		sturdyc.WithNoContinuousEvictions(),
+	)
+
+	keys := make([]string, 0, 100)
+	for i := 0; i < 100; i++ {
+		key := strconv.Itoa(i)
+		keys = append(keys, key)
+		client.Set(key, i)
+	}
+	client.StoreMissingRecord("missing")
+
+	// Delete half of the keys, the missing record, and a key that doesn't exist.
+	keysToDelete := append(keys[:50:50], "missing", "non-existent")
+	if deleted := client.DeleteMany(keysToDelete); deleted != 51 {
+		t.Errorf("expected 51 deleted entries, got %d", deleted)
+	}
+
+	if client.Size() != 50 {
+		t.Errorf("expected cache size to be 50, got %d", client.Size())
+	}
+	for _, key := range keys[50:] {
+		if _, ok := client.Get(key); !ok {
+			t.Errorf("expected key %s to be in the cache", key)
+		}
+	}
+}
+
+func TestDeleteByPrefixOnlyRemovesMatchingKeys(t *testing.T) {
+	t.Parallel()
+
+	client := sturdyc.New[int](1000, 10, time.Hour, 5,
+		sturdyc.WithNoContinuousEvictions(),
+	)
+
+	for i := 0; i < 10; i++ {
+		client.Set("tenant:1:"+strconv.Itoa(i), i)
+		client.Set("tenant:2:"+strconv.Itoa(i), i)
+	}
+	client.StoreMissingRecord("tenant:1:missing")
+
+	if deleted := client.DeleteByPrefix("tenant:1:"); deleted != 11 {
+		t.Errorf("expected 11 deleted entries, got %d", deleted)
+	}
+
+	if client.Size() != 10 {
+		t.Errorf("expected cache size to be 10, got %d", client.Size())
+	}
+	for _, key := range client.ScanKeys() {
+		if !strings.HasPrefix(key, "tenant:2:") {
+			t.Errorf("expected key %s to have been deleted", key)
+		}
+	}
+}
+
+func TestForEachKey(t *testing.T) {
+	t.Parallel()
+
+	ttl := time.Minute
+	clock := sturdyc.NewTestClock(time.Now())
+	client := sturdyc.New[int](1000, 10, ttl, 5,
+		sturdyc.WithNoContinuousEvictions(),
+		sturdyc.WithClock(clock),
+	)
+
+	for i := 0; i < 10; i++ {
+		client.Set("expired-"+strconv.Itoa(i), i)
+	}
+	clock.Add(ttl + 1)
+	for i := 0; i < 10; i++ {
+		client.Set(strconv.Itoa(i), i)
+	}
+
+	seen := make(map[string]bool)
+	client.ForEachKey(func(key string) bool {
+		seen[key] = true
+		return true
+	})
+	if len(seen) != 10 {
+		t.Errorf("expected 10 keys, got %d", len(seen))
+	}
+	for key := range seen {
+		if strings.HasPrefix(key, "expired") {
+			t.Errorf("expected the expired key %s to be skipped", key)
+		}
+	}
+
+	var calls int
+	client.ForEachKey(func(_ string) bool {
+		calls++
+		return calls < 3
+	})
+	if calls != 3 {
+		t.Errorf("expected the iteration to stop after 3 keys, got %d", calls)
+	}
+}
+
+func TestForEach(t *testing.T) {
+	t.Parallel()
+
+	ttl := time.Minute
+	clock := sturdyc.NewTestClock(time.Now())
+	client := sturdyc.New[int](1000, 10, ttl, 5,
+		sturdyc.WithNoContinuousEvictions(),
+		sturdyc.WithClock(clock),
+		sturdyc.WithMissingRecordStorage(),
+	)
+
+	for i := 0; i < 10; i++ {
+		client.Set("expired-"+strconv.Itoa(i), i)
+	}
+	clock.Add(ttl + 1)
+	for i := 0; i < 10; i++ {
+		client.Set(strconv.Itoa(i), i)
+	}
+	client.StoreMissingRecord("missing")
+
+	var sum int
+	seen := make(map[string]bool)
+	client.ForEach(func(key string, value int) bool {
+		seen[key] = true
+		sum += value
+		return true
+	})
+	if len(seen) != 10 || sum != 45 {
+		t.Errorf("expected the 10 live entries with a sum of 45, got %d entries with a sum of %d", len(seen), sum)
+	}
+	if seen["missing"] {
+		t.Error("expected the missing record to be skipped")
+	}
+
+	var calls int
+	client.ForEach(func(_ string, _ int) bool {
+		calls++
+		return calls < 3
+	})
+	if calls != 3 {
+		t.Errorf("expected the iteration to stop after 3 entries, got %d", calls)
+	}
+}
+
+func TestTTLReturnsTheRemainingLifetime(t *testing.T) {
+	t.Parallel()
+
+	ttl := time.Hour
+	clock := sturdyc.NewTestClock(time.Now())
+	client := sturdyc.New[int](100, 1, ttl, 5,
+		sturdyc.WithNoContinuousEvictions(),
+		sturdyc.WithEarlyRefreshes(time.Minute, time.Minute, time.Second),
+		sturdyc.WithClock(clock),
+	)
+
+	client.Set("key", 1)
+	clock.Add(time.Minute * 10)
+
+	// The entry is due for a refresh, but the TTL should still reflect the expiry.
+	remaining, ok := client.TTL("key")
+	if !ok {
+		t.Fatal("expected the key to exist")
+	}
+	if remaining != time.Minute*50 {
+		t.Errorf("expected 50 minutes to remain, got %v", remaining)
+	}
+
+	if _, ok := client.TTL("non-existent"); ok {
+		t.Error("expected the non-existent key to be reported as missing")
+	}
+
+	clock.Add(time.Hour)
+	if remaining, ok := client.TTL("key"); ok || remaining != 0 {
+		t.Errorf("expected the expired key to be reported as missing, got %v %t", remaining, ok)
+	}
+}
+
+func TestSetWithTTLOverridesTheDefaultTTL(t *testing.T) {
+	t.Parallel()
+
+	numShards := 1
+	ttl := time.Hour
+	evictionInterval := time.Minute
+	clock := sturdyc.NewTestClock(time.Now())
+	metricsRecorder := newTestMetricsRecorder(numShards)
+	client := sturdyc.New[string](100, numShards, ttl, 5,
+		sturdyc.WithClock(clock),
+		sturdyc.WithEvictionInterval(evictionInterval),
+		sturdyc.WithMetrics(metricsRecorder),
+	)
+
+	client.Set("default", "value")
+	client.SetWithTTL("short", "value", time.Second*30)
+	client.SetWithTTL("long", "value", time.Hour*2)
+
+	// The continuous evictions should only remove the short lived entry. We'll
+	// sleep briefly first to give the eviction goroutine a chance to start.
+	time.Sleep(10 * time.Millisecond)
+	clock.Add(evictionInterval)
+	time.Sleep(10 * time.Millisecond)
+	if _, ok := client.Get("short"); ok {
+		t.Error("expected the short lived entry to have expired")
+	}
+	metricsRecorder.Lock()
+	if metricsRecorder.evictedEntries != 1 {
+		t.Errorf("expected 1 evicted entry, got %d", metricsRecorder.evictedEntries)
+	}
+	metricsRecorder.Unlock()
+
+	clock.Add(ttl)
+	if _, ok := client.Get("default"); ok {
+		t.Error("expected the entry with the default TTL to have expired")
+	}
+	if _, ok := client.Get("long"); !ok {
+		t.Error("expected the long lived entry to still be in the cache")
+	}
+}
+
+func TestStatsAreGatheredWithoutAMetricsRecorder(t *testing.T) {
+	t.Parallel()
+
+	client := sturdyc.New[int](2, 1, time.Hour, 50, sturdyc.WithNoContinuousEvictions())
+	client.Set("1", 1)
+	client.Set("2", 2)
+	client.Get("1")
+	client.Get("2")
+	client.Get("1")
+	client.Get("3")
+
+	stats := client.Stats()
+	if stats.Hits != 3 || stats.Misses != 1 {
+		t.Errorf("expected 3 hits and 1 miss, got %d hits and %d misses", stats.Hits, stats.Misses)
+	}
+	if stats.HitRatio != 0.75 {
+		t.Errorf("expected a hit ratio of 0.75, got %v", stats.HitRatio)
+	}
+	if stats.Size != 2 {
+		t.Errorf("expected the size to be 2, got %d", stats.Size)
+	}
+
+	client.Set("3", 3)
+	stats = client.Stats()
+	if stats.ForcedEvictions != 1 || stats.EntriesEvicted != 1 {
+		t.Errorf("expected 1 forced eviction of 1 entry, got %d forced evictions of %d entries",
+			stats.ForcedEvictions, stats.EntriesEvicted,
+		)
+	}
+}
+
+func TestResetStats(t *testing.T) {
+	t.Parallel()
+
+	client := sturdyc.New[int](100, 10, time.Hour, 5)
+	client.Set("1", 1)
+	client.Get("1")
+	client.Get("2")
+
+	client.ResetStats()
+	stats := client.Stats()
+	if stats.Hits != 0 || stats.Misses != 0 || stats.HitRatio != 0 {
+		t.Errorf("expected the counters to be reset, got %+v", stats)
+	}
+	if stats.Size != 1 {
+		t.Errorf("expected the size to be unaffected by the reset, got %d", stats.Size)
+	}
+}
+
+func TestCustomHashFnIsUsedForReadsAndWrites(t *testing.T) {
+	t.Parallel()
+
+	numShards := 4
+	recorder := newTestMetricsRecorder(numShards)
+	c := sturdyc.New[int](100, numShards, time.Hour, 5,
+		sturdyc.WithNoContinuousEvictions(),
+		sturdyc.WithMetrics(recorder),
+		sturdyc.WithHashFn(func(key string) uint64 {
+			n, _ := strconv.Atoi(key)
+			return uint64(n)
+		}),
+	)
+
+	for i := 0; i < 8; i++ {
+		c.Set(strconv.Itoa(i), i)
+	}
+	for i := 0; i < 8; i++ {
+		if v, ok := c.Get(strconv.Itoa(i)); !ok || v != i {
+			t.Errorf("expected key %d to be retrievable, got %d %t", i, v, ok)
+		}
+	}
+
+	recorder.Lock()
+	defer recorder.Unlock()
+	for i := 0; i < numShards; i++ {
+		if recorder.shards[i] != 4 {
+			t.Errorf("expected shard %d to have received 4 operations, got %d", i, recorder.shards[i])
+		}
+	}
+}
+
+func TestRefreshJitterSpreadsOutTheRefreshes(t *testing.T) {
+	t.Parallel()
+
+	ttl := time.Minute
+	refreshDelay := time.Second
+	clock := sturdyc.NewTestClock(time.Now())
+	c := sturdyc.New[int](1000, 1, ttl, 10,
+		sturdyc.WithNoContinuousEvictions(),
+		sturdyc.WithClock(clock),
+		sturdyc.WithEarlyRefreshes(refreshDelay, refreshDelay, time.Millisecond),
+		sturdyc.WithRefreshJitter(0.5),
+	)
+
+	numEntries := 100
+	for i := 0; i < numEntries; i++ {
+		c.Set(strconv.Itoa(i), i)
+	}
+
+	readAll := func() int64 {
+		c.ResetStats()
+		for i := 0; i < numEntries; i++ {
+			c.Get(strconv.Itoa(i))
+		}
+		return c.Stats().Refreshes
+	}
+
+	// With a jitter of half the TTL, the entries should become due for a
+	// refresh at some point between 1 and 31 seconds after they were written.
+	clock.Add(refreshDelay + 1)
+	if refreshes := readAll(); refreshes == int64(numEntries) {
+		t.Errorf("expected the jitter to delay some of the refreshes, got %d", refreshes)
+	}
+
+	clock.Add(ttl / 2)
+	if refreshes := readAll(); refreshes != int64(numEntries) {
+		t.Errorf("expected every entry to be due for a refresh, got %d", refreshes)
+	}
+}
+
+func TestExistsDoesNotCountAsAHitOrMiss(t *testing.T) {
+	t.Parallel()
+
+	ttl := time.Minute
+	clock := sturdyc.NewTestClock(time.Now())
+	c := sturdyc.New[int](100, 10, ttl, 5,
+		sturdyc.WithNoContinuousEvictions(),
+		sturdyc.WithClock(clock),
+		sturdyc.WithMissingRecordStorage(),
+	)
+
+	c.Set("1", 1)
+	c.StoreMissingRecord("2")
+
+	if !c.Exists("1") || c.ExistsAsMissing("1") {
+		t.Error("expected key 1 to exist as a regular record")
+	}
+	if !c.Exists("2") || !c.ExistsAsMissing("2") {
+		t.Error("expected key 2 to exist as a missing record")
+	}
+	if c.Exists("3") || c.ExistsAsMissing("3") {
+		t.Error("expected key 3 not to exist")
+	}
+
+	stats := c.Stats()
+	if stats.Hits != 0 || stats.Misses != 0 {
+		t.Errorf("expected no hits or misses, got %d hits and %d misses", stats.Hits, stats.Misses)
+	}
+
+	clock.Add(ttl + 1)
+	if c.Exists("1") || c.Exists("2") {
+		t.Error("expected the expired keys not to exist")
+	}
+}
+
+func TestSetIfAbsent(t *testing.T) {
+	t.Parallel()
+
+	ttl := time.Minute
+	clock := sturdyc.NewTestClock(time.Now())
+	c := sturdyc.New[int](100, 10, ttl, 5,
+		sturdyc.WithNoContinuousEvictions(),
+		sturdyc.WithClock(clock),
+	)
+
+	if !c.SetIfAbsent("1", 1) {
+		t.Error("expected the value to be written when the key is absent")
+	}
+	if c.SetIfAbsent("1", 2) {
+		t.Error("expected the value not to be written when the key is present")
+	}
+	if v, _ := c.Get("1"); v != 1 {
+		t.Errorf("expected the first value to be kept, got %d", v)
+	}
+
+	clock.Add(ttl + 1)
+	if !c.SetIfAbsent("1", 3) {
+		t.Error("expected an expired entry to be overwritten")
+	}
+	if v, _ := c.Get("1"); v != 3 {
+		t.Errorf("expected the new value to be written, got %d", v)
+	}
+}
+
+func TestSetIfAbsentOnlyLetsOneWriterWin(t *testing.T) {
+	t.Parallel()
+
+	c := sturdyc.New[int](100, 10, time.Minute, 5, sturdyc.WithNoContinuousEvictions())
+
+	var wg sync.WaitGroup
+	var wins atomic.Int32
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if c.SetIfAbsent("key", i) {
+				wins.Add(1)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if wins.Load() != 1 {
+		t.Errorf("expected exactly one writer to win, got %d", wins.Load())
+	}
+}
+
+func TestEvictionCallbackReportsTheReason(t *testing.T) {
+	t.Parallel()
+
+	ttl := time.Minute
+	clock := sturdyc.NewTestClock(time.Now())
+	reasons := make(map[string]sturdyc.EvictionReason)
+	var c *sturdyc.Client[int]
+	c = sturdyc.New[int](2, 1, ttl, 50,
+		sturdyc.WithNoContinuousEvictions(),
+		sturdyc.WithClock(clock),
+		sturdyc.WithEvictionCallback(func(key string, value int, reason sturdyc.EvictionReason) {
+			// Calling back into the cache must not deadlock.
+			c.Size()
+			if strconv.Itoa(value) != key {
+				t.Errorf("expected the value of key %s to be passed to the callback, got %d", key, value)
+			}
+			reasons[key] = reason
+		}),
+	)
+
+	c.Set("1", 1)
+	clock.Add(time.Second)
+	c.Set("2", 2)
+	c.Set("3", 3)
+	c.Delete("2")
+	c.Clear()
+
+	expected := map[string]sturdyc.EvictionReason{
+		"1": sturdyc.EvictionReasonCapacity,
+		"2": sturdyc.EvictionReasonDeleted,
+		"3": sturdyc.EvictionReasonCleared,
+	}
+	for key, reason := range expected {
+		if reasons[key] != reason {
+			t.Errorf("expected key %s to be evicted with reason %s, got %s", key, reason, reasons[key])
+		}
+	}
+}
+
+func TestEvictionCallbackIsInvokedForExpiredEntries(t *testing.T) {
+	t.Parallel()
+
+	ttl := time.Minute
+	numShards := 2
+	clock := sturdyc.NewTestClock(time.Now())
+	evicted := make(chan sturdyc.EvictionReason, 10)
+	c := sturdyc.New[string](100, numShards, ttl, 5,
+		sturdyc.WithClock(clock),
+		sturdyc.WithEvictionInterval(time.Second),
+		sturdyc.WithEvictionCallback(func(_, _ string, reason sturdyc.EvictionReason) {
+			evicted <- reason
+		}),
+	)
+
+	c.Set("1", "value")
+	// Give the eviction goroutine a chance to create its ticker before we move the clock.
+	time.Sleep(10 * time.Millisecond)
+	clock.Add(ttl + 1)
+	time.Sleep(5 * time.Millisecond)
+	for i := 0; i < numShards; i++ {
+		clock.Add(time.Second + 1)
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	select {
+	case reason := <-evicted:
+		if reason != sturdyc.EvictionReasonExpired {
+			t.Errorf("expected the entry to have expired, got %s", reason)
+		}
+	case <-time.After(time.Second):
+		t.Error("expected the callback to be invoked for the expired entry")
+	}
+}
+
+func TestMaxCostEvictsEntriesOnceTheBudgetIsExceeded(t *testing.T) {
+	t.Parallel()
+
+	metricsRecorder := newTestMetricsRecorder(1)
+	c := sturdyc.New[string](1000, 1, time.Hour, 10,
+		sturdyc.WithNoContinuousEvictions(),
+		sturdyc.WithMetrics(metricsRecorder),
+		sturdyc.WithCostFn(func(value string) int64 { return int64(len(value)) }),
+		sturdyc.WithMaxCost(100),
+	)
+
+	// The capacity allows for a thousand entries, but the budget only fits ten of these values.
+	value := strings.Repeat("a", 10)
+	for i := 0; i < 10; i++ {
+		c.Set(strconv.Itoa(i), value)
+	}
+	if c.Size() != 10 {
+		t.Fatalf("expected 10 entries, got %d", c.Size())
+	}
+
+	// Overwriting an entry with a value of the same cost should fit.
+	c.Set("0", value)
+	if c.Size() != 10 {
+		t.Fatalf("expected the overwrite not to trigger an eviction, got %d entries", c.Size())
+	}
+
+	// A large value should evict as many entries as it takes to make it fit.
+	c.Set("large", strings.Repeat("b", 55))
+	if c.Size() > 5 {
+		t.Errorf("expected at most 5 entries to fit within the budget, got %d", c.Size())
+	}
+	if _, ok := c.Get("large"); !ok {
+		t.Error("expected the large value to have been written")
+	}
+
+	metricsRecorder.Lock()
+	defer metricsRecorder.Unlock()
+	if metricsRecorder.evictedEntries < 6 {
+		t.Errorf("expected at least 6 evicted entries to be reported, got %d", metricsRecorder.evictedEntries)
+	}
+}
+
+func TestDeletesFreeUpTheCostBudget(t *testing.T) {
+	t.Parallel()
+
+	c := sturdyc.New[int](1000, 1, time.Hour, 10,
+		sturdyc.WithNoContinuousEvictions(),
+		sturdyc.WithCostFn(func(value int) int64 { return int64(value) }),
+		sturdyc.WithMaxCost(10),
+	)
+
+	c.Set("1", 5)
+	c.Set("2", 5)
+	c.Delete("1")
+	if c.Set("3", 5) {
+		t.Error("expected the deleted entry to have freed up its cost")
+	}
+	if c.Size() != 2 {
+		t.Errorf("expected 2 entries, got %d", c.Size())
+	}
+}
+
+func TestCloseStopsTheContinuousEvictions(t *testing.T) {
+	t.Parallel()
+
+	ttl := time.Minute
+	clock := sturdyc.NewTestClock(time.Now())
+	c := sturdyc.New[int](100, 1, ttl, 5,
+		sturdyc.WithClock(clock),
+		sturdyc.WithEvictionInterval(time.Second),
+	)
+
+	c.Set("1", 1)
+	if err := c.Close(); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if err := c.Close(); err != nil {
+		t.Fatalf("expected closing the client twice to be a no-op, got %v", err)
+	}
+
+	// Give the eviction goroutine a chance to exit before we move the clock.
+	time.Sleep(10 * time.Millisecond)
+	clock.Add(ttl + time.Second)
+	time.Sleep(10 * time.Millisecond)
+	if c.Size() != 1 {
+		t.Errorf("expected the expired entry not to be evicted once the client is closed, got size %d", c.Size())
+	}
+}
+
+func TestGetManyWithMisses(t *testing.T) {
+	t.Parallel()
+
+	metricsRecorder := newTestMetricsRecorder(10)
+	c := sturdyc.New[int](1000, 10, time.Hour, 5,
+		sturdyc.WithNoContinuousEvictions(),
+		sturdyc.WithMetrics(metricsRecorder),
+		sturdyc.WithMissingRecordStorage(),
+	)
+
+	for i := 0; i < 10; i++ {
+		c.Set(strconv.Itoa(i), i)
+	}
+	c.StoreMissingRecord("missing")
+
+	keys := []string{"0", "3", "7", "10", "11", "missing"}
+	hits, misses := c.GetManyWithMisses(keys)
+	if len(hits) != 3 || hits["0"] != 0 || hits["3"] != 3 || hits["7"] != 7 {
+		t.Errorf("expected keys 0, 3 and 7 to be found, got %v", hits)
+	}
+	slices.Sort(misses)
+	if !slices.Equal(misses, []string{"10", "11", "missing"}) {
+		t.Errorf("expected keys 10, 11 and missing to be returned as misses, got %v", misses)
+	}
+
+	metricsRecorder.Lock()
+	defer metricsRecorder.Unlock()
+	if metricsRecorder.cacheHits != 4 || metricsRecorder.cacheMisses != 2 {
+		t.Errorf("expected 4 hits and 2 misses, got %d hits and %d misses",
+			metricsRecorder.cacheHits, metricsRecorder.cacheMisses,
+		)
+	}
+}
+
+func TestSetManyWithTTL(t *testing.T) {
+	t.Parallel()
+
+	ttl := time.Hour
+	clock := sturdyc.NewTestClock(time.Now())
+	c := sturdyc.New[int](20, 2, ttl, 50,
+		sturdyc.WithNoContinuousEvictions(),
+		sturdyc.WithClock(clock),
+	)
+
+	records := make(map[string]int, 10)
+	for i := 0; i < 10; i++ {
+		records[strconv.Itoa(i)] = i
+	}
+	if evictions := c.SetManyWithTTL(records, time.Minute); evictions != 0 {
+		t.Errorf("expected no evictions, got %d", evictions)
+	}
+	if c.Size() != 10 {
+		t.Errorf("expected cache size to be 10, got %d", c.Size())
+	}
+
+	clock.Add(time.Minute + 1)
+	hits, _ := c.GetManyWithMisses(c.ScanKeys())
+	if len(hits) != 0 {
+		t.Errorf("expected the records to have expired, got %v", hits)
+	}
+
+	// The capacity is split between the shards, so writing more records than
+	// the capacity has to trigger evictions in both of them.
+	manyRecords := make(map[string]int, 40)
+	for i := 0; i < 40; i++ {
+		manyRecords[strconv.Itoa(i)] = i
+	}
+	if evictions := c.SetManyWithTTL(manyRecords, time.Minute); evictions == 0 {
+		t.Error("expected the writes to trigger evictions")
+	}
+}
+
+func TestLazyEvictionRemovesExpiredEntriesOnAccess(t *testing.T) {
+	t.Parallel()
+
+	ttl := time.Minute
+	clock := sturdyc.NewTestClock(time.Now())
+	evicted := make(map[string]sturdyc.EvictionReason)
+	c := sturdyc.New[int](100, 10, ttl, 5,
+		sturdyc.WithClock(clock),
+		sturdyc.WithLazyEviction(),
+		sturdyc.WithEvictionCallback(func(key string, _ int, reason sturdyc.EvictionReason) {
+			evicted[key] = reason
+		}),
+	)
+
+	c.Set("1", 1)
+	c.Set("2", 2)
+	clock.Add(ttl + 1)
+
+	// The expired entries are still counted until they're accessed.
+	if c.Size() != 2 {
+		t.Errorf("expected the size to include the expired entries, got %d", c.Size())
+	}
+	if _, ok := c.Get("1"); ok {
+		t.Error("expected the expired entry not to be returned")
+	}
+	if c.Size() != 1 {
+		t.Errorf("expected the accessed entry to have been evicted, got size %d", c.Size())
+	}
+	if reason, ok := evicted["1"]; !ok || reason != sturdyc.EvictionReasonExpired {
+		t.Errorf("expected key 1 to have been evicted as expired, got %v", evicted)
+	}
+}
+
+func TestShardKeyFnOnlyAffectsTheRouting(t *testing.T) {
+	t.Parallel()
+
+	numShards := 10
+	recorder := newTestMetricsRecorder(numShards)
+	c := sturdyc.New[int](1000, numShards, time.Hour, 5,
+		sturdyc.WithNoContinuousEvictions(),
+		sturdyc.WithMetrics(recorder),
+		sturdyc.WithShardKeyFn(func(key string) string {
+			tenant, _, _ := strings.Cut(key, "-")
+			return tenant
+		}),
+	)
+
+	for i := 0; i < 20; i++ {
+		c.Set("tenant-"+strconv.Itoa(i), i)
+	}
+	for i := 0; i < 20; i++ {
+		if v, ok := c.Get("tenant-" + strconv.Itoa(i)); !ok || v != i {
+			t.Errorf("expected the full key to be used for the lookup, got %d %t", v, ok)
+		}
+	}
+
+	recorder.Lock()
+	defer recorder.Unlock()
+	if len(recorder.shards) != 1 {
+		t.Errorf("expected every key of the tenant to be routed to the same shard, got %v", recorder.shards)
+	}
+}
+
+func TestShardStats(t *testing.T) {
+	t.Parallel()
+
+	numShards := 4
+	c := sturdyc.New[int](100, numShards, time.Hour, 5,
+		sturdyc.WithNoContinuousEvictions(),
+		sturdyc.WithHashFn(func(key string) uint64 {
+			n, _ := strconv.Atoi(key)
+			return uint64(n)
+		}),
+	)
+
+	// Keys 0 and 4 land in the first shard, and key 1 in the second one.
+	c.Set("0", 0)
+	c.Set("4", 4)
+	c.Set("1", 1)
+	c.Get("0")
+	c.Get("4")
+	c.Get("8")
+	c.Get("1")
+
+	stats := c.ShardStats()
+	if len(stats) != numShards {
+		t.Fatalf("expected %d shard stats, got %d", numShards, len(stats))
+	}
+	if stats[0].Size != 2 || stats[0].Hits != 2 || stats[0].Misses != 1 {
+		t.Errorf("expected the first shard to have 2 entries, 2 hits and 1 miss, got %+v", stats[0])
+	}
+	if stats[1].Size != 1 || stats[1].Hits != 1 || stats[1].Misses != 0 {
+		t.Errorf("expected the second shard to have 1 entry and 1 hit, got %+v", stats[1])
+	}
+	if stats[2].Size != 0 || stats[2].Capacity != 25 {
+		t.Errorf("expected the third shard to be empty with a capacity of 25, got %+v", stats[2])
+	}
+}
+
+func TestTTLJitterSpreadsOutTheExpirations(t *testing.T) {
+	t.Parallel()
+
+	ttl := 100 * time.Second
+	clock := sturdyc.NewTestClock(time.Now())
+	c := sturdyc.New[int](1000, 2, ttl, 5,
+		sturdyc.WithNoContinuousEvictions(),
+		sturdyc.WithClock(clock),
+		sturdyc.WithTTLJitter(0.5),
+	)
+
+	numEntries := 100
+	for i := 0; i < numEntries; i++ {
+		c.Set(strconv.Itoa(i), i)
+	}
+
+	numCached := func() int {
+		var n int
+		for i := 0; i < numEntries; i++ {
+			if _, ok := c.Get(strconv.Itoa(i)); ok {
+				n++
+			}
+		}
+		return n
+	}
+
+	clock.Add(ttl / 2)
+	if n := numCached(); n != numEntries {
+		t.Errorf("expected no entries to expire before the lower bound of the jitter, got %d cached", n)
+	}
+
+	clock.Add(ttl / 2)
+	if n := numCached(); n == 0 || n == numEntries {
+		t.Errorf("expected some of the entries to have expired at the TTL, got %d cached", n)
+	}
+
+	clock.Add(ttl/2 + time.Second)
+	if n := numCached(); n != 0 {
+		t.Errorf("expected every entry to expire after the upper bound of the jitter, got %d cached", n)
+	}
+}
+
+func TestUpdateIsAtomic(t *testing.T) {
+	t.Parallel()
+
+	c := sturdyc.New[int](100, 10, time.Hour, 5, sturdyc.WithNoContinuousEvictions())
+	increment := func(current int, _ bool) (int, bool) {
+		return current + 1, true
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c.Update("counter", increment)
+		}()
+	}
+	wg.Wait()
+
+	if v, _ := c.Get("counter"); v != 100 {
+		t.Errorf("expected the counter to be 100, got %d", v)
+	}
+
+	c.Update("counter", func(current int, exists bool) (int, bool) {
+		if !exists || current != 100 {
+			t.Errorf("expected the current value to be passed to the function, got %d %t", current, exists)
+		}
+		return 0, false
+	})
+	if c.Exists("counter") {
+		t.Error("expected the key to be deleted when the function returns false")
+	}
+}
+
+func TestSetTTLChangesTheTTLOfFutureWrites(t *testing.T) {
+	t.Parallel()
+
+	clock := sturdyc.NewTestClock(time.Now())
+	c := sturdyc.New[int](100, 2, time.Hour, 5,
+		sturdyc.WithNoContinuousEvictions(),
+		sturdyc.WithClock(clock),
+	)
+
+	c.Set("kept", 1)
+	c.SetTTL(time.Minute, false)
+	c.Set("new", 2)
+
+	clock.Add(time.Minute + time.Second)
+	if _, ok := c.Get("new"); ok {
+		t.Error("expected the entry to be written with the new TTL")
+	}
+	if _, ok := c.Get("kept"); !ok {
+		t.Error("expected the existing entry to keep its expiry")
+	}
+}
+
+func TestSetTTLRebasesTheExistingEntries(t *testing.T) {
+	t.Parallel()
+
+	clock := sturdyc.NewTestClock(time.Now())
+	c := sturdyc.New[int](100, 2, time.Hour, 5,
+		sturdyc.WithNoContinuousEvictions(),
+		sturdyc.WithClock(clock),
+	)
+
+	c.Set("1", 1)
+	c.SetTTL(time.Minute, true)
+
+	clock.Add(time.Minute + time.Second)
+	if _, ok := c.Get("1"); ok {
+		t.Error("expected the expiry of the existing entry to be rebased")
+	}
+}
+
+func TestSetEvictionPercentageChangesTheNextEviction(t *testing.T) {
+	t.Parallel()
+
+	c := sturdyc.New[int](10, 1, time.Hour, 10, sturdyc.WithNoContinuousEvictions())
+	for i := 0; i < 10; i++ {
+		c.Set(strconv.Itoa(i), i)
+	}
+
+	c.SetEvictionPercentage(50)
+	if res := c.SetWithResult("10", 10); res.EntriesEvicted != 5 {
+		t.Errorf("expected the new percentage to evict 5 entries, got %d", res.EntriesEvicted)
+	}
+}
+
+type recordingLogger struct {
+	sync.Mutex
+	debugs []string
+	warns  []string
+	onLog  func()
+}
+
+func (l *recordingLogger) Debug(msg string, _ ...any) {
+	l.Lock()
+	l.debugs = append(l.debugs, msg)
+	l.Unlock()
+	if l.onLog != nil {
+		l.onLog()
+	}
+}
+
+func (l *recordingLogger) Warn(msg string, _ ...any) {
+	l.Lock()
+	l.warns = append(l.warns, msg)
+	l.Unlock()
+	if l.onLog != nil {
+		l.onLog()
+	}
+}
+
+func (l *recordingLogger) Error(string, ...any) {}
+
+func TestLoggerIsCalledWithoutHoldingTheShardLock(t *testing.T) {
+	t.Parallel()
+
+	logger := &recordingLogger{}
+	c := sturdyc.New[int](2, 1, time.Hour, 50,
+		sturdyc.WithNoContinuousEvictions(),
+		sturdyc.WithLogger(logger),
+	)
+	// The logger calls back into the cache, which would deadlock if the lock was held.
+	logger.onLog = func() { c.Get("1") }
+
+	c.Set("1", 1)
+	c.Set("2", 2)
+	c.Set("3", 3)
+
+	logger.Lock()
+	defer logger.Unlock()
+	if len(logger.debugs) != 1 {
+		t.Errorf("expected the forced eviction to be logged, got %v", logger.debugs)
+	}
+}
+
+func TestInvalidKeysAreRejectedWithoutHoldingTheShardLock(t *testing.T) {
+	t.Parallel()
+
+	logger := &recordingLogger{}
+	var c *sturdyc.Client[int]
+	c = sturdyc.New[int](10, 1, time.Hour, 50,
+		sturdyc.WithNoContinuousEvictions(),
+		sturdyc.WithLogger(logger),
+		sturdyc.WithKeyValidator(func(key string) error {
+			// The validator calls back into the cache, which would deadlock if the lock was held.
+			c.Get("valid")
+			if key == "invalid" {
+				return errors.New("invalid key")
+			}
+			return nil
+		}),
+	)
+	logger.onLog = func() { c.Get("valid") }
+
+	c.Set("valid", 1)
+	c.Set("invalid", 2)
+	c.SetMany(map[string]int{"invalid": 3})
+
+	logger.Lock()
+	defer logger.Unlock()
+	if len(logger.warns) != 2 || c.Size() != 1 {
+		t.Errorf("expected the invalid writes to be logged and dropped, got %v", logger.warns)
+	}
+}
+
+func TestPeekDoesNotScheduleRefreshes(t *testing.T) {
+	t.Parallel()
+
+	ttl := time.Minute
+	refreshDelay := time.Second
+	clock := sturdyc.NewTestClock(time.Now())
+	c := sturdyc.New[int](100, 1, ttl, 10,
+		sturdyc.WithNoContinuousEvictions(),
+		sturdyc.WithClock(clock),
+		sturdyc.WithEarlyRefreshes(refreshDelay, refreshDelay, time.Millisecond),
+	)
+
+	c.Set("1", 1)
+	clock.Add(refreshDelay + 1)
+
+	for i := 0; i < 3; i++ {
+		if v, ok := c.Peek("1"); !ok || v != 1 {
+			t.Fatalf("expected to peek at 1, got %d %t", v, ok)
+		}
+	}
+	if _, ok := c.Peek("2"); ok {
+		t.Error("expected key 2 to be absent")
+	}
+	stats := c.Stats()
+	if stats.Hits != 3 || stats.Misses != 1 || stats.Refreshes != 0 {
+		t.Errorf("expected 3 hits, 1 miss and no refreshes, got %+v", stats)
+	}
+
+	// The entry should still be due for a refresh on the next read.
+	c.Get("1")
+	if refreshes := c.Stats().Refreshes; refreshes != 1 {
+		t.Errorf("expected the read to schedule a refresh, got %d", refreshes)
+	}
+
+	clock.Add(ttl)
+	if _, ok := c.Peek("1"); ok {
+		t.Error("expected the expired entry to be absent")
+	}
+}
+
+func TestMaxMissingRecordsEvictsTheOldestMissingRecords(t *testing.T) {
+	t.Parallel()
+
+	var evicted []string
+	c := sturdyc.New[int](100, 1, time.Hour, 10,
+		sturdyc.WithNoContinuousEvictions(),
+		sturdyc.WithMissingRecordStorage(),
+		sturdyc.WithMaxMissingRecords(2),
+		sturdyc.WithEvictionCallback(func(key string, _ int, reason sturdyc.EvictionReason) {
+			if reason != sturdyc.EvictionReasonMissingRecordLimit {
+				t.Errorf("expected %s to be evicted because of the limit, got %s", key, reason)
+			}
+			evicted = append(evicted, key)
+		}),
+	)
+
+	c.Set("a", 1)
+	c.StoreMissingRecord("1")
+	c.StoreMissingRecord("2")
+	c.StoreMissingRecord("3")
+	if c.Exists("1") || !c.ExistsAsMissing("2") || !c.ExistsAsMissing("3") {
+		t.Error("expected the oldest missing record to be evicted")
+	}
+
+	// Records that are no longer missing shouldn't count towards the limit.
+	c.Set("2", 2)
+	c.StoreMissingRecord("4")
+	c.StoreMissingRecord("5")
+	if c.Exists("3") || !c.ExistsAsMissing("4") || !c.ExistsAsMissing("5") {
+		t.Error("expected the oldest missing record to be evicted")
+	}
+	if !c.Exists("a") || !c.Exists("2") {
+		t.Error("expected the regular records to be retained")
+	}
+	if len(evicted) != 2 || evicted[0] != "1" || evicted[1] != "3" {
+		t.Errorf("expected 1 and 3 to be evicted, got %v", evicted)
+	}
+}
+
+func TestGetRefGuardsTheEntryFromEvictions(t *testing.T) {
+	t.Parallel()
+
+	type largeValue struct {
+		payload [1024]byte
+		id      int
+	}
+
+	c := sturdyc.New[largeValue](2, 1, time.Hour, 50,
+		sturdyc.WithNoContinuousEvictions(),
+		sturdyc.WithEvictionPolicy(sturdyc.EvictionPolicyLRU),
+	)
+	c.Set("1", largeValue{id: 1})
+	c.Set("2", largeValue{id: 2})
+
+	ref, ok, release := c.GetRef("1")
+	if !ok || ref.id != 1 {
+		t.Fatalf("expected a reference to 1, got %v", ok)
+	}
+
+	// Key 1 is the least recently used entry now, but it's referenced.
+	c.Get("2")
+	c.Set("3", largeValue{id: 3})
+	if !c.Exists("1") {
+		t.Error("expected the referenced entry to be retained")
+	}
+
+	release()
+	release()
+	c.Get("3")
+	c.Set("4", largeValue{id: 4})
+	if c.Exists("1") {
+		t.Error("expected the released entry to be evicted")
+	}
+
+	if ref, ok, release := c.GetRef("5"); ok || ref != nil {
+		t.Error("expected no reference for a missing key")
+	} else {
+		release()
+	}
+}
+
+func TestResizeGrowsAndShrinksTheCapacity(t *testing.T) {
+	t.Parallel()
+
+	recorder := newTestMetricsRecorder(1)
+	c := sturdyc.New[int](10, 1, time.Hour, 10,
+		sturdyc.WithNoContinuousEvictions(),
+		sturdyc.WithEvictionPolicy(sturdyc.EvictionPolicyLRU),
+		sturdyc.WithMetrics(recorder),
+	)
+
+	c.Resize(40)
+	for i := 0; i < 40; i++ {
+		c.Set(strconv.Itoa(i), i)
+	}
+	if c.Size() != 40 {
+		t.Fatalf("expected the grown cache to hold 40 entries, got %d", c.Size())
+	}
+	if recorder.evictedEntries != 0 {
+		t.Errorf("expected no evictions, got %d", recorder.evictedEntries)
+	}
+
+	c.Resize(20)
+	if c.Size() != 20 {
+		t.Errorf("expected the shrunk cache to hold 20 entries, got %d", c.Size())
+	}
+	if recorder.evictedEntries != 20 {
+		t.Errorf("expected 20 entries to be reported as evicted, got %d", recorder.evictedEntries)
+	}
+	if c.Exists("0") || !c.Exists("39") {
+		t.Error("expected the least recently used entries to be evicted")
+	}
+	if capacity := c.ShardStats()[0].Capacity; capacity != 20 {
+		t.Errorf("expected the shard to have a capacity of 20, got %d", capacity)
+	}
+}
+
+func TestSlidingExpirationKeepsAccessedEntriesAlive(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	ttl := time.Minute
+	clock := sturdyc.NewTestClock(time.Now())
+	c := sturdyc.New[int](100, 1, ttl, 10,
+		sturdyc.WithNoContinuousEvictions(),
+		sturdyc.WithClock(clock),
+		sturdyc.WithSlidingExpiration(),
+	)
+	c.Set("accessed", 1)
+	c.Set("idle", 2)
+
+	fetchFn := func(_ context.Context) (int, error) {
+		return 0, errors.New("expected the value to be served from the cache")
+	}
+
+	// Each read happens before the TTL has passed since the previous one.
+	for i := 0; i < 5; i++ {
+		clock.Add(ttl / 2)
+		if i%2 == 0 {
+			if _, ok := c.Get("accessed"); !ok {
+				t.Fatalf("expected the accessed entry to be alive after %d reads", i)
+			}
+			continue
+		}
+		if _, err := c.GetOrFetch(ctx, "accessed", fetchFn); err != nil {
+			t.Fatalf("expected the accessed entry to be alive, got %v", err)
+		}
+	}
+
+	if c.Exists("idle") {
+		t.Error("expected the idle entry to have expired")
+	}
+
+	clock.Add(ttl + 1)
+	if _, ok := c.Get("accessed"); ok {
+		t.Error("expected the entry to expire once it's no longer accessed")
+	}
+
+	// The expiry slides by the TTL that the entry was written with.
+	c.SetWithTTL("short", 3, time.Second)
+	clock.Add(time.Second / 2)
+	if _, ok := c.Get("short"); !ok {
+		t.Fatal("expected the entry with the shorter TTL to be alive")
+	}
+	clock.Add(time.Second + 1)
+	if _, ok := c.Get("short"); ok {
+		t.Error("expected the entry to expire a second after it was read")
+	}
+}
+
+func TestTestClockDrivesTheContinuousEvictions(t *testing.T) {
+	t.Parallel()
+
+	ttl := time.Minute
+	clock := sturdyc.NewTestClock(time.Now())
+	evicted := make(chan string, 1)
+	c := sturdyc.New[string](100, 1, ttl, 5,
+		sturdyc.WithClock(clock),
+		sturdyc.WithEvictionInterval(time.Second),
+		sturdyc.WithEvictionCallback(func(key, _ string, _ sturdyc.EvictionReason) {
+			evicted <- key
+		}),
+	)
+
+	c.Set("1", "value")
+	clock.BlockUntilTickers(1)
+	clock.Advance(ttl + time.Second)
+	clock.Flush()
+
+	select {
+	case key := <-evicted:
+		if key != "1" {
+			t.Errorf("expected key 1 to be evicted, got %s", key)
+		}
+	case <-time.After(time.Second):
+		t.Error("expected the tick to evict the expired entry")
+	}
+}
+
+func TestPinnedEntriesSurviveTheEvictions(t *testing.T) {
+	t.Parallel()
+
+	capacity := 10
+	client := sturdyc.New[int](capacity, 1, time.Hour, 10,
+		sturdyc.WithNoContinuousEvictions(),
+		sturdyc.WithEvictionPolicy(sturdyc.EvictionPolicyLRU),
+		sturdyc.WithMaxPinnedEntries(2),
+	)
+
+	if !client.Pin("0") || !client.Pin("1") {
+		t.Fatal("expected the keys to be pinned")
+	}
+	if client.Pin("2") {
+		t.Error("expected the pin to be rejected once the limit has been reached")
+	}
+
+	// The pinned keys are the least recently used ones,
+	// which makes them the first candidates for the eviction.
+	for i := 0; i < capacity*2; i++ {
+		client.Set(strconv.Itoa(i), i)
+	}
+	for _, key := range []string{"0", "1"} {
+		if _, ok := client.Get(key); !ok {
+			t.Errorf("expected the pinned key %s to survive the evictions", key)
+		}
+	}
+
+	client.Unpin("0")
+	if !client.Pin("2") {
+		t.Error("expected unpinning a key to make room for another pin")
+	}
+	for i := capacity * 2; i < capacity*4; i++ {
+		client.Set(strconv.Itoa(i), i)
+	}
+	if _, ok := client.Get("0"); ok {
+		t.Error("expected the unpinned key 0 to be evicted")
+	}
+}
+
+func TestValueClonerIsolatesTheStoredValue(t *testing.T) {
+	t.Parallel()
+
+	client := sturdyc.New[[]int](10, 1, time.Hour, 10,
+		sturdyc.WithNoContinuousEvictions(),
+		sturdyc.WithValueCloner(slices.Clone[[]int]),
+	)
+
+	value := []int{1, 2, 3}
+	client.Set("1", value)
+	value[0] = 100
+
+	res, ok := client.Get("1")
+	if !ok {
+		t.Fatal("expected key 1 to be in the cache")
+	}
+	if res[0] != 1 {
+		t.Errorf("expected the stored value to be isolated from the caller, got %v", res)
+	}
+
+	res[1] = 200
+	hits := client.GetMany([]string{"1"})
+	if hits["1"][1] != 2 {
+		t.Errorf("expected the reads to return a copy of the stored value, got %v", hits["1"])
+	}
+}
+
+func TestEvictionHighWatermarkBatchesTheEvictions(t *testing.T) {
+	t.Parallel()
+
+	capacity := 100
+	writes := 1000
+	metricsRecorder := newTestMetricsRecorder(1)
+	client := sturdyc.New[int](capacity, 1, time.Hour, 20,
+		sturdyc.WithNoContinuousEvictions(),
+		sturdyc.WithEvictionPolicy(sturdyc.EvictionPolicyLRU),
+		sturdyc.WithEvictionHighWatermark(0.9),
+		sturdyc.WithMetrics(metricsRecorder),
+	)
+
+	for i := 0; i < writes; i++ {
+		client.Set(strconv.Itoa(i), i)
+		if client.Size() > 90 {
+			t.Fatalf("expected the shard to stay at or below the high watermark, got %d entries", client.Size())
+		}
+	}
+
+	metricsRecorder.Lock()
+	defer metricsRecorder.Unlock()
+	if metricsRecorder.forcedEvictions == 0 || metricsRecorder.forcedEvictions > writes/10 {
+		t.Errorf("expected the evictions to be batched, got %d forced evictions", metricsRecorder.forcedEvictions)
+	}
+	if metricsRecorder.evictedEntries != writes-client.Size() {
+		t.Errorf("expected %d evicted entries, got %d", writes-client.Size(), metricsRecorder.evictedEntries)
+	}
+}
+
+func TestRefreshDueAtReturnsTheRefreshWindowOfTheEntry(t *testing.T) {
+	t.Parallel()
+
+	minRefreshTime := time.Minute
+	maxRefreshTime := 2 * time.Minute
+	clock := sturdyc.NewTestClock(time.Now())
+	client := sturdyc.New[string](10, 1, time.Hour, 10,
+		sturdyc.WithNoContinuousEvictions(),
+		sturdyc.WithEarlyRefreshes(minRefreshTime, maxRefreshTime, time.Second),
+		sturdyc.WithClock(clock),
+	)
+
+	if _, ok := client.RefreshDueAt("1"); ok {
+		t.Error("expected the key to be absent")
+	}
+
+	now := clock.Now()
+	client.Set("1", "value")
+	dueAt, ok := client.RefreshDueAt("1")
+	if !ok {
+		t.Fatal("expected the key to exist")
+	}
+	if dueAt.Before(now.Add(minRefreshTime)) || !dueAt.Before(now.Add(maxRefreshTime)) {
+		t.Errorf("expected the refresh to be due between %v and %v, got %v", minRefreshTime, maxRefreshTime, dueAt.Sub(now))
+	}
+
+	noRefreshes := sturdyc.New[string](10, 1, time.Hour, 10, sturdyc.WithNoContinuousEvictions())
+	noRefreshes.Set("1", "value")
+	if dueAt, ok := noRefreshes.RefreshDueAt("1"); !ok || !dueAt.IsZero() {
+		t.Errorf("expected a zero time for an entry that isn't refreshed, got %v", dueAt)
+	}
+}
+
+type versionedValue struct {
+	value   string
+	version uint64
+}
+
+func TestVersionFnPreventsOlderValuesFromReplacingNewerOnes(t *testing.T) {
+	t.Parallel()
+
+	client := sturdyc.New[versionedValue](10, 1, time.Hour, 10,
+		sturdyc.WithNoContinuousEvictions(),
+		sturdyc.WithVersionFn(func(v versionedValue) uint64 { return v.version }),
+	)
+
+	client.Set("1", versionedValue{"fresh", 2})
+	if res := client.SetWithResult("1", versionedValue{"slow refresh", 1}); res.Written {
+		t.Error("expected the older version to be dropped")
+	}
+	if v, _ := client.Get("1"); v.value != "fresh" {
+		t.Errorf("expected the newer version to be kept, got %s", v.value)
+	}
+
+	client.Set("1", versionedValue{"same version", 2})
+	if v, _ := client.Get("1"); v.value != "same version" {
+		t.Errorf("expected a value with the same version to be written, got %s", v.value)
+	}
+	client.Set("1", versionedValue{"newer", 3})
+	if v, _ := client.Get("1"); v.value != "newer" {
+		t.Errorf("expected the newer version to be written, got %s", v.value)
+	}
+}
+
+func TestTheCapacitiesOfTheShardsAddUpToTheCapacity(t *testing.T) {
+	t.Parallel()
+
+	totalCapacity := func(c *sturdyc.Client[int]) int {
+		var capacity int
+		for _, stat := range c.ShardStats() {
+			capacity += stat.Capacity
+		}
+		return capacity
+	}
+
+	testCases := []struct {
+		capacity  int
+		numShards int
+	}{
+		{100, 3},
+		{100, 7},
+		{10, 10},
+		{5, 8},
+		{1000, 64},
+	}
+	for _, tc := range testCases {
+		c := sturdyc.New[int](tc.capacity, tc.numShards, time.Hour, 5,
+			sturdyc.WithNoContinuousEvictions(),
+		)
+		if got := totalCapacity(c); got != tc.capacity {
+			t.Errorf("expected a capacity of %d with %d shards, got %d", tc.capacity, tc.numShards, got)
+		}
+
+		c.Resize(tc.capacity + 1)
+		if got := totalCapacity(c); got != tc.capacity+1 {
+			t.Errorf("expected a capacity of %d with %d shards after resizing, got %d", tc.capacity+1, tc.numShards, got)
+		}
+	}
+}
+
+func TestGetAndDeleteOnlyHandsOutTheValueOnce(t *testing.T) {
+	t.Parallel()
+
+	var evictions atomic.Int32
+	metricsRecorder := newTestMetricsRecorder(1)
+	client := sturdyc.New[string](100, 1, time.Hour, 10,
+		sturdyc.WithNoContinuousEvictions(),
+		sturdyc.WithMetrics(metricsRecorder),
+		sturdyc.WithEvictionCallback(func(_, _ string, reason sturdyc.EvictionReason) {
+			if reason == sturdyc.EvictionReasonDeleted {
+				evictions.Add(1)
+			}
+		}),
+	)
+	client.Set("token", "value")
+
+	var wg sync.WaitGroup
+	var winners atomic.Int32
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if v, ok := client.GetAndDelete("token"); ok && v == "value" {
+				winners.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if n := winners.Load(); n != 1 {
+		t.Errorf("expected exactly one consumer to get the value, got %d", n)
+	}
+	if client.Size() != 0 {
+		t.Errorf("expected the entry to be deleted, got %d entries", client.Size())
+	}
+	if n := evictions.Load(); n != 1 {
+		t.Errorf("expected the eviction callback to be invoked once, got %d", n)
+	}
+
+	metricsRecorder.Lock()
+	defer metricsRecorder.Unlock()
+	if metricsRecorder.cacheHits != 1 || metricsRecorder.cacheMisses != 9 {
+		t.Errorf("expected 1 hit and 9 misses, got %d and %d", metricsRecorder.cacheHits, metricsRecorder.cacheMisses)
+	}
+}
+
+func TestSampledEvictionsApproximateThePolicy(t *testing.T) {
+	t.Parallel()
+
+	capacity := 10
+	metricsRecorder := newTestMetricsRecorder(1)
+	client := sturdyc.New[int](capacity, 1, time.Hour, 10,
+		sturdyc.WithNoContinuousEvictions(),
+		sturdyc.WithEvictionPolicy(sturdyc.EvictionPolicyLRU),
+		// A sample that covers the entire shard makes the eviction exact.
+		sturdyc.WithEvictionSampleSize(capacity),
+		sturdyc.WithMetrics(metricsRecorder),
+	)
+
+	for i := 0; i < capacity; i++ {
+		client.Set(strconv.Itoa(i), i)
+	}
+	client.Get("0")
+	client.Set(strconv.Itoa(capacity), capacity)
+
+	if _, ok := client.Get("0"); !ok {
+		t.Error("expected the recently used key 0 to survive the eviction")
+	}
+	if _, ok := client.Get("1"); ok {
+		t.Error("expected the least recently used key 1 to be evicted")
+	}
+
+	metricsRecorder.Lock()
+	defer metricsRecorder.Unlock()
+	if metricsRecorder.evictedEntries != 1 {
+		t.Errorf("expected 1 evicted entry, got %d", metricsRecorder.evictedEntries)
+	}
+}
+
+type cacheSizeRecorder struct {
+	*TestMetricsRecorder
+	sizes chan int
+}
+
+func (r *cacheSizeRecorder) CacheSize(size int) {
+	r.sizes <- size
+}
+
+func TestTheEvictionTickerSamplesTheCacheSize(t *testing.T) {
+	t.Parallel()
+
+	clock := sturdyc.NewTestClock(time.Now())
+	recorder := &cacheSizeRecorder{
+		TestMetricsRecorder: newTestMetricsRecorder(1),
+		sizes:               make(chan int, 1),
+	}
+	c := sturdyc.New[string](100, 1, time.Hour, 5,
+		sturdyc.WithClock(clock),
+		sturdyc.WithEvictionInterval(time.Second),
+		sturdyc.WithMetrics(recorder),
+	)
+
+	c.Set("1", "value")
+	c.Set("2", "value")
+	// The entries of the namespaces are included in the size.
+	c.Namespace("users", 10, time.Hour).Set("3", "value")
+	clock.BlockUntilTickers(1)
+	clock.Advance(time.Second)
+	clock.Flush()
+
+	select {
+	case size := <-recorder.sizes:
+		if size != 3 {
+			t.Errorf("expected the sampled size to be 3, got %d", size)
+		}
+	case <-time.After(time.Second):
+		t.Error("expected the tick to sample the size of the cache")
+	}
+}
+
+func TestGetWithAgeReturnsTheTimeSinceTheValueWasWritten(t *testing.T) {
+	t.Parallel()
+
+	clock := sturdyc.NewTestClock(time.Now())
+	c := sturdyc.New[string](100, 1, time.Minute, 5,
+		sturdyc.WithNoContinuousEvictions(),
+		sturdyc.WithClock(clock),
+	)
+
+	c.Set("key", "value")
+	clock.Add(20 * time.Second)
+	value, age, ok := c.GetWithAge("key")
+	if !ok || value != "value" {
+		t.Fatalf("expected the value to be found, got %q and %t", value, ok)
+	}
+	if age != 20*time.Second {
+		t.Errorf("expected the age to be 20s, got %v", age)
+	}
+
+	c.Set("key", "new value")
+	if _, age, _ := c.GetWithAge("key"); age != 0 {
+		t.Errorf("expected the write to reset the age, got %v", age)
+	}
+
+	clock.Add(time.Minute + time.Second)
+	if _, _, ok := c.GetWithAge("key"); ok {
+		t.Error("expected the expired value to not be found")
+	}
+	if c.Stats().Hits != 2 || c.Stats().Misses != 1 {
+		t.Errorf("expected 2 hits and 1 miss, got %+v", c.Stats())
+	}
+}
+
+func TestKeysArePassedThroughTheTransform(t *testing.T) {
+	t.Parallel()
+
+	hash := func(key string) string {
+		sum := sha256.Sum256([]byte(key))
+		return hex.EncodeToString(sum[:])
+	}
+	c := sturdyc.New[string](100, 2, time.Minute, 5,
+		sturdyc.WithNoContinuousEvictions(),
+		sturdyc.WithKeyTransform(hash),
+	)
+
+	longKey := strings.Repeat("long-key-", 100)
+	c.Set(longKey, "value")
+	if value, ok := c.Get(longKey); !ok || value != "value" {
+		t.Fatalf("expected the value to be found, got %q and %t", value, ok)
+	}
+	if keys := c.ScanKeys(); len(keys) != 1 || keys[0] != hash(longKey) {
+		t.Errorf("expected the transformed key to be returned, got %v", keys)
+	}
+
+	fetchFn := func(_ context.Context) (string, error) {
+		return "other value", nil
+	}
+	value, err := c.GetOrFetch(context.Background(), "other-key", fetchFn)
+	if err != nil || value != "other value" {
+		t.Fatalf("expected the value to be fetched, got %q and %v", value, err)
+	}
+	if _, ok := c.Get("other-key"); !ok {
+		t.Error("expected the fetched value to be stored under the transformed key")
+	}
+
+	var snapshot bytes.Buffer
+	if err = c.Snapshot(&snapshot); err != nil {
+		t.Fatalf("expected the snapshot to succeed, got %v", err)
+	}
+	restored := sturdyc.New[string](100, 2, time.Minute, 5,
+		sturdyc.WithNoContinuousEvictions(),
+		sturdyc.WithKeyTransform(hash),
+	)
+	if err = restored.Restore(&snapshot); err != nil {
+		t.Fatalf("expected the restore to succeed, got %v", err)
+	}
+	if value, ok := restored.Get(longKey); !ok || value != "value" {
+		t.Errorf("expected the restored value to be found, got %q and %t", value, ok)
+	}
+
+	// The prefix is matched against the transformed keys.
+	if deleted := c.DeleteByPrefix("long-key-"); deleted != 0 {
+		t.Errorf("expected the prefix not to match the original key, got %d deletions", deleted)
+	}
+	if deleted := c.DeleteByPrefix(hash(longKey)[:8]); deleted != 1 {
+		t.Errorf("expected the prefix to match the transformed key, got %d deletions", deleted)
+	}
+	if _, ok := c.Get(longKey); ok {
+		t.Error("expected the key to have been deleted")
+	}
+}
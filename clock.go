@@ -58,6 +58,13 @@ type testTicker struct {
 }
 
 // TestClock is a clock that satisfies the Clock interface. It should only be used for testing.
+// It can be passed to WithClock to write deterministic tests of code that depends on the cache:
+//
+//	clock := sturdyc.NewTestClock(time.Now())
+//	cache := sturdyc.New[string](capacity, numShards, ttl, evictionPercentage, sturdyc.WithClock(clock))
+//	clock.BlockUntilTickers(1) // The continuous eviction job has started.
+//	clock.Advance(ttl)
+//	clock.Flush() // The eviction job has received the tick, but it may not have acted on it yet.
 type TestClock struct {
 	mu      sync.Mutex
 	time    time.Time
@@ -78,7 +85,11 @@ func NewTestClock(time time.Time) *TestClock {
 func (c *TestClock) Set(t time.Time) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
+	c.set(t)
+}
 
+// set should be called with a lock.
+func (c *TestClock) set(t time.Time) {
 	if t.Before(c.time) {
 		panic("can't go back in time")
 	}
@@ -111,7 +122,61 @@ func (c *TestClock) Set(t time.Time) {
 // Add adds the duration to the internal time of the test clock
 // and triggers any timers or tickers that should fire.
 func (c *TestClock) Add(d time.Duration) {
-	c.Set(c.time.Add(d))
+	c.Advance(d)
+}
+
+// Advance moves the internal time of the test clock forward by the duration
+// and triggers any timers or tickers that should fire.
+func (c *TestClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.set(c.time.Add(d))
+}
+
+// BlockUntilTickers blocks until at least n tickers that haven't been stopped
+// have been created from the clock. The cache creates its tickers from
+// goroutines, and this allows a test to wait for them to start before
+// advancing the time.
+func (c *TestClock) BlockUntilTickers(n int) {
+	for c.numActiveTickers() < n {
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func (c *TestClock) numActiveTickers() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var n int
+	for _, ticker := range c.tickers {
+		if !ticker.stopped.Load() {
+			n++
+		}
+	}
+	return n
+}
+
+// Flush blocks until every tick that has been sent by an active ticker of the
+// clock has been received. Calling it after Advance ensures that the
+// goroutines which are driven by the tickers, such as the continuous
+// eviction job, have picked up the tick, and that the next tick isn't
+// dropped because the previous one is still pending. It doesn't wait for
+// the goroutines to act on the tick, which means that a test has to poll for
+// the effects of it.
+func (c *TestClock) Flush() {
+	for c.hasPendingTicks() {
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func (c *TestClock) hasPendingTicks() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, ticker := range c.tickers {
+		if !ticker.stopped.Load() && len(ticker.ch) > 0 {
+			return true
+		}
+	}
+	return false
 }
 
 // Now returns the internal time of the test clock.
@@ -0,0 +1,29 @@
+package sturdyc
+
+import "encoding/json"
+
+// Codec is used to convert the records that the cache writes to the
+// distributed storage to bytes and back. The values are only encoded on the
+// paths that actually need bytes, which means that the in-memory cache never
+// pays for any serialization. The signatures follow encoding/json so that
+// most serialization packages can be wrapped with very little code. The
+// interface isn't generic over the type of the cache, since what's encoded
+// is a record that wraps the value together with its metadata, and because
+// the fetchFns of the package level functions can return other types.
+type Codec interface {
+	Marshal(v any) ([]byte, error)
+	Unmarshal(data []byte, v any) error
+}
+
+// JSONCodec is the default codec. It encodes the records using encoding/json.
+type JSONCodec struct{}
+
+// Marshal wraps json.Marshal from the standard library.
+func (JSONCodec) Marshal(v any) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+// Unmarshal wraps json.Unmarshal from the standard library.
+func (JSONCodec) Unmarshal(data []byte, v any) error {
+	return json.Unmarshal(data, v)
+}
@@ -0,0 +1,91 @@
+package sturdyc
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+)
+
+// Compressor is used to compress the records that the cache writes to the
+// distributed storage once they've been encoded by the codec.
+type Compressor interface {
+	Compress(data []byte) ([]byte, error)
+	Decompress(data []byte) ([]byte, error)
+}
+
+// GzipCompressor compresses the records using compress/gzip.
+type GzipCompressor struct {
+	// Level is the compression level. The zero value uses the default level.
+	Level int
+}
+
+// Compress writes the data to a gzip writer.
+func (g GzipCompressor) Compress(data []byte) ([]byte, error) {
+	level := g.Level
+	if level == 0 {
+		level = gzip.DefaultCompression
+	}
+
+	var buf bytes.Buffer
+	w, err := gzip.NewWriterLevel(&buf, level)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = w.Write(data); err != nil {
+		return nil, err
+	}
+	if err = w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Decompress reads the data from a gzip reader.
+func (g GzipCompressor) Decompress(data []byte) ([]byte, error) {
+	r, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return io.ReadAll(r)
+}
+
+// compressionHeader is written in front of every compressed record. The
+// first byte can never begin a valid UTF-8 string, which makes it possible to
+// tell compressed records apart from the ones that were written without
+// compression. The last byte is the version of the format.
+var compressionHeader = []byte{0xff, 's', 'z', 1}
+
+var errUnsupportedCompression = errors.New("sturdyc: unsupported compression version")
+
+// compress compresses the encoded record if the client has been configured
+// with a compressor.
+func (c *Config) compress(data []byte) ([]byte, error) {
+	if c.compressor == nil {
+		return data, nil
+	}
+
+	compressed, err := c.compressor.Compress(data)
+	if err != nil {
+		return nil, err
+	}
+	return append(append(make([]byte, 0, len(compressionHeader)+len(compressed)), compressionHeader...), compressed...), nil
+}
+
+// decompress decompresses the record if it begins with the compression
+// header. Records without the header are returned as is, which allows the
+// cache to read records that were written before compression was enabled.
+func (c *Config) decompress(data []byte) ([]byte, error) {
+	prefix := compressionHeader[:len(compressionHeader)-1]
+	if !bytes.HasPrefix(data, prefix) {
+		return data, nil
+	}
+	if len(data) < len(compressionHeader) || data[len(prefix)] != compressionHeader[len(prefix)] {
+		return nil, errUnsupportedCompression
+	}
+	if c.compressor == nil {
+		return nil, errors.New("sturdyc: the record is compressed, but no compressor has been configured")
+	}
+	return c.compressor.Decompress(data[len(compressionHeader):])
+}
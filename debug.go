@@ -0,0 +1,66 @@
+package sturdyc
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+)
+
+// DebugInfo is the document that is served by the handler of DebugHandler.
+type DebugInfo struct {
+	// Size is the current number of entries in the cache.
+	Size int `json:"size"`
+	// Stats holds the statistics of the entire cache.
+	Stats Stats `json:"stats"`
+	// Shards holds the statistics of each shard.
+	Shards []ShardStat `json:"shards"`
+	// Keys is a sample of the keys in the cache. It's only included
+	// if the keys query parameter has been set.
+	Keys []string `json:"keys,omitempty"`
+}
+
+// DebugHandler returns a read-only http.Handler that serves the size and the
+// statistics of the cache as JSON, which makes it possible to inspect a
+// running client by mounting it at something like /debug/cache. The keys are
+// left out by default because collecting them has to lock every shard. You
+// can include a sample of them by setting the keys query parameter to the
+// maximum number of keys that you want the response to contain.
+//
+// Returns:
+//
+//	An http.Handler that responds to GET and HEAD requests.
+func (c *Client[T]) DebugHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		maxKeys := 0
+		if param := r.URL.Query().Get("keys"); param != "" {
+			n, err := strconv.Atoi(param)
+			if err != nil || n < 1 {
+				http.Error(w, "keys must be a positive integer", http.StatusBadRequest)
+				return
+			}
+			maxKeys = n
+		}
+
+		stats := c.Stats()
+		info := DebugInfo{Size: stats.Size, Stats: stats, Shards: c.ShardStats()}
+		if maxKeys > 0 {
+			info.Keys = make([]string, 0, min(maxKeys, stats.Size))
+			c.ForEachKey(func(key string) bool {
+				info.Keys = append(info.Keys, key)
+				return len(info.Keys) < maxKeys
+			})
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(info); err != nil {
+			c.log.Error(fmt.Sprintf("sturdyc: error encoding the debug info: %v", err))
+		}
+	})
+}
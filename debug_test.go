@@ -0,0 +1,77 @@
+package sturdyc_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/creativecreature/sturdyc"
+)
+
+func TestDebugHandlerServesTheStatisticsOfTheCache(t *testing.T) {
+	t.Parallel()
+
+	c := sturdyc.New[int](100, 4, time.Hour, 10, sturdyc.WithNoContinuousEvictions())
+	for i := 0; i < 10; i++ {
+		c.Set(strconv.Itoa(i), i)
+	}
+	c.Get("1")
+	c.Get("missing")
+
+	rec := httptest.NewRecorder()
+	c.DebugHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/debug/cache", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", rec.Code)
+	}
+
+	var info sturdyc.DebugInfo
+	if err := json.Unmarshal(rec.Body.Bytes(), &info); err != nil {
+		t.Fatal(err)
+	}
+	if info.Size != 10 {
+		t.Errorf("expected the size to be 10, got %d", info.Size)
+	}
+	if info.Stats.Hits != 1 || info.Stats.Misses != 1 {
+		t.Errorf("expected one hit and one miss, got %d and %d", info.Stats.Hits, info.Stats.Misses)
+	}
+	if len(info.Shards) != 4 {
+		t.Errorf("expected the statistics of 4 shards, got %d", len(info.Shards))
+	}
+	if info.Keys != nil {
+		t.Errorf("expected the keys to be left out by default, got %v", info.Keys)
+	}
+}
+
+func TestDebugHandlerIncludesASampleOfTheKeys(t *testing.T) {
+	t.Parallel()
+
+	c := sturdyc.New[int](100, 4, time.Hour, 10, sturdyc.WithNoContinuousEvictions())
+	for i := 0; i < 10; i++ {
+		c.Set(strconv.Itoa(i), i)
+	}
+
+	rec := httptest.NewRecorder()
+	c.DebugHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/debug/cache?keys=3", nil))
+	var info sturdyc.DebugInfo
+	if err := json.Unmarshal(rec.Body.Bytes(), &info); err != nil {
+		t.Fatal(err)
+	}
+	if len(info.Keys) != 3 {
+		t.Errorf("expected 3 keys, got %v", info.Keys)
+	}
+
+	rec = httptest.NewRecorder()
+	c.DebugHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/debug/cache?keys=all", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("expected status 400 for an invalid limit, got %d", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	c.DebugHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/debug/cache", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("expected status 405 for a write, got %d", rec.Code)
+	}
+}
@@ -2,10 +2,10 @@ package sturdyc
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"maps"
+	"sync/atomic"
 	"time"
 )
 
@@ -31,13 +31,22 @@ type DistributedStorage interface {
 // note that you are responsible for setting the TTL and eviction policy of
 // this storage. The cache will only call the delete functions when it performs
 // a refresh and notices that the record has been deleted at the underlying
-// data source.
+// data source, or when the client has been configured with
+// WithDistributedInvalidation and the keys are deleted from the cache.
 type DistributedStorageWithDeletions interface {
 	DistributedStorage
 	Delete(ctx context.Context, key string)
 	DeleteBatch(ctx context.Context, keys []string)
 }
 
+// DistributedStorageWithTTL can be implemented by a distributed storage to
+// receive the TTL of WithDistributedTTL with every write. The cache calls
+// these functions instead of Set and SetBatch when that option is used.
+type DistributedStorageWithTTL interface {
+	SetWithTTL(ctx context.Context, key string, value []byte, ttl time.Duration)
+	SetBatchWithTTL(ctx context.Context, records map[string][]byte, ttl time.Duration)
+}
+
 // distributedStorage adds noop implementations for the delete functions so
 // that the cache doesn't have to deal with multiple storage types.
 type distributedStorage struct {
@@ -52,41 +61,207 @@ func (d *distributedStorage) Delete(_ context.Context, _ string) {
 func (d *distributedStorage) DeleteBatch(_ context.Context, _ []string) {
 }
 
-func marshalRecord[V, T any](value V, c *Client[T]) ([]byte, error) {
+// deletionStorage returns the storage that the deletions of
+// WithDistributedInvalidation are sent to. A storage that was passed to
+// WithDistributedStorage is used if it happens to implement the delete
+// functions.
+func (c *Config) deletionStorage() (DistributedStorageWithDeletions, bool) {
+	if s, ok := c.distributedStorage.(*distributedStorage); ok {
+		storage, ok := s.DistributedStorage.(DistributedStorageWithDeletions)
+		return storage, ok
+	}
+	return c.distributedStorage, c.distributedStorage != nil
+}
+
+// ttlStorage returns the storage that the writes of WithDistributedTTL are
+// sent to, if the storage that the client was configured with implements it.
+func (c *Config) ttlStorage() (DistributedStorageWithTTL, bool) {
+	var storage any = c.distributedStorage
+	if s, ok := storage.(*distributedStorage); ok {
+		storage = s.DistributedStorage
+	}
+	ttlStorage, ok := storage.(DistributedStorageWithTTL)
+	return ttlStorage, ok
+}
+
+// distributedSet writes the record to the distributed storage, with the TTL
+// of WithDistributedTTL if the client has been configured with one.
+func (c *Client[T]) distributedSet(ctx context.Context, key string, bytes []byte) {
+	if storage, ok := c.ttlStorage(); ok && c.useDistributedTTL {
+		storage.SetWithTTL(ctx, key, bytes, c.distributedTTL)
+		return
+	}
+	c.distributedStorage.Set(ctx, key, bytes)
+}
+
+// distributedSetBatch is the batch equivalent of distributedSet.
+func (c *Client[T]) distributedSetBatch(ctx context.Context, records map[string][]byte) {
+	if storage, ok := c.ttlStorage(); ok && c.useDistributedTTL {
+		storage.SetBatchWithTTL(ctx, records, c.distributedTTL)
+		return
+	}
+	c.distributedStorage.SetBatch(ctx, records)
+}
+
+// invalidateDistributed deletes the keys from the distributed storage if the
+// client has been configured with WithDistributedInvalidation. The failures
+// go to the error handler, and they never affect the local deletion.
+func (c *Client[T]) invalidateDistributed(keys []string) {
+	if !c.distributedInvalidation || len(keys) == 0 {
+		return
+	}
+	storage, _ := c.deletionStorage()
+	c.storageCall(context.Background(), distributedOpDelete, keys, func(ctx context.Context) {
+		if len(keys) == 1 {
+			storage.Delete(ctx, keys[0])
+			return
+		}
+		storage.DeleteBatch(ctx, keys)
+	})
+}
+
+// The operations that are passed to the WithDistributedStorageErrorHandler callback.
+const (
+	distributedOpGet    = "get"
+	distributedOpSet    = "set"
+	distributedOpDelete = "delete"
+)
+
+type storageErrorReporterKey struct{}
+
+// storageErrorReporter is attached to the context that is passed to the
+// distributed storage, which allows the storage to report its failures.
+type storageErrorReporter struct {
+	op      string
+	keys    []string
+	handler func(op, key string, err error)
+	failed  atomic.Bool
+}
+
+// ReportDistributedStorageError can be called by a DistributedStorage
+// implementation to report that an operation failed, for example because the
+// connection to the storage was lost. The context has to be the one that the
+// cache passed to the storage. The error is forwarded to the handler of the
+// WithDistributedStorageErrorHandler option, once for every key of the
+// operation, and the call is a noop if no handler has been configured.
+func ReportDistributedStorageError(ctx context.Context, err error) {
+	reporter, ok := ctx.Value(storageErrorReporterKey{}).(*storageErrorReporter)
+	if !ok || err == nil {
+		return
+	}
+	reporter.failed.Store(true)
+	if reporter.handler == nil {
+		return
+	}
+	for _, key := range reporter.keys {
+		reporter.handler(reporter.op, key, err)
+	}
+}
+
+func (c *Client[T]) reportDistributedError(op string, keys []string, err error) {
+	if c.distributedErrorHandler == nil {
+		return
+	}
+	for _, key := range keys {
+		c.distributedErrorHandler(op, key, err)
+	}
+}
+
+// storageCall invokes fn with a context that the storage can use to report
+// its failures. Panics are recovered and reported as well, which allows the
+// cache to carry on as if the keys were missing from the distributed storage.
+// The returned boolean is true if the call failed, which lets the callers
+// tell a failure apart from keys that are actually missing.
+func (c *Client[T]) storageCall(ctx context.Context, op string, keys []string, fn func(ctx context.Context)) (failed bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			err := fmt.Errorf("sturdyc: panic recovered: %v", r)
+			c.log.Error(err.Error())
+			c.reportDistributedError(op, keys, err)
+			failed = true
+		}
+	}()
+	reporter := &storageErrorReporter{
+		op:      op,
+		keys:    keys,
+		handler: c.distributedErrorHandler,
+	}
+	fn(context.WithValue(ctx, storageErrorReporterKey{}, reporter))
+	return reporter.failed.Load()
+}
+
+func marshalRecord[V, T any](value V, key string, c *Client[T]) ([]byte, error) {
 	record := distributedRecord[V]{CreatedAt: c.clock.Now(), Value: value, IsMissingRecord: false}
-	bytes, err := json.Marshal(record)
+	bytes, err := c.codec.Marshal(record)
+	if err == nil {
+		bytes, err = c.compress(bytes)
+	}
 	if err != nil {
 		c.log.Error(fmt.Sprintf("sturdyc: error marshalling record: %v", err))
+		c.reportDistributedError(distributedOpSet, []string{key}, err)
 	}
 	return bytes, err
 }
 
-func marshalMissingRecord[V, T any](c *Client[T]) ([]byte, error) {
+func marshalMissingRecord[V, T any](key string, c *Client[T]) ([]byte, error) {
 	var missingRecord distributedRecord[V]
 	missingRecord.CreatedAt = c.clock.Now()
 	missingRecord.IsMissingRecord = true
-	bytes, err := json.Marshal(missingRecord)
+	bytes, err := c.codec.Marshal(missingRecord)
+	if err == nil {
+		bytes, err = c.compress(bytes)
+	}
 	if err != nil {
 		c.log.Error(fmt.Sprintf("sturdyc: error marshalling missing record: %v", err))
+		c.reportDistributedError(distributedOpSet, []string{key}, err)
 	}
 	return bytes, err
 }
 
-func unmarshalRecord[V any](bytes []byte, key string, log Logger) (distributedRecord[V], error) {
+func unmarshalRecord[V, T any](bytes []byte, key string, c *Client[T]) (distributedRecord[V], error) {
 	var record distributedRecord[V]
-	unmarshalErr := json.Unmarshal(bytes, &record)
+	bytes, unmarshalErr := c.decompress(bytes)
+	if unmarshalErr == nil {
+		unmarshalErr = c.codec.Unmarshal(bytes, &record)
+	}
 	if unmarshalErr != nil {
-		log.Error("sturdyc: error unmarshalling key: " + key)
+		c.log.Error("sturdyc: error unmarshalling key: " + key)
+		c.reportDistributedError(distributedOpGet, []string{key}, unmarshalErr)
 	}
 	return record, unmarshalErr
 }
 
-func writeMissingRecord[V, T any](c *Client[T], key string) {
+// isOutdated reports whether the value that was fetched from the underlying
+// data source has an older version than the one in the distributed storage.
+// It's always false if the client hasn't been configured with WithVersionFn.
+func isOutdated[V, T any](c *Client[T], fetched, stored V) bool {
+	versionFn := c.shards[0].versionFn
+	if versionFn == nil {
+		return false
+	}
+	fetchedValue, okFetched := any(fetched).(T)
+	storedValue, okStored := any(stored).(T)
+	if !okFetched || !okStored {
+		return false
+	}
+	return versionFn(fetchedValue) < versionFn(storedValue)
+}
+
+// writeMissingRecord encodes the missing record straight away, so that an
+// error from the codec can be returned to the caller, and writes it to the
+// distributed storage in the background.
+func writeMissingRecord[V, T any](c *Client[T], key string) error {
+	missingRecordBytes, err := marshalMissingRecord[V](key, c)
+	if err != nil {
+		return err
+	}
 	c.safeGo(func() {
-		if missingRecordBytes, missingRecordErr := marshalMissingRecord[V](c); missingRecordErr == nil {
-			c.distributedStorage.Set(context.Background(), key, missingRecordBytes)
-		}
+		c.addToLookupFilter(key)
+		c.storageCall(context.Background(), distributedOpSet, []string{key}, func(ctx context.Context) {
+			c.distributedSet(ctx, key, missingRecordBytes)
+		})
 	})
+	return nil
 }
 
 func distributedFetch[V, T any](c *Client[T], key string, fetchFn FetchFn[V]) FetchFn[V] {
@@ -96,10 +271,17 @@ func distributedFetch[V, T any](c *Client[T], key string, fetchFn FetchFn[V]) Fe
 
 	return func(ctx context.Context) (V, error) {
 		stale, hasStale := *new(V), false
-		bytes, ok := c.distributedStorage.Get(ctx, key)
+		var bytes []byte
+		var ok bool
+		// The lookup is skipped for keys that are known to be absent, and for bypasses.
+		if !c.skipDistributedLookup(key) && !isBypassed(ctx) {
+			c.storageCall(ctx, distributedOpGet, []string{key}, func(ctx context.Context) {
+				bytes, ok = c.distributedStorage.Get(ctx, key)
+			})
+		}
 		if ok {
 			c.reportDistributedCacheHit(true)
-			record, unmarshalErr := unmarshalRecord[V](bytes, key, c.log)
+			record, unmarshalErr := unmarshalRecord[V](bytes, key, c)
 			if unmarshalErr != nil {
 				return record.Value, unmarshalErr
 			}
@@ -122,23 +304,38 @@ func distributedFetch[V, T any](c *Client[T], key string, fetchFn FetchFn[V]) Fe
 
 		// If it's not fresh enough, we'll retrieve it from the source.
 		response, fetchErr := fetchFn(ctx)
+		if fetchErr == nil && hasStale && isOutdated(c, response, stale) {
+			// Another writer has already stored a newer version of the record.
+			return stale, nil
+		}
 		if fetchErr == nil {
+			// The record is encoded before we return, which allows the
+			// caller to see the errors of the codec.
+			recordBytes, marshalErr := marshalRecord[V](response, key, c)
+			if marshalErr != nil {
+				return response, marshalErr
+			}
 			c.safeGo(func() {
-				if recordBytes, marshalErr := marshalRecord[V](response, c); marshalErr == nil {
-					c.distributedStorage.Set(context.Background(), key, recordBytes)
-				}
+				c.addToLookupFilter(key)
+				c.storageCall(context.Background(), distributedOpSet, []string{key}, func(ctx context.Context) {
+					c.distributedSet(ctx, key, recordBytes)
+				})
 			})
 			return response, nil
 		}
 
 		if errors.Is(fetchErr, ErrNotFound) {
 			if c.storeMissingRecords {
-				writeMissingRecord[V](c, key)
+				if marshalErr := writeMissingRecord[V](c, key); marshalErr != nil {
+					return response, marshalErr
+				}
 				return response, fetchErr
 			}
 			if hasStale {
 				c.safeGo(func() {
-					c.distributedStorage.Delete(context.Background(), key)
+					c.storageCall(context.Background(), distributedOpDelete, []string{key}, func(ctx context.Context) {
+						c.distributedStorage.Delete(ctx, key)
+					})
 				})
 			}
 			return response, fetchErr
@@ -165,10 +362,19 @@ func distributedBatchFetch[V, T any](c *Client[T], keyFn KeyFn, fetchFn BatchFet
 		for _, id := range ids {
 			key := keyFn(id)
 			keyIDMap[key] = id
+			// The lookup is skipped for keys that are known to be absent, and for bypasses.
+			if c.skipDistributedLookup(key) || isBypassed(ctx) {
+				continue
+			}
 			keys = append(keys, key)
 		}
 
-		distributedRecords := c.distributedStorage.GetBatch(ctx, keys)
+		distributedRecords := make(map[string][]byte)
+		if len(keys) > 0 {
+			c.storageCall(ctx, distributedOpGet, keys, func(ctx context.Context) {
+				distributedRecords = c.distributedStorage.GetBatch(ctx, keys)
+			})
+		}
 		// Group the records we got from the distributed storage into fresh/stale maps.
 		fresh := make(map[string]V, len(ids))
 		stale := make(map[string]V, len(ids))
@@ -185,7 +391,7 @@ func distributedBatchFetch[V, T any](c *Client[T], keyFn KeyFn, fetchFn BatchFet
 			}
 
 			c.reportDistributedCacheHit(true)
-			record, unmarshalErr := unmarshalRecord[V](bytes, key, c.log)
+			record, unmarshalErr := unmarshalRecord[V](bytes, key, c)
 			if unmarshalErr != nil {
 				idsToRefresh = append(idsToRefresh, id)
 				continue
@@ -218,6 +424,15 @@ func distributedBatchFetch[V, T any](c *Client[T], keyFn KeyFn, fetchFn BatchFet
 		}
 
 		dataSourceResponses, err := fetchFn(ctx, idsToRefresh)
+		// A partial batch fetch fails for some of the IDs, while the records
+		// of the others can be written to the distributed storage as usual.
+		var idErrs batchErrors
+		if errors.As(err, &idErrs) {
+			idErrs, err = maps.Clone(idErrs), nil
+			if dataSourceResponses == nil {
+				dataSourceResponses = make(map[string]V)
+			}
+		}
 		// In case of an error, we'll proceed with the ones we got from the distributed storage.
 		if err != nil {
 			for i := 0; i < len(stale); i++ {
@@ -236,15 +451,30 @@ func distributedBatchFetch[V, T any](c *Client[T], keyFn KeyFn, fetchFn BatchFet
 			response, ok := dataSourceResponses[id]
 
 			if ok {
-				if recordBytes, marshalErr := marshalRecord[V](response, c); marshalErr == nil {
+				if storedValue, okStale := stale[id]; okStale && isOutdated(c, response, storedValue) {
+					// Another writer has already stored a newer version of the record.
+					dataSourceResponses[id] = storedValue
+					continue
+				}
+				if recordBytes, marshalErr := marshalRecord[V](response, key, c); marshalErr == nil {
 					recordsToWrite[key] = recordBytes
 				}
 				continue
 			}
 
+			// The IDs that failed fall back to the records of the distributed storage, if there are any.
+			if idErr, failed := idErrs[id]; failed && !errors.Is(idErr, ErrNotFound) {
+				if storedValue, okStale := stale[id]; okStale {
+					c.reportDistributedStaleFallback()
+					dataSourceResponses[id] = storedValue
+					delete(idErrs, id)
+				}
+				continue
+			}
+
 			// At this point, we know that we weren't able to retrieve this ID from the underlying data source.
 			if c.storeMissingRecords {
-				if bytes, err := marshalMissingRecord[V](c); err == nil {
+				if bytes, err := marshalMissingRecord[V](key, c); err == nil {
 					recordsToWrite[key] = bytes
 				}
 				continue
@@ -258,17 +488,29 @@ func distributedBatchFetch[V, T any](c *Client[T], keyFn KeyFn, fetchFn BatchFet
 
 		if len(keysToDelete) > 0 {
 			c.safeGo(func() {
-				c.distributedStorage.DeleteBatch(context.Background(), keysToDelete)
+				c.storageCall(context.Background(), distributedOpDelete, keysToDelete, func(ctx context.Context) {
+					c.distributedStorage.DeleteBatch(ctx, keysToDelete)
+				})
 			})
 		}
 
 		if len(recordsToWrite) > 0 {
 			c.safeGo(func() {
-				c.distributedStorage.SetBatch(context.Background(), recordsToWrite)
+				keys := make([]string, 0, len(recordsToWrite))
+				for key := range recordsToWrite {
+					c.addToLookupFilter(key)
+					keys = append(keys, key)
+				}
+				c.storageCall(context.Background(), distributedOpSet, keys, func(ctx context.Context) {
+					c.distributedSetBatch(ctx, recordsToWrite)
+				})
 			})
 		}
 
 		maps.Copy(fresh, dataSourceResponses)
+		if len(idErrs) > 0 {
+			return fresh, idErrs
+		}
 		return fresh, nil
 	}
 }
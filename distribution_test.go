@@ -1,9 +1,16 @@
 package sturdyc_test
 
 import (
+	"bytes"
 	"context"
+	"encoding/gob"
+	"encoding/json"
 	"errors"
+	"slices"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -696,3 +703,707 @@ func TestDistributedStorageBatchConverstToMissingRecord(t *testing.T) {
 	time.Sleep(50 * time.Millisecond)
 	fetchObserver.AssertFetchCount(t, 3)
 }
+
+type gobCodec struct{}
+
+func (gobCodec) Marshal(v any) ([]byte, error) {
+	var buf bytes.Buffer
+	err := gob.NewEncoder(&buf).Encode(v)
+	return buf.Bytes(), err
+}
+
+func (gobCodec) Unmarshal(data []byte, v any) error {
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(v)
+}
+
+type failingCodec struct {
+	sturdyc.JSONCodec
+}
+
+var errEncoding = errors.New("encoding failed")
+
+func (failingCodec) Marshal(any) ([]byte, error) {
+	return nil, errEncoding
+}
+
+func TestCodecErrorsAreReturnedFromGetOrFetch(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	distributedStorage := &mockStorage{}
+	c := sturdyc.New[string](1000, 10, time.Minute, 30,
+		sturdyc.WithNoContinuousEvictions(),
+		sturdyc.WithDistributedStorage(distributedStorage),
+		sturdyc.WithCodec(failingCodec{}),
+	)
+
+	fetchFn := func(context.Context) (string, error) {
+		return "value", nil
+	}
+	if _, err := c.GetOrFetch(ctx, "key", fetchFn); !errors.Is(err, errEncoding) {
+		t.Errorf("expected the error of the codec to be returned, got %v", err)
+	}
+	if c.Exists("key") {
+		t.Error("expected the value to not be cached")
+	}
+}
+
+func TestDistributedStorageWithCustomCodec(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	distributedStorage := &mockStorage{}
+	c := sturdyc.New[string](1000, 10, time.Minute, 30,
+		sturdyc.WithNoContinuousEvictions(),
+		sturdyc.WithDistributedStorage(distributedStorage),
+		sturdyc.WithCodec(gobCodec{}),
+	)
+	fetchObserver := NewFetchObserver(1)
+
+	key := "key1"
+	fetchObserver.Response(key)
+	_, err := sturdyc.GetOrFetch(ctx, c, key, fetchObserver.Fetch)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	<-fetchObserver.FetchCompleted
+
+	// The keys are written asynchonously, to the distributed storage.
+	time.Sleep(100 * time.Millisecond)
+	distributedStorage.assertRecord(t, key)
+
+	// The record should have been encoded with the custom codec.
+	distributedStorage.Lock()
+	recordBytes := distributedStorage.records[key]
+	distributedStorage.Unlock()
+	if json.Valid(recordBytes) {
+		t.Error("expected the record to be encoded with the custom codec")
+	}
+
+	// Delete the record from memory, and verify that it can be decoded from the distributed storage.
+	c.Delete(key)
+	res, err := sturdyc.GetOrFetch(ctx, c, key, fetchObserver.Fetch)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if res != "valuekey1" {
+		t.Errorf("expected valuekey1, got %s", res)
+	}
+	fetchObserver.AssertFetchCount(t, 1)
+}
+
+func TestDistributedStorageWithCompression(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	distributedStorage := &mockStorage{}
+	c := sturdyc.New[string](1000, 10, time.Minute, 30,
+		sturdyc.WithNoContinuousEvictions(),
+		sturdyc.WithDistributedStorage(distributedStorage),
+		sturdyc.WithCompression(sturdyc.GzipCompressor{}),
+	)
+	fetchObserver := NewFetchObserver(1)
+
+	key := "key1"
+	fetchObserver.Response(key)
+	_, err := sturdyc.GetOrFetch(ctx, c, key, fetchObserver.Fetch)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	<-fetchObserver.FetchCompleted
+
+	// The keys are written asynchonously, to the distributed storage.
+	time.Sleep(100 * time.Millisecond)
+	distributedStorage.assertRecord(t, key)
+
+	distributedStorage.Lock()
+	recordBytes := distributedStorage.records[key]
+	distributedStorage.Unlock()
+	if json.Valid(recordBytes) {
+		t.Error("expected the record to be compressed")
+	}
+
+	// Delete the record from memory, and verify that it can be decompressed from the distributed storage.
+	c.Delete(key)
+	res, err := sturdyc.GetOrFetch(ctx, c, key, fetchObserver.Fetch)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if res != "valuekey1" {
+		t.Errorf("expected valuekey1, got %s", res)
+	}
+	fetchObserver.AssertFetchCount(t, 1)
+}
+
+func TestDistributedStorageWithCompressionReadsUncompressedRecords(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	distributedStorage := &mockStorage{}
+	withoutCompression := sturdyc.New[string](1000, 10, time.Minute, 30,
+		sturdyc.WithNoContinuousEvictions(),
+		sturdyc.WithDistributedStorage(distributedStorage),
+	)
+	fetchObserver := NewFetchObserver(1)
+
+	key := "key1"
+	fetchObserver.Response(key)
+	_, err := sturdyc.GetOrFetch(ctx, withoutCompression, key, fetchObserver.Fetch)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	<-fetchObserver.FetchCompleted
+	time.Sleep(100 * time.Millisecond)
+	distributedStorage.assertRecord(t, key)
+
+	withCompression := sturdyc.New[string](1000, 10, time.Minute, 30,
+		sturdyc.WithNoContinuousEvictions(),
+		sturdyc.WithDistributedStorage(distributedStorage),
+		sturdyc.WithCompression(sturdyc.GzipCompressor{}),
+	)
+	res, err := sturdyc.GetOrFetch(ctx, withCompression, key, fetchObserver.Fetch)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if res != "valuekey1" {
+		t.Errorf("expected valuekey1, got %s", res)
+	}
+	fetchObserver.AssertFetchCount(t, 1)
+}
+
+func TestDistributedStorageSkipsTheKeysThatTheFilterKnowsAreAbsent(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	distributedStorage := &mockStorage{}
+	c := sturdyc.New[string](1000, 10, time.Minute, 30,
+		sturdyc.WithNoContinuousEvictions(),
+		sturdyc.WithDistributedStorage(distributedStorage),
+		sturdyc.WithNegativeLookupFilter(sturdyc.NewBloomFilter(1000, 0.01)),
+	)
+	fetchObserver := NewFetchObserver(1)
+
+	key := "key1"
+	fetchObserver.Response(key)
+	_, err := sturdyc.GetOrFetch(ctx, c, key, fetchObserver.Fetch)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	<-fetchObserver.FetchCompleted
+
+	// The key hasn't been written yet, so the lookup should have been skipped.
+	time.Sleep(100 * time.Millisecond)
+	distributedStorage.assertGetCount(t, 0)
+	distributedStorage.assertRecord(t, key)
+
+	// Once the key has been written, it should be looked up in the distributed storage.
+	c.Delete(key)
+	res, err := sturdyc.GetOrFetch(ctx, c, key, fetchObserver.Fetch)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if res != "valuekey1" {
+		t.Errorf("expected valuekey1, got %s", res)
+	}
+	distributedStorage.assertGetCount(t, 1)
+	fetchObserver.AssertFetchCount(t, 1)
+}
+
+type unavailableStorage struct {
+	mockStorage
+}
+
+func (u *unavailableStorage) Get(ctx context.Context, key string) ([]byte, bool) {
+	sturdyc.ReportDistributedStorageError(ctx, errors.New("connection refused"))
+	return nil, false
+}
+
+func (u *unavailableStorage) GetBatch(ctx context.Context, _ []string) map[string][]byte {
+	sturdyc.ReportDistributedStorageError(ctx, errors.New("connection refused"))
+	return nil
+}
+
+func (u *unavailableStorage) Set(_ context.Context, _ string, _ []byte) {
+	panic("connection refused")
+}
+
+func TestDistributedStorageErrorsAreReportedToTheHandler(t *testing.T) {
+	t.Parallel()
+
+	var mu sync.Mutex
+	var reportedOps []string
+	ctx := context.Background()
+	c := sturdyc.New[string](1000, 10, time.Minute, 30,
+		sturdyc.WithNoContinuousEvictions(),
+		sturdyc.WithDistributedStorage(&unavailableStorage{}),
+		sturdyc.WithDistributedStorageErrorHandler(func(op, key string, err error) {
+			mu.Lock()
+			defer mu.Unlock()
+			if key != "key1" || err == nil {
+				t.Errorf("unexpected report for key %s: %v", key, err)
+			}
+			reportedOps = append(reportedOps, op)
+		}),
+	)
+	fetchObserver := NewFetchObserver(1)
+	fetchObserver.Response("key1")
+
+	// The request should be served by the underlying data source.
+	res, err := sturdyc.GetOrFetch(ctx, c, "key1", fetchObserver.Fetch)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if res != "valuekey1" {
+		t.Errorf("expected valuekey1, got %s", res)
+	}
+	<-fetchObserver.FetchCompleted
+	fetchObserver.AssertFetchCount(t, 1)
+
+	// The write happens in the background.
+	time.Sleep(100 * time.Millisecond)
+	mu.Lock()
+	defer mu.Unlock()
+	if len(reportedOps) != 2 || reportedOps[0] != "get" || reportedOps[1] != "set" {
+		t.Errorf("expected a get and a set failure, got %v", reportedOps)
+	}
+}
+
+func TestDistributedInvalidationDeletesTheKeysFromTheStorage(t *testing.T) {
+	t.Parallel()
+
+	distributedStorage := &mockStorage{}
+	c := sturdyc.New[string](1000, 10, time.Minute, 30,
+		sturdyc.WithNoContinuousEvictions(),
+		sturdyc.WithDistributedStorage(distributedStorage),
+		sturdyc.WithDistributedInvalidation(),
+	)
+
+	for _, key := range []string{"key1", "key2", "key3"} {
+		c.Set(key, "value")
+		distributedStorage.Set(context.Background(), key, []byte("value"))
+	}
+
+	c.Delete("key1")
+	distributedStorage.assertDeleteCount(t, 1)
+	if n := c.DeleteMany([]string{"key2", "key3"}); n != 2 {
+		t.Errorf("expected 2 local deletions, got %d", n)
+	}
+	distributedStorage.assertDeleteCount(t, 3)
+
+	c.Set("prefix-1", "value")
+	c.SetWithTags("tagged", "value", "tag")
+	for _, key := range []string{"prefix-1", "tagged"} {
+		distributedStorage.Set(context.Background(), key, []byte("value"))
+	}
+	if n := c.DeleteByPrefix("prefix-"); n != 1 {
+		t.Errorf("expected 1 local deletion, got %d", n)
+	}
+	distributedStorage.assertDeleteCount(t, 4)
+	if n := c.InvalidateTag("tag"); n != 1 {
+		t.Errorf("expected 1 local deletion, got %d", n)
+	}
+	distributedStorage.assertDeleteCount(t, 5)
+
+	distributedStorage.Lock()
+	defer distributedStorage.Unlock()
+	if len(distributedStorage.records) != 0 {
+		t.Errorf("expected the keys to be deleted from the distributed storage, got %d records", len(distributedStorage.records))
+	}
+}
+
+func TestDistributedInvalidationFailuresDontAffectTheLocalDelete(t *testing.T) {
+	t.Parallel()
+
+	var reported []string
+	c := sturdyc.New[string](1000, 10, time.Minute, 30,
+		sturdyc.WithNoContinuousEvictions(),
+		sturdyc.WithDistributedStorage(&failingDeletionStorage{}),
+		sturdyc.WithDistributedInvalidation(),
+		sturdyc.WithDistributedStorageErrorHandler(func(op, key string, _ error) {
+			reported = append(reported, op+":"+key)
+		}),
+	)
+
+	c.Set("key1", "value")
+	c.Delete("key1")
+	if _, ok := c.Get("key1"); ok {
+		t.Error("expected the key to be deleted locally")
+	}
+	if len(reported) != 1 || reported[0] != "delete:key1" {
+		t.Errorf("expected the failed deletion to be reported, got %v", reported)
+	}
+}
+
+type failingDeletionStorage struct {
+	mockStorage
+}
+
+func (f *failingDeletionStorage) Delete(_ context.Context, _ string) {
+	panic("connection refused")
+}
+
+func TestVersionFnKeepsNewerRecordsInTheDistributedStorage(t *testing.T) {
+	t.Parallel()
+
+	clock := sturdyc.NewTestClock(time.Now())
+	ctx := context.Background()
+	distributedStorage := &mockStorage{}
+	versionFn := func(v string) uint64 {
+		version, _ := strconv.ParseUint(strings.TrimPrefix(v, "v"), 10, 64)
+		return version
+	}
+	c := sturdyc.New[string](1000, 10, time.Minute, 30,
+		sturdyc.WithNoContinuousEvictions(),
+		sturdyc.WithClock(clock),
+		sturdyc.WithDistributedStorageEarlyRefreshes(distributedStorage, time.Minute),
+		sturdyc.WithVersionFn(versionFn),
+	)
+
+	_, err := c.GetOrFetch(ctx, "key1", func(context.Context) (string, error) { return "v2", nil })
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	distributedStorage.assertSetCount(t, 1)
+
+	// Make the record expire in memory, and stale in the distributed storage.
+	// The data source then responds with an older version than the stored one.
+	clock.Add(time.Minute * 2)
+	res, err := c.GetOrFetch(ctx, "key1", func(context.Context) (string, error) { return "v1", nil })
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if res != "v2" {
+		t.Errorf("expected the newer version from the distributed storage, got %s", res)
+	}
+	time.Sleep(50 * time.Millisecond)
+	distributedStorage.assertSetCount(t, 1)
+}
+
+type ttlStorage struct {
+	mockStorage
+	ttls chan time.Duration
+}
+
+func (s *ttlStorage) SetWithTTL(ctx context.Context, key string, value []byte, ttl time.Duration) {
+	s.Set(ctx, key, value)
+	s.ttls <- ttl
+}
+
+func (s *ttlStorage) SetBatchWithTTL(ctx context.Context, records map[string][]byte, ttl time.Duration) {
+	s.SetBatch(ctx, records)
+	s.ttls <- ttl
+}
+
+func TestDistributedTTLIsPassedToTheStorage(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	clock := sturdyc.NewTestClock(time.Now())
+	distributedStorage := &ttlStorage{ttls: make(chan time.Duration, 2)}
+	c := sturdyc.New[string](1000, 10, time.Minute, 30,
+		sturdyc.WithNoContinuousEvictions(),
+		sturdyc.WithClock(clock),
+		sturdyc.WithDistributedStorage(distributedStorage),
+		sturdyc.WithDistributedTTL(time.Hour),
+	)
+
+	_, err := c.GetOrFetch(ctx, "key1", func(context.Context) (string, error) { return "value", nil })
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	_, err = c.GetOrFetchBatch(ctx, []string{"2", "3"}, c.BatchKeyFn("key"), func(_ context.Context, ids []string) (map[string]string, error) {
+		return map[string]string{"2": "value", "3": "value"}, nil
+	})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		select {
+		case ttl := <-distributedStorage.ttls:
+			if ttl != time.Hour {
+				t.Errorf("expected the distributed TTL to be an hour, got %v", ttl)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("expected the records to be written with the distributed TTL")
+		}
+	}
+	distributedStorage.assertRecord(t, "key1")
+
+	// The entries in memory still expire after the TTL of the client.
+	clock.Add(time.Minute + time.Second)
+	if _, ok := c.Get("key1"); ok {
+		t.Error("expected the entry in memory to have expired")
+	}
+}
+
+func TestDistributedReconciliationEvictsEntriesThatHaveDivergedFromTheStorage(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	clock := sturdyc.NewTestClock(time.Now())
+	distributedStorage := &mockStorage{}
+	c := sturdyc.New[string](1000, 10, time.Hour, 30,
+		sturdyc.WithNoContinuousEvictions(),
+		sturdyc.WithClock(clock),
+		sturdyc.WithDistributedStorage(distributedStorage),
+		sturdyc.WithDistributedReconciliation(time.Minute, 10),
+	)
+
+	for _, key := range []string{"deleted", "changed", "unchanged"} {
+		_, err := c.GetOrFetch(ctx, key, func(context.Context) (string, error) { return "value", nil })
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+	}
+	waitFor(t, func() bool {
+		distributedStorage.Lock()
+		defer distributedStorage.Unlock()
+		return len(distributedStorage.records) == 3
+	})
+
+	distributedStorage.Delete(ctx, "deleted")
+	distributedStorage.Set(ctx, "changed", []byte(`{"created_at":"2024-01-01T00:00:00Z","value":"new value","is_missing_record":false}`))
+
+	clock.BlockUntilTickers(1)
+	clock.Advance(time.Minute)
+	clock.Flush()
+
+	waitFor(t, func() bool {
+		_, deleted := c.Get("deleted")
+		_, changed := c.Get("changed")
+		return !deleted && !changed
+	})
+	if _, ok := c.Get("unchanged"); !ok {
+		t.Error("expected the entry that matches the distributed storage to be kept")
+	}
+}
+
+func TestDistributedReconciliationKeepsTheEntriesIfTheStorageFails(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	clock := sturdyc.NewTestClock(time.Now())
+	distributedStorage := &unavailableStorage{}
+	var failures atomic.Int32
+	c := sturdyc.New[string](1000, 10, time.Hour, 30,
+		sturdyc.WithNoContinuousEvictions(),
+		sturdyc.WithClock(clock),
+		sturdyc.WithDistributedStorage(distributedStorage),
+		sturdyc.WithDistributedStorageErrorHandler(func(op, _ string, _ error) {
+			if op == "get" {
+				failures.Add(1)
+			}
+		}),
+		sturdyc.WithDistributedReconciliation(time.Minute, 10),
+	)
+
+	_, err := c.GetOrFetch(ctx, "key", func(context.Context) (string, error) { return "value", nil })
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	before := failures.Load()
+
+	clock.BlockUntilTickers(1)
+	clock.Advance(time.Minute)
+	clock.Flush()
+
+	waitFor(t, func() bool { return failures.Load() > before })
+	if _, ok := c.Get("key"); !ok {
+		t.Error("expected the entry to be kept when the distributed storage fails")
+	}
+}
+
+func TestWriteBehindFlushesTheWritesInBatches(t *testing.T) {
+	t.Parallel()
+
+	clock := sturdyc.NewTestClock(time.Now())
+	distributedStorage := &mockStorage{}
+	c := sturdyc.New[string](1000, 1, time.Hour, 30,
+		sturdyc.WithNoContinuousEvictions(),
+		sturdyc.WithClock(clock),
+		sturdyc.WithDistributedStorage(distributedStorage),
+		sturdyc.WithWriteBehind(2, time.Minute),
+	)
+
+	// The writes are applied in memory right away, and flushed once the batch is full.
+	c.Set("key1", "value")
+	if _, ok := c.Get("key1"); !ok {
+		t.Fatal("expected the write to be applied in memory")
+	}
+	distributedStorage.assertSetCount(t, 0)
+	c.Set("key2", "value")
+	waitFor(t, func() bool {
+		distributedStorage.Lock()
+		defer distributedStorage.Unlock()
+		return distributedStorage.setCount == 1
+	})
+	distributedStorage.assertRecords(t, []string{"key1", "key2"}, func(id string) string { return id })
+
+	// The writes of a partial batch are flushed by the interval.
+	c.Set("key3", "value")
+	clock.BlockUntilTickers(1)
+	clock.Advance(time.Minute)
+	clock.Flush()
+	waitFor(t, func() bool {
+		distributedStorage.Lock()
+		defer distributedStorage.Unlock()
+		return distributedStorage.setCount == 2
+	})
+	distributedStorage.assertRecord(t, "key3")
+
+	// And the remaining ones when the client is closed.
+	c.Set("key4", "value")
+	c.Close()
+	distributedStorage.assertSetCount(t, 3)
+	distributedStorage.assertRecord(t, "key4")
+}
+
+type failingBatchStorage struct {
+	mockStorage
+}
+
+func (f *failingBatchStorage) SetBatch(ctx context.Context, _ map[string][]byte) {
+	sturdyc.ReportDistributedStorageError(ctx, errors.New("connection refused"))
+}
+
+func TestWriteBehindReportsTheFailedWrites(t *testing.T) {
+	t.Parallel()
+
+	var mu sync.Mutex
+	reported := make(map[string]string)
+	c := sturdyc.New[string](1000, 1, time.Hour, 30,
+		sturdyc.WithNoContinuousEvictions(),
+		sturdyc.WithDistributedStorage(&failingBatchStorage{}),
+		sturdyc.WithDistributedStorageErrorHandler(func(op, key string, _ error) {
+			mu.Lock()
+			defer mu.Unlock()
+			reported[key] = op
+		}),
+		sturdyc.WithWriteBehind(10, time.Hour),
+	)
+
+	c.SetMany(map[string]string{"key1": "value", "key2": "value"})
+	c.Close()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(reported) != 2 || reported["key1"] != "set" || reported["key2"] != "set" {
+		t.Errorf("expected the failed writes to be reported, got %v", reported)
+	}
+}
+
+func TestWriteBehindOnlyFlushesTheWritesThatAreStillInTheCache(t *testing.T) {
+	t.Parallel()
+
+	distributedStorage := &mockStorage{}
+	c := sturdyc.New[string](1000, 1, time.Hour, 30,
+		sturdyc.WithNoContinuousEvictions(),
+		sturdyc.WithMaxKeyLength(10),
+		sturdyc.WithDistributedStorage(distributedStorage),
+		sturdyc.WithDistributedInvalidation(),
+		sturdyc.WithWriteBehind(10, time.Hour),
+	)
+
+	c.Set("key1", "value")
+	c.Set("key2", "value")
+	c.SetWithTags("key3", "value", "tag")
+	c.SetMany(map[string]string{"key4": "value", "key5": "value"})
+	c.Set("a-key-that-is-too-long", "value")
+	c.Update("key6", func(string, bool) (string, bool) { return "value", true })
+	c.SetIfAbsent("key7", "value")
+	c.SetIfAbsent("key7", "ignored")
+
+	// The deleted keys shouldn't be written back by the flush.
+	c.Delete("key1")
+	c.InvalidateTag("tag")
+	c.DeleteMany([]string{"key4"})
+	c.Close()
+
+	distributedStorage.Lock()
+	defer distributedStorage.Unlock()
+	keys := make([]string, 0, len(distributedStorage.records))
+	for key := range distributedStorage.records {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	if !slices.Equal(keys, []string{"key2", "key5", "key6", "key7"}) {
+		t.Errorf("expected only the writes that are still in the cache to be flushed, got %v", keys)
+	}
+}
+
+func TestPartialBatchFetchesGoThroughTheDistributedStorage(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	distributedStorage := &mockStorage{}
+	c := sturdyc.New[string](1000, 1, time.Hour, 30,
+		sturdyc.WithNoContinuousEvictions(),
+		sturdyc.WithDistributedStorage(distributedStorage),
+	)
+	keyFn := c.BatchKeyFn("item")
+
+	var calls atomic.Int32
+	fetchFn := func(_ context.Context, ids []string) (map[string]string, map[string]error) {
+		calls.Add(1)
+		res, errs := make(map[string]string), make(map[string]error)
+		for _, id := range ids {
+			if id == "2" {
+				errs[id] = errors.New("unavailable")
+				continue
+			}
+			res[id] = "value" + id
+		}
+		return res, errs
+	}
+
+	res, errs, err := c.GetOrFetchBatchWithErrors(ctx, []string{"1", "2"}, keyFn, fetchFn)
+	if err != nil || res["1"] != "value1" || errs["2"] == nil {
+		t.Fatalf("expected a partial response, got %v, %v and %v", res, errs, err)
+	}
+	waitFor(t, func() bool {
+		distributedStorage.Lock()
+		defer distributedStorage.Unlock()
+		_, ok := distributedStorage.records[keyFn("1")]
+		return ok
+	})
+	distributedStorage.Lock()
+	_, failedWritten := distributedStorage.records[keyFn("2")]
+	distributedStorage.Unlock()
+	if failedWritten {
+		t.Error("expected the ID that failed to not be written to the distributed storage")
+	}
+
+	// Once it's been evicted from memory, the record is read from the distributed storage.
+	c.Delete(keyFn("1"))
+	res, _, err = c.GetOrFetchBatchWithErrors(ctx, []string{"1"}, keyFn, fetchFn)
+	if err != nil || res["1"] != "value1" {
+		t.Fatalf("expected the record to be served, got %v and %v", res, err)
+	}
+	if n := calls.Load(); n != 1 {
+		t.Errorf("expected the record to be read from the distributed storage, got %d calls", n)
+	}
+}
+
+func TestWriteBehindDiscardsThePendingWritesWhenTheCacheIsCleared(t *testing.T) {
+	t.Parallel()
+
+	distributedStorage := &mockStorage{}
+	c := sturdyc.New[string](1000, 1, time.Hour, 30,
+		sturdyc.WithNoContinuousEvictions(),
+		sturdyc.WithDistributedStorage(distributedStorage),
+		sturdyc.WithWriteBehind(10, time.Hour),
+	)
+
+	c.Set("key1", "value")
+	c.Clear()
+	c.Set("key2", "value")
+	c.Close()
+
+	distributedStorage.Lock()
+	defer distributedStorage.Unlock()
+	if _, ok := distributedStorage.records["key1"]; ok || len(distributedStorage.records) != 1 {
+		t.Errorf("expected only the write after the clear to be flushed, got %v", distributedStorage.records)
+	}
+}
@@ -21,6 +21,38 @@ var (
 	// fetch the remaining records failed. As the consumer, you can then decide whether to
 	// proceed with the cached records or if the entire batch is necessary.
 	ErrOnlyCachedRecords = errors.New("sturdyc: failed to fetch the records that were not in the cache")
+	// ErrPartialBatch is returned by client.GetOrFetchBatch together with the
+	// records that could be retrieved when some, but not all, of the chunks of
+	// a client configured with WithBatchChunking failed.
+	ErrPartialBatch = errors.New("sturdyc: failed to fetch some of the chunks in the batch")
+	// ErrStaleRecord is returned by client.GetOrFetch together with an expired
+	// value when the fetchFn fails and the client has been configured with
+	// WithStaleWhileError. The value can be used, but it could be outdated.
+	ErrStaleRecord = errors.New("sturdyc: the record has expired and could not be refreshed")
+	// ErrInvalidSnapshot is returned by client.Restore when the data that it
+	// reads wasn't written by client.Snapshot, or by an unsupported version.
+	ErrInvalidSnapshot = errors.New("sturdyc: invalid snapshot")
+	// ErrInvalidKey is returned by the functions that fetch values through the
+	// cache when a key exceeds the limit of WithMaxKeyLength, or is rejected
+	// by the validator of WithKeyValidator.
+	ErrInvalidKey = errors.New("sturdyc: invalid key")
+	// ErrCircuitOpen is returned by the functions that fetch values through the
+	// cache when the circuit breaker of WithCircuitBreaker is open, without the
+	// fetchFn having been called.
+	ErrCircuitOpen = errors.New("sturdyc: the circuit breaker is open")
+	// ErrEmptyBatch is returned by client.GetOrFetchBatch and
+	// client.PassthroughBatch when the fetchFn returned an empty response for
+	// a batch of IDs, and the client has been configured with
+	// WithTreatEmptyBatchAsError.
+	ErrEmptyBatch = errors.New("sturdyc: the fetchFn returned an empty batch")
+	// ErrReadOnly is returned by the functions that fetch values through the
+	// cache when a key is missing and the client is in read-only mode. The
+	// fetchFn isn't called, and the values that are cached are still served.
+	ErrReadOnly = errors.New("sturdyc: the cache is read-only")
+	// ErrClosed is returned by the batch fetches that were waiting for a fetch
+	// buffer to fill up, or for a chunk to be fetched, when client.Close was
+	// called. The fetchFn isn't called for the IDs that they were waiting for.
+	ErrClosed = errors.New("sturdyc: the client has been closed")
 	// ErrInvalidType is returned when you try to use one of the generic
 	// package level functions but the type assertion fails.
 	ErrInvalidType = errors.New("sturdyc: invalid response type")
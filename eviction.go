@@ -0,0 +1,348 @@
+package sturdyc
+
+import (
+	"cmp"
+	"math"
+	"time"
+)
+
+// EvictionPolicy determines which entries a shard evicts once it has reached
+// its capacity and has to make room for a new one. Regardless of the policy,
+// the number of entries that gets evicted is given by the evictionPercentage.
+type EvictionPolicy int
+
+const (
+	// EvictionPolicyExpiry evicts the entries that are closest to expiring.
+	// This is the default policy.
+	EvictionPolicyExpiry EvictionPolicy = iota
+	// EvictionPolicyLRU evicts the entries that were least recently used.
+	EvictionPolicyLRU
+	// EvictionPolicyLFU evicts the entries that are least frequently used. Ties
+	// are broken by evicting the least recently used entry.
+	EvictionPolicyLFU
+)
+
+// EvictionReason describes why an entry was removed from the cache.
+type EvictionReason int
+
+const (
+	// EvictionReasonExpired is used for entries that were removed by the
+	// continuous eviction job because they had expired.
+	EvictionReasonExpired EvictionReason = iota
+	// EvictionReasonCapacity is used for entries that were evicted to make
+	// room for new ones because a shard had reached its capacity.
+	EvictionReasonCapacity
+	// EvictionReasonDeleted is used for entries that were deleted explicitly.
+	EvictionReasonDeleted
+	// EvictionReasonCleared is used for entries that were removed by client.Clear.
+	EvictionReasonCleared
+	// EvictionReasonMissingRecordLimit is used for missing records that were
+	// evicted because the shard had reached the limit of WithMaxMissingRecords.
+	EvictionReasonMissingRecordLimit
+)
+
+// String returns the name of the reason.
+func (r EvictionReason) String() string {
+	switch r {
+	case EvictionReasonExpired:
+		return "expired"
+	case EvictionReasonCapacity:
+		return "capacity"
+	case EvictionReasonDeleted:
+		return "deleted"
+	case EvictionReasonCleared:
+		return "cleared"
+	case EvictionReasonMissingRecordLimit:
+		return "missing_record_limit"
+	}
+	return "unknown"
+}
+
+// eviction holds an entry that has been removed from a shard until the
+// eviction callback can be invoked for it.
+type eviction[T any] struct {
+	key    string
+	value  T
+	reason EvictionReason
+}
+
+// remove deletes the entry from the shard and queues it for the eviction
+// callback, if one has been configured. Should be called with a lock.
+func (s *shard[T]) remove(e *entry[T], reason EvictionReason) {
+	delete(s.entries, e.key)
+	s.cost -= e.cost
+	if e.isMissingRecord {
+		s.numMissingRecords--
+	}
+	s.untag(e)
+	if s.onEvict != nil {
+		s.evictions = append(s.evictions, eviction[T]{e.key, e.value, reason})
+	}
+}
+
+// evictable reports whether the entry can be removed by the evictions. The
+// entries that are referenced by client.GetRef, or that have been pinned, are
+// left alone. Should be called with a lock.
+func (s *shard[T]) evictable(e *entry[T]) bool {
+	if _, ok := s.pinned[e.key]; ok {
+		return false
+	}
+	return e.refs.Load() == 0
+}
+
+// pin marks the key as pinned, and reports whether it wasn't already.
+func (s *shard[T]) pin(key string) bool {
+	key = s.transformKey(key)
+	s.Lock()
+	defer s.Unlock()
+	if _, ok := s.pinned[key]; ok {
+		return false
+	}
+	if s.pinned == nil {
+		s.pinned = make(map[string]struct{})
+	}
+	s.pinned[key] = struct{}{}
+	return true
+}
+
+// isPinned reports whether the key has been pinned.
+func (s *shard[T]) isPinned(key string) bool {
+	s.RLock()
+	defer s.RUnlock()
+	_, ok := s.pinned[s.transformKey(key)]
+	return ok
+}
+
+// unpin removes the pin of the key, and reports whether it was pinned.
+func (s *shard[T]) unpin(key string) bool {
+	key = s.transformKey(key)
+	s.Lock()
+	defer s.Unlock()
+	if _, ok := s.pinned[key]; !ok {
+		return false
+	}
+	delete(s.pinned, key)
+	return true
+}
+
+// trackMissingRecord adds the missing record to the queue that is used to
+// evict the oldest ones once the shard exceeds the limit of
+// WithMaxMissingRecords. The queue keeps the entries that have since been
+// overwritten or removed until they reach the front, which is why it's
+// compacted once they make up the majority of it. Should be called with a lock.
+func (s *shard[T]) trackMissingRecord(e *entry[T]) {
+	s.missingRecords = append(s.missingRecords, e)
+	if len(s.missingRecords) <= 2*s.maxMissingRecords {
+		return
+	}
+	live := s.missingRecords[:0]
+	for _, m := range s.missingRecords {
+		if s.entries[m.key] == m {
+			live = append(live, m)
+		}
+	}
+	clear(s.missingRecords[len(live):])
+	s.missingRecords = live
+}
+
+// evictMissingRecords evicts the oldest missing records until the shard
+// holds no more than the limit. Should be called with a lock.
+func (s *shard[T]) evictMissingRecords(limit int) int {
+	var entriesEvicted int
+	for s.numMissingRecords > limit && len(s.missingRecords) > 0 {
+		e := s.missingRecords[0]
+		s.missingRecords[0] = nil
+		s.missingRecords = s.missingRecords[1:]
+		if s.entries[e.key] != e {
+			continue
+		}
+		s.remove(e, EvictionReasonMissingRecordLimit)
+		entriesEvicted++
+	}
+	return entriesEvicted
+}
+
+// unlock releases the lock of the shard, and then invokes the eviction
+// callback for the entries that were removed while it was being held. This
+// allows the callback to call back into the cache without deadlocking.
+// It also updates the entry counter that is read by the size of the shard,
+// and logs any forced evictions.
+func (s *shard[T]) unlock() {
+	evictions := s.evictions
+	s.evictions = nil
+	forcedEvictions := s.forcedEvictions
+	s.forcedEvictions = 0
+	numEntries, capacity := len(s.entries), s.capacity
+	s.numEntries.Store(int64(numEntries))
+	s.Unlock()
+	if forcedEvictions > 0 {
+		s.log.Debug("sturdyc: forced an eviction", "entries_evicted", forcedEvictions, "size", numEntries, "capacity", capacity)
+	}
+	for _, e := range evictions {
+		s.onEvict(e.key, e.value, e.reason)
+	}
+}
+
+// exceedsMaxCost reports whether writing an entry with the given cost would
+// make the shard exceed its budget. The cost of any entry that the write is
+// going to replace is subtracted first. Should be called with a lock.
+func (s *shard[T]) exceedsMaxCost(key string, cost int64) bool {
+	current := s.cost
+	if e, ok := s.entries[key]; ok {
+		current -= e.cost
+	}
+	return current+cost > s.maxCost
+}
+
+// touch records that the entry has been accessed. The entries are stamped
+// with a counter rather than the time so that accesses which happen within
+// the same instant can still be ordered. Safe to call with a read lock.
+func (s *shard[T]) touch(e *entry[T]) {
+	if s.evictionPolicy == EvictionPolicyExpiry {
+		return
+	}
+	if s.evictionPolicy == EvictionPolicyLFU {
+		e.accessFrequency.Add(1)
+	}
+	e.lastAccess.Store(s.accessCounter.Add(1))
+}
+
+// decayAccessFrequencies halves the access frequency of every entry in the
+// shard. This prevents keys that received a burst of traffic a long time ago
+// from staying in the cache forever. Should be called with a lock.
+func (s *shard[T]) decayAccessFrequencies() {
+	for _, e := range s.entries {
+		e.accessFrequency.Store(e.accessFrequency.Load() / 2)
+	}
+}
+
+// forceEvict evicts the given percentile of the entries in the shard
+// based on the eviction policy. Should be called with a lock. Returns
+// the number of entries that were evicted.
+func (s *shard[T]) forceEvict(percentile float64) int {
+	s.reportForcedEviction()
+	var entriesEvicted int
+	switch {
+	case s.sampleEvictions:
+		entriesEvicted = s.evictSampled(percentile)
+	case s.evictionPolicy == EvictionPolicyLRU:
+		entriesEvicted = s.evictLeastRecentlyUsed(percentile)
+	case s.evictionPolicy == EvictionPolicyLFU:
+		entriesEvicted = s.evictLeastFrequentlyUsed(percentile)
+	case s.evictionPolicy == EvictionPolicyExpiry:
+		entriesEvicted = s.evictClosestToExpiry(percentile)
+	}
+	s.reportEntriesEvicted(entriesEvicted)
+	s.forcedEvictions += entriesEvicted
+	return entriesEvicted
+}
+
+// evictClosestToExpiry evicts the entries with the earliest expiration times.
+func (s *shard[T]) evictClosestToExpiry(percentile float64) int {
+	expirationTimes := make([]time.Time, 0, len(s.entries))
+	for _, e := range s.entries {
+		expirationTimes = append(expirationTimes, e.expiresAt)
+	}
+
+	cutoff := FindCutoff(expirationTimes, percentile)
+	entriesEvicted := 0
+	for _, e := range s.entries {
+		if e.expiresAt.Before(cutoff) && s.evictable(e) {
+			s.remove(e, EvictionReasonCapacity)
+			entriesEvicted++
+		}
+	}
+	return entriesEvicted
+}
+
+// evictLeastRecentlyUsed evicts the entries that have gone the longest without being accessed.
+func (s *shard[T]) evictLeastRecentlyUsed(percentile float64) int {
+	accesses := make([]uint64, 0, len(s.entries))
+	for _, e := range s.entries {
+		accesses = append(accesses, e.lastAccess.Load())
+	}
+
+	cutoff := findCutoff(accesses, percentile, cmp.Less[uint64])
+	entriesEvicted := 0
+	for _, e := range s.entries {
+		if e.lastAccess.Load() < cutoff && s.evictable(e) {
+			s.remove(e, EvictionReasonCapacity)
+			entriesEvicted++
+		}
+	}
+	return entriesEvicted
+}
+
+// usage is used to rank the entries of a shard by how frequently they are used.
+type usage struct {
+	frequency  uint64
+	lastAccess uint64
+}
+
+func lessUsed(a, b usage) bool {
+	if a.frequency != b.frequency {
+		return a.frequency < b.frequency
+	}
+	return a.lastAccess < b.lastAccess
+}
+
+// evictLeastFrequentlyUsed evicts the entries that have been accessed the least.
+func (s *shard[T]) evictLeastFrequentlyUsed(percentile float64) int {
+	usages := make([]usage, 0, len(s.entries))
+	for _, e := range s.entries {
+		usages = append(usages, usage{e.accessFrequency.Load(), e.lastAccess.Load()})
+	}
+
+	cutoff := findCutoff(usages, percentile, lessUsed)
+	entriesEvicted := 0
+	for _, e := range s.entries {
+		if lessUsed(usage{e.accessFrequency.Load(), e.lastAccess.Load()}, cutoff) && s.evictable(e) {
+			s.remove(e, EvictionReasonCapacity)
+			entriesEvicted++
+		}
+	}
+	return entriesEvicted
+}
+
+// evictSampled approximates the eviction policy by sampling, like Redis does.
+// For every entry that has to be evicted, it examines a sample of the entries
+// of the size that was given to WithEvictionSampleSize, and evicts the one
+// that the policy ranks the lowest. The sample relies on the random iteration
+// order of the map, and it skips the entries that can't be evicted.
+func (s *shard[T]) evictSampled(percentile float64) int {
+	target := int(math.Ceil(float64(len(s.entries)) * percentile))
+	entriesEvicted := 0
+	for entriesEvicted < target {
+		var candidate *entry[T]
+		sampled := 0
+		for _, e := range s.entries {
+			if !s.evictable(e) {
+				continue
+			}
+			if candidate == nil || s.ranksLower(e, candidate) {
+				candidate = e
+			}
+			sampled++
+			if sampled == s.evictionSampleSize {
+				break
+			}
+		}
+		if candidate == nil {
+			break
+		}
+		s.remove(candidate, EvictionReasonCapacity)
+		entriesEvicted++
+	}
+	return entriesEvicted
+}
+
+// ranksLower reports whether the eviction policy would rather evict a than b.
+func (s *shard[T]) ranksLower(a, b *entry[T]) bool {
+	switch s.evictionPolicy {
+	case EvictionPolicyLRU:
+		return a.lastAccess.Load() < b.lastAccess.Load()
+	case EvictionPolicyLFU:
+		return lessUsed(usage{a.accessFrequency.Load(), a.lastAccess.Load()}, usage{b.accessFrequency.Load(), b.lastAccess.Load()})
+	}
+	return a.expiresAt.Before(b.expiresAt)
+}
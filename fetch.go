@@ -2,7 +2,9 @@ package sturdyc
 
 import (
 	"context"
+	"errors"
 	"maps"
+	"time"
 )
 
 func (c *Client[T]) groupIDs(ids []string, keyFn KeyFn) (hits map[string]T, misses, refreshes []string) {
@@ -33,11 +35,161 @@ func (c *Client[T]) groupIDs(ids []string, keyFn KeyFn) (hits map[string]T, miss
 	return hits, misses, refreshes
 }
 
-func getFetch[V, T any](ctx context.Context, c *Client[T], key string, fetchFn FetchFn[V]) (T, error) {
-	wrappedFetch := wrap[T](distributedFetch(c, key, fetchFn))
+// Source describes where the value that was returned by
+// client.GetOrFetchWithSource came from.
+type Source int
 
-	// Begin by checking if we have the item in our cache.
+const (
+	// SourceCache is used for values that were served from the cache.
+	SourceCache Source = iota
+	// SourceFetched is used for values that had to be retrieved with the fetchFn.
+	SourceFetched
+	// SourceStale is used for expired values that were served because the
+	// fetchFn failed. It's only used if WithStaleWhileError is enabled.
+	SourceStale
+)
+
+// String returns the name of the source.
+func (s Source) String() string {
+	switch s {
+	case SourceCache:
+		return "cache"
+	case SourceFetched:
+		return "fetched"
+	case SourceStale:
+		return "stale"
+	}
+	return "unknown"
+}
+
+// getFetch stores the value that it fetches with the TTL, or with the
+// default TTL of the client if it isn't greater than 0. It is called with the
+// argFetchFn that the fetchFn was created from, if any, which is what allows
+// the records that are related to the key to be prefetched.
+func getFetch[V, T any](ctx context.Context, c *Client[T], key string, ttl time.Duration, fetchFn FetchFn[V], argFetchFn ArgFetchFn[V]) (T, Source, error) {
+	wrappedFetch := wrap[T](distributedFetch(c, key, breakerFetch(c.Config, key, fetchFn)))
+
+	// Begin by checking if we have the item in our cache, unless
+	// the caller has asked for the cache to be bypassed.
+	if !isBypassed(ctx) {
+		value, ok, markedAsMissing, shouldRefresh := c.getWithState(key)
+
+		if shouldRefresh && !c.closed.Load() {
+			c.safeGo(func() {
+				c.refresh(key, wrappedFetch)
+			})
+		}
+
+		if markedAsMissing {
+			return value, SourceCache, ErrMissingRecord
+		}
+
+		if ok {
+			return value, SourceCache, nil
+		}
+	}
+
+	res, err := callAndCache(ctx, c, key, ttl, wrappedFetch)
+	if err == nil && argFetchFn != nil {
+		prefetchRelated(ctx, c, key, argFetchFn)
+	}
+	if err != nil && c.maxStaleness > 0 && !errors.Is(err, ErrNotFound) && !errors.Is(err, ErrMissingRecord) {
+		if stale, isStale := c.getShard(key).getStale(key); isStale {
+			return stale, SourceStale, ErrStaleRecord
+		}
+	}
+	return res, SourceFetched, err
+}
+
+// GetOrFetch attempts to retrieve the specified key from the cache. If the value
+// is absent, it invokes the fetchFn function to obtain it and then stores the result.
+// Additionally, when background refreshes are enabled, GetOrFetch determines if the record
+// needs refreshing and, if necessary, schedules this task for background execution.
+//
+// Parameters:
+//
+//	ctx - The context to be used for the request.
+//	key - The key to be fetched.
+//	fetchFn - Used to retrieve the data from the underlying data source if the key is not found in the cache.
+//
+// Returns:
+//
+//	The value corresponding to the key and an error if one occurred.
+func (c *Client[T]) GetOrFetch(ctx context.Context, key string, fetchFn FetchFn[T]) (T, error) {
+	res, _, err := getFetch[T, T](ctx, c, key, 0, fetchFn, nil)
+	return res, err
+}
+
+// GetOrFetch is a convenience function that performs type assertion on the result of client.GetOrFetch.
+//
+// Parameters:
+//
+//	ctx - The context to be used for the request.
+//	c - The cache client.
+//	key - The key to be fetched.
+//	fetchFn - Used to retrieve the data from the underlying data source if the key is not found in the cache.
+//
+// Returns:
+//
+//	The value corresponding to the key and an error if one occurred.
+//
+// Type Parameters:
+//
+//	V - The type returned by the fetchFn. Must be assignable to T.
+//	T - The type stored in the cache.
+func GetOrFetch[V, T any](ctx context.Context, c *Client[T], key string, fetchFn FetchFn[V]) (V, error) {
+	res, _, err := getFetch[V, T](ctx, c, key, 0, fetchFn, nil)
+	return unwrap[V](res, err)
+}
+
+// GetOrFetchWithSource works like GetOrFetch, but it also returns where the
+// value came from. This makes it possible to tell the values that were
+// served from the cache apart from the ones that had to be fetched, for
+// example to record the latency of the data source separately.
+//
+// Parameters:
+//
+//	ctx - The context to be used for the request.
+//	key - The key to be fetched.
+//	fetchFn - Used to retrieve the data from the underlying data source if the key is not found in the cache.
+//
+// Returns:
+//
+//	The value corresponding to the key, the source of the value, and an error if one occurred.
+func (c *Client[T]) GetOrFetchWithSource(ctx context.Context, key string, fetchFn FetchFn[T]) (T, Source, error) {
+	return getFetch[T, T](ctx, c, key, 0, fetchFn, nil)
+}
+
+// GetOrFetchWithSource is a convenience function that performs type assertion
+// on the result of client.GetOrFetchWithSource.
+//
+// Parameters:
+//
+//	ctx - The context to be used for the request.
+//	c - The cache client.
+//	key - The key to be fetched.
+//	fetchFn - Used to retrieve the data from the underlying data source if the key is not found in the cache.
+//
+// Returns:
+//
+//	The value corresponding to the key, the source of the value, and an error if one occurred.
+//
+// Type Parameters:
+//
+//	V - The type returned by the fetchFn. Must be assignable to T.
+//	T - The type stored in the cache.
+func GetOrFetchWithSource[V, T any](ctx context.Context, c *Client[T], key string, fetchFn FetchFn[V]) (V, Source, error) {
+	res, source, err := getFetch[V, T](ctx, c, key, 0, fetchFn, nil)
+	value, err := unwrap[V](res, err)
+	return value, source, err
+}
+
+func getFetchAsync[V, T any](ctx context.Context, c *Client[T], key string, fetchFn FetchFn[V]) (T, bool) {
+	wrappedFetch := wrap[T](distributedFetch(c, key, breakerFetch(c.Config, key, fetchFn)))
 	value, ok, markedAsMissing, shouldRefresh := c.getWithState(key)
+	if c.closed.Load() {
+		return value, ok && !markedAsMissing
+	}
 
 	if shouldRefresh {
 		c.safeGo(func() {
@@ -46,41 +198,186 @@ func getFetch[V, T any](ctx context.Context, c *Client[T], key string, fetchFn F
 	}
 
 	if markedAsMissing {
-		return value, ErrMissingRecord
+		return value, false
 	}
 
 	if ok {
-		return value, nil
+		return value, true
 	}
 
-	return callAndCache(ctx, c, key, wrappedFetch)
+	if c.validateKey(key) != nil || c.readOnly.Load() {
+		var zero T
+		return zero, false
+	}
+
+	// The value is fetched in the background, and the caller is
+	// given the expired value for the time being if there is one.
+	startCall(ctx, c, key, 0, wrappedFetch)
+	if c.maxStaleness > 0 {
+		if stale, isStale := c.getShard(key).getStale(key); isStale {
+			return stale, true
+		}
+	}
+	var zero T
+	return zero, false
 }
 
-// GetOrFetch attempts to retrieve the specified key from the cache. If the value
-// is absent, it invokes the fetchFn function to obtain it and then stores the result.
-// Additionally, when background refreshes are enabled, GetOrFetch determines if the record
-// needs refreshing and, if necessary, schedules this task for background execution.
+// GetOrFetchAsync is a best-effort read for latency-sensitive code that never
+// blocks on the underlying data source. If the key is in the cache, the value
+// is returned immediately, and refreshed in the background like it would be by
+// GetOrFetch. If the key is absent, the fetchFn is called in the background to
+// populate the cache for the next read. In the meantime, an expired value is
+// returned if the client has been configured with WithStaleWhileError and the
+// entry is still within the max staleness. The boolean reports whether the
+// returned value is usable, which is false for cold misses and for keys that
+// have been marked as missing. The context isn't able to cancel the
+// background fetch, since it's shared with every caller that requests the key.
+//
+// Parameters:
+//
+//	ctx - The context to be used for the background fetch.
+//	key - The key to be fetched.
+//	fetchFn - Used to retrieve the data from the underlying data source if the key is not found in the cache.
+//
+// Returns:
+//
+//	The value corresponding to the key and a boolean indicating if it was available.
+func (c *Client[T]) GetOrFetchAsync(ctx context.Context, key string, fetchFn FetchFn[T]) (T, bool) {
+	return getFetchAsync[T, T](ctx, c, key, fetchFn)
+}
+
+// GetOrFetchAsync is a convenience function that performs type assertion on
+// the result of client.GetOrFetchAsync.
+//
+// Parameters:
+//
+//	ctx - The context to be used for the background fetch.
+//	c - The cache client.
+//	key - The key to be fetched.
+//	fetchFn - Used to retrieve the data from the underlying data source if the key is not found in the cache.
+//
+// Returns:
+//
+//	The value corresponding to the key and a boolean indicating if it was available.
+//
+// Type Parameters:
+//
+//	V - The type returned by the fetchFn. Must be assignable to T.
+//	T - The type stored in the cache.
+func GetOrFetchAsync[V, T any](ctx context.Context, c *Client[T], key string, fetchFn FetchFn[V]) (V, bool) {
+	res, ok := getFetchAsync[V, T](ctx, c, key, fetchFn)
+	if !ok {
+		var zero V
+		return zero, false
+	}
+	value, err := unwrap[V](res, nil)
+	return value, err == nil
+}
+
+// chainFetch returns a FetchFn that calls the functions in order until one of
+// them succeeds. The errors of every function are joined if all of them fail.
+func chainFetch[V any](fetchFns []FetchFn[V]) FetchFn[V] {
+	if len(fetchFns) == 0 {
+		panic("fetchFns must contain at least one function")
+	}
+	return func(ctx context.Context) (V, error) {
+		var errs []error
+		for _, fetchFn := range fetchFns {
+			if err := ctx.Err(); err != nil {
+				errs = append(errs, err)
+				break
+			}
+			res, err := fetchFn(ctx)
+			if err == nil {
+				return res, nil
+			}
+			errs = append(errs, err)
+		}
+		var zero V
+		return zero, errors.Join(errs...)
+	}
+}
+
+// GetOrFetchChain works like GetOrFetch, but for values that can be retrieved
+// from several data sources, such as a primary database and a read replica.
+// If the key is absent from the cache, the fetch functions are called in order
+// until one of them succeeds, and the first successful value is cached. The
+// background refreshes go through the same chain. If every function fails,
+// their errors are joined into the one that is returned. Please note that
+// the key is stored as a missing record if any of the functions returned
+// ErrNotFound, and the client has been configured with WithMissingRecordStorage.
+// It panics if it's called without any fetch functions.
+//
+// Parameters:
+//
+//	ctx - The context to be used for the request.
+//	key - The key to be fetched.
+//	fetchFns - The functions that are used to retrieve the value, in the order they should be tried.
+//
+// Returns:
+//
+//	The value corresponding to the key and an error if one occurred.
+func (c *Client[T]) GetOrFetchChain(ctx context.Context, key string, fetchFns ...FetchFn[T]) (T, error) {
+	res, _, err := getFetch[T, T](ctx, c, key, 0, chainFetch(fetchFns), nil)
+	return res, err
+}
+
+// GetOrFetchChain is a convenience function that performs type assertion on
+// the result of client.GetOrFetchChain.
+//
+// Parameters:
+//
+//	ctx - The context to be used for the request.
+//	c - The cache client.
+//	key - The key to be fetched.
+//	fetchFns - The functions that are used to retrieve the value, in the order they should be tried.
+//
+// Returns:
+//
+//	The value corresponding to the key and an error if one occurred.
+//
+// Type Parameters:
+//
+//	V - The type returned by the fetchFns. Must be assignable to T.
+//	T - The type stored in the cache.
+func GetOrFetchChain[V, T any](ctx context.Context, c *Client[T], key string, fetchFns ...FetchFn[V]) (V, error) {
+	res, _, err := getFetch[V, T](ctx, c, key, 0, chainFetch(fetchFns), nil)
+	return unwrap[V](res, err)
+}
+
+// GetOrFetchWithTTL works like GetOrFetch, but the value is stored with the
+// TTL that is passed to it, instead of the default TTL of the client, if it
+// has to be fetched. This allows callers with different requirements for the
+// freshness of the same key, such as a batch job and an API, to share the
+// cache. The callers don't coordinate, which means that the last writer wins.
+// The TTL of the call that fetches the value is used for every caller that is
+// waiting for it, and a later fetch or background refresh of the key writes
+// the value with its own TTL. A TTL that isn't greater than 0 is ignored.
 //
 // Parameters:
 //
 //	ctx - The context to be used for the request.
 //	key - The key to be fetched.
+//	ttl - The TTL that the fetched value is stored with.
 //	fetchFn - Used to retrieve the data from the underlying data source if the key is not found in the cache.
 //
 // Returns:
 //
 //	The value corresponding to the key and an error if one occurred.
-func (c *Client[T]) GetOrFetch(ctx context.Context, key string, fetchFn FetchFn[T]) (T, error) {
-	return getFetch[T, T](ctx, c, key, fetchFn)
+func (c *Client[T]) GetOrFetchWithTTL(ctx context.Context, key string, ttl time.Duration, fetchFn FetchFn[T]) (T, error) {
+	res, _, err := getFetch[T, T](ctx, c, key, ttl, fetchFn, nil)
+	return res, err
 }
 
-// GetOrFetch is a convenience function that performs type assertion on the result of client.GetOrFetch.
+// GetOrFetchWithTTL is a convenience function that performs type assertion
+// on the result of client.GetOrFetchWithTTL.
 //
 // Parameters:
 //
 //	ctx - The context to be used for the request.
 //	c - The cache client.
 //	key - The key to be fetched.
+//	ttl - The TTL that the fetched value is stored with.
 //	fetchFn - Used to retrieve the data from the underlying data source if the key is not found in the cache.
 //
 // Returns:
@@ -91,17 +388,155 @@ func (c *Client[T]) GetOrFetch(ctx context.Context, key string, fetchFn FetchFn[
 //
 //	V - The type returned by the fetchFn. Must be assignable to T.
 //	T - The type stored in the cache.
-func GetOrFetch[V, T any](ctx context.Context, c *Client[T], key string, fetchFn FetchFn[V]) (V, error) {
-	res, err := getFetch[V, T](ctx, c, key, fetchFn)
+func GetOrFetchWithTTL[V, T any](ctx context.Context, c *Client[T], key string, ttl time.Duration, fetchFn FetchFn[V]) (V, error) {
+	res, _, err := getFetch[V, T](ctx, c, key, ttl, fetchFn, nil)
 	return unwrap[V](res, err)
 }
 
+// withArg turns the fetchFn into one that is called with the argument.
+func withArg[V any](fetchFn ArgFetchFn[V], arg string) FetchFn[V] {
+	return func(ctx context.Context) (V, error) {
+		return fetchFn(ctx, arg)
+	}
+}
+
+// GetOrFetchWithKey works like GetOrFetch, but the key that the value is
+// stored under is separate from the argument that is passed to the fetchFn.
+// This is useful when the natural cache key differs from what the data
+// source expects, such as a normalized key for a raw query, without having
+// to create a closure for every call. The in-flight requests are still
+// deduplicated on the cache key.
+//
+// Parameters:
+//
+//	ctx - The context to be used for the request.
+//	cacheKey - The key that the value is stored under.
+//	fetchArg - The argument that is passed to the fetchFn.
+//	fetchFn - Used to retrieve the data from the underlying data source if the key is not found in the cache.
+//
+// Returns:
+//
+//	The value corresponding to the key and an error if one occurred.
+func (c *Client[T]) GetOrFetchWithKey(ctx context.Context, cacheKey, fetchArg string, fetchFn ArgFetchFn[T]) (T, error) {
+	res, _, err := getFetch[T, T](ctx, c, cacheKey, 0, withArg(fetchFn, fetchArg), fetchFn)
+	return res, err
+}
+
+// GetOrFetchWithKey is a convenience function that performs type assertion
+// on the result of client.GetOrFetchWithKey.
+//
+// Parameters:
+//
+//	ctx - The context to be used for the request.
+//	c - The cache client.
+//	cacheKey - The key that the value is stored under.
+//	fetchArg - The argument that is passed to the fetchFn.
+//	fetchFn - Used to retrieve the data from the underlying data source if the key is not found in the cache.
+//
+// Returns:
+//
+//	The value corresponding to the key and an error if one occurred.
+//
+// Type Parameters:
+//
+//	V - The type returned by the fetchFn. Must be assignable to T.
+//	T - The type stored in the cache.
+func GetOrFetchWithKey[V, T any](ctx context.Context, c *Client[T], cacheKey, fetchArg string, fetchFn ArgFetchFn[V]) (V, error) {
+	res, _, err := getFetch[V, T](ctx, c, cacheKey, 0, withArg(fetchFn, fetchArg), fetchFn)
+	return unwrap[V](res, err)
+}
+
+func getFetchWithFallback[V, T any](ctx context.Context, c *Client[T], key string, fetchFn FetchFn[V], fallback V) V {
+	res, _, err := getFetch[V, T](ctx, c, key, 0, fetchFn, nil)
+	// Stale values are preferred over the fallback.
+	if err == nil || errors.Is(err, ErrStaleRecord) {
+		if value, unwrapErr := unwrap[V](res, nil); unwrapErr == nil {
+			return value
+		}
+	}
+
+	c.reportFallbackServed()
+	if c.fallbackTTL > 0 && c.acceptsKey(key) {
+		if value, ok := any(fallback).(T); ok {
+			c.getShard(key).setWithTTL(key, value, c.fallbackTTL, false)
+		}
+	}
+	return fallback
+}
+
+// GetOrFetchWithFallback works like GetOrFetch, but it returns the fallback
+// rather than an error if the key is absent from the cache and the fetchFn
+// fails. This includes keys that have been marked as missing. The fallback
+// isn't written to the cache, unless the client has been configured with
+// WithFallbackTTL. An expired value is still preferred over the fallback if
+// the client has been configured with WithStaleWhileError. Every fallback
+// that is served is reported to metrics recorders that implement
+// FallbackRecorder.
+//
+// Parameters:
+//
+//	ctx - The context to be used for the request.
+//	key - The key to be fetched.
+//	fetchFn - Used to retrieve the data from the underlying data source if the key is not found in the cache.
+//	fallback - The value to return if the fetchFn fails.
+//
+// Returns:
+//
+//	The value corresponding to the key, or the fallback.
+func (c *Client[T]) GetOrFetchWithFallback(ctx context.Context, key string, fetchFn FetchFn[T], fallback T) T {
+	return getFetchWithFallback[T, T](ctx, c, key, fetchFn, fallback)
+}
+
+// GetOrFetchWithFallback is a convenience function that performs type
+// assertion on the result of client.GetOrFetchWithFallback.
+//
+// Parameters:
+//
+//	ctx - The context to be used for the request.
+//	c - The cache client.
+//	key - The key to be fetched.
+//	fetchFn - Used to retrieve the data from the underlying data source if the key is not found in the cache.
+//	fallback - The value to return if the fetchFn fails.
+//
+// Returns:
+//
+//	The value corresponding to the key, or the fallback.
+//
+// Type Parameters:
+//
+//	V - The type returned by the fetchFn. Must be assignable to T.
+//	T - The type stored in the cache.
+func GetOrFetchWithFallback[V, T any](ctx context.Context, c *Client[T], key string, fetchFn FetchFn[V], fallback V) V {
+	return getFetchWithFallback[V, T](ctx, c, key, fetchFn, fallback)
+}
+
+// rejectEmptyBatches turns an empty response to a batch of IDs into
+// ErrEmptyBatch if the client has been configured with WithTreatEmptyBatchAsError.
+func rejectEmptyBatches[V any](c *Config, fetchFn BatchFetchFn[V]) BatchFetchFn[V] {
+	if !c.treatEmptyBatchAsError {
+		return fetchFn
+	}
+	return func(ctx context.Context, ids []string) (map[string]V, error) {
+		res, err := fetchFn(ctx, ids)
+		if err == nil && len(res) == 0 && len(ids) > 0 {
+			return res, ErrEmptyBatch
+		}
+		return res, err
+	}
+}
+
 func getFetchBatch[V, T any](ctx context.Context, c *Client[T], ids []string, keyFn KeyFn, fetchFn BatchFetchFn[V]) (map[string]T, error) {
-	wrappedFetch := wrapBatch[T](distributedBatchFetch[V, T](c, keyFn, fetchFn))
-	cachedRecords, cacheMisses, idsToRefresh := c.groupIDs(ids, keyFn)
+	if err := c.validateKeys(ids, keyFn); err != nil {
+		return nil, err
+	}
+	wrappedFetch := wrapBatch[T](distributedBatchFetch[V, T](c, keyFn, breakerBatchFetch(c.Config, keyFn, rejectEmptyBatches(c.Config, fetchFn))))
+	cachedRecords, cacheMisses, idsToRefresh := map[string]T{}, ids, []string(nil)
+	if !isBypassed(ctx) {
+		cachedRecords, cacheMisses, idsToRefresh = c.groupIDs(ids, keyFn)
+	}
 
 	// If any records need to be refreshed, we'll do so in the background.
-	if len(idsToRefresh) > 0 {
+	if len(idsToRefresh) > 0 && !c.closed.Load() {
 		c.safeGo(func() {
 			if c.bufferRefreshes {
 				bufferBatchRefresh(c, idsToRefresh, keyFn, wrappedFetch)
@@ -118,6 +553,11 @@ func getFetchBatch[V, T any](ctx context.Context, c *Client[T], ids []string, ke
 
 	callBatchOpts := callBatchOpts[T, T]{ids: cacheMisses, keyFn: keyFn, fn: wrappedFetch}
 	response, err := callAndCacheBatch(ctx, c, callBatchOpts)
+	if errors.Is(err, ErrPartialBatch) {
+		prefetch(ctx, c, ids, response, keyFn, fetchFn)
+		maps.Copy(cachedRecords, response)
+		return cachedRecords, err
+	}
 	if err != nil {
 		if len(cachedRecords) > 0 {
 			return cachedRecords, ErrOnlyCachedRecords
@@ -125,6 +565,7 @@ func getFetchBatch[V, T any](ctx context.Context, c *Client[T], ids []string, ke
 		return cachedRecords, err
 	}
 
+	prefetch(ctx, c, ids, response, keyFn, fetchFn)
 	maps.Copy(cachedRecords, response)
 	return cachedRecords, nil
 }
@@ -173,3 +614,154 @@ func GetOrFetchBatch[V, T any](ctx context.Context, c *Client[T], ids []string,
 	res, err := getFetchBatch[V, T](ctx, c, ids, keyFn, fetchFn)
 	return unwrapBatch[V](res, err)
 }
+
+// alignToIDs returns the records in the same order as the ids, together with
+// a slice that reports whether each of them was found.
+func alignToIDs[V any](ids []string, records map[string]V) ([]V, []bool) {
+	values := make([]V, len(ids))
+	found := make([]bool, len(ids))
+	for i, id := range ids {
+		values[i], found[i] = records[id]
+	}
+	return values, found
+}
+
+// GetOrFetchBatchSlice works like GetOrFetchBatch, but it returns the values
+// in a slice that is aligned to the ids, which saves the caller from having to
+// order the map. The ids that couldn't be retrieved are given the zero value,
+// and the parallel slice of booleans reports whether each value was found.
+// The slices are returned together with the same errors as GetOrFetchBatch,
+// which means that they can hold the records that were cached even if the
+// fetch failed.
+//
+// Parameters:
+//
+//	ctx - The context to be used for the request.
+//	ids - The list of IDs to be fetched.
+//	keyFn - Used to generate the cache key for each ID.
+//	fetchFn - Used to retrieve the data from the underlying data source if any IDs are not found in the cache.
+//
+// Returns:
+//
+//	The values in the order of the ids, whether each of them was found, and an error if one occurred.
+func (c *Client[T]) GetOrFetchBatchSlice(ctx context.Context, ids []string, keyFn KeyFn, fetchFn BatchFetchFn[T]) ([]T, []bool, error) {
+	res, err := getFetchBatch[T, T](ctx, c, ids, keyFn, fetchFn)
+	values, found := alignToIDs(ids, res)
+	return values, found, err
+}
+
+// GetOrFetchBatchSlice is a convenience function that performs type assertion
+// on the result of client.GetOrFetchBatchSlice.
+//
+// Parameters:
+//
+//	ctx - The context to be used for the request.
+//	c - The cache client.
+//	ids - The list of IDs to be fetched.
+//	keyFn - Used to prefix each ID in order to create a unique cache key.
+//	fetchFn - Used to retrieve the data from the underlying data source.
+//
+// Returns:
+//
+//	The values in the order of the ids, whether each of them was found, and an error if one occurred.
+//
+// Type Parameters:
+//
+//	V - The type returned by the fetchFn. Must be assignable to T.
+//	T - The type stored in the cache.
+func GetOrFetchBatchSlice[V, T any](ctx context.Context, c *Client[T], ids []string, keyFn KeyFn, fetchFn BatchFetchFn[V]) ([]V, []bool, error) {
+	res, err := unwrapBatch[V](getFetchBatch[V, T](ctx, c, ids, keyFn, fetchFn))
+	values, found := alignToIDs(ids, res)
+	return values, found, err
+}
+
+func getFetchBatchWithErrors[V, T any](ctx context.Context, c *Client[T], ids []string, keyFn KeyFn, fetchFn PartialBatchFetchFn[V]) (map[string]T, map[string]error, error) {
+	if err := c.validateKeys(ids, keyFn); err != nil {
+		return nil, nil, err
+	}
+	cachedRecords, cacheMisses, idsToRefresh := map[string]T{}, ids, []string(nil)
+	if !isBypassed(ctx) {
+		cachedRecords, cacheMisses, idsToRefresh = c.groupIDs(ids, keyFn)
+	}
+
+	// If any records need to be refreshed, we'll do so in the background.
+	if len(idsToRefresh) > 0 && !c.closed.Load() {
+		refreshFetch := wrapBatch[T](distributedBatchFetch[V, T](c, keyFn, breakerBatchFetch(c.Config, keyFn, rejectEmptyBatches(c.Config, wrapPartialBatchRefresh[V](fetchFn)))))
+		c.safeGo(func() {
+			if c.bufferRefreshes {
+				bufferBatchRefresh(c, idsToRefresh, keyFn, refreshFetch)
+				return
+			}
+			c.refreshBatch(idsToRefresh, keyFn, refreshFetch)
+		})
+	}
+
+	// If we were able to retrieve all records from the cache, we can return them straight away.
+	if len(cacheMisses) == 0 {
+		return cachedRecords, map[string]error{}, nil
+	}
+
+	wrappedFetch := wrapBatch[T](distributedBatchFetch[V, T](c, keyFn, breakerBatchFetch(c.Config, keyFn, rejectEmptyBatches(c.Config, wrapPartialBatch[V](fetchFn)))))
+	callBatchOpts := callBatchOpts[T, T]{ids: cacheMisses, keyFn: keyFn, fn: wrappedFetch}
+	response, errs, err := callAndCacheBatchWithErrors(ctx, c, callBatchOpts)
+	if err != nil {
+		if len(cachedRecords) > 0 {
+			return cachedRecords, errs, ErrOnlyCachedRecords
+		}
+		return cachedRecords, errs, err
+	}
+
+	maps.Copy(cachedRecords, response)
+	return cachedRecords, errs, nil
+}
+
+// GetOrFetchBatchWithErrors works like GetOrFetchBatch, but for data sources
+// that are able to fail for some of the IDs while succeeding for others. The
+// records that were retrieved successfully are cached and returned, while the
+// errors of the others are returned in a map of their own. IDs that failed
+// with ErrNotFound are stored as missing records if the client has been
+// configured to do so. Any other error leaves the ID out of the cache. The
+// records go through the distributed storage like the ones of
+// GetOrFetchBatch, and an ID that fails is served from the distributed
+// storage instead if it has a record for it.
+//
+// Parameters:
+//
+//	ctx - The context to be used for the request.
+//	ids - The list of IDs to be fetched.
+//	keyFn - Used to generate the cache key for each ID.
+//	fetchFn - Used to retrieve the data from the underlying data source if any IDs are not found in the cache.
+//
+// Returns:
+//
+//	A map of IDs to their corresponding values, a map of IDs to the errors
+//	that occurred when they were fetched, and an error if the entire fetch failed.
+func (c *Client[T]) GetOrFetchBatchWithErrors(ctx context.Context, ids []string, keyFn KeyFn, fetchFn PartialBatchFetchFn[T]) (map[string]T, map[string]error, error) {
+	return getFetchBatchWithErrors[T, T](ctx, c, ids, keyFn, fetchFn)
+}
+
+// GetOrFetchBatchWithErrors is a convenience function that performs type
+// assertion on the result of client.GetOrFetchBatchWithErrors.
+//
+// Parameters:
+//
+//	ctx - The context to be used for the request.
+//	c - The cache client.
+//	ids - The list of IDs to be fetched.
+//	keyFn - Used to prefix each ID in order to create a unique cache key.
+//	fetchFn - Used to retrieve the data from the underlying data source.
+//
+// Returns:
+//
+//	A map of IDs to their corresponding values, a map of IDs to the errors
+//	that occurred when they were fetched, and an error if the entire fetch failed.
+//
+// Type Parameters:
+//
+//	V - The type returned by the fetchFn. Must be assignable to T.
+//	T - The type stored in the cache.
+func GetOrFetchBatchWithErrors[V, T any](ctx context.Context, c *Client[T], ids []string, keyFn KeyFn, fetchFn PartialBatchFetchFn[V]) (map[string]V, map[string]error, error) {
+	res, errs, err := getFetchBatchWithErrors[V, T](ctx, c, ids, keyFn, fetchFn)
+	values, err := unwrapBatch[V](res, err)
+	return values, errs, err
+}
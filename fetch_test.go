@@ -3,7 +3,10 @@ package sturdyc_test
 import (
 	"context"
 	"errors"
+	"slices"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -692,3 +695,1583 @@ func TestGetFetchBatchConvertsDeletedRecordsToMissingRecords(t *testing.T) {
 		t.Errorf("expected key3 to not be returned by Get")
 	}
 }
+
+func TestRefreshBypassesTheCache(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	ttl := time.Minute
+	clock := sturdyc.NewTestClock(time.Now())
+	c := sturdyc.New[string](10, 2, ttl, 10,
+		sturdyc.WithNoContinuousEvictions(),
+		sturdyc.WithClock(clock),
+	)
+
+	c.Set("1", "stale")
+	clock.Add(ttl / 2)
+
+	fetchObserver := NewFetchObserver(1)
+	fetchObserver.Response("1")
+	value, err := sturdyc.Refresh(ctx, c, "1", fetchObserver.Fetch)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if value != "value1" {
+		t.Errorf("expected value1, got %v", value)
+	}
+	<-fetchObserver.FetchCompleted
+	fetchObserver.AssertFetchCount(t, 1)
+
+	// The refreshed value should have been written with a fresh TTL.
+	clock.Add(ttl / 2)
+	if cachedValue, ok := c.Get("1"); !ok || cachedValue != "value1" {
+		t.Errorf("expected the refreshed value to be cached, got %q %t", cachedValue, ok)
+	}
+}
+
+func TestRefreshKeepsTheCachedValueIfTheFetchFails(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	c := sturdyc.New[string](10, 2, time.Minute, 10,
+		sturdyc.WithNoContinuousEvictions(),
+	)
+
+	c.Set("1", "value1")
+	fetchObserver := NewFetchObserver(1)
+	fetchObserver.Err(errors.New("error"))
+	if _, err := c.Refresh(ctx, "1", fetchObserver.Fetch); err == nil {
+		t.Error("expected the error to be returned")
+	}
+	<-fetchObserver.FetchCompleted
+
+	if cachedValue, ok := c.Get("1"); !ok || cachedValue != "value1" {
+		t.Errorf("expected the cached value to be intact, got %q %t", cachedValue, ok)
+	}
+}
+
+func TestRefreshStoresAMissingRecordIfTheRecordIsNotFound(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	c := sturdyc.New[string](10, 2, time.Minute, 10,
+		sturdyc.WithNoContinuousEvictions(),
+		sturdyc.WithMissingRecordStorage(),
+	)
+
+	c.Set("1", "value1")
+	fetchObserver := NewFetchObserver(1)
+	fetchObserver.Err(sturdyc.ErrNotFound)
+	if _, err := c.Refresh(ctx, "1", fetchObserver.Fetch); !errors.Is(err, sturdyc.ErrMissingRecord) {
+		t.Errorf("expected ErrMissingRecord, got %v", err)
+	}
+	<-fetchObserver.FetchCompleted
+
+	if !c.ExistsAsMissing("1") {
+		t.Error("expected the cached value to have been replaced with a missing record")
+	}
+}
+
+func TestFetchTimeoutReleasesTheCallerOfAHangingFetch(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	c := sturdyc.New[string](10, 2, time.Minute, 10,
+		sturdyc.WithNoContinuousEvictions(),
+		sturdyc.WithFetchTimeout(10*time.Millisecond),
+	)
+
+	// The fetch function ignores its context to simulate a misbehaving backend.
+	release := make(chan struct{})
+	defer close(release)
+	hangingFetch := func(_ context.Context) (string, error) {
+		<-release
+		return "value", nil
+	}
+
+	_, err := sturdyc.GetOrFetch(ctx, c, "1", hangingFetch)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected context.DeadlineExceeded, got %v", err)
+	}
+	if _, ok := c.Get("1"); ok {
+		t.Error("expected nothing to be written to the cache")
+	}
+}
+
+func TestFetchTimeoutReleasesTheCallerOfAHangingBatchFetch(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	c := sturdyc.New[string](10, 2, time.Minute, 10,
+		sturdyc.WithNoContinuousEvictions(),
+		sturdyc.WithFetchTimeout(10*time.Millisecond),
+	)
+
+	release := make(chan struct{})
+	defer close(release)
+	hangingFetch := func(_ context.Context, ids []string) (map[string]string, error) {
+		<-release
+		response := make(map[string]string, len(ids))
+		for _, id := range ids {
+			response[id] = "value" + id
+		}
+		return response, nil
+	}
+
+	ids := []string{"1", "2"}
+	_, err := sturdyc.GetOrFetchBatch(ctx, c, ids, c.BatchKeyFn("item"), hangingFetch)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected context.DeadlineExceeded, got %v", err)
+	}
+	if c.Size() != 0 {
+		t.Errorf("expected nothing to be written to the cache, got %d entries", c.Size())
+	}
+}
+
+func TestGetOrFetchMissingRecordTTL(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	ttl := time.Hour
+	missingRecordTTL := time.Second * 30
+	clock := sturdyc.NewTestClock(time.Now())
+	c := sturdyc.New[string](10, 1, ttl, 10,
+		sturdyc.WithNoContinuousEvictions(),
+		sturdyc.WithClock(clock),
+		sturdyc.WithMissingRecordStorage(),
+		sturdyc.WithMissingRecordTTL(missingRecordTTL),
+	)
+
+	c.Set("2", "value2")
+	fetchObserver := NewFetchObserver(1)
+	fetchObserver.Err(sturdyc.ErrNotFound)
+	_, err := sturdyc.GetOrFetch(ctx, c, "1", fetchObserver.Fetch)
+	if !errors.Is(err, sturdyc.ErrMissingRecord) {
+		t.Fatalf("expected ErrMissingRecord, got %v", err)
+	}
+	<-fetchObserver.FetchCompleted
+	fetchObserver.AssertFetchCount(t, 1)
+
+	// Once the missing record has expired, the next request should go to the
+	// data source while the regular record is still in the cache.
+	clock.Add(missingRecordTTL + 1)
+	if _, ok := c.Get("2"); !ok {
+		t.Error("expected the regular record to use the default TTL")
+	}
+	fetchObserver.Clear()
+	fetchObserver.Response("1")
+	val, err := sturdyc.GetOrFetch(ctx, c, "1", fetchObserver.Fetch)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if val != "value1" {
+		t.Errorf("expected value to be value1, got %v", val)
+	}
+	<-fetchObserver.FetchCompleted
+	fetchObserver.AssertFetchCount(t, 2)
+}
+
+func TestGetOrFetchWithNoMissingRecordRefreshes(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	minRefreshDelay := time.Second
+	maxRefreshDelay := time.Second * 2
+	clock := sturdyc.NewTestClock(time.Now())
+	c := sturdyc.New[string](10, 1, time.Hour, 10,
+		sturdyc.WithNoContinuousEvictions(),
+		sturdyc.WithClock(clock),
+		sturdyc.WithEarlyRefreshes(minRefreshDelay, maxRefreshDelay, time.Millisecond*10),
+		sturdyc.WithMissingRecordStorage(),
+		sturdyc.WithNoMissingRecordRefreshes(),
+	)
+
+	fetchObserver := NewFetchObserver(1)
+	fetchObserver.Err(sturdyc.ErrNotFound)
+	_, err := sturdyc.GetOrFetch(ctx, c, "1", fetchObserver.Fetch)
+	if !errors.Is(err, sturdyc.ErrMissingRecord) {
+		t.Fatalf("expected ErrMissingRecord, got %v", err)
+	}
+	<-fetchObserver.FetchCompleted
+	fetchObserver.AssertFetchCount(t, 1)
+
+	// The missing record is past its refresh time, but it shouldn't be refreshed.
+	clock.Add(maxRefreshDelay + 1)
+	_, err = sturdyc.GetOrFetch(ctx, c, "1", fetchObserver.Fetch)
+	if !errors.Is(err, sturdyc.ErrMissingRecord) {
+		t.Fatalf("expected ErrMissingRecord, got %v", err)
+	}
+	time.Sleep(10 * time.Millisecond)
+	fetchObserver.AssertFetchCount(t, 1)
+}
+
+type refreshOutcome struct {
+	key string
+	err error
+}
+
+func TestRefreshCallbackIsInvokedAfterEachRefresh(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	minRefreshDelay := time.Millisecond * 500
+	maxRefreshDelay := time.Second
+	clock := sturdyc.NewTestClock(time.Now())
+	outcomes := make(chan refreshOutcome, 10)
+	c := sturdyc.New[string](1000, 10, time.Hour, 10,
+		sturdyc.WithNoContinuousEvictions(),
+		sturdyc.WithEarlyRefreshes(minRefreshDelay, maxRefreshDelay, time.Millisecond*10),
+		sturdyc.WithClock(clock),
+		sturdyc.WithRefreshCallback(func(key string, err error, _ time.Duration) {
+			outcomes <- refreshOutcome{key, err}
+		}),
+	)
+
+	fetchObserver := NewFetchObserver(1)
+	fetchObserver.Response("1")
+	sturdyc.GetOrFetch(ctx, c, "1", fetchObserver.Fetch)
+	<-fetchObserver.FetchCompleted
+
+	// The initial fetch isn't a refresh, so it shouldn't invoke the callback.
+	clock.Add(maxRefreshDelay + 1)
+	fetchErr := errors.New("error")
+	fetchObserver.Err(fetchErr)
+	sturdyc.GetOrFetch(ctx, c, "1", fetchObserver.Fetch)
+	<-fetchObserver.FetchCompleted
+
+	outcome := <-outcomes
+	if outcome.key != "1" || !errors.Is(outcome.err, fetchErr) {
+		t.Errorf("expected a failed refresh of key 1, got %+v", outcome)
+	}
+	if len(outcomes) != 0 {
+		t.Errorf("expected a single refresh outcome, got %d more", len(outcomes))
+	}
+}
+
+func TestRefreshCallbackIsInvokedForEachIDInABatch(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	minRefreshDelay := time.Millisecond * 500
+	maxRefreshDelay := time.Second
+	clock := sturdyc.NewTestClock(time.Now())
+	outcomes := make(chan refreshOutcome, 10)
+	c := sturdyc.New[string](1000, 10, time.Hour, 10,
+		sturdyc.WithNoContinuousEvictions(),
+		sturdyc.WithEarlyRefreshes(minRefreshDelay, maxRefreshDelay, time.Millisecond*10),
+		sturdyc.WithClock(clock),
+		sturdyc.WithRefreshCallback(func(key string, err error, _ time.Duration) {
+			outcomes <- refreshOutcome{key, err}
+		}),
+	)
+
+	ids := []string{"1", "2", "3"}
+	keyFn := c.BatchKeyFn("item")
+	fetchObserver := NewFetchObserver(1)
+	fetchObserver.BatchResponse(ids)
+	c.GetOrFetchBatch(ctx, ids, keyFn, fetchObserver.FetchBatch)
+	<-fetchObserver.FetchCompleted
+
+	fetchObserver.BatchResponse([]string{"1", "2"})
+	clock.Add(maxRefreshDelay + 1)
+	c.GetOrFetchBatch(ctx, ids, keyFn, fetchObserver.FetchBatch)
+	<-fetchObserver.FetchCompleted
+
+	results := make(map[string]error, len(ids))
+	for range ids {
+		outcome := <-outcomes
+		results[outcome.key] = outcome.err
+	}
+	if results[keyFn("1")] != nil || results[keyFn("2")] != nil {
+		t.Errorf("expected the refreshes of 1 and 2 to succeed, got %v", results)
+	}
+	if !errors.Is(results[keyFn("3")], sturdyc.ErrNotFound) {
+		t.Errorf("expected the refresh of 3 to be reported as not found, got %v", results[keyFn("3")])
+	}
+}
+
+func TestCloseStopsTheBackgroundRefreshes(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	minRefreshDelay := time.Millisecond * 500
+	maxRefreshDelay := time.Second
+	clock := sturdyc.NewTestClock(time.Now())
+	c := sturdyc.New[string](100, 1, time.Hour, 5,
+		sturdyc.WithNoContinuousEvictions(),
+		sturdyc.WithEarlyRefreshes(minRefreshDelay, maxRefreshDelay, time.Millisecond*10),
+		sturdyc.WithClock(clock),
+	)
+
+	fetchObserver := NewFetchObserver(1)
+	fetchObserver.Response("1")
+	sturdyc.GetOrFetch(ctx, c, "1", fetchObserver.Fetch)
+	<-fetchObserver.FetchCompleted
+
+	c.Close()
+	clock.Add(maxRefreshDelay + 1)
+	value, err := sturdyc.GetOrFetch(ctx, c, "1", fetchObserver.Fetch)
+	if err != nil || value != "value1" {
+		t.Fatalf("expected the cached value to be served, got %q %v", value, err)
+	}
+	time.Sleep(10 * time.Millisecond)
+	fetchObserver.AssertFetchCount(t, 1)
+}
+
+func TestCloseEndsTheFetchesThatAreBeingBuffered(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	c := sturdyc.New[string](100, 1, time.Hour, 5,
+		sturdyc.WithNoContinuousEvictions(),
+		sturdyc.WithFetchBuffering(10, time.Hour),
+	)
+
+	var calls atomic.Int32
+	fetchFn := func(_ context.Context, ids []string) (map[string]string, error) {
+		calls.Add(1)
+		return map[string]string{ids[0]: "value"}, nil
+	}
+
+	errs := make(chan error)
+	go func() {
+		_, err := c.GetOrFetchBatch(ctx, []string{"1"}, c.BatchKeyFn("item"), fetchFn)
+		errs <- err
+	}()
+	c.Close()
+
+	select {
+	case err := <-errs:
+		if !errors.Is(err, sturdyc.ErrClosed) {
+			t.Errorf("expected ErrClosed, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected the buffered fetch to end when the client is closed")
+	}
+	if n := calls.Load(); n != 0 {
+		t.Errorf("expected the fetchFn to not be called, got %d calls", n)
+	}
+}
+
+func TestRefreshRetryStopsAfterTheMaxRetries(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	minRefreshDelay := time.Second
+	maxRefreshDelay := time.Second * 2
+	retryBaseDelay := time.Millisecond * 10
+	maxRetries := 2
+	clock := sturdyc.NewTestClock(time.Now())
+	c := sturdyc.New[string](5, 1, time.Hour, 10,
+		sturdyc.WithNoContinuousEvictions(),
+		sturdyc.WithRefreshRetry(retryBaseDelay, maxRetries, 3),
+		sturdyc.WithEarlyRefreshes(minRefreshDelay, maxRefreshDelay, time.Minute),
+		sturdyc.WithClock(clock),
+	)
+
+	fetchObserver := NewFetchObserver(10)
+	fetchObserver.Response("1")
+	sturdyc.GetOrFetch(ctx, c, "1", fetchObserver.Fetch)
+	<-fetchObserver.FetchCompleted
+	fetchObserver.Clear()
+	fetchObserver.Err(errors.New("error"))
+
+	// The delays between the retries are 10ms, 30ms, and 90ms. Moving the
+	// clock by 10ms between each call gives every retry a chance to run.
+	clock.Add(maxRefreshDelay + 1)
+	for i := 0; i < 100; i++ {
+		value, err := sturdyc.GetOrFetch(ctx, c, "1", fetchObserver.Fetch)
+		if err != nil || value != "value1" {
+			t.Fatalf("expected the stale value to be served, got %q %v", value, err)
+		}
+		time.Sleep(time.Millisecond)
+		clock.Add(retryBaseDelay)
+	}
+
+	// The initial fetch, the first refresh, and the two retries.
+	fetchObserver.AssertFetchCount(t, 4)
+}
+
+func TestStaleWhileErrorServesExpiredValues(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	ttl := time.Minute
+	maxStaleness := time.Minute * 5
+	clock := sturdyc.NewTestClock(time.Now())
+	c := sturdyc.New[string](100, 1, ttl, 10,
+		sturdyc.WithNoContinuousEvictions(),
+		sturdyc.WithClock(clock),
+		sturdyc.WithStaleWhileError(maxStaleness),
+	)
+
+	fetchObserver := NewFetchObserver(3)
+	fetchObserver.Response("1")
+	sturdyc.GetOrFetch(ctx, c, "1", fetchObserver.Fetch)
+	<-fetchObserver.FetchCompleted
+
+	// The value has expired and the data source is failing, so we should get the stale value.
+	clock.Add(ttl + time.Minute)
+	fetchObserver.Err(errors.New("error"))
+	value, err := sturdyc.GetOrFetch(ctx, c, "1", fetchObserver.Fetch)
+	<-fetchObserver.FetchCompleted
+	if !errors.Is(err, sturdyc.ErrStaleRecord) {
+		t.Fatalf("expected ErrStaleRecord, got %v", err)
+	}
+	if value != "value1" {
+		t.Errorf("expected the stale value to be returned, got %q", value)
+	}
+
+	// Once the max staleness has passed, the error should be returned.
+	clock.Add(maxStaleness)
+	if _, err = sturdyc.GetOrFetch(ctx, c, "1", fetchObserver.Fetch); err == nil || errors.Is(err, sturdyc.ErrStaleRecord) {
+		t.Errorf("expected the fetch error to be returned, got %v", err)
+	}
+	<-fetchObserver.FetchCompleted
+}
+
+type contextKey string
+
+func TestRefreshContextFnIsUsedForBackgroundRefreshes(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	minRefreshDelay := time.Millisecond * 500
+	maxRefreshDelay := time.Second
+	clock := sturdyc.NewTestClock(time.Now())
+	c := sturdyc.New[string](100, 1, time.Hour, 5,
+		sturdyc.WithNoContinuousEvictions(),
+		sturdyc.WithEarlyRefreshes(minRefreshDelay, maxRefreshDelay, time.Millisecond*10),
+		sturdyc.WithClock(clock),
+		sturdyc.WithRefreshContextFn(func() context.Context {
+			return context.WithValue(context.Background(), contextKey("credentials"), "secret")
+		}),
+	)
+
+	sturdyc.GetOrFetch(ctx, c, "1", func(context.Context) (string, error) {
+		return "value1", nil
+	})
+
+	credentials := make(chan any, 1)
+	clock.Add(maxRefreshDelay + 1)
+	sturdyc.GetOrFetch(ctx, c, "1", func(ctx context.Context) (string, error) {
+		credentials <- ctx.Value(contextKey("credentials"))
+		return "value1", nil
+	})
+
+	select {
+	case value := <-credentials:
+		if value != "secret" {
+			t.Errorf("expected the refresh context to carry the credentials, got %v", value)
+		}
+	case <-time.After(time.Second):
+		t.Error("expected the record to be refreshed")
+	}
+}
+
+func TestFetchBufferingCoalescesTheMissesOfConcurrentBatches(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	clock := sturdyc.NewTestClock(time.Now())
+	c := sturdyc.New[string](100, 2, time.Hour, 10,
+		sturdyc.WithNoContinuousEvictions(),
+		sturdyc.WithClock(clock),
+		sturdyc.WithFetchBuffering(4, time.Minute),
+	)
+
+	var mu sync.Mutex
+	var fetchedIDs [][]string
+	fetchFn := func(_ context.Context, ids []string) (map[string]string, error) {
+		mu.Lock()
+		fetchedIDs = append(fetchedIDs, ids)
+		mu.Unlock()
+		response := make(map[string]string, len(ids))
+		for _, id := range ids {
+			response[id] = "value" + id
+		}
+		return response, nil
+	}
+
+	var wg sync.WaitGroup
+	for _, ids := range [][]string{{"1", "2"}, {"3", "4"}} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			res, err := sturdyc.GetOrFetchBatch(ctx, c, ids, c.BatchKeyFn("item"), fetchFn)
+			if err != nil {
+				t.Errorf("expected no error, got %v", err)
+			}
+			for _, id := range ids {
+				if res[id] != "value"+id {
+					t.Errorf("expected value%s, got %s", id, res[id])
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	if len(fetchedIDs) != 1 || len(fetchedIDs[0]) != 4 {
+		t.Errorf("expected a single fetch of 4 ids, got %v", fetchedIDs)
+	}
+	if c.Size() != 4 {
+		t.Errorf("expected 4 entries in the cache, got %d", c.Size())
+	}
+}
+
+func TestFetchBufferingFetchesTheBufferOnceTheWindowHasPassed(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	window := time.Second
+	clock := sturdyc.NewTestClock(time.Now())
+	c := sturdyc.New[string](100, 2, time.Hour, 10,
+		sturdyc.WithNoContinuousEvictions(),
+		sturdyc.WithClock(clock),
+		sturdyc.WithFetchBuffering(10, window),
+	)
+
+	fetchFn := func(_ context.Context, ids []string) (map[string]string, error) {
+		response := make(map[string]string, len(ids))
+		for _, id := range ids {
+			response[id] = "value" + id
+		}
+		return response, nil
+	}
+
+	done := make(chan map[string]string)
+	go func() {
+		res, _ := sturdyc.GetOrFetchBatch(ctx, c, []string{"1"}, c.BatchKeyFn("item"), fetchFn)
+		done <- res
+	}()
+
+	time.Sleep(10 * time.Millisecond)
+	select {
+	case <-done:
+		t.Fatal("expected the call to wait for the window to pass")
+	default:
+	}
+
+	clock.Add(window)
+	select {
+	case res := <-done:
+		if res["1"] != "value1" {
+			t.Errorf("expected value1, got %s", res["1"])
+		}
+	case <-time.After(time.Second):
+		t.Error("expected the buffer to be fetched once the window had passed")
+	}
+}
+
+func TestGetOrFetchBatchWithErrorsReturnsTheErrorsOfEachID(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	c := sturdyc.New[string](100, 2, time.Hour, 10,
+		sturdyc.WithNoContinuousEvictions(),
+		sturdyc.WithMissingRecordStorage(),
+	)
+
+	errUnavailable := errors.New("unavailable")
+	fetchFn := func(_ context.Context, _ []string) (map[string]string, map[string]error) {
+		return map[string]string{"1": "value1"}, map[string]error{
+			"2": errUnavailable,
+			"3": sturdyc.ErrNotFound,
+		}
+	}
+
+	keyFn := c.BatchKeyFn("item")
+	res, errs, err := sturdyc.GetOrFetchBatchWithErrors(ctx, c, []string{"1", "2", "3"}, keyFn, fetchFn)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(res) != 1 || res["1"] != "value1" {
+		t.Errorf("expected only the successful record to be returned, got %v", res)
+	}
+	if !errors.Is(errs["2"], errUnavailable) || !errors.Is(errs["3"], sturdyc.ErrNotFound) {
+		t.Errorf("expected the errors of each id to be returned, got %v", errs)
+	}
+
+	if !c.Exists(keyFn("1")) {
+		t.Error("expected the successful record to be cached")
+	}
+	if c.Exists(keyFn("2")) {
+		t.Error("expected the failed record not to be cached")
+	}
+	if !c.ExistsAsMissing(keyFn("3")) {
+		t.Error("expected the record that wasn't found to be stored as missing")
+	}
+}
+
+func TestRefreshAheadThresholdRefreshesReadsInTheTailOfTheTTL(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	ttl := time.Minute
+	clock := sturdyc.NewTestClock(time.Now())
+	c := sturdyc.New[string](100, 1, ttl, 5,
+		sturdyc.WithNoContinuousEvictions(),
+		sturdyc.WithEarlyRefreshes(time.Second, time.Second, time.Second),
+		sturdyc.WithRefreshAheadThreshold(0.2),
+		sturdyc.WithClock(clock),
+	)
+
+	refreshes := make(chan struct{}, 10)
+	fetchFn := func(context.Context) (string, error) {
+		refreshes <- struct{}{}
+		return "value", nil
+	}
+	sturdyc.GetOrFetch(ctx, c, "1", fetchFn)
+	<-refreshes
+
+	clock.Add(40 * time.Second)
+	sturdyc.GetOrFetch(ctx, c, "1", fetchFn)
+	select {
+	case <-refreshes:
+		t.Fatal("expected no refresh before the tail of the TTL")
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	clock.Add(9 * time.Second)
+	sturdyc.GetOrFetch(ctx, c, "1", fetchFn)
+	sturdyc.GetOrFetch(ctx, c, "1", fetchFn)
+	select {
+	case <-refreshes:
+	case <-time.After(time.Second):
+		t.Fatal("expected a read in the tail of the TTL to trigger a refresh")
+	}
+	select {
+	case <-refreshes:
+		t.Error("expected the simultaneous reads to trigger a single refresh")
+	case <-time.After(10 * time.Millisecond):
+	}
+}
+
+func TestGetOrFetchWithKeyPassesTheArgumentToTheFetchFn(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	c := sturdyc.New[string](100, 1, time.Hour, 5, sturdyc.WithNoContinuousEvictions())
+
+	var calls atomic.Int32
+	fetchFn := func(_ context.Context, arg string) (string, error) {
+		calls.Add(1)
+		return "result for " + arg, nil
+	}
+
+	for _, arg := range []string{"Query ", "query", " QUERY"} {
+		res, err := sturdyc.GetOrFetchWithKey(ctx, c, strings.ToLower(strings.TrimSpace(arg)), arg, fetchFn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res != "result for Query " {
+			t.Errorf("expected the value of the first argument, got %q", res)
+		}
+	}
+	if calls.Load() != 1 {
+		t.Errorf("expected the fetchFn to be called once, got %d", calls.Load())
+	}
+	if _, ok := c.Get("query"); !ok {
+		t.Error("expected the value to be stored under the cache key")
+	}
+}
+
+func TestReadOnlyClientsServeTheCachedValuesWithoutFetching(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	c := sturdyc.New[string](100, 1, time.Hour, 5, sturdyc.WithNoContinuousEvictions())
+	c.Set("cached", "value")
+	c.SetReadOnly(true)
+
+	var calls atomic.Int32
+	fetchFn := func(context.Context) (string, error) {
+		calls.Add(1)
+		return "fetched", nil
+	}
+	batchFetchFn := func(_ context.Context, _ []string) (map[string]string, error) {
+		calls.Add(1)
+		return map[string]string{}, nil
+	}
+
+	res, err := c.GetOrFetch(ctx, "cached", fetchFn)
+	if err != nil || res != "value" {
+		t.Errorf("expected the cached value to be served, got %q and %v", res, err)
+	}
+	if _, err := c.GetOrFetch(ctx, "missing", fetchFn); !errors.Is(err, sturdyc.ErrReadOnly) {
+		t.Errorf("expected ErrReadOnly for a missing key, got %v", err)
+	}
+	if _, err := c.GetOrFetchBatch(ctx, []string{"1", "2"}, c.BatchKeyFn("key"), batchFetchFn); !errors.Is(err, sturdyc.ErrReadOnly) {
+		t.Errorf("expected ErrReadOnly for a batch of missing keys, got %v", err)
+	}
+	if calls.Load() != 0 {
+		t.Errorf("expected the fetchFns to never be called, got %d calls", calls.Load())
+	}
+
+	c.Set("written", "value")
+	if _, ok := c.Get("written"); ok {
+		t.Error("expected the write to be discarded")
+	}
+
+	c.SetReadOnly(false)
+	res, err = c.GetOrFetch(ctx, "missing", fetchFn)
+	if err != nil || res != "fetched" {
+		t.Errorf("expected the value to be fetched once the client is writable, got %q and %v", res, err)
+	}
+}
+
+type adaptiveRefreshRecorder struct {
+	*TestMetricsRecorder
+	factors chan float64
+}
+
+func (r *adaptiveRefreshRecorder) RefreshIntervalFactor(factor float64) {
+	r.factors <- factor
+}
+
+func TestAdaptiveRefreshScalesTheRefreshIntervalsByTheLatency(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	clock := sturdyc.NewTestClock(time.Now())
+	recorder := &adaptiveRefreshRecorder{
+		TestMetricsRecorder: newTestMetricsRecorder(1),
+		factors:             make(chan float64, 10),
+	}
+	c := sturdyc.New[string](100, 1, time.Hour, 5,
+		sturdyc.WithNoContinuousEvictions(),
+		sturdyc.WithClock(clock),
+		sturdyc.WithEarlyRefreshes(10*time.Second, 10*time.Second, time.Second),
+		sturdyc.WithAdaptiveRefresh(100*time.Millisecond),
+		sturdyc.WithMetrics(recorder),
+	)
+
+	fetchWithLatency := func(latency time.Duration) sturdyc.FetchFn[string] {
+		return func(context.Context) (string, error) {
+			clock.Add(latency)
+			return "value", nil
+		}
+	}
+
+	// A data source that is four times slower than the target.
+	if _, err := c.GetOrFetch(ctx, "slow", fetchWithLatency(400*time.Millisecond)); err != nil {
+		t.Fatal(err)
+	}
+	dueAt, _ := c.RefreshDueAt("slow")
+	if delay := dueAt.Sub(clock.Now()); delay != 40*time.Second {
+		t.Errorf("expected the refresh interval to be scaled to 40s, got %v", delay)
+	}
+	if factor := <-recorder.factors; factor != 4 {
+		t.Errorf("expected a factor of 4 to be reported, got %v", factor)
+	}
+
+	// A fast response moves the average back towards the target.
+	if _, err := c.GetOrFetch(ctx, "fast", fetchWithLatency(0)); err != nil {
+		t.Fatal(err)
+	}
+	dueAt, _ = c.RefreshDueAt("fast")
+	if delay := dueAt.Sub(clock.Now()); delay != 32*time.Second {
+		t.Errorf("expected the refresh interval to be scaled to 32s, got %v", delay)
+	}
+}
+
+func TestAdaptiveRefreshIgnoresTheFetchesThatFailFast(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	clock := sturdyc.NewTestClock(time.Now())
+	c := sturdyc.New[string](100, 1, time.Hour, 5,
+		sturdyc.WithNoContinuousEvictions(),
+		sturdyc.WithClock(clock),
+		sturdyc.WithEarlyRefreshes(10*time.Second, 10*time.Second, time.Second),
+		sturdyc.WithAdaptiveRefresh(100*time.Millisecond),
+		sturdyc.WithCircuitBreaker(1, time.Minute),
+	)
+
+	slowFetch := func(context.Context) (string, error) {
+		clock.Add(400 * time.Millisecond)
+		return "value", nil
+	}
+	failingFetch := func(context.Context) (string, error) {
+		return "", errors.New("unavailable")
+	}
+	if _, err := c.GetOrFetch(ctx, "1", slowFetch); err != nil {
+		t.Fatal(err)
+	}
+
+	// Neither the failure, nor the fetches that are rejected by the
+	// open breaker, should make the data source appear to be faster.
+	for _, key := range []string{"2", "3", "4"} {
+		if _, err := c.GetOrFetch(ctx, key, failingFetch); err == nil {
+			t.Fatal("expected the fetch to fail")
+		}
+	}
+
+	clock.Add(time.Minute)
+	if _, err := c.GetOrFetch(ctx, "5", slowFetch); err != nil {
+		t.Fatal(err)
+	}
+	dueAt, _ := c.RefreshDueAt("5")
+	if delay := dueAt.Sub(clock.Now()); delay != 40*time.Second {
+		t.Errorf("expected the refresh interval to remain scaled to 40s, got %v", delay)
+	}
+}
+
+func TestWithBypassFetchesAndOverwritesTheCachedValues(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	c := sturdyc.New[string](100, 1, time.Hour, 5, sturdyc.WithNoContinuousEvictions())
+	c.Set("key", "cached")
+	c.Set(c.BatchKeyFn("key")("1"), "cached")
+	c.Set(c.BatchKeyFn("key")("2"), "cached")
+
+	fetchFn := func(context.Context) (string, error) {
+		return "fresh", nil
+	}
+	batchFetchFn := func(_ context.Context, ids []string) (map[string]string, error) {
+		response := make(map[string]string, len(ids))
+		for _, id := range ids {
+			response[id] = "fresh"
+		}
+		return response, nil
+	}
+
+	res, err := c.GetOrFetch(ctx, "key", fetchFn)
+	if err != nil || res != "cached" {
+		t.Fatalf("expected the cached value without a bypass, got %q and %v", res, err)
+	}
+	res, err = c.GetOrFetch(sturdyc.WithBypass(ctx), "key", fetchFn)
+	if err != nil || res != "fresh" {
+		t.Errorf("expected the bypass to fetch a fresh value, got %q and %v", res, err)
+	}
+	if v, _ := c.Get("key"); v != "fresh" {
+		t.Errorf("expected the bypass to overwrite the cached value, got %q", v)
+	}
+
+	batch, err := c.GetOrFetchBatch(sturdyc.WithBypass(ctx), []string{"1", "2"}, c.BatchKeyFn("key"), batchFetchFn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if batch["1"] != "fresh" || batch["2"] != "fresh" {
+		t.Errorf("expected the bypass to fetch fresh values for the batch, got %v", batch)
+	}
+	if v, _ := c.Get(c.BatchKeyFn("key")("2")); v != "fresh" {
+		t.Errorf("expected the bypass to overwrite the cached values of the batch, got %q", v)
+	}
+
+	c.Set(c.BatchKeyFn("key")("1"), "cached")
+	partialFetchFn := func(ctx context.Context, ids []string) (map[string]string, map[string]error) {
+		response, _ := batchFetchFn(ctx, ids)
+		return response, nil
+	}
+	batch, _, err = c.GetOrFetchBatchWithErrors(sturdyc.WithBypass(ctx), []string{"1"}, c.BatchKeyFn("key"), partialFetchFn)
+	if err != nil || batch["1"] != "fresh" {
+		t.Errorf("expected the bypass to fetch fresh values for the partial batch, got %v and %v", batch, err)
+	}
+}
+
+func TestGetOrFetchWithTTLStoresTheValueWithTheTTLOfTheCall(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	clock := sturdyc.NewTestClock(time.Now())
+	c := sturdyc.New[string](100, 1, time.Hour, 5,
+		sturdyc.WithNoContinuousEvictions(),
+		sturdyc.WithClock(clock),
+	)
+
+	fetchFn := func(context.Context) (string, error) {
+		return "value", nil
+	}
+	if _, err := sturdyc.GetOrFetchWithTTL(ctx, c, "short", time.Minute, fetchFn); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.GetOrFetch(ctx, "default", fetchFn); err != nil {
+		t.Fatal(err)
+	}
+
+	if ttl, _ := c.TTL("short"); ttl != time.Minute {
+		t.Errorf("expected the TTL of the call to be used, got %v", ttl)
+	}
+	if ttl, _ := c.TTL("default"); ttl != time.Hour {
+		t.Errorf("expected the default TTL to be used, got %v", ttl)
+	}
+
+	clock.Add(time.Minute + time.Second)
+	if _, ok := c.Get("short"); ok {
+		t.Error("expected the value to expire after the TTL of the call")
+	}
+	if _, ok := c.Get("default"); !ok {
+		t.Error("expected the value with the default TTL to still be cached")
+	}
+}
+
+func TestGetOrFetchWithTTLIsNotInheritedByNestedCalls(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	c := sturdyc.New[string](100, 1, time.Hour, 5,
+		sturdyc.WithNoContinuousEvictions(),
+		sturdyc.WithClock(sturdyc.NewTestClock(time.Now())),
+	)
+
+	innerFetchFn := func(context.Context) (string, error) {
+		return "inner", nil
+	}
+	outerFetchFn := func(ctx context.Context) (string, error) {
+		return c.GetOrFetch(ctx, "inner", innerFetchFn)
+	}
+	if _, err := c.GetOrFetchWithTTL(ctx, "outer", time.Minute, outerFetchFn); err != nil {
+		t.Fatal(err)
+	}
+
+	if ttl, _ := c.TTL("outer"); ttl != time.Minute {
+		t.Errorf("expected the TTL of the call to be used, got %v", ttl)
+	}
+	if ttl, _ := c.TTL("inner"); ttl != time.Hour {
+		t.Errorf("expected the nested call to use the default TTL, got %v", ttl)
+	}
+}
+
+func TestEmptyBatchesAreTreatedAsErrors(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	c := sturdyc.New[string](100, 1, time.Hour, 5,
+		sturdyc.WithNoContinuousEvictions(),
+		sturdyc.WithMissingRecordStorage(),
+		sturdyc.WithTreatEmptyBatchAsError(),
+	)
+	keyFn := c.BatchKeyFn("key")
+
+	emptyFetchFn := func(context.Context, []string) (map[string]string, error) {
+		return map[string]string{}, nil
+	}
+	if _, err := c.GetOrFetchBatch(ctx, []string{"1", "2"}, keyFn, emptyFetchFn); !errors.Is(err, sturdyc.ErrEmptyBatch) {
+		t.Errorf("expected ErrEmptyBatch, got %v", err)
+	}
+	if c.Exists(keyFn("1")) || c.Exists(keyFn("2")) {
+		t.Error("expected the IDs of the empty batch to not be stored as missing records")
+	}
+
+	partialFetchFn := func(context.Context, []string) (map[string]string, error) {
+		return map[string]string{"1": "value"}, nil
+	}
+	res, err := c.GetOrFetchBatch(ctx, []string{"1", "2"}, keyFn, partialFetchFn)
+	if err != nil || res["1"] != "value" {
+		t.Fatalf("expected the partial response to be returned, got %v and %v", res, err)
+	}
+	if !c.Exists(keyFn("2")) {
+		t.Error("expected the ID that was absent from a partial response to be stored as a missing record")
+	}
+}
+
+func TestSoftTTLServesTheStaleValueUntilTheHardExpiry(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	ttl := time.Minute
+	clock := sturdyc.NewTestClock(time.Now())
+	c := sturdyc.New[string](100, 1, ttl, 5,
+		sturdyc.WithNoContinuousEvictions(),
+		sturdyc.WithSoftTTL(20*time.Second),
+		sturdyc.WithClock(clock),
+	)
+
+	var calls atomic.Int32
+	refreshed := make(chan struct{}, 10)
+	release := make(chan struct{})
+	fetchFn := func(context.Context) (string, error) {
+		if calls.Add(1) == 1 {
+			return "value-1", nil
+		}
+		<-release
+		refreshed <- struct{}{}
+		return "value-2", nil
+	}
+	sturdyc.GetOrFetch(ctx, c, "1", fetchFn)
+
+	clock.Add(10 * time.Second)
+	if _, ok := c.Get("1"); !ok {
+		t.Fatal("expected the value to be fresh before the soft expiry")
+	}
+	if calls.Load() != 1 {
+		t.Errorf("expected no refresh before the soft expiry, got %d calls", calls.Load())
+	}
+
+	clock.Add(15 * time.Second)
+	res, err := sturdyc.GetOrFetch(ctx, c, "1", fetchFn)
+	if err != nil || res != "value-1" {
+		t.Errorf("expected the stale value to be served after the soft expiry, got %s and %v", res, err)
+	}
+	close(release)
+	select {
+	case <-refreshed:
+	case <-time.After(time.Second):
+		t.Fatal("expected a read after the soft expiry to schedule a refresh")
+	}
+	waitFor(t, func() bool {
+		v, _ := c.Get("1")
+		return v == "value-2"
+	})
+
+	clock.Add(ttl + time.Second)
+	if _, ok := c.Get("1"); ok {
+		t.Error("expected a miss after the hard expiry")
+	}
+}
+
+func TestGetOrFetchWithSourceReportsWhereTheValueCameFrom(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	ttl := time.Minute
+	clock := sturdyc.NewTestClock(time.Now())
+	c := sturdyc.New[string](100, 1, ttl, 5,
+		sturdyc.WithNoContinuousEvictions(),
+		sturdyc.WithClock(clock),
+		sturdyc.WithStaleWhileError(time.Hour),
+	)
+
+	fetchFn := func(context.Context) (string, error) {
+		return "value", nil
+	}
+	if _, source, _ := sturdyc.GetOrFetchWithSource(ctx, c, "1", fetchFn); source != sturdyc.SourceFetched {
+		t.Errorf("expected the value to be fetched, got %s", source)
+	}
+	if _, source, _ := sturdyc.GetOrFetchWithSource(ctx, c, "1", fetchFn); source != sturdyc.SourceCache {
+		t.Errorf("expected the value to be served from the cache, got %s", source)
+	}
+
+	clock.Add(ttl + time.Second)
+	failingFetch := func(context.Context) (string, error) {
+		return "", errors.New("unavailable")
+	}
+	value, source, err := sturdyc.GetOrFetchWithSource(ctx, c, "1", failingFetch)
+	if source != sturdyc.SourceStale || !errors.Is(err, sturdyc.ErrStaleRecord) || value != "value" {
+		t.Errorf("expected the stale value to be served, got %s %s %v", value, source, err)
+	}
+}
+
+func TestRefreshConcurrencyQueuesTheRefreshesOverTheLimit(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	refreshDelay := time.Second
+	clock := sturdyc.NewTestClock(time.Now())
+	c := sturdyc.New[string](100, 2, time.Hour, 5,
+		sturdyc.WithNoContinuousEvictions(),
+		sturdyc.WithEarlyRefreshes(refreshDelay, refreshDelay, time.Second),
+		sturdyc.WithRefreshConcurrency(1),
+		sturdyc.WithClock(clock),
+	)
+
+	for _, key := range []string{"1", "2"} {
+		sturdyc.GetOrFetch(ctx, c, key, func(context.Context) (string, error) {
+			return "value", nil
+		})
+	}
+
+	release := make(chan struct{})
+	var refreshes atomic.Int32
+	blockingFetch := func(context.Context) (string, error) {
+		refreshes.Add(1)
+		<-release
+		return "refreshed", nil
+	}
+
+	clock.Add(refreshDelay + 1)
+	for _, key := range []string{"1", "2"} {
+		if v, _ := sturdyc.GetOrFetch(ctx, c, key, blockingFetch); v != "value" {
+			t.Errorf("expected the cached value to be served while refreshing, got %s", v)
+		}
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	if refreshes.Load() != 1 {
+		t.Errorf("expected a single refresh to be in-flight, got %d", refreshes.Load())
+	}
+	if c.RefreshQueueDepth() != 1 {
+		t.Errorf("expected one refresh to be queued, got %d", c.RefreshQueueDepth())
+	}
+
+	close(release)
+	time.Sleep(50 * time.Millisecond)
+	if refreshes.Load() != 2 {
+		t.Errorf("expected the queued refresh to run once a slot was freed, got %d", refreshes.Load())
+	}
+	if c.RefreshQueueDepth() != 0 {
+		t.Errorf("expected the queue to be empty, got %d", c.RefreshQueueDepth())
+	}
+}
+
+func TestBatchChunkingSplitsTheMissesAndBoundsTheParallelism(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	c := sturdyc.New[string](1000, 2, time.Hour, 10,
+		sturdyc.WithNoContinuousEvictions(),
+		sturdyc.WithBatchChunking(3, 2),
+	)
+
+	var mu sync.Mutex
+	var inFlight, maxInFlight, calls int
+	errUnavailable := errors.New("unavailable")
+	fetchFn := func(_ context.Context, ids []string) (map[string]string, error) {
+		mu.Lock()
+		calls++
+		inFlight++
+		maxInFlight = max(maxInFlight, inFlight)
+		mu.Unlock()
+
+		time.Sleep(20 * time.Millisecond)
+
+		mu.Lock()
+		inFlight--
+		mu.Unlock()
+
+		if len(ids) > 3 {
+			t.Errorf("expected chunks of at most 3 ids, got %d", len(ids))
+		}
+		if slices.Contains(ids, "10") {
+			return nil, errUnavailable
+		}
+		res := make(map[string]string, len(ids))
+		for _, id := range ids {
+			res[id] = "value" + id
+		}
+		return res, nil
+	}
+
+	ids := []string{"1", "2", "3", "4", "5", "6", "7", "8", "9", "10"}
+	res, err := sturdyc.GetOrFetchBatch(ctx, c, ids, c.BatchKeyFn("item"), fetchFn)
+	if !errors.Is(err, sturdyc.ErrPartialBatch) {
+		t.Fatalf("expected ErrPartialBatch, got %v", err)
+	}
+	if len(res) != 9 || res["9"] != "value9" {
+		t.Errorf("expected the records of the successful chunks, got %v", res)
+	}
+	if calls != 4 {
+		t.Errorf("expected 4 chunks to be fetched, got %d", calls)
+	}
+	if maxInFlight > 2 {
+		t.Errorf("expected at most 2 chunks in flight, got %d", maxInFlight)
+	}
+}
+
+func TestFetchTimeoutUsesTheClockOfTheCache(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	clock := sturdyc.NewTestClock(time.Now())
+	c := sturdyc.New[string](10, 2, time.Minute, 10,
+		sturdyc.WithNoContinuousEvictions(),
+		sturdyc.WithClock(clock),
+		sturdyc.WithFetchTimeout(time.Second),
+	)
+
+	release := make(chan struct{})
+	defer close(release)
+	hangingFetch := func(_ context.Context) (string, error) {
+		<-release
+		return "value", nil
+	}
+
+	errChan := make(chan error, 1)
+	go func() {
+		_, err := sturdyc.GetOrFetch(ctx, c, "1", hangingFetch)
+		errChan <- err
+	}()
+
+	// The timeout shouldn't pass until the clock has been moved forward.
+	time.Sleep(10 * time.Millisecond)
+	select {
+	case err := <-errChan:
+		t.Fatalf("expected the fetch to still be waiting, got %v", err)
+	default:
+	}
+
+	clock.Add(time.Second)
+	if err := <-errChan; !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected context.DeadlineExceeded, got %v", err)
+	}
+}
+
+type fallbackRecorder struct {
+	*TestMetricsRecorder
+	fallbacks atomic.Int32
+}
+
+func (r *fallbackRecorder) FallbackServed() {
+	r.fallbacks.Add(1)
+}
+
+func TestGetOrFetchWithFallbackServesTheFallbackIfTheFetchFails(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	recorder := &fallbackRecorder{TestMetricsRecorder: newTestMetricsRecorder(1)}
+	c := sturdyc.New[string](10, 1, time.Minute, 10,
+		sturdyc.WithNoContinuousEvictions(),
+		sturdyc.WithMetrics(recorder),
+	)
+
+	failingFetch := func(_ context.Context) (string, error) {
+		return "", errors.New("unavailable")
+	}
+	if res := sturdyc.GetOrFetchWithFallback(ctx, c, "1", failingFetch, "default"); res != "default" {
+		t.Errorf("expected the fallback, got %s", res)
+	}
+	if c.Exists("1") {
+		t.Error("expected the fallback not to be cached")
+	}
+	if recorder.fallbacks.Load() != 1 || recorder.cacheMisses != 1 {
+		t.Errorf("expected a miss and a fallback to be recorded, got %d and %d", recorder.cacheMisses, recorder.fallbacks.Load())
+	}
+
+	successfulFetch := func(_ context.Context) (string, error) {
+		return "value", nil
+	}
+	if res := sturdyc.GetOrFetchWithFallback(ctx, c, "1", successfulFetch, "default"); res != "value" {
+		t.Errorf("expected the fetched value, got %s", res)
+	}
+}
+
+func TestFallbackTTLCachesTheFallback(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	clock := sturdyc.NewTestClock(time.Now())
+	c := sturdyc.New[string](10, 1, time.Minute, 10,
+		sturdyc.WithNoContinuousEvictions(),
+		sturdyc.WithClock(clock),
+		sturdyc.WithFallbackTTL(time.Second),
+	)
+
+	var calls atomic.Int32
+	failingFetch := func(_ context.Context) (string, error) {
+		calls.Add(1)
+		return "", errors.New("unavailable")
+	}
+	for i := 0; i < 3; i++ {
+		if res := c.GetOrFetchWithFallback(ctx, "1", failingFetch, "default"); res != "default" {
+			t.Errorf("expected the fallback, got %s", res)
+		}
+	}
+	if calls.Load() != 1 {
+		t.Errorf("expected the cached fallback to be served, got %d calls", calls.Load())
+	}
+
+	clock.Add(time.Second + 1)
+	c.GetOrFetchWithFallback(ctx, "1", failingFetch, "default")
+	if calls.Load() != 2 {
+		t.Errorf("expected the fallback to expire, got %d calls", calls.Load())
+	}
+}
+
+func TestGetOrFetchChainTriesEachFetchFnInOrder(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	c := sturdyc.New[string](10, 1, time.Minute, 10,
+		sturdyc.WithNoContinuousEvictions(),
+	)
+
+	var calls []string
+	errPrimary := errors.New("primary unavailable")
+	errReplica := errors.New("replica unavailable")
+	primary := func(_ context.Context) (string, error) {
+		calls = append(calls, "primary")
+		return "", errPrimary
+	}
+	replica := func(_ context.Context) (string, error) {
+		calls = append(calls, "replica")
+		return "from-replica", nil
+	}
+	unreachable := func(_ context.Context) (string, error) {
+		calls = append(calls, "unreachable")
+		return "", nil
+	}
+
+	res, err := sturdyc.GetOrFetchChain(ctx, c, "1", primary, replica, unreachable)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if res != "from-replica" {
+		t.Errorf("expected the value of the replica, got %s", res)
+	}
+	if !slices.Equal(calls, []string{"primary", "replica"}) {
+		t.Errorf("expected the chain to stop at the first success, got %v", calls)
+	}
+	if v, ok := c.Get("1"); !ok || v != "from-replica" {
+		t.Error("expected the successful value to be cached")
+	}
+
+	failingReplica := func(_ context.Context) (string, error) {
+		return "", errReplica
+	}
+	_, err = c.GetOrFetchChain(ctx, "2", primary, failingReplica)
+	if !errors.Is(err, errPrimary) || !errors.Is(err, errReplica) {
+		t.Errorf("expected the errors of every fetchFn to be joined, got %v", err)
+	}
+}
+
+func TestGetOrFetchChainPanicsWithoutAnyFetchFns(t *testing.T) {
+	t.Parallel()
+
+	defer func() {
+		err := recover()
+		if err == nil {
+			t.Error("expected a panic when the chain is empty")
+		}
+	}()
+	c := sturdyc.New[string](100, 1, time.Minute, 5, sturdyc.WithNoContinuousEvictions())
+	_, _ = c.GetOrFetchChain(context.Background(), "key")
+}
+
+func TestGetOrFetchAsyncNeverBlocksOnTheFetch(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	ttl := time.Minute
+	clock := sturdyc.NewTestClock(time.Now())
+	c := sturdyc.New[string](10, 1, ttl, 10,
+		sturdyc.WithNoContinuousEvictions(),
+		sturdyc.WithStaleWhileError(time.Hour),
+		sturdyc.WithClock(clock),
+	)
+
+	release := make(chan struct{})
+	var calls atomic.Int32
+	fetchFn := func(_ context.Context) (string, error) {
+		calls.Add(1)
+		<-release
+		return "value", nil
+	}
+
+	if _, ok := c.GetOrFetchAsync(ctx, "1", fetchFn); ok {
+		t.Fatal("expected a cold miss to report that no data was available")
+	}
+	if _, ok := sturdyc.GetOrFetchAsync(ctx, c, "1", fetchFn); ok {
+		t.Fatal("expected the key to be absent while it's being fetched")
+	}
+	close(release)
+
+	for {
+		if res, ok := c.GetOrFetchAsync(ctx, "1", fetchFn); ok {
+			if res != "value" {
+				t.Errorf("expected the fetched value, got %s", res)
+			}
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if n := calls.Load(); n != 1 {
+		t.Errorf("expected the background fetches to be deduplicated, got %d calls", n)
+	}
+
+	// Expired values within the max staleness are served while the key is fetched again.
+	clock.Add(ttl + time.Second)
+	if res, ok := c.GetOrFetchAsync(ctx, "1", fetchFn); !ok || res != "value" {
+		t.Errorf("expected the expired value to be served, got %q", res)
+	}
+}
+
+func TestInvalidKeysAreRejectedBeforeEnteringTheCache(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	errUpperCase := errors.New("keys must be lower case")
+	c := sturdyc.New[string](10, 1, time.Minute, 10,
+		sturdyc.WithNoContinuousEvictions(),
+		sturdyc.WithMaxKeyLength(8),
+		sturdyc.WithKeyValidator(func(key string) error {
+			if strings.ToLower(key) != key {
+				return errUpperCase
+			}
+			return nil
+		}),
+	)
+
+	fetchObserver := NewFetchObserver(1)
+	fetchObserver.Response("1")
+	_, err := sturdyc.GetOrFetch(ctx, c, "much-too-long", fetchObserver.Fetch)
+	if !errors.Is(err, sturdyc.ErrInvalidKey) {
+		t.Errorf("expected a key that is too long to be rejected, got %v", err)
+	}
+	_, err = c.GetOrFetch(ctx, "UPPER", fetchObserver.Fetch)
+	if !errors.Is(err, sturdyc.ErrInvalidKey) || !errors.Is(err, errUpperCase) {
+		t.Errorf("expected the error of the validator to be wrapped, got %v", err)
+	}
+	fetchObserver.AssertFetchCount(t, 0)
+
+	_, err = c.GetOrFetchBatch(ctx, []string{"1", "2"}, c.BatchKeyFn("much-too-long"), func(_ context.Context, _ []string) (map[string]string, error) {
+		t.Error("expected the batch to be rejected before it's fetched")
+		return nil, nil
+	})
+	if !errors.Is(err, sturdyc.ErrInvalidKey) {
+		t.Errorf("expected the batch to be rejected, got %v", err)
+	}
+
+	if res := c.SetWithResult("UPPER", "value"); res.Written {
+		t.Error("expected the write of an invalid key to be dropped")
+	}
+	if c.Size() != 0 {
+		t.Errorf("expected the cache to be empty, got %d entries", c.Size())
+	}
+}
+
+func TestGetOrFetchBatchSliceIsAlignedToTheIDs(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	c := sturdyc.New[string](100, 2, time.Minute, 10,
+		sturdyc.WithNoContinuousEvictions(),
+	)
+	keyFn := c.BatchKeyFn("item")
+	c.Set(keyFn("3"), "cached3")
+
+	fetchFn := func(_ context.Context, ids []string) (map[string]string, error) {
+		res := make(map[string]string)
+		for _, id := range ids {
+			// The data source doesn't have ID 2.
+			if id != "2" {
+				res[id] = "value" + id
+			}
+		}
+		return res, nil
+	}
+
+	ids := []string{"3", "1", "2", "4"}
+	values, found, err := sturdyc.GetOrFetchBatchSlice(ctx, c, ids, keyFn, fetchFn)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	expectedValues := []string{"cached3", "value1", "", "value4"}
+	expectedFound := []bool{true, true, false, true}
+	if !slices.Equal(values, expectedValues) {
+		t.Errorf("expected the values %v, got %v", expectedValues, values)
+	}
+	if !slices.Equal(found, expectedFound) {
+		t.Errorf("expected the found slice %v, got %v", expectedFound, found)
+	}
+}
+
+func TestRelatedRecordsArePrefetchedInTheBackground(t *testing.T) {
+	t.Parallel()
+
+	prefetchFn := func(id string) []string {
+		return []string{id + "0", id + "1"}
+	}
+	c := sturdyc.New[string](100, 1, time.Minute, 5,
+		sturdyc.WithNoContinuousEvictions(),
+		sturdyc.WithPrefetchFn(prefetchFn),
+	)
+
+	var mu sync.Mutex
+	var calls [][]string
+	fetchFn := func(_ context.Context, ids []string) (map[string]string, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		batch := slices.Clone(ids)
+		slices.Sort(batch)
+		calls = append(calls, batch)
+		response := make(map[string]string, len(ids))
+		for _, id := range ids {
+			response[id] = "value" + id
+		}
+		return response, nil
+	}
+	fetchCalls := func() [][]string {
+		mu.Lock()
+		defer mu.Unlock()
+		return slices.Clone(calls)
+	}
+
+	keyFn := c.BatchKeyFn("item")
+	res, err := c.GetOrFetchBatch(context.Background(), []string{"1"}, keyFn, fetchFn)
+	if err != nil || res["1"] != "value1" {
+		t.Fatalf("expected the record to be fetched, got %v and %v", res, err)
+	}
+
+	waitFor(t, func() bool { return c.Size() == 3 })
+	if value, ok := c.Get(keyFn("10")); !ok || value != "value10" {
+		t.Errorf("expected the related record to have been prefetched, got %q and %t", value, ok)
+	}
+	if calls := fetchCalls(); len(calls) != 2 || !slices.Equal(calls[1], []string{"10", "11"}) {
+		t.Errorf("expected the related records to be fetched in one batch, got %v", calls)
+	}
+
+	// The prefetched records are cached, and they shouldn't
+	// have scheduled any prefetches of their own.
+	if _, err = c.GetOrFetchBatch(context.Background(), []string{"10", "11"}, keyFn, fetchFn); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	time.Sleep(10 * time.Millisecond)
+	if calls := fetchCalls(); len(calls) != 2 || c.Size() != 3 {
+		t.Errorf("expected the prefetches to not recurse, got %v", calls)
+	}
+}
+
+func TestRelatedRecordsArePrefetchedForSingleKeys(t *testing.T) {
+	t.Parallel()
+
+	prefetchFn := func(id string) []string {
+		return []string{id + "0", id + "1"}
+	}
+	c := sturdyc.New[string](100, 1, time.Minute, 5,
+		sturdyc.WithNoContinuousEvictions(),
+		sturdyc.WithPrefetchFn(prefetchFn),
+	)
+
+	var calls atomic.Int32
+	fetchFn := func(_ context.Context, arg string) (string, error) {
+		calls.Add(1)
+		return "value" + arg, nil
+	}
+
+	res, err := c.GetOrFetchWithKey(context.Background(), "1", "1", fetchFn)
+	if err != nil || res != "value1" {
+		t.Fatalf("expected the record to be fetched, got %q and %v", res, err)
+	}
+
+	waitFor(t, func() bool { return c.Size() == 3 })
+	if value, ok := c.Get("11"); !ok || value != "value11" {
+		t.Errorf("expected the related record to have been prefetched, got %q and %t", value, ok)
+	}
+	time.Sleep(10 * time.Millisecond)
+	if n := calls.Load(); n != 3 || c.Size() != 3 {
+		t.Errorf("expected the prefetches to not recurse, got %d calls", n)
+	}
+}
+
+func TestRelatedRecordsArePrefetchedForPartialBatches(t *testing.T) {
+	t.Parallel()
+
+	prefetchFn := func(id string) []string {
+		return []string{id + "0"}
+	}
+	c := sturdyc.New[string](100, 1, time.Minute, 5,
+		sturdyc.WithNoContinuousEvictions(),
+		sturdyc.WithBatchChunking(1, 1),
+		sturdyc.WithPrefetchFn(prefetchFn),
+	)
+
+	fetchFn := func(_ context.Context, ids []string) (map[string]string, error) {
+		if ids[0] == "2" {
+			return nil, errors.New("unavailable")
+		}
+		return map[string]string{ids[0]: "value" + ids[0]}, nil
+	}
+
+	keyFn := c.BatchKeyFn("item")
+	_, err := c.GetOrFetchBatch(context.Background(), []string{"1", "2"}, keyFn, fetchFn)
+	if !errors.Is(err, sturdyc.ErrPartialBatch) {
+		t.Fatalf("expected ErrPartialBatch, got %v", err)
+	}
+	waitFor(t, func() bool { return c.Exists(keyFn("10")) })
+	if c.Exists(keyFn("20")) {
+		t.Error("expected the records of the failed chunk to not cause any prefetches")
+	}
+}
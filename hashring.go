@@ -0,0 +1,55 @@
+package sturdyc
+
+import (
+	"cmp"
+	"slices"
+	"strconv"
+)
+
+// hashRing places the keys on the shards with consistent hashing. Each shard
+// is given a number of virtual nodes on the ring, and a key belongs to the
+// shard of the first node that follows its hash. Adding a shard only moves
+// the keys that end up in front of its nodes, while the rest stay in place.
+type hashRing struct {
+	hashes []uint64
+	shards []int
+}
+
+// newHashRing creates a ring with the virtual nodes of every shard. The
+// nodes are hashed with the same function as the keys.
+func newHashRing(numShards, virtualNodes int, hashFn func(string) uint64) *hashRing {
+	type node struct {
+		hash  uint64
+		shard int
+	}
+
+	nodes := make([]node, 0, numShards*virtualNodes)
+	for shard := 0; shard < numShards; shard++ {
+		for i := 0; i < virtualNodes; i++ {
+			name := "shard-" + strconv.Itoa(shard) + "-node-" + strconv.Itoa(i)
+			nodes = append(nodes, node{hash: hashFn(name), shard: shard})
+		}
+	}
+	slices.SortFunc(nodes, func(a, b node) int {
+		return cmp.Or(cmp.Compare(a.hash, b.hash), cmp.Compare(a.shard, b.shard))
+	})
+
+	ring := &hashRing{
+		hashes: make([]uint64, len(nodes)),
+		shards: make([]int, len(nodes)),
+	}
+	for i, n := range nodes {
+		ring.hashes[i] = n.hash
+		ring.shards[i] = n.shard
+	}
+	return ring
+}
+
+// shard returns the index of the shard that the hash belongs to.
+func (r *hashRing) shard(hash uint64) int {
+	i, _ := slices.BinarySearch(r.hashes, hash)
+	if i == len(r.hashes) {
+		i = 0
+	}
+	return r.shards[i]
+}
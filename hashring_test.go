@@ -0,0 +1,71 @@
+package sturdyc_test
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/creativecreature/sturdyc"
+)
+
+// shardPlacement returns the index of the shard that each key is placed on.
+func shardPlacement(t *testing.T, numShards int, keys []string, opts ...sturdyc.Option) map[string]int {
+	t.Helper()
+
+	recorder := newTestMetricsRecorder(numShards)
+	opts = append(opts, sturdyc.WithNoContinuousEvictions(), sturdyc.WithMetrics(recorder))
+	c := sturdyc.New[int](len(keys)*numShards, numShards, time.Hour, 10, opts...)
+
+	placement := make(map[string]int, len(keys))
+	for _, key := range keys {
+		recorder.Lock()
+		clear(recorder.shards)
+		recorder.Unlock()
+
+		c.Get(key)
+
+		recorder.Lock()
+		for index := range recorder.shards {
+			placement[key] = index
+		}
+		recorder.Unlock()
+	}
+	return placement
+}
+
+func TestConsistentHashingMovesFewKeysWhenTheShardsChange(t *testing.T) {
+	t.Parallel()
+
+	keys := make([]string, 10_000)
+	for i := range keys {
+		keys[i] = "key-" + strconv.Itoa(i)
+	}
+
+	before := shardPlacement(t, 10, keys, sturdyc.WithConsistentHashing(200))
+	after := shardPlacement(t, 11, keys, sturdyc.WithConsistentHashing(200))
+
+	var moved int
+	for _, key := range keys {
+		if before[key] != after[key] {
+			moved++
+			// Keys should only ever move to the shard that was added.
+			if after[key] != 10 {
+				t.Fatalf("expected %s to move to the new shard, got %d", key, after[key])
+			}
+		}
+	}
+
+	// Adding one shard to ten should move roughly 1/11 of the keys.
+	if movedPercentage := moved * 100 / len(keys); movedPercentage > 15 {
+		t.Errorf("expected at most 15%% of the keys to be moved, got %d%%", movedPercentage)
+	}
+
+	// Every shard should still receive keys.
+	counts := make(map[int]int)
+	for _, index := range after {
+		counts[index]++
+	}
+	if len(counts) != 11 {
+		t.Errorf("expected the keys to be spread over 11 shards, got %d", len(counts))
+	}
+}
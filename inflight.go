@@ -5,34 +5,85 @@ import (
 	"errors"
 	"fmt"
 	"sync"
+	"time"
 )
 
 type inFlightCall[T any] struct {
-	sync.WaitGroup
-	val T
-	err error
+	done chan struct{}
+	val  T
+	err  error
+	// errs holds the errors of the individual IDs of a batch call.
+	errs batchErrors
 }
 
-// newFlight should be called with a lock.
-func (c *Client[T]) newFlight(key string) *inFlightCall[T] {
-	call := new(inFlightCall[T])
-	call.Add(1)
-	c.inFlightMap[key] = call
+func newInFlightCall[T any]() *inFlightCall[T] {
+	return &inFlightCall[T]{done: make(chan struct{})}
+}
+
+// wait blocks until the call has completed, or the context is cancelled.
+// Cancelling the context only stops this caller from waiting. The call
+// itself keeps running for any other callers that are waiting for it.
+func (call *inFlightCall[T]) wait(ctx context.Context) error {
+	select {
+	case <-call.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// numInFlightStripes is the number of stripes that the in-flight calls of a
+// shard are split into. The keys of a shard only contend for the lock of the
+// in-flight calls with the keys that are in the same stripe.
+const numInFlightStripes = 16
+
+// inFlightStripe holds the in-flight calls for a subset of the keys in a shard.
+type inFlightStripe[T any] struct {
+	sync.Mutex
+	calls map[string]*inFlightCall[T]
+}
+
+// inFlightStripe returns the stripe that tracks the in-flight calls of the
+// key. The key is hashed a second time, since the shard only holds on to
+// its index. The low bits of the hash are likely to be the same for every
+// key in the shard, which is why the higher ones are folded into them first.
+// This also spreads the keys out for hash functions that only use 32 bits.
+func (s *shard[T]) inFlightStripe(key string) *inFlightStripe[T] {
+	h := s.hashFn(key)
+	h ^= h>>32 ^ h>>16
+	return &s.inFlight[h%numInFlightStripes]
+}
+
+// newFlight should be called with the lock of the stripe.
+func (stripe *inFlightStripe[T]) newFlight(key string) *inFlightCall[T] {
+	if stripe.calls == nil {
+		stripe.calls = make(map[string]*inFlightCall[T])
+	}
+	call := newInFlightCall[T]()
+	stripe.calls[key] = call
 	return call
 }
 
-func makeCall[T, V any](ctx context.Context, c *Client[T], key string, fn FetchFn[V], call *inFlightCall[T]) {
+// endFlight removes the call from the in-flight map and notifies the callers that are waiting for it.
+func (s *shard[T]) endFlight(key string, call *inFlightCall[T]) {
+	stripe := s.inFlightStripe(key)
+	stripe.Lock()
+	delete(stripe.calls, key)
+	stripe.Unlock()
+	close(call.done)
+}
+
+// makeCall stores the value with the TTL, or with the default TTL of the
+// client if it isn't greater than 0.
+func makeCall[T, V any](ctx context.Context, c *Client[T], s *shard[T], key string, ttl time.Duration, fn FetchFn[V], call *inFlightCall[T]) {
 	defer func() {
 		if err := recover(); err != nil {
 			call.err = fmt.Errorf("sturdyc: panic recovered: %v", err)
 		}
-		call.Done()
-		c.inFlightMutex.Lock()
-		delete(c.inFlightMap, key)
-		c.inFlightMutex.Unlock()
+		s.endFlight(key, call)
 	}()
 
-	response, err := fn(ctx)
+	response, err := callWithTimeout(ctx, c.Config, fn)
 	if err != nil && c.storeMissingRecords && errors.Is(err, ErrNotFound) {
 		c.StoreMissingRecord(key)
 		call.err = ErrMissingRecord
@@ -52,28 +103,52 @@ func makeCall[T, V any](ctx context.Context, c *Client[T], key string, fn FetchF
 
 	call.err = nil
 	call.val = res
-	c.Set(key, res)
+	if ttl > 0 {
+		s.setWithTTL(key, res, ttl, false)
+		return
+	}
+	c.set(key, res)
 }
 
-func callAndCache[V, T any](ctx context.Context, c *Client[T], key string, fn FetchFn[V]) (V, error) {
-	c.inFlightMutex.Lock()
-	if call, ok := c.inFlightMap[key]; ok {
-		c.inFlightMutex.Unlock()
-		call.Wait()
-		return unwrap[V, T](call.val, call.err)
+func callAndCache[V, T any](ctx context.Context, c *Client[T], key string, ttl time.Duration, fn FetchFn[V]) (V, error) {
+	if err := c.validateKey(key); err != nil {
+		var zero V
+		return zero, err
+	}
+	if c.readOnly.Load() {
+		var zero V
+		return zero, ErrReadOnly
+	}
+	call := startCall(ctx, c, key, ttl, fn)
+	if err := call.wait(ctx); err != nil {
+		var zero V
+		return zero, err
 	}
-
-	call := c.newFlight(key)
-	c.inFlightMutex.Unlock()
-	makeCall(ctx, c, key, fn, call)
 	return unwrap[V, T](call.val, call.err)
 }
 
+// startCall returns the in-flight call for the key, and starts a new one if
+// the key isn't already being fetched.
+func startCall[V, T any](ctx context.Context, c *Client[T], key string, ttl time.Duration, fn FetchFn[V]) *inFlightCall[T] {
+	s := c.shards[c.shardIndex(key)]
+	stripe := s.inFlightStripe(key)
+	stripe.Lock()
+	defer stripe.Unlock()
+	call, ok := stripe.calls[key]
+	if !ok {
+		call = stripe.newFlight(key)
+		// The call is shared by every caller that requests this key while it's
+		// in-flight. Hence, we don't want the cancellation of the context that
+		// happened to start it to abort the fetch for everyone else.
+		go makeCall(context.WithoutCancel(ctx), c, s, key, ttl, fn, call)
+	}
+	return call
+}
+
 // newBatchFlight should be called with a lock.
 func (c *Client[T]) newBatchFlight(ids []string, keyFn KeyFn) *inFlightCall[map[string]T] {
-	call := new(inFlightCall[map[string]T])
+	call := newInFlightCall[map[string]T]()
 	call.val = make(map[string]T, len(ids))
-	call.Add(1)
 	for _, id := range ids {
 		c.inFlightBatchMap[keyFn(id)] = call
 	}
@@ -81,12 +156,12 @@ func (c *Client[T]) newBatchFlight(ids []string, keyFn KeyFn) *inFlightCall[map[
 }
 
 func (c *Client[T]) endBatchFlight(ids []string, keyFn KeyFn, call *inFlightCall[map[string]T]) {
-	call.Done()
 	c.inFlightBatchMutex.Lock()
 	for _, id := range ids {
 		delete(c.inFlightBatchMap, keyFn(id))
 	}
 	c.inFlightBatchMutex.Unlock()
+	close(call.done)
 }
 
 type makeBatchCallOpts[T, V any] struct {
@@ -97,18 +172,33 @@ type makeBatchCallOpts[T, V any] struct {
 }
 
 func makeBatchCall[T, V any](ctx context.Context, c *Client[T], opts makeBatchCallOpts[T, V]) {
-	response, err := opts.fn(ctx, opts.ids)
+	response, err := callWithTimeout(ctx, c.Config, func(ctx context.Context) (map[string]V, error) {
+		return opts.fn(ctx, opts.ids)
+	})
+
+	// A partial batch fetch reports the IDs that failed individually.
+	var idErrs batchErrors
+	if errors.As(err, &idErrs) {
+		opts.call.errs = idErrs
+		err = nil
+	}
+
 	if err != nil {
 		opts.call.err = err
 		return
 	}
 
-	// Check if we should store any of these IDs as a missing record.
+	// Check if we should store any of these IDs as a missing record. IDs that
+	// failed are only stored as missing if they weren't found at the source.
 	if c.storeMissingRecords && len(response) < len(opts.ids) {
 		for _, id := range opts.ids {
-			if _, ok := response[id]; !ok {
-				c.StoreMissingRecord(opts.keyFn(id))
+			if _, ok := response[id]; ok {
+				continue
 			}
+			if idErr, ok := idErrs[id]; ok && !errors.Is(idErr, ErrNotFound) {
+				continue
+			}
+			c.StoreMissingRecord(opts.keyFn(id))
 		}
 	}
 
@@ -119,11 +209,31 @@ func makeBatchCall[T, V any](ctx context.Context, c *Client[T], opts makeBatchCa
 			c.log.Error("sturdyc: invalid type for ID:" + id)
 			continue
 		}
-		c.Set(opts.keyFn(id), v)
+		c.set(opts.keyFn(id), v)
 		opts.call.val[id] = v
 	}
 }
 
+// startBatchCall fetches the ids, and then ends the in-flight call.
+func startBatchCall[V, T any](ctx context.Context, c *Client[T], ids []string, opts callBatchOpts[T, V], call *inFlightCall[map[string]T]) {
+	// Other batches might pick IDs from this call while it's in-flight, so
+	// it shouldn't be aborted if the caller that started it gives up.
+	detachedCtx := context.WithoutCancel(ctx)
+	defer func() {
+		if err := recover(); err != nil {
+			call.err = fmt.Errorf("sturdyc: panic recovered: %v", err)
+		}
+		c.endBatchFlight(ids, opts.keyFn, call)
+	}()
+	batchCallOpts := makeBatchCallOpts[T, V]{
+		ids:   ids,
+		fn:    opts.fn,
+		keyFn: opts.keyFn,
+		call:  call,
+	}
+	makeBatchCall(detachedCtx, c, batchCallOpts)
+}
+
 type callBatchOpts[T, V any] struct {
 	ids   []string
 	keyFn KeyFn
@@ -131,6 +241,51 @@ type callBatchOpts[T, V any] struct {
 }
 
 func callAndCacheBatch[V, T any](ctx context.Context, c *Client[T], opts callBatchOpts[T, V]) (map[string]V, error) {
+	response, errs, err := callAndCacheBatchWithErrors(ctx, c, opts)
+	if err != nil || len(errs) == 0 {
+		return response, err
+	}
+
+	// The errors are from chunks that failed, while others might have succeeded.
+	if len(response) > 0 {
+		return response, ErrPartialBatch
+	}
+	for _, chunkErr := range errs {
+		return response, chunkErr
+	}
+	return response, nil
+}
+
+// startChunkedBatchCalls splits the IDs into chunks that are fetched
+// separately, with a bounded number of calls running at the same time. The
+// chunks that are still waiting for their turn when the client is closed end
+// with ErrClosed. It should be called with the inFlightBatch lock.
+func startChunkedBatchCalls[V, T any](ctx context.Context, c *Client[T], ids []string, opts callBatchOpts[T, V], callIDs map[*inFlightCall[map[string]T]][]string) {
+	slots := make(chan struct{}, c.fetchChunkParallelism)
+	for start := 0; start < len(ids); start += c.fetchChunkSize {
+		chunk := ids[start:min(start+c.fetchChunkSize, len(ids))]
+		call := c.newBatchFlight(chunk, opts.keyFn)
+		callIDs[call] = append(callIDs[call], chunk...)
+		go func() {
+			select {
+			case slots <- struct{}{}:
+			case <-c.done:
+				call.err = ErrClosed
+				c.endBatchFlight(chunk, opts.keyFn, call)
+				return
+			}
+			defer func() { <-slots }()
+			startBatchCall(ctx, c, chunk, opts, call)
+		}()
+	}
+}
+
+// callAndCacheBatchWithErrors works like callAndCacheBatch, but it also
+// returns the errors of the individual IDs that a partial batch fetch failed.
+func callAndCacheBatchWithErrors[V, T any](ctx context.Context, c *Client[T], opts callBatchOpts[T, V]) (map[string]V, map[string]error, error) {
+	if c.readOnly.Load() {
+		return map[string]V{}, map[string]error{}, ErrReadOnly
+	}
 	c.inFlightBatchMutex.Lock()
 
 	callIDs := make(map[*inFlightCall[map[string]T]][]string)
@@ -143,37 +298,43 @@ func callAndCacheBatch[V, T any](ctx context.Context, c *Client[T], opts callBat
 		uniqueIDs = append(uniqueIDs, id)
 	}
 
-	if len(uniqueIDs) > 0 {
+	if len(uniqueIDs) > 0 && c.bufferFetches {
+		bufferBatchFetch(ctx, c, uniqueIDs, opts, callIDs)
+	} else if len(uniqueIDs) > 0 && c.chunkFetches {
+		startChunkedBatchCalls(ctx, c, uniqueIDs, opts, callIDs)
+	} else if len(uniqueIDs) > 0 {
 		call := c.newBatchFlight(uniqueIDs, opts.keyFn)
 		callIDs[call] = append(callIDs[call], uniqueIDs...)
-		go func() {
-			defer func() {
-				if err := recover(); err != nil {
-					call.err = fmt.Errorf("sturdyc: panic recovered: %v", err)
-				}
-				c.endBatchFlight(uniqueIDs, opts.keyFn, call)
-			}()
-			batchCallOpts := makeBatchCallOpts[T, V]{
-				ids:   uniqueIDs,
-				fn:    opts.fn,
-				keyFn: opts.keyFn,
-				call:  call,
-			}
-			makeBatchCall(ctx, c, batchCallOpts)
-		}()
+		go startBatchCall(ctx, c, uniqueIDs, opts, call)
 	}
 	c.inFlightBatchMutex.Unlock()
 
 	response := make(map[string]V, len(opts.ids))
+	errs := make(map[string]error)
 	for call, callIDs := range callIDs {
-		call.Wait()
+		if err := call.wait(ctx); err != nil {
+			return response, errs, err
+		}
+		// A chunk that failed is reported for each of its IDs, so that the
+		// rest of the batch can still be returned.
+		if call.err != nil && c.chunkFetches && !c.bufferFetches {
+			for _, id := range callIDs {
+				errs[id] = call.err
+			}
+			continue
+		}
 		if call.err != nil {
-			return response, call.err
+			return response, errs, call.err
 		}
 
 		// We need to iterate through the values that we want from this call. The
 		// batch could contain a hundred IDs, but we might only want a few of them.
 		for _, id := range callIDs {
+			if idErr, ok := call.errs[id]; ok {
+				errs[id] = idErr
+				continue
+			}
+
 			v, ok := call.val[id]
 			if !ok {
 				continue
@@ -183,9 +344,9 @@ func callAndCacheBatch[V, T any](ctx context.Context, c *Client[T], opts callBat
 				response[id] = val
 				continue
 			}
-			return response, ErrInvalidType
+			return response, errs, ErrInvalidType
 		}
 	}
 
-	return response, nil
+	return response, errs, nil
 }
@@ -2,6 +2,7 @@ package sturdyc_test
 
 import (
 	"context"
+	"errors"
 	"math/rand/v2"
 	"strconv"
 	"sync"
@@ -228,3 +229,159 @@ func TestInflightKeyIsRemovedIfTheRequestPanics(t *testing.T) {
 		t.Errorf("expected no keys in cache; got %d", c.Size())
 	}
 }
+
+func TestCancellingOneCallerDoesNotCancelTheSharedFetch(t *testing.T) {
+	t.Parallel()
+
+	capacity := 100
+	numShards := 2
+	ttl := time.Minute
+	evictionPercentage := 10
+	c := sturdyc.New[string](capacity, numShards, ttl, evictionPercentage)
+
+	ch := make(chan string)
+	var calls atomic.Int32
+	fn := func(ctx context.Context) (string, error) {
+		calls.Add(1)
+		select {
+		case v := <-ch:
+			return v, nil
+		case <-ctx.Done():
+			return "", ctx.Err()
+		}
+	}
+
+	// The first caller starts the fetch, and then gives up waiting for it.
+	cancelCtx, cancel := context.WithCancel(context.Background())
+	cancelledErr := make(chan error)
+	go func() {
+		_, err := c.GetOrFetch(cancelCtx, "id-1", fn)
+		cancelledErr <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			v, err := c.GetOrFetch(context.Background(), "id-1", fn)
+			if err != nil {
+				t.Error(err)
+			}
+			if v != "value1" {
+				t.Errorf("got %q; want %q", v, "value1")
+			}
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+
+	cancel()
+	if err := <-cancelledErr; !errors.Is(err, context.Canceled) {
+		t.Errorf("expected the cancelled caller to get context.Canceled; got %v", err)
+	}
+
+	ch <- "value1"
+	wg.Wait()
+	if got := calls.Load(); got != 1 {
+		t.Errorf("got %d calls; wanted 1", got)
+	}
+	if v, ok := c.Get("id-1"); !ok || v != "value1" {
+		t.Errorf("expected the shared fetch to be cached; got %q %t", v, ok)
+	}
+}
+
+func TestCancellingOneBatchDoesNotCancelTheIDsSharedWithOtherBatches(t *testing.T) {
+	t.Parallel()
+
+	capacity := 100
+	numShards := 2
+	ttl := time.Minute
+	evictionPercentage := 10
+	c := sturdyc.New[string](capacity, numShards, ttl, evictionPercentage)
+	keyFn := c.BatchKeyFn("item")
+
+	var calls atomic.Int32
+	cond := sync.NewCond(&sync.Mutex{})
+	batchFn := createBatchFn("item", &calls, cond)
+
+	// The first batch starts fetching IDs 1-3, and then gives up waiting for them.
+	cancelCtx, cancel := context.WithCancel(context.Background())
+	cancelledErr := make(chan error)
+	go func() {
+		_, err := c.GetOrFetchBatch(cancelCtx, []string{"1", "2", "3"}, keyFn, batchFn)
+		cancelledErr <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	// The second batch overlaps with the first one.
+	res := make(chan map[string]string)
+	go func() {
+		records, err := c.GetOrFetchBatch(context.Background(), []string{"2", "3", "4"}, keyFn, batchFn)
+		if err != nil {
+			t.Error(err)
+		}
+		res <- records
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	cancel()
+	if err := <-cancelledErr; !errors.Is(err, context.Canceled) {
+		t.Errorf("expected the cancelled batch to get context.Canceled; got %v", err)
+	}
+
+	cond.Broadcast()
+	records := <-res
+	for _, id := range []string{"2", "3", "4"} {
+		if want := "item-" + id; records[id] != want {
+			t.Errorf("expected %s got %s", want, records[id])
+		}
+	}
+	if got := calls.Load(); got != 2 {
+		t.Errorf("got %d calls; wanted 2", got)
+	}
+	if c.Size() != 4 {
+		t.Errorf("expected all 4 records to be cached; got %d", c.Size())
+	}
+}
+
+func TestFetchesOfDifferentKeysInTheSameShardDoNotBlockEachOther(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	c := sturdyc.New[string](100, 1, time.Minute, 10,
+		sturdyc.WithNoContinuousEvictions(),
+	)
+
+	release := make(chan struct{})
+	started := make(chan struct{})
+	slowFetch := func(_ context.Context) (string, error) {
+		close(started)
+		<-release
+		return "slow", nil
+	}
+	fastFetch := func(_ context.Context) (string, error) {
+		return "fast", nil
+	}
+
+	slowDone := make(chan struct{})
+	go func() {
+		defer close(slowDone)
+		if res, err := sturdyc.GetOrFetch(ctx, c, "slow", slowFetch); err != nil || res != "slow" {
+			t.Errorf("expected slow, got %s %v", res, err)
+		}
+	}()
+	<-started
+
+	// Every key lives in the same shard, but the fetch of another
+	// key shouldn't have to wait for the slow one to complete.
+	for i := 0; i < 10; i++ {
+		key := "fast-" + strconv.Itoa(i)
+		if res, err := sturdyc.GetOrFetch(ctx, c, key, fastFetch); err != nil || res != "fast" {
+			t.Errorf("expected fast, got %s %v", res, err)
+		}
+	}
+
+	close(release)
+	<-slowDone
+}
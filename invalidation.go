@@ -0,0 +1,101 @@
+package sturdyc
+
+import (
+	"context"
+	"math/rand/v2"
+	"strconv"
+)
+
+// InvalidationMessage is sent between the instances of a cluster to make them
+// drop their local copy of a key that has been deleted or updated elsewhere.
+type InvalidationMessage struct {
+	// Key is the cache key that was deleted or updated.
+	Key string `json:"key"`
+	// Version is the version of the value that was written, and zero if the
+	// key was deleted or the cache isn't able to tell the version.
+	Version uint64 `json:"version,omitempty"`
+	// Origin identifies the instance that published the message, which allows
+	// it to ignore its own messages when they're delivered back to it.
+	Origin string `json:"origin"`
+}
+
+// InvalidationSubscriber is an abstraction of the pub/sub channel, such as a
+// Redis channel, that the instances of a cluster use to exchange invalidation
+// messages. Publish is called while the call to the cache that deleted or
+// updated the key is in progress, which is why it shouldn't block on the
+// network. The channel that is returned by Subscribe should be closed once
+// the context is cancelled, which happens when the client is closed.
+type InvalidationSubscriber interface {
+	Publish(ctx context.Context, msg InvalidationMessage)
+	Subscribe(ctx context.Context) <-chan InvalidationMessage
+}
+
+// newInstanceID returns a random ID that is used as the origin of the
+// invalidation messages that the client publishes.
+func newInstanceID() string {
+	return strconv.FormatUint(rand.Uint64(), 36)
+}
+
+// subscribeToInvalidations drops the keys of the invalidation messages that
+// are published by the other instances until the client is closed.
+func (c *Client[T]) subscribeToInvalidations() {
+	ctx, cancel := context.WithCancel(context.Background())
+	messages := c.invalidationSubscriber.Subscribe(ctx)
+	c.safeGo(func() {
+		defer cancel()
+		for {
+			select {
+			case <-c.done:
+				return
+			case msg, ok := <-messages:
+				if !ok {
+					return
+				}
+				if msg.Origin == c.instanceID {
+					continue
+				}
+				c.getShard(msg.Key).invalidate(msg.Key, msg.Version)
+			}
+		}
+	})
+}
+
+// publishInvalidation notifies the other instances that the keys have been
+// deleted or updated, if the client has been configured with
+// WithInvalidationSubscriber.
+func (c *Client[T]) publishInvalidation(keys ...string) {
+	if c.invalidationSubscriber == nil {
+		return
+	}
+	for _, key := range keys {
+		c.invalidationSubscriber.Publish(context.Background(), InvalidationMessage{Key: key, Origin: c.instanceID})
+	}
+}
+
+// publishWrite notifies the other instances that the key has been updated
+// with the value. The message carries the version of the value if the client
+// has been configured with WithVersionFn.
+func (c *Client[T]) publishWrite(key string, value T) {
+	if c.invalidationSubscriber == nil || c.readOnly.Load() {
+		return
+	}
+	var version uint64
+	if versionFn := c.shards[0].versionFn; versionFn != nil {
+		version = versionFn(value)
+	}
+	c.invalidationSubscriber.Publish(context.Background(), InvalidationMessage{Key: key, Version: version, Origin: c.instanceID})
+}
+
+// publishRecordInvalidations publishes the writes of the records, after the
+// keyFn has been applied to their keys if it's not nil.
+func (c *Client[T]) publishRecordInvalidations(records map[string]T, keyFn KeyFn) {
+	if c.invalidationSubscriber == nil {
+		return
+	}
+	for key, value := range records {
+		if keyFn != nil {
+			key = keyFn(key)
+		}
+		c.publishWrite(key, value)
+	}
+}
@@ -0,0 +1,128 @@
+package sturdyc_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/creativecreature/sturdyc"
+)
+
+// invalidationBus delivers every message that is published to all of the subscribers.
+type invalidationBus struct {
+	sync.Mutex
+	subscribers []chan sturdyc.InvalidationMessage
+}
+
+func (b *invalidationBus) Publish(_ context.Context, msg sturdyc.InvalidationMessage) {
+	b.Lock()
+	defer b.Unlock()
+	for _, subscriber := range b.subscribers {
+		subscriber <- msg
+	}
+}
+
+func (b *invalidationBus) Subscribe(_ context.Context) <-chan sturdyc.InvalidationMessage {
+	b.Lock()
+	defer b.Unlock()
+	ch := make(chan sturdyc.InvalidationMessage, 100)
+	b.subscribers = append(b.subscribers, ch)
+	return ch
+}
+
+func TestInvalidationMessagesDropTheKeysOfTheOtherInstances(t *testing.T) {
+	t.Parallel()
+
+	bus := &invalidationBus{}
+	newInstance := func() *sturdyc.Client[string] {
+		return sturdyc.New[string](100, 1, time.Hour, 10,
+			sturdyc.WithNoContinuousEvictions(),
+			sturdyc.WithInvalidationSubscriber(bus),
+		)
+	}
+	a, b := newInstance(), newInstance()
+	defer a.Close()
+	defer b.Close()
+
+	// Populate the caches the way a fetch would, which isn't published.
+	ctx := context.Background()
+	for _, c := range []*sturdyc.Client[string]{a, b} {
+		for _, key := range []string{"1", "2"} {
+			if _, err := c.GetOrFetch(ctx, key, func(context.Context) (string, error) { return "fetched", nil }); err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+		}
+	}
+	if _, ok := b.Get("1"); !ok {
+		t.Fatal("expected the fetched values to be kept by the other instance")
+	}
+
+	a.Set("1", "updated")
+	a.Delete("2")
+	waitFor(t, func() bool {
+		_, ok1 := b.Get("1")
+		_, ok2 := b.Get("2")
+		return !ok1 && !ok2
+	})
+
+	// The instance ignores its own messages.
+	if v, ok := a.Get("1"); !ok || v != "updated" {
+		t.Errorf("expected the instance to keep its own update, got %q", v)
+	}
+}
+
+func TestInvalidationMessagesArePublishedForPrefixesTagsAndAbsentKeys(t *testing.T) {
+	t.Parallel()
+
+	bus := &invalidationBus{}
+	newInstance := func() *sturdyc.Client[string] {
+		return sturdyc.New[string](100, 1, time.Hour, 10,
+			sturdyc.WithNoContinuousEvictions(),
+			sturdyc.WithInvalidationSubscriber(bus),
+		)
+	}
+	a, b := newInstance(), newInstance()
+	defer a.Close()
+	defer b.Close()
+
+	ctx := context.Background()
+	for _, key := range []string{"prefix-1", "prefix-2", "tagged", "absent"} {
+		if _, err := b.GetOrFetch(ctx, key, func(context.Context) (string, error) { return "fetched", nil }); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+	}
+
+	a.Set("prefix-1", "value")
+	a.Set("prefix-2", "value")
+	a.SetWithTags("tagged", "value", "tag")
+	// Let the messages of the writes drop the keys, and populate them again.
+	waitFor(t, func() bool { return b.Size() == 1 })
+	for _, key := range []string{"prefix-1", "prefix-2", "tagged"} {
+		if _, err := b.GetOrFetch(ctx, key, func(context.Context) (string, error) { return "fetched", nil }); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+	}
+
+	if deleted := a.DeleteByPrefix("prefix-"); deleted != 2 {
+		t.Fatalf("expected 2 keys to be deleted, got %d", deleted)
+	}
+	if deleted := a.InvalidateTag("tag"); deleted != 1 {
+		t.Fatalf("expected 1 key to be deleted, got %d", deleted)
+	}
+	if !a.SetIfAbsent("absent", "value") {
+		t.Fatal("expected the value to be written")
+	}
+	waitFor(t, func() bool { return b.Size() == 0 })
+}
+
+func waitFor(t *testing.T, condition func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for the condition")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
@@ -62,6 +62,24 @@ func (c *Client[T]) relativeTime(t time.Time) string {
 	return fmt.Sprintf("%s%dh%02dm%02ds", direction, hours, minutes, seconds)
 }
 
+// RelativeTimeKey creates a cache key from the prefix and the time relative
+// to the current time of the clock. Both times are truncated to the duration
+// that was passed to WithRelativeTimeKeyFormat, which makes the key identical
+// to the one that client.PermutatedKey produces for a struct with the time as
+// its only field. This can be used to warm or invalidate a specific bucket.
+//
+// Parameters:
+//
+//	prefix - The prefix for the cache key.
+//	t - The time to be formatted relative to the current time.
+//
+// Returns:
+//
+//	A string to be used as the cache key.
+func (c *Client[T]) RelativeTimeKey(prefix string, t time.Time) string {
+	return prefix + "-" + c.relativeTime(t)
+}
+
 // handleTime turns the time.Time into an epoch string.
 func (c *Client[T]) handleTime(v reflect.Value) string {
 	if timestamp, ok := v.Interface().(time.Time); ok {
@@ -196,3 +214,41 @@ func (c *Client[T]) PermutatedBatchKeyFn(prefix string, permutationStruct interf
 		return fmt.Sprintf("%s-ID-%s", key, id)
 	}
 }
+
+// validateKey checks the key against the limit of WithMaxKeyLength and the
+// validator of WithKeyValidator. Every key is valid by default.
+func (c *Config) validateKey(key string) error {
+	if c.maxKeyLength > 0 && len(key) > c.maxKeyLength {
+		return fmt.Errorf("%w: the key is %d bytes long, which exceeds the limit of %d", ErrInvalidKey, len(key), c.maxKeyLength)
+	}
+	if c.keyValidator != nil {
+		if err := c.keyValidator(key); err != nil {
+			return fmt.Errorf("%w: %w", ErrInvalidKey, err)
+		}
+	}
+	return nil
+}
+
+// acceptsKey validates the key of a write, and logs a warning if it's
+// rejected. It has to be called before the shard is locked, since neither the
+// validator nor the logger are allowed to run while a lock is held.
+func (c *Config) acceptsKey(key string) bool {
+	if err := c.validateKey(key); err != nil {
+		c.log.Warn("sturdyc: rejected an invalid key", "key", key, "error", err)
+		return false
+	}
+	return true
+}
+
+// validateKeys validates the cache key of each ID, and returns the first error.
+func (c *Config) validateKeys(ids []string, keyFn KeyFn) error {
+	if c.maxKeyLength == 0 && c.keyValidator == nil {
+		return nil
+	}
+	for _, id := range ids {
+		if err := c.validateKey(keyFn(id)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
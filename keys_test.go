@@ -221,3 +221,40 @@ func TestTimePointers(t *testing.T) {
 		t.Errorf("got: %s wanted: %s", got, want)
 	}
 }
+
+func TestRelativeTimeKeyTruncatesAtTheBoundaries(t *testing.T) {
+	t.Parallel()
+
+	bucket := time.Now().Truncate(time.Minute)
+	clock := sturdyc.NewTestClock(bucket.Add(30 * time.Second))
+	c := sturdyc.New[any](100, 1, time.Hour, 5,
+		sturdyc.WithNoContinuousEvictions(),
+		sturdyc.WithRelativeTimeKeyFormat(time.Minute),
+		sturdyc.WithClock(clock),
+	)
+
+	testCases := []struct {
+		time time.Time
+		want string
+	}{
+		{bucket, "prefix-(-)0h00m00s"},
+		{bucket.Add(time.Minute - time.Nanosecond), "prefix-(-)0h00m00s"},
+		{bucket.Add(-time.Nanosecond), "prefix-(-)0h01m00s"},
+		{bucket.Add(time.Minute), "prefix-(+)0h01m00s"},
+		{bucket.Add(25*time.Hour + 59*time.Second), "prefix-(+)25h00m00s"},
+	}
+
+	type opts struct {
+		Time time.Time
+	}
+
+	for _, tc := range testCases {
+		key := c.RelativeTimeKey("prefix", tc.time)
+		if key != tc.want {
+			t.Errorf("got: %s wanted: %s", key, tc.want)
+		}
+		if permutatedKey := c.PermutatedKey("prefix", opts{tc.time}); permutatedKey != key {
+			t.Errorf("expected the key to match the permutated key %s, got %s", permutatedKey, key)
+		}
+	}
+}
@@ -1,11 +1,17 @@
 package sturdyc
 
+// Logger is used by the cache to log the events that would otherwise be
+// hard to debug. The messages are followed by key-value pairs, which follow
+// the conventions of log/slog. A *slog.Logger satisfies the interface.
 type Logger interface {
+	Debug(msg string, args ...any)
 	Warn(msg string, args ...any)
 	Error(msg string, args ...any)
 }
 
+// NoopLogger discards every log. It's the default logger of the cache.
 type NoopLogger struct{}
 
+func (l *NoopLogger) Debug(_ string, _ ...any) {}
 func (l *NoopLogger) Warn(_ string, _ ...any)  {}
 func (l *NoopLogger) Error(_ string, _ ...any) {}
@@ -42,6 +42,77 @@ type DistributedMetricsRecorder interface {
 	DistributedFallback()
 }
 
+// RefreshQueueRecorder can be implemented by a MetricsRecorder to observe
+// the number of background refreshes that are waiting for a slot when the
+// client has been configured with WithRefreshConcurrency.
+type RefreshQueueRecorder interface {
+	// RefreshQueueDepth is called whenever the number of queued refreshes changes.
+	RefreshQueueDepth(depth int)
+}
+
+// BatchRefreshCoalescingRecorder can be implemented by a MetricsRecorder to
+// quantify how much load WithRefreshCoalescing saves the data source.
+type BatchRefreshCoalescingRecorder interface {
+	// CacheBatchRefreshCoalesced is called when a buffer is flushed with the
+	// number of refreshes that added IDs to it, and the number of unique IDs
+	// that it contained.
+	CacheBatchRefreshCoalesced(requests, uniqueIDs int)
+}
+
+// FallbackRecorder can be implemented by a MetricsRecorder to observe the
+// fallback values that are served by client.GetOrFetchWithFallback.
+type FallbackRecorder interface {
+	// FallbackServed is called every time the fallback is returned instead of a value.
+	FallbackServed()
+}
+
+// CircuitBreakerRecorder can be implemented by a MetricsRecorder to observe
+// the state transitions of the circuit breakers of WithCircuitBreaker.
+type CircuitBreakerRecorder interface {
+	// CircuitStateChanged is called with the target of the circuit breaker
+	// every time it transitions to a new state.
+	CircuitStateChanged(target string, state CircuitState)
+}
+
+// AdaptiveRefreshRecorder can be implemented by a MetricsRecorder to observe
+// how WithAdaptiveRefresh adjusts the refresh intervals to the latency of the
+// underlying data source.
+type AdaptiveRefreshRecorder interface {
+	// RefreshIntervalFactor is called with the factor that the refresh
+	// intervals are multiplied by every time that it changes.
+	RefreshIntervalFactor(factor float64)
+}
+
+// CacheSizeRecorder can be implemented by a MetricsRecorder that isn't able
+// to register the scrape time callback of ObserveCacheSize, which is common
+// for push based metric systems. The size is sampled every time the eviction
+// job ticks, which means that it's never reported for clients that have been
+// configured with WithNoContinuousEvictions.
+type CacheSizeRecorder interface {
+	// CacheSize is called with the number of entries in the cache.
+	CacheSize(size int)
+}
+
+// MissingRecordEvictionRecorder can be implemented by a MetricsRecorder to
+// observe the missing records that are evicted because a shard has reached
+// the limit of WithMaxMissingRecords.
+type MissingRecordEvictionRecorder interface {
+	// MissingRecordsEvicted is called with the number of missing records that were evicted.
+	MissingRecordsEvicted(n int)
+}
+
+// optionalRecorder returns the metrics recorder as R if it implements it.
+// Recorders that don't implement the distributed metrics are wrapped by the
+// client, which is why we have to look at the recorder that they embed too.
+func optionalRecorder[R any](c *Config) (R, bool) {
+	var recorder any = c.metricsRecorder
+	if d, ok := recorder.(*distributedMetricsRecorder); ok {
+		recorder = d.MetricsRecorder
+	}
+	r, ok := recorder.(R)
+	return r, ok
+}
+
 type distributedMetricsRecorder struct {
 	MetricsRecorder
 }
@@ -57,13 +128,22 @@ func (d *distributedMetricsRecorder) DistributedMissingRecord() {}
 func (d *distributedMetricsRecorder) DistributedFallback() {}
 
 func (s *shard[T]) reportForcedEviction() {
+	s.counters.forcedEvictions.Add(1)
 	if s.metricsRecorder == nil {
 		return
 	}
 	s.metricsRecorder.ForcedEviction()
 }
 
+func (s *shard[T]) reportMissingRecordsEvicted(n int) {
+	s.reportEntriesEvicted(n)
+	if recorder, ok := optionalRecorder[MissingRecordEvictionRecorder](s.Config); ok {
+		recorder.MissingRecordsEvicted(n)
+	}
+}
+
 func (s *shard[T]) reportEntriesEvicted(n int) {
+	s.counters.entriesEvicted.Add(int64(n))
 	if s.metricsRecorder == nil {
 		return
 	}
@@ -71,24 +151,62 @@ func (s *shard[T]) reportEntriesEvicted(n int) {
 }
 
 // reportCacheHits is used to report cache hits and misses to the metrics recorder.
-func (c *Client[T]) reportCacheHits(cacheHit, missingRecord, refresh bool) {
-	if c.metricsRecorder == nil {
+func (s *shard[T]) reportCacheHits(cacheHit, missingRecord, refresh bool) {
+	s.countCacheHits(cacheHit, missingRecord, refresh)
+	if s.metricsRecorder == nil {
+		return
+	}
+
+	if missingRecord {
+		s.metricsRecorder.MissingRecord()
+	}
+
+	if refresh {
+		s.metricsRecorder.Refresh()
+	}
+
+	if !cacheHit {
+		s.metricsRecorder.CacheMiss()
+		return
+	}
+	s.metricsRecorder.CacheHit()
+}
+
+// reportCacheHitsInAggregate is used to report the outcome of reading several keys at once.
+func (s *shard[T]) reportCacheHitsInAggregate(hits, misses, missingRecords int) {
+	s.counters.hits.Add(int64(hits))
+	s.counters.misses.Add(int64(misses))
+	s.counters.missingRecords.Add(int64(missingRecords))
+	if s.metricsRecorder == nil {
 		return
 	}
 
+	for i := 0; i < missingRecords; i++ {
+		s.metricsRecorder.MissingRecord()
+	}
+	for i := 0; i < misses; i++ {
+		s.metricsRecorder.CacheMiss()
+	}
+	for i := 0; i < hits; i++ {
+		s.metricsRecorder.CacheHit()
+	}
+}
+
+// countCacheHits updates the counters that are returned by client.Stats.
+func (s *shard[T]) countCacheHits(cacheHit, missingRecord, refresh bool) {
 	if missingRecord {
-		c.metricsRecorder.MissingRecord()
+		s.counters.missingRecords.Add(1)
 	}
 
 	if refresh {
-		c.metricsRecorder.Refresh()
+		s.counters.refreshes.Add(1)
 	}
 
 	if !cacheHit {
-		c.metricsRecorder.CacheMiss()
+		s.counters.misses.Add(1)
 		return
 	}
-	c.metricsRecorder.CacheHit()
+	s.counters.hits.Add(1)
 }
 
 func (c *Client[T]) reportShardIndex(index int) {
@@ -136,3 +254,33 @@ func (c *Client[T]) reportDistributedStaleFallback() {
 	}
 	c.metricsRecorder.DistributedFallback()
 }
+
+func (c *Config) reportBatchRefreshCoalesced(requests int, ids []string) {
+	recorder, ok := optionalRecorder[BatchRefreshCoalescingRecorder](c)
+	if !ok {
+		return
+	}
+	unique := make(map[string]struct{}, len(ids))
+	for _, id := range ids {
+		unique[id] = struct{}{}
+	}
+	recorder.CacheBatchRefreshCoalesced(requests, len(unique))
+}
+
+func (c *Config) reportFallbackServed() {
+	if recorder, ok := optionalRecorder[FallbackRecorder](c); ok {
+		recorder.FallbackServed()
+	}
+}
+
+func (c *Config) reportCacheSize() {
+	if recorder, ok := optionalRecorder[CacheSizeRecorder](c); ok {
+		recorder.CacheSize(c.getSize())
+	}
+}
+
+func (c *Config) reportRefreshQueueDepth(depth int64) {
+	if recorder, ok := optionalRecorder[RefreshQueueRecorder](c); ok {
+		recorder.RefreshQueueDepth(int(depth))
+	}
+}
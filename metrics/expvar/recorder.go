@@ -0,0 +1,164 @@
+// Package expvar provides an implementation of the sturdyc MetricsRecorder
+// and DistributedMetricsRecorder interfaces that publishes the metrics using
+// the expvar package from the standard library. This makes the metrics
+// available at /debug/vars without any additional dependencies.
+package expvar
+
+import (
+	"errors"
+	"expvar"
+	"sync/atomic"
+)
+
+// ErrAlreadyPublished is returned by New if a variable with the same name has already been published.
+var ErrAlreadyPublished = errors.New("expvar: a variable with this name has already been published")
+
+// Recorder publishes the metrics of a cache as an expvar map.
+type Recorder struct {
+	cacheHits        expvar.Int
+	cacheMisses      expvar.Int
+	refreshes        expvar.Int
+	missingRecords   expvar.Int
+	forcedEvictions  expvar.Int
+	entriesEvicted   expvar.Int
+	batchRefreshSize expvar.Int
+	refreshQueue     expvar.Int
+	missingEvicted   expvar.Int
+	coalescedReqs    expvar.Int
+	coalescedIDs     expvar.Int
+	cacheSize        atomic.Pointer[func() int]
+
+	distributedCacheHits      expvar.Int
+	distributedCacheMisses    expvar.Int
+	distributedRefreshes      expvar.Int
+	distributedMissingRecords expvar.Int
+	distributedFallbacks      expvar.Int
+}
+
+// New creates a Recorder and publishes its metrics as a map with the given
+// name. Multiple caches can be published as long as they use distinct names.
+// Because expvar doesn't allow variables to be unpublished, New returns
+// ErrAlreadyPublished if the name has been used before.
+func New(name string) (*Recorder, error) {
+	if expvar.Get(name) != nil {
+		return nil, ErrAlreadyPublished
+	}
+
+	r := &Recorder{}
+	m := new(expvar.Map)
+	m.Set("hits", &r.cacheHits)
+	m.Set("misses", &r.cacheMisses)
+	m.Set("refreshes", &r.refreshes)
+	m.Set("missing_records", &r.missingRecords)
+	m.Set("forced_evictions", &r.forcedEvictions)
+	m.Set("entries_evicted", &r.entriesEvicted)
+	m.Set("batch_refresh_size_total", &r.batchRefreshSize)
+	m.Set("refresh_queue_depth", &r.refreshQueue)
+	m.Set("missing_records_evicted", &r.missingEvicted)
+	m.Set("batch_refresh_requests_total", &r.coalescedReqs)
+	m.Set("batch_refresh_unique_ids_total", &r.coalescedIDs)
+	m.Set("size", expvar.Func(r.size))
+	m.Set("distributed_hits", &r.distributedCacheHits)
+	m.Set("distributed_misses", &r.distributedCacheMisses)
+	m.Set("distributed_refreshes", &r.distributedRefreshes)
+	m.Set("distributed_missing_records", &r.distributedMissingRecords)
+	m.Set("distributed_fallbacks", &r.distributedFallbacks)
+	expvar.Publish(name, m)
+
+	return r, nil
+}
+
+// size is called whenever the published variables are read.
+func (r *Recorder) size() any {
+	callback := r.cacheSize.Load()
+	if callback == nil {
+		return 0
+	}
+	return (*callback)()
+}
+
+// CacheHit increments the cache hits counter.
+func (r *Recorder) CacheHit() {
+	r.cacheHits.Add(1)
+}
+
+// CacheMiss increments the cache misses counter.
+func (r *Recorder) CacheMiss() {
+	r.cacheMisses.Add(1)
+}
+
+// Refresh increments the refreshes counter.
+func (r *Recorder) Refresh() {
+	r.refreshes.Add(1)
+}
+
+// MissingRecord increments the missing records counter.
+func (r *Recorder) MissingRecord() {
+	r.missingRecords.Add(1)
+}
+
+// ForcedEviction increments the forced evictions counter.
+func (r *Recorder) ForcedEviction() {
+	r.forcedEvictions.Add(1)
+}
+
+// EntriesEvicted adds the number of evicted entries to the entries evicted counter.
+func (r *Recorder) EntriesEvicted(n int) {
+	r.entriesEvicted.Add(int64(n))
+}
+
+// ShardIndex is a noop. Publishing a variable per shard would clutter /debug/vars.
+func (r *Recorder) ShardIndex(int) {}
+
+// CacheBatchRefreshSize adds the size of the batch refresh to the total number of refreshed IDs.
+func (r *Recorder) CacheBatchRefreshSize(size int) {
+	r.batchRefreshSize.Add(int64(size))
+}
+
+// RefreshQueueDepth sets the number of refreshes that are waiting for a slot.
+func (r *Recorder) RefreshQueueDepth(depth int) {
+	r.refreshQueue.Set(int64(depth))
+}
+
+// CacheBatchRefreshCoalesced adds to the counters of the refreshes that were
+// coalesced into batches, and of the unique IDs that the batches contained.
+func (r *Recorder) CacheBatchRefreshCoalesced(requests, uniqueIDs int) {
+	r.coalescedReqs.Add(int64(requests))
+	r.coalescedIDs.Add(int64(uniqueIDs))
+}
+
+// MissingRecordsEvicted adds to the counter of missing records that were
+// evicted because a shard had reached its limit of missing records.
+func (r *Recorder) MissingRecordsEvicted(n int) {
+	r.missingEvicted.Add(int64(n))
+}
+
+// ObserveCacheSize sets the callback that is used to publish the size of the cache.
+func (r *Recorder) ObserveCacheSize(callback func() int) {
+	r.cacheSize.Store(&callback)
+}
+
+// DistributedCacheHit increments the distributed cache hits counter.
+func (r *Recorder) DistributedCacheHit() {
+	r.distributedCacheHits.Add(1)
+}
+
+// DistributedCacheMiss increments the distributed cache misses counter.
+func (r *Recorder) DistributedCacheMiss() {
+	r.distributedCacheMisses.Add(1)
+}
+
+// DistributedRefresh increments the distributed refreshes counter.
+func (r *Recorder) DistributedRefresh() {
+	r.distributedRefreshes.Add(1)
+}
+
+// DistributedMissingRecord increments the distributed missing records counter.
+func (r *Recorder) DistributedMissingRecord() {
+	r.distributedMissingRecords.Add(1)
+}
+
+// DistributedFallback increments the distributed fallbacks counter.
+func (r *Recorder) DistributedFallback() {
+	r.distributedFallbacks.Add(1)
+}
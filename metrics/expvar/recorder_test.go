@@ -0,0 +1,52 @@
+package expvar_test
+
+import (
+	"encoding/json"
+	"errors"
+	stdexpvar "expvar"
+	"testing"
+	"time"
+
+	"github.com/creativecreature/sturdyc"
+	"github.com/creativecreature/sturdyc/metrics/expvar"
+)
+
+func TestRecorderPublishesTheMetrics(t *testing.T) {
+	t.Parallel()
+
+	recorder, err := expvar.New("sturdyc_test_metrics")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	c := sturdyc.New[int](100, 10, time.Hour, 5,
+		sturdyc.WithNoContinuousEvictions(),
+		sturdyc.WithMetrics(recorder),
+	)
+	c.Set("1", 1)
+	c.Set("2", 2)
+	c.Get("1")
+	c.Get("3")
+
+	var values map[string]int
+	if err = json.Unmarshal([]byte(stdexpvar.Get("sturdyc_test_metrics").String()), &values); err != nil {
+		t.Fatalf("expected the published map to be valid JSON, got %v", err)
+	}
+	expected := map[string]int{"hits": 1, "misses": 1, "size": 2}
+	for name, want := range expected {
+		if got := values[name]; got != want {
+			t.Errorf("expected %s to be %d, got %d", name, want, got)
+		}
+	}
+}
+
+func TestNewReturnsAnErrorIfTheNameIsTaken(t *testing.T) {
+	t.Parallel()
+
+	if _, err := expvar.New("sturdyc_test_duplicate"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if _, err := expvar.New("sturdyc_test_duplicate"); !errors.Is(err, expvar.ErrAlreadyPublished) {
+		t.Errorf("expected ErrAlreadyPublished, got %v", err)
+	}
+}
@@ -0,0 +1,179 @@
+// Package otel provides an implementation of the sturdyc MetricsRecorder and
+// DistributedMetricsRecorder interfaces that records to an OpenTelemetry
+// meter. It lives in a module of its own so that the cache itself doesn't have
+// to depend on OpenTelemetry.
+package otel
+
+import (
+	"context"
+	"sync/atomic"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+type config struct {
+	prefix string
+}
+
+// Option allows for additional configurations to be applied to the recorder.
+type Option func(*config)
+
+// WithPrefix sets the prefix of the instrument names. Defaults to "sturdyc".
+// Multiple caches can record to the same meter as long as they use distinct
+// prefixes.
+func WithPrefix(prefix string) Option {
+	return func(c *config) {
+		c.prefix = prefix
+	}
+}
+
+// Recorder records the metrics of a cache to an OpenTelemetry meter.
+type Recorder struct {
+	cacheHits        metric.Int64Counter
+	cacheMisses      metric.Int64Counter
+	refreshes        metric.Int64Counter
+	missingRecords   metric.Int64Counter
+	forcedEvictions  metric.Int64Counter
+	entriesEvicted   metric.Int64Counter
+	shardOperations  metric.Int64Counter
+	batchRefreshSize metric.Int64Histogram
+	cacheSize        atomic.Pointer[func() int]
+
+	distributedCacheHits      metric.Int64Counter
+	distributedCacheMisses    metric.Int64Counter
+	distributedRefreshes      metric.Int64Counter
+	distributedMissingRecords metric.Int64Counter
+	distributedFallbacks      metric.Int64Counter
+}
+
+// New creates the instruments for a Recorder using the meter. The size of the
+// cache is reported through an observable gauge that invokes the callback
+// passed to ObserveCacheSize whenever the meter collects its metrics.
+func New(meter metric.Meter, opts ...Option) (*Recorder, error) {
+	cfg := &config{prefix: "sturdyc"}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+
+	var err error
+	counter := func(name, description string) metric.Int64Counter {
+		if err != nil {
+			return nil
+		}
+		var c metric.Int64Counter
+		c, err = meter.Int64Counter(cfg.prefix+"."+name, metric.WithDescription(description))
+		return c
+	}
+
+	r := &Recorder{
+		cacheHits:       counter("hits", "Number of keys that resulted in a cache hit."),
+		cacheMisses:     counter("misses", "Number of keys that resulted in a cache miss."),
+		refreshes:       counter("refreshes", "Number of get operations that resulted in a refresh."),
+		missingRecords:  counter("missing_records", "Number of lookups for keys that have been marked as missing."),
+		forcedEvictions: counter("forced_evictions", "Number of times the cache had to evict keys to make room for a new one."),
+		entriesEvicted:  counter("entries_evicted", "Number of entries that have been evicted."),
+		shardOperations: counter("shard_operations", "Number of operations that have been performed by each shard."),
+
+		distributedCacheHits:      counter("distributed.hits", "Number of keys that resulted in a distributed storage hit."),
+		distributedCacheMisses:    counter("distributed.misses", "Number of keys that resulted in a distributed storage miss."),
+		distributedRefreshes:      counter("distributed.refreshes", "Number of distributed records that were due for a refresh."),
+		distributedMissingRecords: counter("distributed.missing_records", "Number of distributed records that have been marked as missing."),
+		distributedFallbacks:      counter("distributed.fallbacks", "Number of failed refreshes that fell back to the distributed record."),
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	r.batchRefreshSize, err = meter.Int64Histogram(cfg.prefix+".batch_refresh_size",
+		metric.WithDescription("Number of IDs in each batch refresh."),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = meter.Int64ObservableGauge(cfg.prefix+".size",
+		metric.WithDescription("Number of entries in the cache."),
+		metric.WithInt64Callback(func(_ context.Context, observer metric.Int64Observer) error {
+			if callback := r.cacheSize.Load(); callback != nil {
+				observer.Observe(int64((*callback)()))
+			}
+			return nil
+		}),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// CacheHit increments the cache hits counter.
+func (r *Recorder) CacheHit() {
+	r.cacheHits.Add(context.Background(), 1)
+}
+
+// CacheMiss increments the cache misses counter.
+func (r *Recorder) CacheMiss() {
+	r.cacheMisses.Add(context.Background(), 1)
+}
+
+// Refresh increments the refreshes counter.
+func (r *Recorder) Refresh() {
+	r.refreshes.Add(context.Background(), 1)
+}
+
+// MissingRecord increments the missing records counter.
+func (r *Recorder) MissingRecord() {
+	r.missingRecords.Add(context.Background(), 1)
+}
+
+// ForcedEviction increments the forced evictions counter.
+func (r *Recorder) ForcedEviction() {
+	r.forcedEvictions.Add(context.Background(), 1)
+}
+
+// EntriesEvicted adds the number of evicted entries to the entries evicted counter.
+func (r *Recorder) EntriesEvicted(n int) {
+	r.entriesEvicted.Add(context.Background(), int64(n))
+}
+
+// ShardIndex increments the operations counter of the shard.
+func (r *Recorder) ShardIndex(index int) {
+	r.shardOperations.Add(context.Background(), 1, metric.WithAttributes(attribute.Int("shard", index)))
+}
+
+// CacheBatchRefreshSize records the size of a batch refresh.
+func (r *Recorder) CacheBatchRefreshSize(size int) {
+	r.batchRefreshSize.Record(context.Background(), int64(size))
+}
+
+// ObserveCacheSize sets the callback that the size gauge invokes when the metrics are collected.
+func (r *Recorder) ObserveCacheSize(callback func() int) {
+	r.cacheSize.Store(&callback)
+}
+
+// DistributedCacheHit increments the distributed cache hits counter.
+func (r *Recorder) DistributedCacheHit() {
+	r.distributedCacheHits.Add(context.Background(), 1)
+}
+
+// DistributedCacheMiss increments the distributed cache misses counter.
+func (r *Recorder) DistributedCacheMiss() {
+	r.distributedCacheMisses.Add(context.Background(), 1)
+}
+
+// DistributedRefresh increments the distributed refreshes counter.
+func (r *Recorder) DistributedRefresh() {
+	r.distributedRefreshes.Add(context.Background(), 1)
+}
+
+// DistributedMissingRecord increments the distributed missing records counter.
+func (r *Recorder) DistributedMissingRecord() {
+	r.distributedMissingRecords.Add(context.Background(), 1)
+}
+
+// DistributedFallback increments the distributed fallbacks counter.
+func (r *Recorder) DistributedFallback() {
+	r.distributedFallbacks.Add(context.Background(), 1)
+}
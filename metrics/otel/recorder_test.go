@@ -0,0 +1,113 @@
+package otel_test
+
+import (
+	"context"
+	"testing"
+
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+
+	"github.com/creativecreature/sturdyc/metrics/otel"
+)
+
+func collect(t *testing.T, reader *sdkmetric.ManualReader) map[string]int64 {
+	t.Helper()
+
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(context.Background(), &rm); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	values := make(map[string]int64)
+	for _, scope := range rm.ScopeMetrics {
+		for _, m := range scope.Metrics {
+			switch data := m.Data.(type) {
+			case metricdata.Sum[int64]:
+				for _, point := range data.DataPoints {
+					values[m.Name] += point.Value
+				}
+			case metricdata.Gauge[int64]:
+				for _, point := range data.DataPoints {
+					values[m.Name] = point.Value
+				}
+			case metricdata.Histogram[int64]:
+				for _, point := range data.DataPoints {
+					values[m.Name] += int64(point.Count)
+				}
+			}
+		}
+	}
+	return values
+}
+
+func TestRecorderRecordsToTheMeter(t *testing.T) {
+	t.Parallel()
+
+	reader := sdkmetric.NewManualReader()
+	meter := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)).Meter("test")
+	recorder, err := otel.New(meter)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	recorder.CacheHit()
+	recorder.CacheHit()
+	recorder.CacheMiss()
+	recorder.ForcedEviction()
+	recorder.EntriesEvicted(5)
+	recorder.ShardIndex(1)
+	recorder.ShardIndex(2)
+	recorder.CacheBatchRefreshSize(10)
+	recorder.DistributedCacheHit()
+
+	size := 42
+	recorder.ObserveCacheSize(func() int { return size })
+
+	expected := map[string]int64{
+		"sturdyc.hits":               2,
+		"sturdyc.misses":             1,
+		"sturdyc.forced_evictions":   1,
+		"sturdyc.entries_evicted":    5,
+		"sturdyc.shard_operations":   2,
+		"sturdyc.batch_refresh_size": 1,
+		"sturdyc.distributed.hits":   1,
+		"sturdyc.size":               42,
+	}
+	values := collect(t, reader)
+	for name, want := range expected {
+		if got, ok := values[name]; !ok || got != want {
+			t.Errorf("expected %s to be %d, got %d", name, want, got)
+		}
+	}
+}
+
+func TestRecordersWithDistinctPrefixesCanShareAMeter(t *testing.T) {
+	t.Parallel()
+
+	reader := sdkmetric.NewManualReader()
+	meter := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)).Meter("test")
+	orders, err := otel.New(meter, otel.WithPrefix("orders"))
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	users, err := otel.New(meter, otel.WithPrefix("users"))
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	orders.CacheHit()
+	users.CacheMiss()
+	orders.ObserveCacheSize(func() int { return 1 })
+	users.ObserveCacheSize(func() int { return 2 })
+
+	values := collect(t, reader)
+	if values["orders.hits"] != 1 || values["orders.misses"] != 0 {
+		t.Errorf("expected the orders recorder to have 1 hit and no misses, got %v", values)
+	}
+	if values["users.hits"] != 0 || values["users.misses"] != 1 {
+		t.Errorf("expected the users recorder to have 1 miss and no hits, got %v", values)
+	}
+	if values["orders.size"] != 1 || values["users.size"] != 2 {
+		t.Errorf("expected the sizes to be observed per recorder, got %v", values)
+	}
+}
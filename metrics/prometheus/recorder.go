@@ -0,0 +1,223 @@
+// Package prometheus provides an implementation of the sturdyc
+// MetricsRecorder and DistributedMetricsRecorder interfaces that is backed by
+// Prometheus collectors. It lives in a module of its own so that the cache
+// itself doesn't have to depend on the Prometheus client.
+package prometheus
+
+import (
+	"strconv"
+	"sync/atomic"
+
+	prom "github.com/prometheus/client_golang/prometheus"
+)
+
+type config struct {
+	namespace        string
+	subsystem        string
+	constLabels      prom.Labels
+	batchSizeBuckets []float64
+}
+
+// Option allows for additional configurations to be applied to the recorder.
+type Option func(*config)
+
+// WithNamespace sets the namespace of the metric names. Defaults to "sturdyc".
+func WithNamespace(namespace string) Option {
+	return func(c *config) {
+		c.namespace = namespace
+	}
+}
+
+// WithSubsystem sets the subsystem of the metric names. This is useful if
+// you have multiple caches that are registered with the same registerer.
+func WithSubsystem(subsystem string) Option {
+	return func(c *config) {
+		c.subsystem = subsystem
+	}
+}
+
+// WithConstLabels adds labels with fixed values to every metric.
+func WithConstLabels(labels prom.Labels) Option {
+	return func(c *config) {
+		c.constLabels = labels
+	}
+}
+
+// WithBatchSizeBuckets sets the buckets of the batch refresh size histogram.
+func WithBatchSizeBuckets(buckets []float64) Option {
+	return func(c *config) {
+		c.batchSizeBuckets = buckets
+	}
+}
+
+// Recorder reports the metrics of a cache to Prometheus.
+type Recorder struct {
+	cacheHits        prom.Counter
+	cacheMisses      prom.Counter
+	refreshes        prom.Counter
+	missingRecords   prom.Counter
+	forcedEvictions  prom.Counter
+	entriesEvicted   prom.Counter
+	shardIndex       *prom.CounterVec
+	batchRefreshSize prom.Histogram
+	cacheSize        atomic.Pointer[func() int]
+
+	distributedCacheHits      prom.Counter
+	distributedCacheMisses    prom.Counter
+	distributedRefreshes      prom.Counter
+	distributedMissingRecords prom.Counter
+	distributedFallbacks      prom.Counter
+}
+
+// New creates a Recorder and registers its collectors with the registerer.
+// The size of the cache is reported through a gauge that invokes the callback
+// passed to ObserveCacheSize at scrape time.
+func New(registerer prom.Registerer, opts ...Option) (*Recorder, error) {
+	cfg := &config{
+		namespace:        "sturdyc",
+		batchSizeBuckets: prom.ExponentialBuckets(1, 2, 10),
+	}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+
+	counter := func(name, help string) prom.Counter {
+		return prom.NewCounter(prom.CounterOpts{
+			Namespace:   cfg.namespace,
+			Subsystem:   cfg.subsystem,
+			Name:        name,
+			Help:        help,
+			ConstLabels: cfg.constLabels,
+		})
+	}
+
+	r := &Recorder{
+		cacheHits:       counter("cache_hits_total", "Number of keys that resulted in a cache hit."),
+		cacheMisses:     counter("cache_misses_total", "Number of keys that resulted in a cache miss."),
+		refreshes:       counter("refreshes_total", "Number of get operations that resulted in a refresh."),
+		missingRecords:  counter("missing_records_total", "Number of lookups for keys that have been marked as missing."),
+		forcedEvictions: counter("forced_evictions_total", "Number of times the cache had to evict keys to make room for a new one."),
+		entriesEvicted:  counter("entries_evicted_total", "Number of entries that have been evicted."),
+		shardIndex: prom.NewCounterVec(prom.CounterOpts{
+			Namespace:   cfg.namespace,
+			Subsystem:   cfg.subsystem,
+			Name:        "shard_operations_total",
+			Help:        "Number of operations that have been performed by each shard.",
+			ConstLabels: cfg.constLabels,
+		}, []string{"shard"}),
+		batchRefreshSize: prom.NewHistogram(prom.HistogramOpts{
+			Namespace:   cfg.namespace,
+			Subsystem:   cfg.subsystem,
+			Name:        "batch_refresh_size",
+			Help:        "Number of IDs in each batch refresh.",
+			ConstLabels: cfg.constLabels,
+			Buckets:     cfg.batchSizeBuckets,
+		}),
+		distributedCacheHits:      counter("distributed_cache_hits_total", "Number of keys that resulted in a distributed storage hit."),
+		distributedCacheMisses:    counter("distributed_cache_misses_total", "Number of keys that resulted in a distributed storage miss."),
+		distributedRefreshes:      counter("distributed_refreshes_total", "Number of distributed records that were due for a refresh."),
+		distributedMissingRecords: counter("distributed_missing_records_total", "Number of distributed records that have been marked as missing."),
+		distributedFallbacks:      counter("distributed_fallbacks_total", "Number of failed refreshes that fell back to the distributed record."),
+	}
+
+	cacheSize := prom.NewGaugeFunc(prom.GaugeOpts{
+		Namespace:   cfg.namespace,
+		Subsystem:   cfg.subsystem,
+		Name:        "cache_size",
+		Help:        "Number of entries in the cache.",
+		ConstLabels: cfg.constLabels,
+	}, r.size)
+
+	collectors := []prom.Collector{
+		r.cacheHits, r.cacheMisses, r.refreshes, r.missingRecords, r.forcedEvictions,
+		r.entriesEvicted, r.shardIndex, r.batchRefreshSize, cacheSize,
+		r.distributedCacheHits, r.distributedCacheMisses, r.distributedRefreshes,
+		r.distributedMissingRecords, r.distributedFallbacks,
+	}
+	for _, collector := range collectors {
+		if err := registerer.Register(collector); err != nil {
+			return nil, err
+		}
+	}
+
+	return r, nil
+}
+
+// size is called at scrape time to report the size of the cache.
+func (r *Recorder) size() float64 {
+	callback := r.cacheSize.Load()
+	if callback == nil {
+		return 0
+	}
+	return float64((*callback)())
+}
+
+// CacheHit increments the cache hits counter.
+func (r *Recorder) CacheHit() {
+	r.cacheHits.Inc()
+}
+
+// CacheMiss increments the cache misses counter.
+func (r *Recorder) CacheMiss() {
+	r.cacheMisses.Inc()
+}
+
+// Refresh increments the refreshes counter.
+func (r *Recorder) Refresh() {
+	r.refreshes.Inc()
+}
+
+// MissingRecord increments the missing records counter.
+func (r *Recorder) MissingRecord() {
+	r.missingRecords.Inc()
+}
+
+// ForcedEviction increments the forced evictions counter.
+func (r *Recorder) ForcedEviction() {
+	r.forcedEvictions.Inc()
+}
+
+// EntriesEvicted adds the number of evicted entries to the entries evicted counter.
+func (r *Recorder) EntriesEvicted(n int) {
+	r.entriesEvicted.Add(float64(n))
+}
+
+// ShardIndex increments the operations counter of the shard.
+func (r *Recorder) ShardIndex(index int) {
+	r.shardIndex.WithLabelValues(strconv.Itoa(index)).Inc()
+}
+
+// CacheBatchRefreshSize observes the size of a batch refresh.
+func (r *Recorder) CacheBatchRefreshSize(size int) {
+	r.batchRefreshSize.Observe(float64(size))
+}
+
+// ObserveCacheSize sets the callback that the cache size gauge invokes at scrape time.
+func (r *Recorder) ObserveCacheSize(callback func() int) {
+	r.cacheSize.Store(&callback)
+}
+
+// DistributedCacheHit increments the distributed cache hits counter.
+func (r *Recorder) DistributedCacheHit() {
+	r.distributedCacheHits.Inc()
+}
+
+// DistributedCacheMiss increments the distributed cache misses counter.
+func (r *Recorder) DistributedCacheMiss() {
+	r.distributedCacheMisses.Inc()
+}
+
+// DistributedRefresh increments the distributed refreshes counter.
+func (r *Recorder) DistributedRefresh() {
+	r.distributedRefreshes.Inc()
+}
+
+// DistributedMissingRecord increments the distributed missing records counter.
+func (r *Recorder) DistributedMissingRecord() {
+	r.distributedMissingRecords.Inc()
+}
+
+// DistributedFallback increments the distributed fallbacks counter.
+func (r *Recorder) DistributedFallback() {
+	r.distributedFallbacks.Inc()
+}
@@ -0,0 +1,125 @@
+package prometheus_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	prom "github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+
+	"github.com/creativecreature/sturdyc/metrics/prometheus"
+)
+
+func TestRecorderReportsToTheRegisteredCollectors(t *testing.T) {
+	t.Parallel()
+
+	registry := prom.NewRegistry()
+	recorder, err := prometheus.New(registry,
+		prometheus.WithSubsystem("orders"),
+		prometheus.WithConstLabels(prom.Labels{"service": "api"}),
+	)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	recorder.CacheHit()
+	recorder.CacheHit()
+	recorder.CacheMiss()
+	recorder.EntriesEvicted(5)
+	recorder.ShardIndex(3)
+	recorder.CacheBatchRefreshSize(10)
+	recorder.DistributedFallback()
+
+	size := 42
+	recorder.ObserveCacheSize(func() int { return size })
+
+	metricFamilies, err := registry.Gather()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	values := make(map[string]float64, len(metricFamilies))
+	for _, family := range metricFamilies {
+		metric := family.GetMetric()[0]
+		if !hasLabel(metric.GetLabel(), "service", "api") {
+			t.Errorf("expected %s to have the const label", family.GetName())
+		}
+		switch {
+		case metric.GetCounter() != nil:
+			values[family.GetName()] = metric.GetCounter().GetValue()
+		case metric.GetGauge() != nil:
+			values[family.GetName()] = metric.GetGauge().GetValue()
+		case metric.GetHistogram() != nil:
+			values[family.GetName()] = float64(metric.GetHistogram().GetSampleCount())
+		}
+	}
+
+	expected := map[string]float64{
+		"sturdyc_orders_cache_hits_total":            2,
+		"sturdyc_orders_cache_misses_total":          1,
+		"sturdyc_orders_entries_evicted_total":       5,
+		"sturdyc_orders_shard_operations_total":      1,
+		"sturdyc_orders_batch_refresh_size":          1,
+		"sturdyc_orders_distributed_fallbacks_total": 1,
+		"sturdyc_orders_cache_size":                  42,
+	}
+	for name, want := range expected {
+		if got, ok := values[name]; !ok || got != want {
+			t.Errorf("expected %s to be %v, got %v", name, want, got)
+		}
+	}
+}
+
+func TestCacheSizeIsObservedAtScrapeTime(t *testing.T) {
+	t.Parallel()
+
+	registry := prom.NewRegistry()
+	recorder, err := prometheus.New(registry)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	size := 1
+	recorder.ObserveCacheSize(func() int { return size })
+	if err := testutil.GatherAndCompare(registry, expectedCacheSize(1), "sturdyc_cache_size"); err != nil {
+		t.Error(err)
+	}
+
+	size = 2
+	if err := testutil.GatherAndCompare(registry, expectedCacheSize(2), "sturdyc_cache_size"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestNewReturnsAnErrorIfTheMetricsAreAlreadyRegistered(t *testing.T) {
+	t.Parallel()
+
+	registry := prom.NewRegistry()
+	if _, err := prometheus.New(registry); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if _, err := prometheus.New(registry); err == nil {
+		t.Error("expected an error when registering the same metrics twice")
+	}
+	if _, err := prometheus.New(registry, prometheus.WithSubsystem("other")); err != nil {
+		t.Errorf("expected no error for a different subsystem, got %v", err)
+	}
+}
+
+func expectedCacheSize(size int) *strings.Reader {
+	return strings.NewReader(fmt.Sprintf(`
+# HELP sturdyc_cache_size Number of entries in the cache.
+# TYPE sturdyc_cache_size gauge
+sturdyc_cache_size %d
+`, size))
+}
+
+func hasLabel(labels []*dto.LabelPair, name, value string) bool {
+	for _, label := range labels {
+		if label.GetName() == name && label.GetValue() == value {
+			return true
+		}
+	}
+	return false
+}
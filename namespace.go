@@ -0,0 +1,90 @@
+package sturdyc
+
+import "time"
+
+// Namespace creates a client with a key space, capacity and TTL of its own.
+// The namespace shares the configuration, metrics recorder and continuous
+// evictions of the client that it was created from, which means that several
+// logically distinct datasets can be stored without running a goroutine for
+// each one of them. The keys of a namespace never collide with the keys of
+// the client, or with the keys of any other namespace. The continuous
+// evictions visit the shards of every namespace in turn, so each shard is
+// visited less frequently as more namespaces are created.
+//
+// Closing a namespace closes the client it was created from, along with
+// every other namespace. Namespaces can't be used together with a
+// distributed storage, since it would be shared by every key space.
+//
+// Parameters:
+//
+//	name - The name of the namespace. Each name can only be used once.
+//	capacity - The maximum number of entries that the namespace can store.
+//	ttl - The time to live for each entry in the namespace.
+//
+// Returns:
+//
+//	A client for the namespace.
+func (c *Client[T]) Namespace(name string, capacity int, ttl time.Duration) *Client[T] {
+	root := c.root
+	if root.distributedStorage != nil {
+		panic("namespaces can't be used with a distributed storage")
+	}
+	if root.invalidationSubscriber != nil {
+		panic("namespaces can't be used with an invalidation subscriber")
+	}
+	if capacity < 1 {
+		panic("capacity must be greater than 0")
+	}
+	if ttl < 1 {
+		panic("ttl must be greater than 0")
+	}
+
+	root.namespaceMutex.Lock()
+	defer root.namespaceMutex.Unlock()
+	if _, ok := root.namespaces[name]; ok {
+		panic("sturdyc: namespace " + name + " already exists")
+	}
+
+	// The shards inherit the eviction settings of the root client.
+	template := root.shards[0]
+	shards := make([]*shard[T], len(root.shards))
+	for i := range shards {
+		shards[i] = newShard[T](shardCapacity(capacity, len(shards), i), ttl, template.evictionPercentage, root.Config)
+		shards[i].onEvict = template.onEvict
+		shards[i].costFn = template.costFn
+		shards[i].cloneFn = template.cloneFn
+		shards[i].versionFn = template.versionFn
+		shards[i].maxCost = template.maxCost
+	}
+
+	namespace := &Client[T]{
+		Config:               root.Config,
+		shards:               shards,
+		ring:                 root.ring,
+		inFlightBatchMap:     make(map[string]*inFlightCall[map[string]T]),
+		fetchBufferMap:       make(map[string]*fetchBuffer[T]),
+		permutationBufferMap: make(map[string]*buffer),
+		closeOnce:            root.closeOnce,
+		closed:               root.closed,
+		done:                 root.done,
+		root:                 root,
+	}
+	namespace.ttl.Store(int64(ttl))
+	root.namespaces[name] = namespace
+	root.evictionShards = append(root.evictionShards, shards...)
+	return namespace
+}
+
+// totalSize returns the number of entries in the client and every one of its
+// namespaces. It's the size that is reported to the metrics recorder, which
+// is shared by all of them.
+func (c *Client[T]) totalSize() int {
+	c.namespaceMutex.Lock()
+	shards := c.evictionShards
+	c.namespaceMutex.Unlock()
+	var sum int
+	for _, shard := range shards {
+		sum += shard.size()
+	}
+	return sum
+}
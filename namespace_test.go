@@ -0,0 +1,129 @@
+package sturdyc_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/creativecreature/sturdyc"
+)
+
+func TestNamespacesHaveIndependentKeySpacesAndTTLs(t *testing.T) {
+	t.Parallel()
+
+	clock := sturdyc.NewTestClock(time.Now())
+	c := sturdyc.New[string](100, 2, time.Hour, 5,
+		sturdyc.WithNoContinuousEvictions(),
+		sturdyc.WithClock(clock),
+	)
+	users := c.Namespace("users", 10, time.Minute)
+	orders := c.Namespace("orders", 10, time.Hour)
+
+	c.Set("1", "root")
+	users.Set("1", "user")
+	orders.Set("1", "order")
+
+	for client, want := range map[*sturdyc.Client[string]]string{c: "root", users: "user", orders: "order"} {
+		if v, ok := client.Get("1"); !ok || v != want {
+			t.Errorf("expected %s, got %s", want, v)
+		}
+	}
+
+	clock.Add(time.Minute + time.Second)
+	if _, ok := users.Get("1"); ok {
+		t.Error("expected the entry to expire with the TTL of its namespace")
+	}
+	if _, ok := orders.Get("1"); !ok {
+		t.Error("expected the entries of the other namespace to remain")
+	}
+}
+
+func TestNamespacesShareTheContinuousEvictions(t *testing.T) {
+	t.Parallel()
+
+	clock := sturdyc.NewTestClock(time.Now())
+	c := sturdyc.New[string](100, 1, time.Hour, 5,
+		sturdyc.WithClock(clock),
+		sturdyc.WithEvictionInterval(time.Second),
+	)
+	defer c.Close()
+
+	ttl := time.Minute
+	users := c.Namespace("users", 10, ttl)
+	users.Set("1", "user")
+
+	clock.Add(ttl + time.Second)
+	for i := 0; i < 2; i++ {
+		time.Sleep(10 * time.Millisecond)
+		clock.Add(time.Second)
+	}
+	time.Sleep(10 * time.Millisecond)
+	if users.Size() != 0 {
+		t.Errorf("expected the expired entry of the namespace to be evicted, got size %d", users.Size())
+	}
+}
+
+func TestPanicsIfANamespaceIsCreatedTwice(t *testing.T) {
+	t.Parallel()
+
+	defer func() {
+		err := recover()
+		if err == nil {
+			t.Error("expected a panic when a namespace is created twice")
+		}
+	}()
+	c := sturdyc.New[string](100, 1, time.Hour, 5, sturdyc.WithNoContinuousEvictions())
+	c.Namespace("users", 10, time.Minute)
+	c.Namespace("users", 10, time.Minute)
+}
+
+func TestPanicsIfANamespaceHasNoCapacity(t *testing.T) {
+	t.Parallel()
+
+	defer func() {
+		err := recover()
+		if err == nil {
+			t.Error("expected a panic when a namespace has a capacity of 0")
+		}
+	}()
+	c := sturdyc.New[string](100, 1, time.Hour, 5, sturdyc.WithNoContinuousEvictions())
+	c.Namespace("users", 0, time.Minute)
+}
+
+func TestNamespacesDontShareTheRefreshBuffers(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	clock := sturdyc.NewTestClock(time.Now())
+	c := sturdyc.New[string](1000, 10, time.Hour, 10,
+		sturdyc.WithNoContinuousEvictions(),
+		sturdyc.WithEarlyRefreshes(time.Minute*5, time.Minute*10, time.Millisecond*10),
+		sturdyc.WithRefreshCoalescing(10, time.Minute),
+		sturdyc.WithClock(clock),
+	)
+	namespace := c.Namespace("other", 1000, time.Hour)
+
+	rootObserver, namespaceObserver := NewFetchObserver(1), NewFetchObserver(1)
+	rootObserver.BatchResponse([]string{"1", "2"})
+	namespaceObserver.BatchResponse([]string{"3", "4"})
+	sturdyc.GetOrFetchBatch(ctx, c, []string{"1", "2"}, c.BatchKeyFn("item"), rootObserver.FetchBatch)
+	sturdyc.GetOrFetchBatch(ctx, namespace, []string{"3", "4"}, namespace.BatchKeyFn("item"), namespaceObserver.FetchBatch)
+	<-rootObserver.FetchCompleted
+	<-namespaceObserver.FetchCompleted
+	rootObserver.Clear()
+	namespaceObserver.Clear()
+
+	// Both clients use the same permutation, but the refreshes
+	// of each one should be fetched with its own fetchFn.
+	clock.Add(time.Minute*10 + time.Second)
+	sturdyc.GetOrFetchBatch(ctx, c, []string{"1", "2"}, c.BatchKeyFn("item"), rootObserver.FetchBatch)
+	time.Sleep(10 * time.Millisecond)
+	sturdyc.GetOrFetchBatch(ctx, namespace, []string{"3", "4"}, namespace.BatchKeyFn("item"), namespaceObserver.FetchBatch)
+	time.Sleep(10 * time.Millisecond)
+
+	clock.Add(time.Minute + 1)
+	<-rootObserver.FetchCompleted
+	<-namespaceObserver.FetchCompleted
+	rootObserver.AssertRequestedRecords(t, []string{"1", "2"})
+	namespaceObserver.AssertRequestedRecords(t, []string{"3", "4"})
+}
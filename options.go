@@ -1,6 +1,9 @@
 package sturdyc
 
-import "time"
+import (
+	"context"
+	"time"
+)
 
 type Option func(*Config)
 
@@ -12,7 +15,11 @@ func WithMetrics(recorder MetricsRecorder) Option {
 	}
 }
 
-// WithClock can be used to change the clock that the cache uses. This is useful for testing.
+// WithClock can be used to change the clock that the cache uses. Every
+// computation that involves time goes through it, which includes the
+// expiration of the entries, the refresh windows and retry delays, the
+// intervals of the eviction job, and the fetch timeout. This is useful for
+// testing, or for simulating clock drift.
 func WithClock(clock Clock) Option {
 	return func(c *Config) {
 		c.clock = clock
@@ -39,16 +46,323 @@ func WithNoContinuousEvictions() Option {
 	}
 }
 
+// WithLazyEviction disables the continuous eviction job, and makes the
+// shards remove expired entries as they're being accessed instead. This
+// avoids running a goroutine in the background, which is useful for caches
+// that are short-lived. Please note that client.Size includes the entries
+// that have expired without being accessed since, which means that it
+// could overcount. Like WithNoContinuousEvictions, the shards still perform
+// forced evictions once they reach their capacity.
+func WithLazyEviction() Option {
+	return func(c *Config) {
+		c.disableContinuousEvictions = true
+		c.lazyEviction = true
+	}
+}
+
+// WithInitialShardCapacity allocates the map of each shard with room for n
+// entries up front. This prevents the maps from having to grow repeatedly
+// while the cache is being warmed up. The hint is capped at the capacity of
+// each shard, so it never allocates room for more entries than a shard is
+// able to hold.
+func WithInitialShardCapacity(n int) Option {
+	return func(c *Config) {
+		c.initialShardCapacity = n
+	}
+}
+
+// WithMaxKeyLength rejects the keys that are longer than n bytes. Very long
+// keys waste memory, and they're often the result of a bug in the way that the
+// keys are constructed. The functions that fetch values through the cache
+// return ErrInvalidKey for them, and the writes of client.Set and its
+// variants are dropped and logged as warnings. The length isn't limited by default.
+func WithMaxKeyLength(n int) Option {
+	return func(c *Config) {
+		c.maxKeyLength = n
+	}
+}
+
+// WithKeyValidator sets a function that validates every key before it enters
+// the cache. The keys that it returns an error for are rejected like the ones
+// that exceed the limit of WithMaxKeyLength, with the error wrapped in
+// ErrInvalidKey. It's called on the hot path of every write and fetch, which is
+// why it should be fast. The keys aren't validated by default.
+func WithKeyValidator(validator func(key string) error) Option {
+	return func(c *Config) {
+		c.keyValidator = validator
+	}
+}
+
+// WithCircuitBreaker stops the cache from calling a data source that is
+// failing hard. Once failureThreshold fetches in a row have failed, the breaker
+// opens, and the fetches fail fast with ErrCircuitOpen until the openDuration
+// has elapsed. An expired value is served instead if the client has been
+// configured with WithStaleWhileError. After that, the breaker lets a single
+// probe through, which closes it again if it succeeds, or keeps it open for
+// another openDuration if it fails. Records that don't exist at the data
+// source, and fetches that are cancelled by the caller, don't count as
+// failures. There is a single breaker for every key by default, which can be
+// divided into several breakers with WithCircuitBreakerTargetFn. The state
+// transitions are logged, and reported to metrics recorders that implement
+// CircuitBreakerRecorder.
+func WithCircuitBreaker(failureThreshold int, openDuration time.Duration) Option {
+	return func(c *Config) {
+		c.circuitBreakers = newCircuitBreakers(failureThreshold, openDuration)
+	}
+}
+
+// WithCircuitBreakerTargetFn gives each fetch target its own circuit breaker.
+// The function maps the keys to their targets, for example the service or
+// database table that they're fetched from, which allows one of them to fail
+// without the breaker opening for the others. Batches are guarded by the
+// breaker of the key of their first ID.
+//
+// NOTE: This requires the WithCircuitBreaker functionality to be enabled.
+func WithCircuitBreakerTargetFn(targetFn func(key string) string) Option {
+	return func(c *Config) {
+		c.circuitBreakerTargetFn = targetFn
+	}
+}
+
+// WithEvictionPolicy sets the policy that the shards use to decide which
+// entries to evict once they have reached their capacity. The default policy
+// evicts the entries that are closest to expiring, which could throw out keys
+// that are in active use. EvictionPolicyLRU makes every read update the
+// recency of the entry, and evicts the least recently used entries instead.
+// EvictionPolicyLFU counts the reads, and evicts the entries that are used
+// the least. The counts are halved every time the continuous eviction job
+// scans a shard so that old bursts of traffic decay over time.
+func WithEvictionPolicy(policy EvictionPolicy) Option {
+	return func(c *Config) {
+		c.evictionPolicy = policy
+	}
+}
+
+// WithEvictionSampleSize makes the forced evictions approximate the eviction
+// policy by sampling, rather than by ranking every entry of the shard. For
+// each entry that has to be evicted, n candidates are examined, and the one
+// that the policy ranks the lowest is evicted, which is the same technique
+// that Redis uses to approximate LRU and LFU. A larger sample gives better
+// eviction decisions at a higher cost. It's mostly useful for large shards
+// with a low eviction percentage, where ranking every entry is wasteful.
+func WithEvictionSampleSize(n int) Option {
+	return func(c *Config) {
+		c.sampleEvictions = true
+		c.evictionSampleSize = n
+	}
+}
+
+// WithEvictionHighWatermark makes the shards start to evict once they're
+// filled to the fraction of their capacity, rather than once they're full.
+// Each eviction removes the evictionPercentage of the entries, which leaves
+// the shard at a low watermark below the high one. This spreads the eviction
+// work out into batches, and avoids the churn of evicting on nearly every
+// write once the cache is full. The evictions are reported as forced
+// evictions, and in the number of evicted entries, like any other. The
+// default is 1, which evicts once the shards have reached their capacity. It
+// doesn't apply to the budget of WithMaxCost.
+func WithEvictionHighWatermark(fraction float64) Option {
+	return func(c *Config) {
+		c.evictionHighWatermark = fraction
+	}
+}
+
+// WithEvictionCallback sets a function that is invoked for every entry that
+// gets removed from the cache. The reason tells you whether the entry expired,
+// was evicted because a shard had reached its capacity, or if it was removed
+// through one of the delete functions or client.Clear. Missing records are
+// passed to the callback with the zero value, and with WithKeyTransform, the
+// key is the transformed one. The type of the value has to match the type of
+// the cache, and New panics if it doesn't.
+//
+// The callback is invoked synchronously once the shard's lock has been
+// released, which means that it's safe to call back into the cache. However,
+// the goroutine that triggered the eviction is blocked until the callback
+// returns. A forced eviction can remove a large number of entries at once,
+// so if you have a lot of churn, you should keep the callback cheap or hand
+// the entries off to a goroutine of your own.
+func WithEvictionCallback[T any](callback func(key string, value T, reason EvictionReason)) Option {
+	return func(c *Config) {
+		c.evictionCallback = callback
+	}
+}
+
+// WithCostFn sets a function that computes the cost of each value that is
+// written to the cache, which is typically an estimate of its size in bytes.
+// When it's used together with WithMaxCost, the shards start evicting entries
+// once their total cost exceeds the budget, rather than once the number of
+// entries exceeds the capacity. The type of the value has to match the type
+// of the cache, and New panics if it doesn't.
+func WithCostFn[T any](costFn func(T) int64) Option {
+	return func(c *Config) {
+		c.costFn = costFn
+	}
+}
+
+// WithValueCloner sets a function that is used to copy the values of the
+// cache. The values are cloned as they're written, which isolates the stored
+// copy from the one of the caller, and they're cloned again as they're read,
+// which prevents the callers from mutating the entry in place. This is
+// important for value types that contain slices, maps or pointers, which are
+// shared between every reader of the cache by default. The values that are
+// handed out by client.GetRef aren't cloned, since the point of it is to
+// avoid the copy. The type of the value has to match the type of the cache,
+// and New panics if it doesn't.
+func WithValueCloner[T any](cloneFn func(T) T) Option {
+	return func(c *Config) {
+		c.cloneFn = cloneFn
+	}
+}
+
+// WithVersionFn sets a function that returns the version of a value, such as
+// an updatedAt timestamp, which has to increase every time the value changes.
+// In a setup with multiple writers, it prevents a slow refresh from
+// overwriting a value that was written by a faster one. A write is dropped if
+// the cache holds a value with a newer version for the key, and the same goes
+// for the records that would replace newer ones in the distributed storage.
+// Values with the same version are still written, since that is what renews
+// the TTL of entries that are refreshed without having changed. The version
+// is also included in the messages of WithInvalidationSubscriber, which
+// allows the other instances to keep their copy if it's already up to date.
+// The type of the value has to match the type of the cache, and New panics
+// if it doesn't.
+func WithVersionFn[T any](versionFn func(T) uint64) Option {
+	return func(c *Config) {
+		c.versionFn = versionFn
+	}
+}
+
+// WithMaxCost sets the total cost that the values in the cache are allowed to
+// have. The budget is divided evenly between the shards, which means that it
+// has to be at least the number of shards, and a shard that
+// exceeds its budget keeps evicting entries, based on the eviction policy and
+// evictionPercentage, until the new value fits.
+//
+// NOTE: This requires a cost function to be set through WithCostFn.
+func WithMaxCost(maxCost int64) Option {
+	return func(c *Config) {
+		c.maxCost = maxCost
+	}
+}
+
+// WithHashFn sets the function that is used to hash the keys when deciding
+// which shard they belong to. The keys are hashed with xxhash by default.
+// Please note that the placement of the keys is only stable for as long as
+// the function stays the same. Changing it between two deployments is fine,
+// as every client starts out empty, but it makes keys land in different
+// shards than they would have before.
+func WithHashFn(hashFn func(string) uint64) Option {
+	return func(c *Config) {
+		c.hashFn = hashFn
+	}
+}
+
+// WithConsistentHashing places the keys on the shards with a hash ring rather
+// than by taking the hash of the key modulo the number of shards. Each shard
+// is given virtualNodes positions on the ring, and more of them spread the
+// keys more evenly at the cost of a slower lookup. Unlike the modulo, the
+// ring keeps most of the keys on the same shard if the number of shards is
+// changed, and only about 1/numShards of them are moved to a new one. This
+// also makes it possible to align the placement with an external ring that
+// uses the same hash function.
+func WithConsistentHashing(virtualNodes int) Option {
+	return func(c *Config) {
+		c.consistentHashing = true
+		c.virtualNodes = virtualNodes
+	}
+}
+
+// WithFetchTimeout bounds the time that the cache waits for a FetchFn or
+// BatchFetchFn to return. Every invocation is given a context that is
+// cancelled once the timeout has passed. If the function hasn't returned by
+// then, the cache stops waiting for it and returns context.DeadlineExceeded
+// without writing anything to the cache. This applies to the background
+// refreshes too, which ensures that a slow data source can't stall them.
+func WithFetchTimeout(timeout time.Duration) Option {
+	return func(c *Config) {
+		c.fetchTimeout = timeout
+	}
+}
+
+// WithShardKeyFn sets a function that derives the string which is hashed to
+// decide which shard a key belongs to. The entries are still stored and
+// retrieved using their full keys, it's only the routing that changes. This
+// allows you to make related keys share a shard, for example by stripping a
+// volatile suffix, or to spread hot keys out over more shards.
+func WithShardKeyFn(shardKeyFn func(key string) string) Option {
+	return func(c *Config) {
+		c.shardKeyFn = shardKeyFn
+	}
+}
+
+// WithKeyTransform sets a function that the keys are passed through before
+// they're stored, for example to hash very long keys to a fixed length. The
+// transform has to be deterministic. Only the transformed key is stored, which
+// means that the keys that the cache hands back, such as those of
+// client.ScanKeys, client.ForEach and the eviction callback, are the
+// transformed ones, and that client.DeleteByPrefix matches the prefix against
+// them. The keys that are passed to your fetch functions are left as they are.
+// The transform can't be combined with WithShardKeyFn, a distributed storage
+// or an invalidation subscriber, since they all depend on the original keys.
+func WithKeyTransform(transform func(key string) string) Option {
+	return func(c *Config) {
+		c.keyTransform = transform
+	}
+}
+
 // WithMissingRecordStorage allows the cache to mark keys as missing from the
 // underlying data source. This allows you to stop streams of outgoing requests
 // for requests that don't exist. The keys will still have the same TTL and
-// refresh durations as any of the other record in the cache.
+// refresh durations as any of the other record in the cache, unless you use
+// the WithMissingRecordTTL or WithNoMissingRecordRefreshes options.
 func WithMissingRecordStorage() Option {
 	return func(c *Config) {
 		c.storeMissingRecords = true
 	}
 }
 
+// WithMissingRecordTTL sets the TTL of the records that have been marked as
+// missing. This allows you to cache the records that don't exist at the
+// underlying data source for a shorter duration than the ones that do. The
+// missing records use the same TTL as every other record by default.
+//
+// NOTE: This requires the WithMissingRecordStorage functionality to be enabled.
+func WithMissingRecordTTL(ttl time.Duration) Option {
+	return func(c *Config) {
+		c.missingRecordTTL = ttl
+	}
+}
+
+// WithMaxMissingRecords limits the number of missing records that each shard
+// retains. Once a shard holds n of them, the oldest missing record is evicted
+// to make room for the next one. The missing records still count towards the
+// capacity of the cache, but the limit ensures that a flood of requests for
+// IDs that don't exist is unable to push out the records that do. The
+// evictions are passed to the eviction callback with
+// EvictionReasonMissingRecordLimit, and reported to metrics recorders that
+// implement MissingRecordEvictionRecorder.
+//
+// NOTE: This requires the WithMissingRecordStorage functionality to be enabled.
+func WithMaxMissingRecords(n int) Option {
+	return func(c *Config) {
+		c.limitMissingRecords = true
+		c.maxMissingRecords = n
+	}
+}
+
+// WithNoMissingRecordRefreshes stops the cache from refreshing the records
+// that have been marked as missing in the background. They'll stay missing
+// until they expire, and are fetched again on the next request after that.
+// This can be combined with WithMissingRecordTTL to control how long it takes
+// for a record that gets created at the underlying data source to appear.
+//
+// NOTE: This requires the WithMissingRecordStorage functionality to be enabled.
+func WithNoMissingRecordRefreshes() Option {
+	return func(c *Config) {
+		c.disableMissingRecordRefreshes = true
+	}
+}
+
 // WithEarlyRefreshes instructs the cache to refresh the keys that are in
 // active rotation, thereby preventing them from ever expiring. This can have a
 // significant impact on your application's latency as you're able to
@@ -61,7 +375,152 @@ func WithEarlyRefreshes(minRefreshTime, maxRefreshTime, retryBaseDelay time.Dura
 		c.refreshInBackground = true
 		c.minRefreshTime = minRefreshTime
 		c.maxRefreshTime = maxRefreshTime
-		c.retryBaseDelay = retryBaseDelay
+		if !c.customRefreshRetries {
+			c.retryBaseDelay = retryBaseDelay
+		}
+	}
+}
+
+// WithRefreshRetry controls how the cache retries background refreshes that
+// fail. The first retry happens after the baseDelay, and every subsequent one
+// waits multiplier times as long as the previous one, up to the TTL. Once a
+// refresh has been retried maxRetries times, the cache stops refreshing the
+// entry and keeps serving the stale value until it expires. A maxRetries of 0
+// keeps retrying until the entry expires. This takes precedence over the
+// retryBaseDelay that was passed to WithEarlyRefreshes, which doubles the
+// delay between each retry.
+//
+// NOTE: This requires the WithEarlyRefreshes functionality to be enabled.
+func WithRefreshRetry(baseDelay time.Duration, maxRetries int, multiplier float64) Option {
+	return func(c *Config) {
+		c.customRefreshRetries = true
+		c.retryBaseDelay = baseDelay
+		c.maxRefreshRetries = maxRetries
+		c.retryMultiplier = multiplier
+	}
+}
+
+// WithTTLJitter adds or subtracts a random duration of up to the given
+// fraction of the TTL when an entry is written. Entries that are written in
+// the same burst then expire at different times, which spreads out the load
+// of fetching them again. The jitter applies to the TTL that the client was
+// configured with, as well as the TTL of missing records. It's computed once
+// per write and stored with the entry. TTLs that are passed explicitly, such
+// as the one to client.SetWithTTL, are used as is.
+func WithTTLJitter(fraction float64) Option {
+	return func(c *Config) {
+		c.ttlJitter = fraction
+	}
+}
+
+// WithRefreshConcurrency limits the number of background refreshes that can
+// be in-flight at the same time. Refreshes that become due while every slot
+// is taken are queued until one of the others has finished, and the entries
+// keep serving the values that are in the cache until then. The limit applies
+// to the total number of calls to the fetchFns, regardless of whether they're
+// for a single key or a batch. The depth of the queue is available through
+// client.RefreshQueueDepth, and is reported to metrics recorders that
+// implement RefreshQueueRecorder.
+//
+// NOTE: This requires the WithEarlyRefreshes functionality to be enabled.
+func WithRefreshConcurrency(limit int) Option {
+	return func(c *Config) {
+		c.refreshConcurrency = limit
+		c.refreshSlots = make(chan struct{}, max(limit, 0))
+	}
+}
+
+// WithRefreshAheadThreshold makes each entry due for a refresh once it has
+// entered the last fraction of its TTL, rather than after the minRefreshTime
+// and maxRefreshTime that were passed to WithEarlyRefreshes. A read in the
+// tail of the TTL schedules a single background refresh, which keeps the
+// entries that are in active rotation fresh, while the ones that aren't
+// requested are left to expire. A fraction of 0.2 refreshes an entry with
+// a TTL of one minute if it's read during its final 12 seconds.
+//
+// NOTE: This requires the WithEarlyRefreshes functionality to be enabled.
+func WithRefreshAheadThreshold(fraction float64) Option {
+	return func(c *Config) {
+		c.refreshAheadThreshold = fraction
+	}
+}
+
+// WithAdaptiveRefresh adjusts the refresh intervals to the latency of the
+// underlying data source, which prevents the refreshes from amplifying the
+// load on a backend that is already slow. The cache keeps a moving average
+// of how long the fetchFns take, and the time until an entry becomes due
+// for a refresh is multiplied by how that average compares to the target.
+// A data source that responds in twice the target latency makes the
+// entries that are written refresh half as often, while one that is faster
+// than the target makes them refresh more often. The factor is kept between
+// 0.5 and 8, and it's reported to metrics recorders that implement
+// AdaptiveRefreshRecorder.
+//
+// NOTE: This requires the WithEarlyRefreshes functionality to be enabled.
+func WithAdaptiveRefresh(target time.Duration) Option {
+	return func(c *Config) {
+		c.adaptiveRefresh = newAdaptiveRefresh(target)
+	}
+}
+
+// WithSoftTTL gives each entry a soft expiry in addition to the hard expiry
+// of the TTL. Once the soft TTL has passed, the value is considered stale.
+// Reads keep serving it, but they also schedule a background refresh. It's
+// not until the hard expiry has passed that a read results in a cache miss.
+// This enables the background refreshes, and a refresh that fails is retried
+// after another soft TTL unless WithRefreshRetry has been used. It replaces
+// the refresh times of WithEarlyRefreshes and WithRefreshAheadThreshold, and
+// can't be combined with them.
+func WithSoftTTL(d time.Duration) Option {
+	return func(c *Config) {
+		c.refreshInBackground = true
+		c.softExpiry = true
+		c.softTTL = d
+		if !c.customRefreshRetries {
+			c.retryBaseDelay = d
+		}
+	}
+}
+
+// WithRefreshJitter delays the point at which each entry becomes due for a
+// refresh by a random duration of up to the given fraction of its TTL. The
+// jitter is computed once when the entry is written, which keeps the schedule
+// stable across reads. This smooths out the load on the underlying data
+// source when a lot of entries are written at the same time.
+//
+// NOTE: This requires the WithEarlyRefreshes functionality to be enabled.
+func WithRefreshJitter(fraction float64) Option {
+	return func(c *Config) {
+		c.refreshJitter = fraction
+	}
+}
+
+// WithRefreshCallback sets a function that is invoked after each background
+// refresh has completed. It receives the key that was refreshed, the error
+// returned by the fetch function, and the duration of the refresh. Batch
+// refreshes invoke the callback once for every ID in the batch, and IDs that
+// weren't part of the response are reported with ErrNotFound. The callback is
+// invoked from the goroutine that performed the refresh, without holding any
+// of the cache's locks, so it's safe to call back into the cache.
+//
+// NOTE: This requires the WithEarlyRefreshes functionality to be enabled.
+func WithRefreshCallback(callback func(key string, err error, duration time.Duration)) Option {
+	return func(c *Config) {
+		c.refreshCallback = callback
+	}
+}
+
+// WithRefreshContextFn sets a function that creates the context which is
+// passed to the fetch functions when the records are refreshed in the
+// background. The refreshes run detached from the requests that triggered
+// them, and use context.Background() by default. This allows you to provide
+// a base context that carries values such as service credentials or tracing
+// information.
+//
+// NOTE: This requires the WithEarlyRefreshes functionality to be enabled.
+func WithRefreshContextFn(refreshContextFn func() context.Context) Option {
+	return func(c *Config) {
+		c.refreshContextFn = refreshContextFn
 	}
 }
 
@@ -76,7 +535,119 @@ func WithRefreshCoalescing(bufferSize int, bufferDuration time.Duration) Option
 		c.bufferRefreshes = true
 		c.bufferSize = bufferSize
 		c.bufferTimeout = bufferDuration
-		c.permutationBufferMap = make(map[string]*buffer)
+	}
+}
+
+// WithFetchBuffering applies the buffering of WithRefreshCoalescing to the
+// cache misses of client.GetOrFetchBatch. The IDs that are missing from the
+// cache are gathered in a buffer for each cache key permutation until the
+// batchSize is reached, or the window has passed. The buffered IDs are then
+// retrieved with a single call to the fetchFn, and every caller returns as
+// soon as that call has completed.
+//
+// NOTE: The permutation is extracted from the cache keys, which means that
+// the keyFn should be created with client.BatchKeyFn or
+// client.PermutatedBatchKeyFn. The fetchFn of the caller that created the
+// buffer is used to retrieve every ID in it.
+func WithFetchBuffering(batchSize int, window time.Duration) Option {
+	return func(c *Config) {
+		c.bufferFetches = true
+		c.fetchBufferSize = batchSize
+		c.fetchBufferWindow = window
+	}
+}
+
+// WithBatchChunking splits the cache misses of client.GetOrFetchBatch into
+// chunks of at most batchSize IDs, which are retrieved with separate calls to
+// the fetchFn. At most parallelism of those calls run at the same time for
+// each request. This keeps large requests within the limits of the underlying
+// data source. A chunk that fails doesn't fail the others. The records of the
+// successful chunks are returned together with ErrPartialBatch, while
+// client.GetOrFetchBatchWithErrors reports the error of the failed chunk for
+// each of its IDs. The misses are buffered rather than chunked if the client
+// uses WithFetchBuffering.
+func WithBatchChunking(batchSize, parallelism int) Option {
+	return func(c *Config) {
+		c.chunkFetches = true
+		c.fetchChunkSize = batchSize
+		c.fetchChunkParallelism = parallelism
+	}
+}
+
+// WithPrefetchFn warms the cache with the records that are likely to be
+// requested next, which is useful for graph-like data. Once
+// client.GetOrFetchBatch has fetched the records that it was missing, the
+// prefetchFn is called with the ID of each one of them, and the IDs that it
+// returns are fetched in the background with the same keyFn and fetchFn.
+// This applies to the records of an ErrPartialBatch too. A successful fetch
+// of client.GetOrFetchWithKey calls the prefetchFn with the cache key, and
+// the keys that it returns are passed to the same fetchFn. The other
+// single-key functions don't prefetch, since their fetchFn can't fetch any
+// other key. The records that are cached already are skipped, and the
+// fetches are deduplicated and buffered like any other. The prefetches are
+// subject to the limit of WithRefreshConcurrency, and the records that they
+// fetch don't cause any further prefetches.
+func WithPrefetchFn(prefetchFn func(id string) []string) Option {
+	return func(c *Config) {
+		c.prefetchFn = prefetchFn
+	}
+}
+
+// WithSlidingExpiration makes every read that results in a cache hit move
+// the expiry of the entry to a full TTL from the time of the read. The TTL is
+// the one that the entry was written with, such as that of client.SetWithTTL.
+// This allows entries such as sessions to live for as long as they're being
+// accessed. It applies to client.Get, client.GetMany and the functions that
+// fetch values through the cache. Missing records keep their expiry, so that
+// they are eventually fetched again. Reads have to acquire the write lock of
+// the shard to change the expiry, which makes them slightly more expensive.
+func WithSlidingExpiration() Option {
+	return func(c *Config) {
+		c.slidingExpiration = true
+	}
+}
+
+// WithMaxPinnedEntries sets the maximum number of keys that can be pinned with
+// client.Pin. Once the limit has been reached, client.Pin returns false until
+// another key has been unpinned. The limit defaults to the capacity of the cache.
+func WithMaxPinnedEntries(n int) Option {
+	return func(c *Config) {
+		c.maxPinnedEntries = n
+	}
+}
+
+// WithFallbackTTL makes client.GetOrFetchWithFallback write the fallback to
+// the cache for the given TTL. Until it expires, the fallback is served from
+// the cache like any other value, which gives the data source some time to
+// recover rather than being called on every request. The fallback isn't
+// cached by default.
+func WithFallbackTTL(ttl time.Duration) Option {
+	return func(c *Config) {
+		c.fallbackTTL = ttl
+	}
+}
+
+// WithStaleWhileError makes client.GetOrFetch serve expired values if the
+// fetchFn fails. The continuous eviction job retains the expired entries for
+// the maxStaleness, and if the fetchFn returns an error during that time, the
+// expired value is returned together with ErrStaleRecord. This allows you to
+// tell a stale value apart from a fresh one, and from a hard failure. Records
+// that are reported as missing by the fetchFn are never served stale.
+func WithStaleWhileError(maxStaleness time.Duration) Option {
+	return func(c *Config) {
+		c.maxStaleness = maxStaleness
+	}
+}
+
+// WithPassthroughPercentage makes client.Passthrough and
+// client.PassthroughBatch serve the given percentage of the calls from the
+// cache, provided that it has the records. The decision is made at random for
+// every call. This allows you to gradually shift traffic from the underlying
+// data source to the cache. The default is 0, which sends every call to the
+// data source.
+func WithPassthroughPercentage(percentage int) Option {
+	return func(c *Config) {
+		c.passthroughPercentage = percentage
 	}
 }
 
@@ -89,12 +660,47 @@ func WithRelativeTimeKeyFormat(truncation time.Duration) Option {
 	}
 }
 
-// WithLog allows you to set a custom logger for the cache. The cache isn't chatty,
-// and will only log warnings and errors that would be a nightmare to debug. If you
-// absolutely don't want any logs, you can pass in the sturdyc.NoopLogger.
+// WithLogger allows you to set a custom logger for the cache. The cache isn't
+// chatty, and will only log the events that would be a nightmare to debug.
+// Refresh failures are logged as warnings, and forced evictions as debug logs.
+// The logs are discarded by default, and a *slog.Logger can be passed to
+// write them with log/slog. The cache never logs while it's holding the lock
+// of a shard, which means that the logger is free to call back into it.
+func WithLogger(logger Logger) Option {
+	return func(c *Config) {
+		c.log = logger
+	}
+}
+
+// WithLog allows you to set a custom logger for the cache.
+//
+// Deprecated: Use WithLogger instead.
 func WithLog(log Logger) Option {
+	return WithLogger(log)
+}
+
+// WithTreatEmptyBatchAsError makes the cache treat a batch fetchFn that
+// returns an empty response, without an error, as if it had failed with
+// ErrEmptyBatch. None of the IDs are then stored as missing records, and
+// the background refreshes leave the cached values intact, which prevents a
+// transient issue at the data source from being cached. Responses that
+// contain some of the IDs are handled like before, and the IDs that are
+// absent from them are still stored as missing records.
+func WithTreatEmptyBatchAsError() Option {
 	return func(c *Config) {
-		c.log = log
+		c.treatEmptyBatchAsError = true
+	}
+}
+
+// WithReadOnly puts the client in read-only mode, which freezes the cache for
+// incident mitigation. The entries that are in the cache are still served,
+// but the fetchFns are never called, and the keys that are missing result in
+// ErrReadOnly. The background refreshes are skipped, and the writes of
+// client.Set and its variants are discarded, while deletions and evictions
+// still take effect. This can be toggled at runtime with client.SetReadOnly.
+func WithReadOnly(enabled bool) Option {
+	return func(c *Config) {
+		c.readOnly.Store(enabled)
 	}
 }
 
@@ -134,6 +740,154 @@ func WithDistributedStorageEarlyRefreshes(storage DistributedStorageWithDeletion
 	}
 }
 
+// WithDistributedStorageErrorHandler registers a callback that is invoked
+// whenever a read, write or deletion against the distributed storage fails.
+// The op is one of "get", "set" or "delete", and the callback is invoked once
+// for every key of a batch operation. The failed operations are treated as if
+// the keys were missing from the distributed storage, which means that the
+// cache keeps serving requests from memory and the underlying data source
+// during an outage. Records that fail to be encoded or decoded are reported,
+// as are panics from the storage. The DistributedStorage interface doesn't
+// return errors, so the storage reports its own failures by passing the
+// context it received to ReportDistributedStorageError. The callback is never
+// invoked while the cache holds any of its locks.
+func WithDistributedStorageErrorHandler(handler func(op, key string, err error)) Option {
+	return func(c *Config) {
+		c.distributedErrorHandler = handler
+	}
+}
+
+// WithDistributedInvalidation makes client.Delete, client.DeleteMany,
+// client.DeleteByPrefix and client.InvalidateTag delete the keys from the
+// distributed storage as well. The prefixes and tags are matched against the
+// local cache, which means that the last two only delete the keys that it
+// holds. Without it, the deletions are local, and the other instances are
+// going to keep reading the records from the distributed storage until they
+// expire. A failure to delete the keys from the distributed storage doesn't
+// affect the local deletion, but it's passed to the handler of
+// WithDistributedStorageErrorHandler.
+//
+// NOTE: This requires a distributed storage that implements the delete
+// functions of DistributedStorageWithDeletions.
+func WithDistributedInvalidation() Option {
+	return func(c *Config) {
+		c.distributedInvalidation = true
+	}
+}
+
+// WithDistributedTTL makes the records that are written to the distributed
+// storage expire after their own TTL, rather than the one that you've set up
+// for the storage. This decouples the lifetime of the shared records from the
+// memory pressure of each instance. A longer TTL in the distributed storage
+// allows instances that are starting up with a cold cache to benefit more
+// from the records that the others have fetched. The entries in memory keep
+// honoring the TTL that the client was created with.
+//
+// NOTE: This requires a distributed storage that implements the functions
+// of DistributedStorageWithTTL.
+func WithDistributedTTL(d time.Duration) Option {
+	return func(c *Config) {
+		c.useDistributedTTL = true
+		c.distributedTTL = d
+	}
+}
+
+// WithWriteBehind makes client.Set and its variants write the values to the
+// distributed storage as well, which they otherwise never do. The values are
+// written to memory right away, while the writes to the distributed storage
+// are buffered and flushed in batches. This reduces the number of round trips
+// to the storage during bursts of writes, at the expense of the other
+// instances seeing the values a little later. The buffer is flushed once it
+// holds batchSize writes, every interval, and when the client is closed. The
+// failures are passed to the handler of WithDistributedStorageErrorHandler.
+//
+// NOTE: This requires the WithDistributedStorage functionality to be enabled.
+func WithWriteBehind(batchSize int, interval time.Duration) Option {
+	return func(c *Config) {
+		c.useWriteBehind = true
+		c.writeBehindBatchSize = batchSize
+		c.writeBehindInterval = interval
+	}
+}
+
+// WithDistributedReconciliation catches the invalidations that the client
+// might have missed without having to sync the entire cache. Every interval,
+// a random sample of sampleSize keys is looked up in the distributed storage.
+// The entries that have been deleted from it, or whose values no longer match
+// the stored records, are then evicted from memory, and fetched again on the
+// next request. This runs in the background and never blocks the reads. The
+// failures are passed to the handler of WithDistributedStorageErrorHandler,
+// and no entries are evicted when the storage can't be reached. Please note
+// that the values written by client.Set and its variants only reach the
+// distributed storage with WithWriteBehind. Without it, they're evicted once
+// they're sampled.
+//
+// NOTE: This requires the WithDistributedStorage functionality to be enabled.
+func WithDistributedReconciliation(interval time.Duration, sampleSize int) Option {
+	return func(c *Config) {
+		c.reconcileDistributed = true
+		c.reconciliationInterval = interval
+		c.reconciliationSampleSize = sampleSize
+	}
+}
+
+// WithInvalidationSubscriber keeps a cluster of caches roughly coherent
+// without having them poll the distributed storage. Every time a key is
+// deleted or updated through client.Delete, client.DeleteMany,
+// client.DeleteByPrefix, client.InvalidateTag, client.Set, or one of its
+// variants, an InvalidationMessage is published for it. The messages that the
+// other instances publish make the client drop its local copy of the key,
+// which is then fetched again on the next request. The values that the cache
+// fetches and refreshes itself aren't published, and neither is client.Clear,
+// which only empties the local cache.
+func WithInvalidationSubscriber(subscriber InvalidationSubscriber) Option {
+	return func(c *Config) {
+		c.invalidationSubscriber = subscriber
+	}
+}
+
+// WithCodec sets the codec that is used to encode the records that are
+// written to the distributed storage. The records are encoded as JSON by
+// default. Please note that changing the codec makes the cache unable to
+// decode any records that were written to the distributed storage with the
+// previous one. The errors of the codec are returned from the functions that
+// fetch a single key. A batch fetch refetches the records that it can't
+// decode, and still returns the records that it can't encode, since one of
+// them shouldn't fail the others. Their errors are logged and passed to the
+// handler of WithDistributedStorageErrorHandler.
+func WithCodec(codec Codec) Option {
+	return func(c *Config) {
+		c.codec = codec
+	}
+}
+
+// WithNegativeLookupFilter makes the cache skip the distributed storage for
+// the keys that the filter knows are absent from it. Those keys go straight
+// to the fetchFn, which saves a round-trip for every key that doesn't exist
+// anywhere. The keys that the cache writes to the distributed storage are
+// added to the filter. Keys that are written by other processes have to be
+// added with filter.Add, as the cache would otherwise skip the lookup of them
+// too. The filter is probabilistic and sized with NewBloomFilter, and a false
+// positive only means that the distributed storage is queried for nothing.
+func WithNegativeLookupFilter(filter *BloomFilter) Option {
+	return func(c *Config) {
+		c.negativeLookupFilter = filter
+	}
+}
+
+// WithCompression compresses the records that are written to the
+// distributed storage after they've been encoded by the codec, and
+// decompresses them before they're decoded. The compressed records are
+// prefixed with a header, which allows the cache to keep reading the records
+// that were written before compression was enabled. GzipCompressor can be used
+// out of the box, and any other algorithm can be used by implementing the
+// Compressor interface.
+func WithCompression(compressor Compressor) Option {
+	return func(c *Config) {
+		c.compressor = compressor
+	}
+}
+
 // WithDistributedMetrics instructs the cache to report additional metrics
 // regarding its interaction with the distributed storage.
 func WithDistributedMetrics(metricsRecorder DistributedMetricsRecorder) Option {
@@ -161,10 +915,78 @@ func validateConfig(capacity, numShards int, ttl time.Duration, evictionPercenta
 		panic("evictionPercentage must be between 0 and 100")
 	}
 
+	if cfg.maxStaleness < 0 {
+		panic("maxStaleness must be greater than or equal to 0")
+	}
+
+	if cfg.passthroughPercentage < 0 || cfg.passthroughPercentage > 100 {
+		panic("passthroughPercentage must be between 0 and 100")
+	}
+
+	if cfg.evictionPolicy < EvictionPolicyExpiry || cfg.evictionPolicy > EvictionPolicyLFU {
+		panic("evictionPolicy must be one of the predefined policies")
+	}
+
+	if cfg.costFn != nil && cfg.maxCost <= 0 {
+		panic("maxCost must be greater than 0 when a cost function is used")
+	}
+
+	if cfg.costFn == nil && cfg.maxCost != 0 {
+		panic("maxCost requires a cost function to be set")
+	}
+
+	if cfg.costFn != nil && cfg.maxCost < int64(numShards) {
+		panic("maxCost must be at least the number of shards")
+	}
+
 	if !cfg.refreshInBackground && cfg.bufferRefreshes {
 		panic("refresh buffering requires background refreshes to be enabled")
 	}
 
+	if !cfg.refreshInBackground && cfg.refreshJitter > 0 {
+		panic("refresh jitter requires background refreshes to be enabled")
+	}
+
+	if cfg.ttlJitter < 0 || cfg.ttlJitter >= 1 {
+		panic("ttlJitter must be greater than or equal to 0, and less than 1")
+	}
+
+	if !cfg.refreshInBackground && cfg.refreshSlots != nil {
+		panic("refresh concurrency requires background refreshes to be enabled")
+	}
+
+	if cfg.refreshSlots != nil && cfg.refreshConcurrency < 1 {
+		panic("refreshConcurrency must be greater than 0")
+	}
+
+	if !cfg.refreshInBackground && cfg.refreshAheadThreshold > 0 {
+		panic("refresh-ahead threshold requires background refreshes to be enabled")
+	}
+
+	if cfg.refreshAheadThreshold < 0 || cfg.refreshAheadThreshold > 1 {
+		panic("refreshAheadThreshold must be between 0 and 1")
+	}
+
+	if !cfg.refreshInBackground && cfg.adaptiveRefresh != nil {
+		panic("adaptive refreshes require background refreshes to be enabled")
+	}
+
+	if cfg.adaptiveRefresh != nil && cfg.adaptiveRefresh.target < 1 {
+		panic("the target latency of adaptive refreshes must be greater than 0")
+	}
+
+	if cfg.softExpiry && (cfg.softTTL <= 0 || cfg.softTTL >= ttl) {
+		panic("softTTL must be greater than 0, and less than the TTL")
+	}
+
+	if cfg.softTTL > 0 && (cfg.minRefreshTime > 0 || cfg.maxRefreshTime > 0 || cfg.refreshAheadThreshold > 0) {
+		panic("softTTL can't be combined with early refreshes or a refresh-ahead threshold")
+	}
+
+	if cfg.refreshJitter < 0 || cfg.refreshJitter > 1 {
+		panic("refreshJitter must be between 0 and 1")
+	}
+
 	if cfg.bufferRefreshes && cfg.bufferSize < 1 {
 		panic("batchSize must be greater than 0")
 	}
@@ -173,6 +995,30 @@ func validateConfig(capacity, numShards int, ttl time.Duration, evictionPercenta
 		panic("bufferTimeout must be greater than 0")
 	}
 
+	if cfg.bufferFetches && cfg.fetchBufferSize < 1 {
+		panic("fetch buffering requires a batchSize greater than 0")
+	}
+
+	if cfg.bufferFetches && cfg.fetchBufferWindow < 1 {
+		panic("fetch buffering requires a window greater than 0")
+	}
+
+	if cfg.chunkFetches && cfg.fetchChunkSize < 1 {
+		panic("batch chunking requires a batchSize greater than 0")
+	}
+
+	if cfg.chunkFetches && cfg.fetchChunkParallelism < 1 {
+		panic("batch chunking requires a parallelism greater than 0")
+	}
+
+	if cfg.initialShardCapacity < 0 {
+		panic("initialShardCapacity must be greater than or equal to 0")
+	}
+
+	if cfg.clock == nil {
+		panic("clock must not be nil")
+	}
+
 	if cfg.evictionInterval < 1 {
 		panic("evictionInterval must be greater than 0")
 	}
@@ -181,6 +1027,114 @@ func validateConfig(capacity, numShards int, ttl time.Duration, evictionPercenta
 		panic("minRefreshTime must be less than or equal to maxRefreshTime")
 	}
 
+	if cfg.codec == nil {
+		panic("codec must not be nil")
+	}
+
+	if cfg.hashFn == nil {
+		panic("hashFn must not be nil")
+	}
+
+	if cfg.consistentHashing && cfg.virtualNodes < 1 {
+		panic("consistent hashing requires at least 1 virtual node")
+	}
+
+	if _, ok := cfg.deletionStorage(); cfg.distributedInvalidation && !ok {
+		panic("distributed invalidation requires a distributed storage that implements the delete functions")
+	}
+
+	if cfg.useWriteBehind && cfg.distributedStorage == nil {
+		panic("write-behind requires a distributed storage")
+	}
+
+	if cfg.useWriteBehind && (cfg.writeBehindBatchSize < 1 || cfg.writeBehindInterval < 1) {
+		panic("write-behind requires a batchSize and an interval greater than 0")
+	}
+
+	if cfg.reconcileDistributed && cfg.distributedStorage == nil {
+		panic("distributed reconciliation requires a distributed storage")
+	}
+
+	if cfg.reconcileDistributed && (cfg.reconciliationInterval < 1 || cfg.reconciliationSampleSize < 1) {
+		panic("distributed reconciliation requires an interval and a sampleSize greater than 0")
+	}
+
+	if cfg.useDistributedTTL && cfg.distributedTTL < 1 {
+		panic("distributedTTL must be greater than 0")
+	}
+
+	if _, ok := cfg.ttlStorage(); cfg.useDistributedTTL && !ok {
+		panic("distributed TTLs require a distributed storage that implements the TTL functions")
+	}
+
+	if cfg.circuitBreakers != nil && cfg.circuitBreakers.failureThreshold < 1 {
+		panic("failureThreshold must be greater than 0")
+	}
+
+	if cfg.circuitBreakers != nil && cfg.circuitBreakers.openDuration < 1 {
+		panic("openDuration must be greater than 0")
+	}
+
+	if cfg.circuitBreakers == nil && cfg.circuitBreakerTargetFn != nil {
+		panic("the circuit breaker target function requires the circuit breaker to be enabled")
+	}
+
+	if cfg.keyTransform != nil && cfg.shardKeyFn != nil {
+		panic("the key transform can't be combined with a shard key function")
+	}
+
+	if cfg.keyTransform != nil && cfg.distributedStorage != nil {
+		panic("the key transform can't be combined with a distributed storage")
+	}
+
+	if cfg.keyTransform != nil && cfg.invalidationSubscriber != nil {
+		panic("the key transform can't be combined with an invalidation subscriber")
+	}
+
+	if cfg.maxKeyLength < 0 {
+		panic("maxKeyLength must be greater than or equal to 0")
+	}
+
+	if cfg.sampleEvictions && cfg.evictionSampleSize < 1 {
+		panic("evictionSampleSize must be greater than 0")
+	}
+
+	if cfg.evictionHighWatermark < 0 || cfg.evictionHighWatermark > 1 {
+		panic("evictionHighWatermark must be between 0 and 1")
+	}
+
+	if cfg.maxPinnedEntries < 0 {
+		panic("maxPinnedEntries must be greater than or equal to 0")
+	}
+
+	if cfg.fallbackTTL < 0 {
+		panic("fallbackTTL must be greater than or equal to 0")
+	}
+
+	if cfg.missingRecordTTL < 0 {
+		panic("missingRecordTTL must be greater than or equal to 0")
+	}
+
+	if !cfg.storeMissingRecords && (cfg.missingRecordTTL > 0 || cfg.disableMissingRecordRefreshes || cfg.limitMissingRecords) {
+		panic("missing record options require missing record storage to be enabled")
+	}
+
+	if cfg.limitMissingRecords && cfg.maxMissingRecords < 1 {
+		panic("maxMissingRecords must be greater than 0")
+	}
+
+	if cfg.fetchTimeout < 0 {
+		panic("fetchTimeout must be greater than or equal to 0")
+	}
+
+	if cfg.retryMultiplier < 1 {
+		panic("retryMultiplier must be greater than or equal to 1")
+	}
+
+	if cfg.maxRefreshRetries < 0 {
+		panic("maxRefreshRetries must be greater than or equal to 0")
+	}
+
 	if cfg.retryBaseDelay < 0 {
 		panic("retryBaseDelay must be greater than or equal to 0")
 	}
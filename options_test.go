@@ -1,6 +1,7 @@
 package sturdyc_test
 
 import (
+	"strings"
 	"testing"
 	"time"
 
@@ -152,3 +153,402 @@ func TestPanicsIfTheRetryBaseDelayIsLessThanZero(t *testing.T) {
 		sturdyc.WithEarlyRefreshes(time.Minute, time.Hour, -1),
 	)
 }
+
+func TestPanicsIfTheEvictionPolicyIsUnknown(t *testing.T) {
+	t.Parallel()
+
+	defer func() {
+		err := recover()
+		if err == nil {
+			t.Error("expected a panic when trying to use an unknown eviction policy")
+		}
+	}()
+	sturdyc.New[string](100, 10, time.Minute, 5,
+		sturdyc.WithEvictionPolicy(sturdyc.EvictionPolicy(-1)),
+	)
+}
+
+func TestPanicsIfTheCodecIsNil(t *testing.T) {
+	t.Parallel()
+
+	defer func() {
+		err := recover()
+		if err == nil {
+			t.Error("expected a panic when trying to use a nil codec")
+		}
+	}()
+	sturdyc.New[string](100, 10, time.Minute, 5,
+		sturdyc.WithCodec(nil),
+	)
+}
+
+func TestPanicsIfTheHashFnIsNil(t *testing.T) {
+	t.Parallel()
+
+	defer func() {
+		err := recover()
+		if err == nil {
+			t.Error("expected a panic when trying to use a nil hash function")
+		}
+	}()
+	sturdyc.New[string](100, 10, time.Minute, 5,
+		sturdyc.WithHashFn(nil),
+	)
+}
+
+func TestPanicsIfMissingRecordTTLIsSetWithoutMissingRecordStorage(t *testing.T) {
+	t.Parallel()
+
+	defer func() {
+		err := recover()
+		if err == nil {
+			t.Error("expected a panic when setting a missing record TTL without storing missing records")
+		}
+	}()
+	sturdyc.New[string](100, 10, time.Minute, 5,
+		sturdyc.WithMissingRecordTTL(time.Second),
+	)
+}
+
+func TestPanicsIfTheRefreshJitterIsOutOfRange(t *testing.T) {
+	t.Parallel()
+
+	defer func() {
+		err := recover()
+		if err == nil {
+			t.Error("expected a panic when the refresh jitter is greater than 1")
+		}
+	}()
+	sturdyc.New[string](100, 10, time.Minute, 5,
+		sturdyc.WithEarlyRefreshes(time.Second, time.Second*2, time.Second),
+		sturdyc.WithRefreshJitter(1.5),
+	)
+}
+
+func TestPanicsIfTheEvictionCallbackIsOfTheWrongType(t *testing.T) {
+	t.Parallel()
+
+	defer func() {
+		err := recover()
+		if err == nil {
+			t.Error("expected a panic when the eviction callback doesn't match the type of the cache")
+		}
+	}()
+	sturdyc.New[string](100, 10, time.Minute, 5,
+		sturdyc.WithEvictionCallback(func(_ string, _ int, _ sturdyc.EvictionReason) {}),
+	)
+}
+
+func TestPanicsIfACostFnIsSetWithoutAMaxCost(t *testing.T) {
+	t.Parallel()
+
+	defer func() {
+		err := recover()
+		if err == nil {
+			t.Error("expected a panic when using a cost function without a max cost")
+		}
+	}()
+	sturdyc.New[string](100, 10, time.Minute, 5,
+		sturdyc.WithCostFn(func(value string) int64 { return int64(len(value)) }),
+	)
+}
+
+func TestPanicsIfTheMaxCostIsLessThanTheNumberOfShards(t *testing.T) {
+	t.Parallel()
+
+	defer func() {
+		err := recover()
+		if err == nil {
+			t.Error("expected a panic when the max cost can't be split between the shards")
+		}
+	}()
+	sturdyc.New[string](100, 10, time.Minute, 5,
+		sturdyc.WithCostFn(func(value string) int64 { return int64(len(value)) }),
+		sturdyc.WithMaxCost(5),
+	)
+}
+
+func TestPanicsIfTheRefreshAheadThresholdIsUsedWithoutEarlyRefreshes(t *testing.T) {
+	t.Parallel()
+
+	defer func() {
+		err := recover()
+		if err == nil {
+			t.Error("expected a panic when using a refresh-ahead threshold without early refreshes")
+		}
+	}()
+	sturdyc.New[string](100, 10, time.Minute, 5,
+		sturdyc.WithRefreshAheadThreshold(0.2),
+	)
+}
+
+func TestPanicsIfTheInitialShardCapacityIsLessThanZero(t *testing.T) {
+	t.Parallel()
+
+	defer func() {
+		err := recover()
+		if err == nil {
+			t.Error("expected a panic when the initial shard capacity is less than zero")
+		}
+	}()
+	sturdyc.New[string](100, 10, time.Minute, 5,
+		sturdyc.WithInitialShardCapacity(-1),
+	)
+}
+
+func TestPanicsIfTheBatchChunkingParallelismIsLessThanOne(t *testing.T) {
+	t.Parallel()
+
+	defer func() {
+		err := recover()
+		if err == nil {
+			t.Error("expected a panic when the batch chunking parallelism is less than one")
+		}
+	}()
+	sturdyc.New[string](100, 10, time.Minute, 5,
+		sturdyc.WithBatchChunking(10, 0),
+	)
+}
+
+func TestPanicsIfMaxMissingRecordsIsUsedWithoutMissingRecordStorage(t *testing.T) {
+	t.Parallel()
+
+	defer func() {
+		err := recover()
+		if err == nil {
+			t.Error("expected a panic when limiting the missing records without missing record storage")
+		}
+	}()
+	sturdyc.New[string](100, 10, time.Minute, 5,
+		sturdyc.WithMaxMissingRecords(10),
+	)
+}
+
+func TestPanicsIfConsistentHashingHasNoVirtualNodes(t *testing.T) {
+	t.Parallel()
+
+	defer func() {
+		err := recover()
+		if err == nil {
+			t.Error("expected a panic when consistent hashing is used without virtual nodes")
+		}
+	}()
+	sturdyc.New[string](100, 10, time.Minute, 5,
+		sturdyc.WithConsistentHashing(0),
+	)
+}
+
+func TestPanicsIfTheMaxPinnedEntriesIsNegative(t *testing.T) {
+	t.Parallel()
+
+	defer func() {
+		err := recover()
+		if err == nil {
+			t.Error("expected a panic when the max pinned entries is negative")
+		}
+	}()
+	sturdyc.New[string](100, 10, time.Minute, 5,
+		sturdyc.WithMaxPinnedEntries(-1),
+	)
+}
+
+func TestPanicsIfTheValueClonerHasTheWrongType(t *testing.T) {
+	t.Parallel()
+
+	defer func() {
+		err := recover()
+		if err == nil {
+			t.Error("expected a panic when the cloner doesn't accept the type of the cache")
+		}
+	}()
+	sturdyc.New[string](100, 10, time.Minute, 5,
+		sturdyc.WithValueCloner(func(v int) int { return v }),
+	)
+}
+
+func TestPanicsIfTheEvictionHighWatermarkIsOutOfRange(t *testing.T) {
+	t.Parallel()
+
+	defer func() {
+		err := recover()
+		if err == nil {
+			t.Error("expected a panic when the high watermark exceeds the capacity")
+		}
+	}()
+	sturdyc.New[string](100, 10, time.Minute, 5,
+		sturdyc.WithEvictionHighWatermark(1.5),
+	)
+}
+
+func TestPanicsIfTheMaxKeyLengthIsNegative(t *testing.T) {
+	t.Parallel()
+
+	defer func() {
+		err := recover()
+		if err == nil {
+			t.Error("expected a panic when the max key length is negative")
+		}
+	}()
+	sturdyc.New[string](100, 10, time.Minute, 5,
+		sturdyc.WithMaxKeyLength(-1),
+	)
+}
+
+func TestPanicsIfDistributedInvalidationIsUsedWithoutDeletions(t *testing.T) {
+	t.Parallel()
+
+	defer func() {
+		err := recover()
+		if err == nil {
+			t.Error("expected a panic when distributed invalidation is used without a distributed storage")
+		}
+	}()
+	sturdyc.New[string](100, 10, time.Minute, 5,
+		sturdyc.WithDistributedInvalidation(),
+	)
+}
+
+func TestPanicsIfTheVersionFnHasTheWrongType(t *testing.T) {
+	t.Parallel()
+
+	defer func() {
+		err := recover()
+		if err == nil {
+			t.Error("expected a panic when the versionFn doesn't accept the type of the cache")
+		}
+	}()
+	sturdyc.New[string](100, 10, time.Minute, 5,
+		sturdyc.WithVersionFn(func(v int) uint64 { return uint64(v) }),
+	)
+}
+
+func TestPanicsIfTheCircuitBreakerTargetFnIsUsedWithoutTheBreaker(t *testing.T) {
+	t.Parallel()
+
+	defer func() {
+		err := recover()
+		if err == nil {
+			t.Error("expected a panic when the target function is used without the circuit breaker")
+		}
+	}()
+	sturdyc.New[string](100, 10, time.Minute, 5,
+		sturdyc.WithCircuitBreakerTargetFn(func(key string) string { return key }),
+	)
+}
+
+func TestPanicsIfTheEvictionSampleSizeIsNotPositive(t *testing.T) {
+	t.Parallel()
+
+	defer func() {
+		err := recover()
+		if err == nil {
+			t.Error("expected a panic when the eviction sample size is zero")
+		}
+	}()
+	sturdyc.New[string](100, 10, time.Minute, 5,
+		sturdyc.WithEvictionSampleSize(0),
+	)
+}
+
+func TestPanicsIfTheSoftTTLIsNotLessThanTheTTL(t *testing.T) {
+	t.Parallel()
+
+	defer func() {
+		err := recover()
+		if err == nil {
+			t.Error("expected a panic when the soft TTL is equal to the TTL")
+		}
+	}()
+	sturdyc.New[string](100, 10, time.Minute, 5,
+		sturdyc.WithSoftTTL(time.Minute),
+	)
+}
+
+func TestPanicsIfTheSoftTTLIsCombinedWithEarlyRefreshes(t *testing.T) {
+	t.Parallel()
+
+	defer func() {
+		err := recover()
+		if err == nil {
+			t.Error("expected a panic when the soft TTL is combined with early refreshes")
+		}
+	}()
+	sturdyc.New[string](100, 10, time.Minute, 5,
+		sturdyc.WithEarlyRefreshes(time.Second, time.Second, time.Second),
+		sturdyc.WithSoftTTL(30*time.Second),
+	)
+}
+
+func TestPanicsIfTheDistributedTTLIsUsedWithAStorageWithoutTTLs(t *testing.T) {
+	t.Parallel()
+
+	defer func() {
+		err := recover()
+		if err == nil {
+			t.Error("expected a panic when the distributed storage doesn't implement the TTL functions")
+		}
+	}()
+	sturdyc.New[string](100, 10, time.Minute, 5,
+		sturdyc.WithDistributedStorage(&mockStorage{}),
+		sturdyc.WithDistributedTTL(time.Hour),
+	)
+}
+
+func TestPanicsIfAdaptiveRefreshesAreUsedWithoutEarlyRefreshes(t *testing.T) {
+	t.Parallel()
+
+	defer func() {
+		err := recover()
+		if err == nil {
+			t.Error("expected a panic when using adaptive refreshes without early refreshes")
+		}
+	}()
+	sturdyc.New[string](100, 10, time.Minute, 5,
+		sturdyc.WithAdaptiveRefresh(100*time.Millisecond),
+	)
+}
+
+func TestPanicsIfTheKeyTransformIsCombinedWithAShardKeyFn(t *testing.T) {
+	t.Parallel()
+
+	defer func() {
+		err := recover()
+		if err == nil {
+			t.Error("expected a panic when the key transform is combined with a shard key function")
+		}
+	}()
+	sturdyc.New[string](100, 10, time.Minute, 5,
+		sturdyc.WithKeyTransform(strings.ToLower),
+		sturdyc.WithShardKeyFn(strings.ToLower),
+	)
+}
+
+func TestPanicsIfTheKeyTransformIsCombinedWithADistributedStorage(t *testing.T) {
+	t.Parallel()
+
+	defer func() {
+		err := recover()
+		if err == nil {
+			t.Error("expected a panic when the key transform is combined with a distributed storage")
+		}
+	}()
+	sturdyc.New[string](100, 10, time.Minute, 5,
+		sturdyc.WithKeyTransform(strings.ToLower),
+		sturdyc.WithDistributedStorage(&mockStorage{}),
+	)
+}
+
+func TestPanicsIfTheKeyTransformIsCombinedWithAnInvalidationSubscriber(t *testing.T) {
+	t.Parallel()
+
+	defer func() {
+		err := recover()
+		if err == nil {
+			t.Error("expected a panic when the key transform is combined with an invalidation subscriber")
+		}
+	}()
+	sturdyc.New[string](100, 10, time.Minute, 5,
+		sturdyc.WithKeyTransform(strings.ToLower),
+		sturdyc.WithInvalidationSubscriber(&invalidationBus{}),
+	)
+}
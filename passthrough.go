@@ -2,10 +2,20 @@ package sturdyc
 
 import (
 	"context"
+	"maps"
+	"math/rand/v2"
 )
 
+// servePassthroughFromCache decides, at random, if a passthrough call should
+// be served from the cache based on the configured passthrough percentage.
+func (c *Client[T]) servePassthroughFromCache() bool {
+	return c.passthroughPercentage > 0 && rand.IntN(100) < c.passthroughPercentage
+}
+
 // Passthrough attempts to retrieve the latest data by calling the provided fetchFn.
-// If fetchFn encounters an error, the cache is used as a fallback.
+// If fetchFn encounters an error, the cache is used as a fallback. If the client
+// has been configured with WithPassthroughPercentage, that share of the calls is
+// served from the cache whenever it has the key.
 //
 // Parameters:
 //
@@ -17,7 +27,13 @@ import (
 //
 //	The value and an error if one occurred and the key was not found in the cache.
 func (c *Client[T]) Passthrough(ctx context.Context, key string, fetchFn FetchFn[T]) (T, error) {
-	res, err := callAndCache(ctx, c, key, fetchFn)
+	if c.servePassthroughFromCache() {
+		if value, ok := c.Get(key); ok {
+			return value, nil
+		}
+	}
+
+	res, err := callAndCache(ctx, c, key, 0, measuredFetch(c.Config, fetchFn))
 	if err == nil {
 		return res, nil
 	}
@@ -53,7 +69,9 @@ func Passthrough[T, V any](ctx context.Context, c *Client[T], key string, fetchF
 }
 
 // PassthroughBatch attempts to retrieve the latest data by calling the provided fetchFn.
-// If fetchFn encounters an error, the cache is used as a fallback.
+// If fetchFn encounters an error, the cache is used as a fallback. If the client
+// has been configured with WithPassthroughPercentage, that share of the calls is
+// served from the cache, and only the IDs that the cache doesn't have are fetched.
 //
 // Parameters:
 //
@@ -67,6 +85,30 @@ func Passthrough[T, V any](ctx context.Context, c *Client[T], key string, fetchF
 //	A map of IDs to their corresponding values, and an error if one occurred and
 //	none of the IDs were found in the cache.
 func (c *Client[T]) PassthroughBatch(ctx context.Context, ids []string, keyFn KeyFn, fetchFn BatchFetchFn[T]) (map[string]T, error) {
+	if err := c.validateKeys(ids, keyFn); err != nil {
+		return nil, err
+	}
+	fetchFn = measuredBatchFetch(c.Config, rejectEmptyBatches(c.Config, fetchFn))
+	if c.servePassthroughFromCache() {
+		cachedRecords := c.GetManyKeyFn(ids, keyFn)
+		if len(cachedRecords) == len(ids) {
+			return cachedRecords, nil
+		}
+
+		misses := make([]string, 0, len(ids)-len(cachedRecords))
+		for _, id := range ids {
+			if _, ok := cachedRecords[id]; !ok {
+				misses = append(misses, id)
+			}
+		}
+		res, err := callAndCacheBatch(ctx, c, callBatchOpts[T, T]{misses, keyFn, fetchFn})
+		if err != nil && len(cachedRecords) == 0 {
+			return res, err
+		}
+		maps.Copy(cachedRecords, res)
+		return cachedRecords, nil
+	}
+
 	res, err := callAndCacheBatch(ctx, c, callBatchOpts[T, T]{ids, keyFn, fetchFn})
 	if err == nil {
 		return res, nil
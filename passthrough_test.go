@@ -124,3 +124,70 @@ func TestPassthroughBatch(t *testing.T) {
 		t.Errorf("expected no inflight keys, got %v", c.NumKeysInflight())
 	}
 }
+
+func TestPassthroughPercentage(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	c := sturdyc.New[string](1000, 10, time.Minute, 10,
+		sturdyc.WithNoContinuousEvictions(),
+		sturdyc.WithPassthroughPercentage(50),
+	)
+
+	id := "1"
+	numPassthroughs := 1000
+	fetchObserver := NewFetchObserver(numPassthroughs)
+	fetchObserver.Response(id)
+	c.Set(id, "value1")
+
+	var fetches int
+	for i := 0; i < numPassthroughs; i++ {
+		res, err := sturdyc.Passthrough(ctx, c, id, fetchObserver.Fetch)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if res != "value1" {
+			t.Errorf("expected value1, got %v", res)
+		}
+	}
+	for len(fetchObserver.FetchCompleted) > 0 {
+		<-fetchObserver.FetchCompleted
+		fetches++
+	}
+
+	// Roughly half of the calls should have been served from the cache.
+	if fetches < 350 || fetches > 650 {
+		t.Errorf("expected about half of the calls to reach the data source, got %d", fetches)
+	}
+	if hits := c.Stats().Hits; hits < 350 || hits > 650 {
+		t.Errorf("expected about half of the calls to be counted as cache hits, got %d", hits)
+	}
+}
+
+func TestPassthroughBatchPercentageOnlyFetchesTheMisses(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	c := sturdyc.New[string](1000, 10, time.Minute, 10,
+		sturdyc.WithNoContinuousEvictions(),
+		sturdyc.WithPassthroughPercentage(100),
+	)
+
+	keyFn := c.BatchKeyFn("item")
+	c.Set(keyFn("1"), "value1")
+	c.Set(keyFn("2"), "value2")
+
+	fetchObserver := NewFetchObserver(1)
+	fetchObserver.BatchResponse([]string{"3"})
+	res, err := sturdyc.PassthroughBatch(ctx, c, []string{"1", "2", "3"}, keyFn, fetchObserver.FetchBatch)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	<-fetchObserver.FetchCompleted
+	fetchObserver.AssertRequestedRecords(t, []string{"3"})
+
+	expected := map[string]string{"1": "value1", "2": "value2", "3": "value3"}
+	if !cmp.Equal(expected, res) {
+		t.Error(cmp.Diff(expected, res))
+	}
+}
@@ -0,0 +1,95 @@
+package sturdyc
+
+import (
+	"context"
+	"errors"
+)
+
+type prefetchKey struct{}
+
+// isPrefetch returns true if the context belongs to a prefetch. The records
+// that a prefetch fetches never schedule any prefetches of their own, which
+// prevents a graph of related records from being traversed in its entirety.
+func isPrefetch(ctx context.Context) bool {
+	prefetch, _ := ctx.Value(prefetchKey{}).(bool)
+	return prefetch
+}
+
+// relatedIDs returns the IDs that the prefetch function of WithPrefetchFn
+// relates to the records that were fetched. The IDs that were part of the
+// request are left out, and every ID is only included once.
+func (c *Client[T]) relatedIDs(ids, fetched []string) []string {
+	seen := make(map[string]struct{}, len(ids))
+	for _, id := range ids {
+		seen[id] = struct{}{}
+	}
+
+	var related []string
+	for _, id := range fetched {
+		for _, relatedID := range c.prefetchFn(id) {
+			if _, ok := seen[relatedID]; ok {
+				continue
+			}
+			seen[relatedID] = struct{}{}
+			related = append(related, relatedID)
+		}
+	}
+	return related
+}
+
+// prefetch schedules a background fetch of the records that are related to
+// the ones that were fetched. It goes through client.GetOrFetchBatch, which
+// means that the records that are cached already are skipped, and that the
+// fetches are deduplicated and buffered like any other. The prefetches share
+// the limit of WithRefreshConcurrency with the background refreshes.
+func prefetch[V, T any](ctx context.Context, c *Client[T], ids []string, fetched map[string]T, keyFn KeyFn, fetchFn BatchFetchFn[V]) {
+	if c.prefetchFn == nil || isPrefetch(ctx) || c.closed.Load() {
+		return
+	}
+
+	fetchedIDs := make([]string, 0, len(fetched))
+	for id := range fetched {
+		fetchedIDs = append(fetchedIDs, id)
+	}
+	related := c.relatedIDs(ids, fetchedIDs)
+	if len(related) == 0 {
+		return
+	}
+
+	c.safeGo(func() {
+		release := c.acquireRefreshSlot()
+		defer release()
+
+		prefetchCtx := context.WithValue(c.refreshContext(), prefetchKey{}, true)
+		if _, err := getFetchBatch[V, T](prefetchCtx, c, related, keyFn, fetchFn); err != nil {
+			c.log.Warn("sturdyc: failed to prefetch the related records", "ids", len(related), "error", err)
+		}
+	})
+}
+
+// prefetchRelated is the equivalent of prefetch for the functions that fetch
+// a single key. The related keys are fetched one at a time through getFetch,
+// and they are used both as the cache key and as the argument of the fetchFn.
+func prefetchRelated[V, T any](ctx context.Context, c *Client[T], key string, fetchFn ArgFetchFn[V]) {
+	if c.prefetchFn == nil || isPrefetch(ctx) || c.closed.Load() {
+		return
+	}
+
+	related := c.relatedIDs([]string{key}, []string{key})
+	if len(related) == 0 {
+		return
+	}
+
+	c.safeGo(func() {
+		release := c.acquireRefreshSlot()
+		defer release()
+
+		prefetchCtx := context.WithValue(c.refreshContext(), prefetchKey{}, true)
+		for _, relatedKey := range related {
+			_, _, err := getFetch[V, T](prefetchCtx, c, relatedKey, 0, withArg(fetchFn, relatedKey), fetchFn)
+			if err != nil && !errors.Is(err, ErrNotFound) && !errors.Is(err, ErrMissingRecord) {
+				c.log.Warn("sturdyc: failed to prefetch the related record", "key", relatedKey, "error", err)
+			}
+		}
+	})
+}
@@ -2,49 +2,55 @@ package sturdyc
 
 import "time"
 
-func partition(times []time.Time, low, high int) int {
-	pivot := times[high]
+func partition[E any](values []E, low, high int, less func(a, b E) bool) int {
+	pivot := values[high]
 	i := low
 	for j := low; j < high; j++ {
-		if times[j].Before(pivot) {
-			times[i], times[j] = times[j], times[i]
+		if less(values[j], pivot) {
+			values[i], values[j] = values[j], values[i]
 			i++
 		}
 	}
-	times[i], times[high] = times[high], times[i]
+	values[i], values[high] = values[high], values[i]
 	return i
 }
 
-func quickSelect(times []time.Time, low, high, k int) time.Time {
+func quickSelect[E any](values []E, low, high, k int, less func(a, b E) bool) E {
 	if low < high {
-		pi := partition(times, low, high)
+		pi := partition(values, low, high, less)
 		if pi == k {
-			return times[pi]
+			return values[pi]
 		} else if pi < k {
-			return quickSelect(times, pi+1, high, k)
+			return quickSelect(values, pi+1, high, k, less)
 		}
-		return quickSelect(times, low, pi-1, k)
+		return quickSelect(values, low, pi-1, k, less)
 	}
 
 	// Base case for single element
-	return times[low]
+	return values[low]
 }
 
-// FindCutoff returns the time that is the k-th smallest time in the slice.
-func FindCutoff(times []time.Time, percentile float64) time.Time {
-	if len(times) == 0 {
-		return time.Time{}
+// findCutoff returns the value that is the k-th smallest value in the slice.
+func findCutoff[E any](values []E, percentile float64, less func(a, b E) bool) E {
+	var zero E
+	if len(values) == 0 {
+		return zero
 	}
 	if percentile < 0 || percentile > 1 {
-		return time.Time{}
+		return zero
 	}
 
-	n := len(times)
+	n := len(values)
 	// Calculate the index for the given percentile
 	k := int(float64(n) * percentile)
 	// Adjust if k equals the length of the slice
 	if k == n {
 		k--
 	}
-	return quickSelect(times, 0, n-1, k)
+	return quickSelect(values, 0, n-1, k, less)
+}
+
+// FindCutoff returns the time that is the k-th smallest time in the slice.
+func FindCutoff(times []time.Time, percentile float64) time.Time {
+	return findCutoff(times, percentile, time.Time.Before)
 }
@@ -0,0 +1,118 @@
+package sturdyc
+
+import (
+	"bytes"
+	"context"
+	"math/rand/v2"
+)
+
+// reconcileContinuously reconciles a sample of the keys with the distributed
+// storage every time the ticker fires, until the client is closed.
+func (c *Client[T]) reconcileContinuously() {
+	c.safeGo(func() {
+		ticker, stop := c.clock.NewTicker(c.reconciliationInterval)
+		defer stop()
+		for {
+			select {
+			case <-c.done:
+				return
+			case <-ticker:
+				c.reconcile()
+			}
+		}
+	})
+}
+
+// reconcile evicts the sampled entries that have been deleted from the
+// distributed storage, or whose values no longer match the stored records.
+// Nothing is evicted if the storage fails, since the keys could be there.
+func (c *Client[T]) reconcile() {
+	entries := c.sampleEntries(c.reconciliationSampleSize)
+	if len(entries) == 0 {
+		return
+	}
+
+	keys := make([]string, 0, len(entries))
+	for _, e := range entries {
+		keys = append(keys, e.key)
+	}
+	var records map[string][]byte
+	failed := c.storageCall(context.Background(), distributedOpGet, keys, func(ctx context.Context) {
+		records = c.distributedStorage.GetBatch(ctx, keys)
+	})
+	if failed {
+		return
+	}
+
+	for _, e := range entries {
+		recordBytes, ok := records[e.key]
+		if ok {
+			record, err := unmarshalRecord[T](recordBytes, e.key, c)
+			if err != nil || !c.diverged(e, record) {
+				continue
+			}
+		}
+		if c.getShard(e.key).removeIfCurrent(e) {
+			c.discardWrites(e.key)
+		}
+	}
+}
+
+// diverged returns true if the value of the entry differs from the record in
+// the distributed storage. The values are compared in their encoded form.
+func (c *Client[T]) diverged(e *entry[T], record distributedRecord[T]) bool {
+	if e.isMissingRecord || record.IsMissingRecord {
+		return e.isMissingRecord != record.IsMissingRecord
+	}
+	local, localErr := c.codec.Marshal(e.value)
+	stored, storedErr := c.codec.Marshal(record.Value)
+	if localErr != nil || storedErr != nil {
+		return false
+	}
+	return !bytes.Equal(local, stored)
+}
+
+// sampleEntries returns up to n live entries, starting from a random shard.
+func (c *Client[T]) sampleEntries(n int) []*entry[T] {
+	entries := make([]*entry[T], 0, n)
+	start := rand.IntN(len(c.shards))
+	for i := range c.shards {
+		if len(entries) == n {
+			break
+		}
+		shard := c.shards[(start+i)%len(c.shards)]
+		entries = append(entries, shard.sample(n-len(entries))...)
+	}
+	return entries
+}
+
+// sample returns up to n of the live entries in the shard. The order in which
+// a map is iterated is random, which makes the entries a random sample.
+func (s *shard[T]) sample(n int) []*entry[T] {
+	s.RLock()
+	defer s.RUnlock()
+	now := s.clock.Now()
+	entries := make([]*entry[T], 0, min(n, len(s.entries)))
+	for _, e := range s.entries {
+		if len(entries) == n {
+			break
+		}
+		if now.After(e.expiresAt) {
+			continue
+		}
+		entries = append(entries, e)
+	}
+	return entries
+}
+
+// removeIfCurrent removes the entry, unless the key has been written again
+// since it was read. It returns true if the entry was removed.
+func (s *shard[T]) removeIfCurrent(e *entry[T]) bool {
+	s.Lock()
+	defer s.unlock()
+	if current, ok := s.entries[e.key]; ok && current == e {
+		s.remove(e, EvictionReasonDeleted)
+		return true
+	}
+	return false
+}
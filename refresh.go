@@ -3,26 +3,144 @@ package sturdyc
 import (
 	"context"
 	"errors"
+	"fmt"
+	"time"
 )
 
+// acquireRefreshSlot blocks until the number of concurrent background
+// refreshes is below the limit of WithRefreshConcurrency. The returned
+// function has to be called to release the slot once the refresh is done.
+func (c *Config) acquireRefreshSlot() func() {
+	if c.refreshSlots == nil {
+		return func() {}
+	}
+
+	select {
+	case c.refreshSlots <- struct{}{}:
+	default:
+		// Every slot is taken, so we'll have to queue the refresh.
+		c.reportRefreshQueueDepth(c.refreshQueueDepth.Add(1))
+		c.refreshSlots <- struct{}{}
+		c.reportRefreshQueueDepth(c.refreshQueueDepth.Add(-1))
+	}
+	return func() { <-c.refreshSlots }
+}
+
 func (c *Client[T]) refresh(key string, fetchFn FetchFn[T]) {
-	response, err := fetchFn(context.Background())
+	if c.readOnly.Load() {
+		return
+	}
+	// If the key is already being fetched, the value is going to be
+	// fresh once that call completes, and we can skip this refresh.
+	s := c.shards[c.shardIndex(key)]
+	stripe := s.inFlightStripe(key)
+	stripe.Lock()
+	if _, ok := stripe.calls[key]; ok {
+		stripe.Unlock()
+		return
+	}
+	call := stripe.newFlight(key)
+	stripe.Unlock()
+
+	// The slot is acquired once the flight has been registered, which means
+	// that the refreshes of keys that are already in flight never occupy one.
+	release := c.acquireRefreshSlot()
+	defer release()
+
+	start := c.clock.Now()
+	var refreshErr error
+	defer func() {
+		if err := recover(); err != nil {
+			call.err = fmt.Errorf("sturdyc: panic recovered: %v", err)
+			refreshErr = call.err
+			c.log.Error(call.err.Error())
+		}
+		s.endFlight(key, call)
+		c.reportRefreshOutcome(key, refreshErr, c.clock.Since(start))
+	}()
+
+	response, err := callWithTimeout(c.refreshContext(), c.Config, fetchFn)
 	if err != nil {
+		call.err = err
+		refreshErr = err
+		if !errors.Is(err, ErrNotFound) {
+			c.log.Warn("sturdyc: failed to refresh key", "key", key, "error", err)
+		}
 		if c.storeMissingRecords && errors.Is(err, ErrNotFound) {
 			c.StoreMissingRecord(key)
+			call.err = ErrMissingRecord
 		}
 		if !c.storeMissingRecords && errors.Is(err, ErrNotFound) {
 			c.Delete(key)
 		}
 		return
 	}
-	c.Set(key, response)
+	call.val = response
+	c.set(key, response)
+}
+
+// Refresh bypasses the cache and calls the fetchFn to retrieve the latest
+// value for the key. The value is written to the cache with a fresh TTL. If
+// the fetchFn returns an error, the value that is currently in the cache is
+// left intact. The exception is ErrNotFound for a client that uses
+// WithMissingRecordStorage, which replaces the value with a missing record
+// and returns ErrMissingRecord, just like a background refresh would. Any
+// in-flight fetches, or background refreshes, for the same key are
+// deduplicated with this call.
+//
+// Parameters:
+//
+//	ctx - The context to be used for the request.
+//	key - The key to be refreshed.
+//	fetchFn - Used to retrieve the data from the underlying data source.
+//
+// Returns:
+//
+//	The refreshed value and an error if one occurred.
+func (c *Client[T]) Refresh(ctx context.Context, key string, fetchFn FetchFn[T]) (T, error) {
+	return callAndCache(ctx, c, key, 0, fetchFn)
+}
+
+// Refresh is a convenience function that performs type assertion on the result of client.Refresh.
+//
+// Parameters:
+//
+//	ctx - The context to be used for the request.
+//	c - The cache client.
+//	key - The key to be refreshed.
+//	fetchFn - Used to retrieve the data from the underlying data source.
+//
+// Returns:
+//
+//	The refreshed value and an error if one occurred.
+//
+// Type Parameters:
+//
+//	V - The type returned by the fetchFn. Must be assignable to T.
+//	T - The type stored in the cache.
+func Refresh[V, T any](ctx context.Context, c *Client[T], key string, fetchFn FetchFn[V]) (V, error) {
+	value, err := c.Refresh(ctx, key, wrap[T](fetchFn))
+	return unwrap[V](value, err)
 }
 
 func (c *Client[T]) refreshBatch(ids []string, keyFn KeyFn, fetchFn BatchFetchFn[T]) {
+	if c.readOnly.Load() {
+		return
+	}
+	release := c.acquireRefreshSlot()
+	defer release()
+
 	c.reportBatchRefreshSize(len(ids))
-	response, err := fetchFn(context.Background(), ids)
+	start := c.clock.Now()
+	response, err := callWithTimeout(c.refreshContext(), c.Config, func(ctx context.Context) (map[string]T, error) {
+		return fetchFn(ctx, ids)
+	})
+	duration := c.clock.Since(start)
 	if err != nil {
+		c.log.Warn("sturdyc: failed to refresh batch", "ids", len(ids), "error", err)
+		for _, id := range ids {
+			c.reportRefreshOutcome(keyFn(id), err, duration)
+		}
 		return
 	}
 
@@ -46,6 +164,31 @@ func (c *Client[T]) refreshBatch(ids []string, keyFn KeyFn, fetchFn BatchFetchFn
 
 	// Cache the refreshed records.
 	for id, record := range response {
-		c.Set(keyFn(id), record)
+		c.set(keyFn(id), record)
+	}
+
+	for _, id := range ids {
+		if _, ok := response[id]; !ok {
+			c.reportRefreshOutcome(keyFn(id), ErrNotFound, duration)
+			continue
+		}
+		c.reportRefreshOutcome(keyFn(id), nil, duration)
+	}
+}
+
+// refreshContext returns the context that is passed to the fetch functions
+// when the records are refreshed in the background.
+func (c *Client[T]) refreshContext() context.Context {
+	if c.refreshContextFn == nil {
+		return context.Background()
+	}
+	return c.refreshContextFn()
+}
+
+// reportRefreshOutcome invokes the refresh callback, if one has been configured.
+func (c *Client[T]) reportRefreshOutcome(key string, err error, duration time.Duration) {
+	if c.refreshCallback == nil {
+		return
 	}
+	c.refreshCallback(key, err, duration)
 }
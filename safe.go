@@ -2,6 +2,7 @@ package sturdyc
 
 import (
 	"context"
+	"errors"
 	"fmt"
 )
 
@@ -35,7 +36,9 @@ func wrap[T, V any](fetchFn FetchFn[V]) FetchFn[T] {
 }
 
 func unwrap[V, T any](val T, err error) (V, error) {
-	if err != nil {
+	// Stale records are returned together with an error that lets
+	// the caller know that the value has expired.
+	if err != nil && !errors.Is(err, ErrStaleRecord) {
 		var zero V
 		return zero, err
 	}
@@ -51,7 +54,9 @@ func unwrap[V, T any](val T, err error) (V, error) {
 func wrapBatch[T, V any](fetchFn BatchFetchFn[V]) BatchFetchFn[T] {
 	return func(ctx context.Context, ids []string) (map[string]T, error) {
 		resV, err := fetchFn(ctx, ids)
-		if err != nil {
+		// The records of a partial batch fetch are kept along with the errors of the other IDs.
+		var idErrs batchErrors
+		if err != nil && !errors.As(err, &idErrs) {
 			return map[string]T{}, err
 		}
 
@@ -64,10 +69,61 @@ func wrapBatch[T, V any](fetchFn BatchFetchFn[V]) BatchFetchFn[T] {
 			resT[id] = val
 		}
 
+		return resT, err
+	}
+}
+
+// batchErrors holds the errors of the IDs that a PartialBatchFetchFn failed
+// to retrieve. It's passed along as the error of a BatchFetchFn so that the
+// partial fetches can share the in-flight tracking of the regular ones.
+type batchErrors map[string]error
+
+func (e batchErrors) Error() string {
+	return fmt.Sprintf("sturdyc: failed to fetch %d of the ids in the batch", len(e))
+}
+
+// wrapPartialBatch turns the PartialBatchFetchFn into a BatchFetchFn. The
+// successful records are returned together with the errors of the others.
+func wrapPartialBatch[T, V any](fetchFn PartialBatchFetchFn[V]) BatchFetchFn[T] {
+	return func(ctx context.Context, ids []string) (map[string]T, error) {
+		resV, errs := fetchFn(ctx, ids)
+		resT := make(map[string]T, len(resV))
+		for id, v := range resV {
+			val, ok := any(v).(T)
+			if !ok {
+				return resT, ErrInvalidType
+			}
+			resT[id] = val
+		}
+
+		if len(errs) > 0 {
+			return resT, batchErrors(errs)
+		}
 		return resT, nil
 	}
 }
 
+// wrapPartialBatchRefresh turns the PartialBatchFetchFn into a BatchFetchFn
+// that can be used for refreshes. IDs that weren't found are left out of the
+// response, and any other error makes the refresh fail so that the records
+// are retried rather than deleted.
+func wrapPartialBatchRefresh[T, V any](fetchFn PartialBatchFetchFn[V]) BatchFetchFn[T] {
+	wrappedFetch := wrapPartialBatch[T](fetchFn)
+	return func(ctx context.Context, ids []string) (map[string]T, error) {
+		res, err := wrappedFetch(ctx, ids)
+		var idErrs batchErrors
+		if !errors.As(err, &idErrs) {
+			return res, err
+		}
+		for _, idErr := range idErrs {
+			if !errors.Is(idErr, ErrNotFound) {
+				return res, err
+			}
+		}
+		return res, nil
+	}
+}
+
 func unwrapBatch[V, T any](values map[string]T, err error) (map[string]V, error) {
 	vals := make(map[string]V, len(values))
 	for id, v := range values {
@@ -1,19 +1,38 @@
 package sturdyc
 
 import (
+	"cmp"
+	"math"
 	"math/rand/v2"
+	"slices"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
 // entry represents a single cache entry.
 type entry[T any] struct {
-	key                 string
-	value               T
-	expiresAt           time.Time
-	refreshAt           time.Time
+	key       string
+	value     T
+	writtenAt time.Time
+	expiresAt time.Time
+	refreshAt time.Time
+	// ttl is the TTL that the entry was written with, which is
+	// what a read slides the expiry by with WithSlidingExpiration.
+	ttl                 time.Duration
 	numOfRefreshRetries int
 	isMissingRecord     bool
+	cost                int64
+	lastAccess          atomic.Uint64
+	accessFrequency     atomic.Uint64
+	// refs is the number of references that have been handed out by
+	// client.GetRef. Referenced entries are skipped by the evictions.
+	refs atomic.Int32
+	// tags holds the tags that the entry was written with by client.SetWithTags.
+	tags []string
+	// version is the version of the value given by the function of WithVersionFn.
+	version uint64
 }
 
 // shard is a thread-safe data structure that holds a subset of the cache entries.
@@ -24,59 +43,133 @@ type shard[T any] struct {
 	ttl                time.Duration
 	entries            map[string]*entry[T]
 	evictionPercentage int
+	inFlight           [numInFlightStripes]inFlightStripe[T]
+	accessCounter      atomic.Uint64
+	counters           counters
+	onEvict            func(key string, value T, reason EvictionReason)
+	costFn             func(T) int64
+	cloneFn            func(T) T
+	versionFn          func(T) uint64
+	maxCost            int64
+	cost               int64
+	evictions          []eviction[T]
+	numEntries         atomic.Int64
+	// numMissingRecords is the number of entries that are missing records,
+	// and missingRecords holds them in the order they were written when the
+	// cache has been configured with WithMaxMissingRecords.
+	numMissingRecords int
+	missingRecords    []*entry[T]
+	// pinned holds the keys that have been pinned with client.Pin. They're
+	// tracked by key, which allows the pin to survive refreshes and writes.
+	pinned map[string]struct{}
+	// tagIndex maps each tag to the keys in the shard that have been tagged with it.
+	tagIndex map[string]map[string]struct{}
+	// forcedEvictions holds the number of entries that were forcefully evicted
+	// while the lock was held, so that they can be logged once it's released.
+	forcedEvictions int
 }
 
 // newShard creates a new shard and returns a pointer to it.
 func newShard[T any](capacity int, ttl time.Duration, evictionPercentage int, cfg *Config) *shard[T] {
-	return &shard[T]{
+	s := &shard[T]{
 		Config:             cfg,
 		capacity:           capacity,
 		ttl:                ttl,
-		entries:            make(map[string]*entry[T]),
 		evictionPercentage: evictionPercentage,
 	}
+	s.entries = make(map[string]*entry[T], s.initialCapacity())
+	return s
 }
 
-// size returns the number of entries in the shard.
+// highWatermark returns the number of entries at which the shard starts to
+// evict. It's the capacity of the shard unless the cache has been configured
+// with WithEvictionHighWatermark.
+func (s *shard[T]) highWatermark() int {
+	if s.evictionHighWatermark == 0 {
+		return s.capacity
+	}
+	return max(int(math.Ceil(float64(s.capacity)*s.evictionHighWatermark)), 1)
+}
+
+// shardCapacity returns the capacity of the shard at the index when the
+// capacity of the cache is split between numShards shards. The remainder of
+// the division is distributed by giving the first shards one extra slot, which
+// ensures that the capacities of the shards add up to the capacity of the cache.
+func shardCapacity(capacity, numShards, index int) int {
+	size := capacity / numShards
+	if index < capacity%numShards {
+		size++
+	}
+	return size
+}
+
+// shardMaxCost returns the cost budget of the shard at the index. Like
+// shardCapacity, it hands out the remainder of the division to the first
+// shards so that the budgets add up to the max cost of the cache.
+func shardMaxCost(maxCost int64, numShards, index int) int64 {
+	budget := maxCost / int64(numShards)
+	if int64(index) < maxCost%int64(numShards) {
+		budget++
+	}
+	return budget
+}
+
+// initialCapacity returns the number of entries that the map of the shard
+// should be allocated for. It never exceeds the capacity of the shard.
+func (s *shard[T]) initialCapacity() int {
+	return min(s.initialShardCapacity, s.capacity)
+}
+
+// size returns the number of entries in the shard. It reads a counter that
+// is updated whenever the shard is unlocked after a write, which means that
+// it doesn't have to acquire the lock.
 func (s *shard[T]) size() int {
-	s.RLock()
-	defer s.RUnlock()
-	return len(s.entries)
+	return int(s.numEntries.Load())
+}
+
+// numKeysInflight returns the number of keys in the shard that are currently being fetched.
+func (s *shard[T]) numKeysInflight() int {
+	var n int
+	for i := range s.inFlight {
+		s.inFlight[i].Lock()
+		n += len(s.inFlight[i].calls)
+		s.inFlight[i].Unlock()
+	}
+	return n
 }
 
 // evictExpired evicts all the expired entries in the shard.
 func (s *shard[T]) evictExpired() {
 	s.Lock()
-	defer s.Unlock()
+	defer s.unlock()
+
+	if s.evictionPolicy == EvictionPolicyLFU {
+		s.decayAccessFrequencies()
+	}
 
 	var entriesEvicted int
 	for _, e := range s.entries {
-		if s.clock.Now().After(e.expiresAt) {
-			delete(s.entries, e.key)
+		// Expired entries are retained for the max staleness so that
+		// they can be served if the underlying data source fails.
+		if s.clock.Now().After(e.expiresAt.Add(s.maxStaleness)) && s.evictable(e) {
+			s.remove(e, EvictionReasonExpired)
 			entriesEvicted++
 		}
 	}
 	s.reportEntriesEvicted(entriesEvicted)
 }
 
-// forceEvict evicts a certain percentage of the entries in the shard
-// based on the expiration time. Should be called with a lock.
-func (s *shard[T]) forceEvict() {
-	s.reportForcedEviction()
-	expirationTimes := make([]time.Time, 0, len(s.entries))
-	for _, e := range s.entries {
-		expirationTimes = append(expirationTimes, e.expiresAt)
-	}
-
-	cutoff := FindCutoff(expirationTimes, float64(s.evictionPercentage)/100)
-	entriesEvicted := 0
-	for key, e := range s.entries {
-		if e.expiresAt.Before(cutoff) {
-			delete(s.entries, key)
-			entriesEvicted++
-		}
+// evictIfExpired removes the entry if it has expired. It's used to evict
+// entries as they're being accessed when the cache is using lazy evictions.
+func (s *shard[T]) evictIfExpired(key string) {
+	s.Lock()
+	defer s.unlock()
+	item, ok := s.entries[s.transformKey(key)]
+	if !ok || !s.clock.Now().After(item.expiresAt.Add(s.maxStaleness)) || !s.evictable(item) {
+		return
 	}
-	s.reportEntriesEvicted(entriesEvicted)
+	s.remove(item, EvictionReasonExpired)
+	s.reportEntriesEvicted(1)
 }
 
 // get retrieves attempts to retrieve a value from the shard.
@@ -92,8 +185,12 @@ func (s *shard[T]) forceEvict() {
 //	markedAsMissing: A boolean indicating if the key has been marked as a missing record.
 //	refresh: A boolean indicating if the value should be refreshed in the background.
 func (s *shard[T]) get(key string) (val T, exists, markedAsMissing, refresh bool) {
+	if s.slidingExpiration {
+		return s.getSliding(key)
+	}
+
 	s.RLock()
-	item, ok := s.entries[key]
+	item, ok := s.entries[s.transformKey(key)]
 	if !ok {
 		s.RUnlock()
 		return val, false, false, false
@@ -101,10 +198,14 @@ func (s *shard[T]) get(key string) (val T, exists, markedAsMissing, refresh bool
 
 	if s.clock.Now().After(item.expiresAt) {
 		s.RUnlock()
+		if s.lazyEviction {
+			s.evictIfExpired(key)
+		}
 		return val, false, false, false
 	}
 
-	shouldRefresh := s.refreshInBackground && s.clock.Now().After(item.refreshAt)
+	s.touch(item)
+	shouldRefresh := s.refreshes(item.isMissingRecord) && s.clock.Now().After(item.refreshAt) && !s.retriesExhausted(item)
 	if shouldRefresh {
 		// Release the read lock, and switch to a write lock.
 		s.RUnlock()
@@ -115,69 +216,663 @@ func (s *shard[T]) get(key string) (val T, exists, markedAsMissing, refresh bool
 		// check if this operation should still be performed.
 		if !s.clock.Now().After(item.refreshAt) {
 			s.Unlock()
-			return item.value, true, item.isMissingRecord, false
+			return s.read(item), true, item.isMissingRecord, false
 		}
 
 		// Update the "refreshAt" so no other goroutines attempts to refresh the same entry.
-		nextRefresh := s.retryBaseDelay * (1 << item.numOfRefreshRetries)
-		item.refreshAt = s.clock.Now().Add(nextRefresh)
+		item.refreshAt = s.clock.Now().Add(s.retryDelay(item.numOfRefreshRetries))
 		item.numOfRefreshRetries++
 
 		s.Unlock()
-		return item.value, true, item.isMissingRecord, shouldRefresh
+		return s.read(item), true, item.isMissingRecord, shouldRefresh
 	}
 
 	s.RUnlock()
-	return item.value, true, item.isMissingRecord, false
+	return s.read(item), true, item.isMissingRecord, false
+}
+
+// getSliding works like get, but it moves the expiry of the entry to a full
+// TTL from now. This requires the write lock, since the expiry is changed.
+func (s *shard[T]) getSliding(key string) (val T, exists, markedAsMissing, refresh bool) {
+	s.Lock()
+	item, ok := s.entries[s.transformKey(key)]
+	if !ok {
+		s.Unlock()
+		return val, false, false, false
+	}
+
+	now := s.clock.Now()
+	if now.After(item.expiresAt) {
+		s.Unlock()
+		if s.lazyEviction {
+			s.evictIfExpired(key)
+		}
+		return val, false, false, false
+	}
+
+	s.touch(item)
+	s.slideExpiry(item, now)
+	refresh = s.refreshes(item.isMissingRecord) && now.After(item.refreshAt) && !s.retriesExhausted(item)
+	if refresh {
+		// Update the "refreshAt" so no other goroutines attempts to refresh the same entry.
+		item.refreshAt = now.Add(s.retryDelay(item.numOfRefreshRetries))
+		item.numOfRefreshRetries++
+	}
+	s.Unlock()
+	return s.read(item), true, item.isMissingRecord, refresh
 }
 
-// set writes a key-value pair to the shard and returns a
-// boolean indicating whether an eviction was performed.
+// slideExpiry moves the expiry of the entry to the full TTL that it was
+// written with from now. Missing records keep their expiry, so that they
+// are eventually fetched again. Should be called with the write lock.
+func (s *shard[T]) slideExpiry(e *entry[T], now time.Time) {
+	if e.isMissingRecord {
+		return
+	}
+	e.expiresAt = now.Add(e.ttl)
+}
+
+// getMany retrieves the keys from the shard while holding the lock once. The
+// values that are found are added to the hits, and the keys that aren't are
+// appended to the misses. The hits and misses are reported in aggregate.
+func (s *shard[T]) getMany(keys []string, hits map[string]T, misses []string) []string {
+	// The expiry of the entries is changed when the expiration is sliding.
+	lock, unlock := s.RLock, s.RUnlock
+	if s.slidingExpiration {
+		lock, unlock = s.Lock, s.Unlock
+	}
+
+	lock()
+	now := s.clock.Now()
+	var numHits, numMisses, numMissingRecords int
+	for _, key := range keys {
+		item, ok := s.entries[s.transformKey(key)]
+		if !ok || now.After(item.expiresAt) {
+			misses = append(misses, key)
+			numMisses++
+			continue
+		}
+
+		s.touch(item)
+		if item.isMissingRecord {
+			misses = append(misses, key)
+			numHits++
+			numMissingRecords++
+			continue
+		}
+		if s.slidingExpiration {
+			s.slideExpiry(item, now)
+		}
+		hits[key] = s.read(item)
+		numHits++
+	}
+	unlock()
+
+	s.reportCacheHitsInAggregate(numHits, numMisses, numMissingRecords)
+	return misses
+}
+
+// retryDelay returns the duration to wait before the entry is refreshed again
+// if the refresh that is about to be performed fails. The delay grows
+// exponentially with the number of retries, but never exceeds the TTL.
+func (s *shard[T]) retryDelay(retries int) time.Duration {
+	delay := float64(s.retryBaseDelay) * math.Pow(s.retryMultiplier, float64(retries))
+	if delay > float64(s.ttl) {
+		return s.ttl
+	}
+	return time.Duration(delay)
+}
+
+// retriesExhausted returns true if the refreshes of the entry have failed as
+// many times as they're allowed to. The entry is then served until it expires.
+func (s *shard[T]) retriesExhausted(item *entry[T]) bool {
+	return s.maxRefreshRetries > 0 && item.numOfRefreshRetries > s.maxRefreshRetries
+}
+
+// getStale retrieves a value that has expired, but is still within the max
+// staleness. Returns false for entries that haven't expired yet.
+func (s *shard[T]) getStale(key string) (T, bool) {
+	s.RLock()
+	defer s.RUnlock()
+	var zero T
+	item, ok := s.entries[s.transformKey(key)]
+	if !ok || item.isMissingRecord {
+		return zero, false
+	}
+	now := s.clock.Now()
+	if !now.After(item.expiresAt) || now.After(item.expiresAt.Add(s.maxStaleness)) {
+		return zero, false
+	}
+	return s.read(item), true
+}
+
+// isNewer reports whether the entry holds a newer version than the given one.
+// Missing records and expired entries have no version to protect, which
+// allows any value to replace them. Should be called with a lock.
+func (s *shard[T]) isNewer(e *entry[T], version uint64) bool {
+	if e.isMissingRecord || s.clock.Now().After(e.expiresAt) {
+		return false
+	}
+	return e.version > version
+}
+
+// invalidate removes the entry unless it holds a version that is at least as
+// new as the given one. A version of zero always removes the entry.
+func (s *shard[T]) invalidate(key string, version uint64) {
+	s.Lock()
+	defer s.unlock()
+	e, ok := s.entries[s.transformKey(key)]
+	if !ok {
+		return
+	}
+	upToDate := version > 0 && s.versionFn != nil && (e.version == version || s.isNewer(e, version))
+	if upToDate && !e.isMissingRecord {
+		return
+	}
+	s.remove(e, EvictionReasonDeleted)
+}
+
+// read returns the value of the entry. It's cloned if the cache has been
+// configured with WithValueCloner, which prevents the caller from mutating
+// the value that is stored in the shard.
+func (s *shard[T]) read(e *entry[T]) T {
+	if s.cloneFn == nil {
+		return e.value
+	}
+	return s.cloneFn(e.value)
+}
+
+// store returns the value that should be stored in the shard. Like read, it
+// clones the value to isolate the stored copy from the one of the caller.
+func (s *shard[T]) store(value T, isMissingRecord bool) T {
+	if s.cloneFn == nil || isMissingRecord {
+		return value
+	}
+	return s.cloneFn(value)
+}
+
+// exists checks if the shard has an entry for the key that hasn't expired,
+// without updating the access statistics of the entry.
+func (s *shard[T]) exists(key string) (exists, markedAsMissing bool) {
+	s.RLock()
+	defer s.RUnlock()
+	item, ok := s.entries[s.transformKey(key)]
+	if !ok || s.clock.Now().After(item.expiresAt) {
+		return false, false
+	}
+	return true, item.isMissingRecord
+}
+
+// getRef retrieves the entry and adds a reference to it. The reference is
+// added with the read lock held, which ensures that an eviction can't remove
+// the entry in between.
+func (s *shard[T]) getRef(key string) (e *entry[T], exists, markedAsMissing bool) {
+	s.RLock()
+	defer s.RUnlock()
+	item, ok := s.entries[s.transformKey(key)]
+	if !ok || s.clock.Now().After(item.expiresAt) {
+		return nil, false, false
+	}
+	s.touch(item)
+	if item.isMissingRecord {
+		return nil, true, true
+	}
+	item.refs.Add(1)
+	return item, true, false
+}
+
+// peek reads the entry without touching it, evicting it, or moving its refreshAt.
+func (s *shard[T]) peek(key string) (val T, exists, markedAsMissing bool) {
+	s.RLock()
+	defer s.RUnlock()
+	item, ok := s.entries[s.transformKey(key)]
+	if !ok || s.clock.Now().After(item.expiresAt) {
+		return val, false, false
+	}
+	return s.read(item), true, item.isMissingRecord
+}
+
+// remainingTTL returns the duration until the entry expires, and a boolean
+// indicating if the key exists and hasn't expired or been marked as missing.
+func (s *shard[T]) remainingTTL(key string) (time.Duration, bool) {
+	s.RLock()
+	defer s.RUnlock()
+	item, ok := s.entries[s.transformKey(key)]
+	if !ok || item.isMissingRecord {
+		return 0, false
+	}
+
+	remaining := item.expiresAt.Sub(s.clock.Now())
+	if remaining < 0 {
+		return 0, false
+	}
+	return remaining, true
+}
+
+// refreshDueAt returns the time at which the entry becomes eligible for a
+// background refresh, and a boolean indicating if the entry exists.
+func (s *shard[T]) refreshDueAt(key string) (time.Time, bool) {
+	s.RLock()
+	defer s.RUnlock()
+	item, ok := s.entries[s.transformKey(key)]
+	if !ok || s.clock.Now().After(item.expiresAt) {
+		return time.Time{}, false
+	}
+	if !s.refreshes(item.isMissingRecord) {
+		return time.Time{}, true
+	}
+	return item.refreshAt, true
+}
+
+// age returns the time that has passed since the entry was written, and a
+// boolean indicating if the key exists and hasn't expired or been marked as missing.
+func (s *shard[T]) age(key string) (time.Duration, bool) {
+	s.RLock()
+	defer s.RUnlock()
+	item, ok := s.entries[s.transformKey(key)]
+	now := s.clock.Now()
+	if !ok || item.isMissingRecord || now.After(item.expiresAt) {
+		return 0, false
+	}
+	return now.Sub(item.writtenAt), true
+}
+
+// set writes a key-value pair to the shard using the default TTL and
+// returns a boolean indicating whether an eviction was performed.
 func (s *shard[T]) set(key string, value T, isMissingRecord bool) bool {
 	s.Lock()
-	defer s.Unlock()
+	defer s.unlock()
+	ttl := s.ttl
+	if isMissingRecord && s.missingRecordTTL > 0 {
+		ttl = s.missingRecordTTL
+	}
+	res := s.write(key, value, s.jitter(ttl), isMissingRecord)
+	return res.Written && res.OverCapacity
+}
+
+// setTTL changes the TTL of the entries that are written to the shard from
+// now on. If rebase is true, the expiry of the existing entries is moved by
+// the difference between the new and the old TTL.
+func (s *shard[T]) setTTL(ttl time.Duration, rebase bool) {
+	s.Lock()
+	defer s.unlock()
+	if rebase {
+		diff := ttl - s.ttl
+		for _, e := range s.entries {
+			e.expiresAt = e.expiresAt.Add(diff)
+		}
+	}
+	s.ttl = ttl
+}
+
+// currentCapacity returns the capacity of the shard, which can be changed by client.Resize.
+func (s *shard[T]) currentCapacity() int {
+	s.RLock()
+	defer s.RUnlock()
+	return s.capacity
+}
+
+// resize changes the capacity of the shard, and evicts the entries that no
+// longer fit if it has shrunk. The entries are picked by the eviction policy,
+// and the ones that are referenced by client.GetRef are left alone.
+func (s *shard[T]) resize(capacity int) {
+	s.Lock()
+	defer s.unlock()
+	s.capacity = capacity
+	excess := len(s.entries) - capacity
+	if excess < 1 {
+		return
+	}
+
+	candidates := make([]*entry[T], 0, len(s.entries))
+	for _, e := range s.entries {
+		if s.evictable(e) {
+			candidates = append(candidates, e)
+		}
+	}
+	slices.SortFunc(candidates, func(a, b *entry[T]) int {
+		switch s.evictionPolicy {
+		case EvictionPolicyLRU:
+			return cmp.Compare(a.lastAccess.Load(), b.lastAccess.Load())
+		case EvictionPolicyLFU:
+			return cmp.Or(
+				cmp.Compare(a.accessFrequency.Load(), b.accessFrequency.Load()),
+				cmp.Compare(a.lastAccess.Load(), b.lastAccess.Load()),
+			)
+		default:
+			return a.expiresAt.Compare(b.expiresAt)
+		}
+	})
+
+	entriesEvicted := min(excess, len(candidates))
+	for _, e := range candidates[:entriesEvicted] {
+		s.remove(e, EvictionReasonCapacity)
+	}
+	s.reportEntriesEvicted(entriesEvicted)
+}
+
+// setEvictionPercentage changes the percentage of entries
+// that are evicted when the shard reaches its capacity.
+func (s *shard[T]) setEvictionPercentage(percentage int) {
+	s.Lock()
+	defer s.unlock()
+	s.evictionPercentage = percentage
+}
+
+// jitter adds or subtracts a random fraction of the TTL if the client has
+// been configured with WithTTLJitter. Entries that are written in the same
+// burst are then spread out rather than expiring at the same time.
+func (s *shard[T]) jitter(ttl time.Duration) time.Duration {
+	maxJitter := int64(float64(ttl) * s.ttlJitter)
+	if maxJitter < 1 {
+		return ttl
+	}
+	return ttl + time.Duration(rand.Int64N(2*maxJitter+1)-maxJitter)
+}
+
+// refreshes returns a boolean indicating if the entry should be refreshed in the background.
+func (s *shard[T]) refreshes(isMissingRecord bool) bool {
+	if isMissingRecord && s.disableMissingRecordRefreshes {
+		return false
+	}
+	return s.refreshInBackground
+}
+
+// setWithTTL writes a key-value pair that expires after the given TTL to the
+// shard and returns the result of the write.
+func (s *shard[T]) setWithTTL(key string, value T, ttl time.Duration, isMissingRecord bool) SetResult {
+	s.Lock()
+	defer s.unlock()
+	return s.write(key, value, ttl, isMissingRecord)
+}
+
+// setWithResult writes a key-value pair to the shard and returns the
+// result of the write.
+func (s *shard[T]) setWithResult(key string, value T) SetResult {
+	s.Lock()
+	defer s.unlock()
+	return s.write(key, value, s.jitter(s.ttl), false)
+}
+
+// setMany writes the records to the shard while holding the lock once. The
+// TTL of each record is jittered if jitter is true. Returns the number of
+// writes that triggered an eviction, and the keys that were written.
+func (s *shard[T]) setMany(records map[string]T, ttl time.Duration, jitter bool) (int, []string) {
+	s.Lock()
+	defer s.unlock()
+	var evictions int
+	written := make([]string, 0, len(records))
+	for key, value := range records {
+		recordTTL := ttl
+		if jitter {
+			recordTTL = s.jitter(ttl)
+		}
+		res := s.write(key, value, recordTTL, false)
+		if !res.Written {
+			continue
+		}
+		written = append(written, key)
+		if res.OverCapacity {
+			evictions++
+		}
+	}
+	return evictions, written
+}
+
+// setIfAbsent writes a key-value pair to the shard if it doesn't have an
+// entry for the key that hasn't expired. It returns a boolean indicating
+// whether the value was written.
+func (s *shard[T]) setIfAbsent(key string, value T) bool {
+	s.Lock()
+	defer s.unlock()
+	if item, ok := s.entries[s.transformKey(key)]; ok && !s.clock.Now().After(item.expiresAt) {
+		return false
+	}
+	return s.write(key, value, s.jitter(s.ttl), false).Written
+}
+
+// update applies the function to the current value of the key while holding
+// the lock. The value that it returns is written to the shard, or the entry is
+// deleted if the function returns false.
+func (s *shard[T]) update(key string, fn func(current T, exists bool) (T, bool)) (T, bool) {
+	s.Lock()
+	defer s.unlock()
+
+	var current T
+	item, exists := s.entries[s.transformKey(key)]
+	if exists && (item.isMissingRecord || s.clock.Now().After(item.expiresAt)) {
+		exists = false
+	}
+	if exists {
+		current = s.read(item)
+	}
+
+	value, keep := fn(current, exists)
+	if !keep {
+		if item != nil {
+			s.remove(item, EvictionReasonDeleted)
+		}
+		var zero T
+		return zero, false
+	}
+	return value, s.write(key, value, s.jitter(s.ttl), false).Written
+}
+
+// write should be called with the shard's lock held. The result describes
+// whether the entry was written, and the evictions that were performed to
+// make room for it. The key has to be validated before the lock is taken.
+func (s *shard[T]) write(key string, value T, ttl time.Duration, isMissingRecord bool) SetResult {
+	return s.writeEntry(s.transformKey(key), value, ttl, isMissingRecord)
+}
+
+// writeEntry performs the write once the key has been transformed. Like
+// write, it should be called with the shard's lock held.
+func (s *shard[T]) writeEntry(key string, value T, ttl time.Duration, isMissingRecord bool) SetResult {
+	if s.readOnly.Load() {
+		return SetResult{}
+	}
+
+	// With versioning, a value is never allowed to replace a newer one.
+	var version uint64
+	if s.versionFn != nil && !isMissingRecord {
+		version = s.versionFn(value)
+		if current, ok := s.entries[key]; ok && s.isNewer(current, version) {
+			return SetResult{}
+		}
+	}
 
 	// Check we need to perform an eviction first.
-	evict := len(s.entries) >= s.capacity
+	full := len(s.entries) >= s.capacity
+	evict := len(s.entries) >= s.highWatermark()
+	var cost int64
+	if s.costFn != nil {
+		cost = s.costFn(value)
+		full = s.exceedsMaxCost(key, cost)
+		evict = full
+	}
 
 	// If the cache is configured to not evict any entries,
 	// and we're att full capacity, we'll return early.
-	if s.evictionPercentage < 1 && evict {
-		return false
+	if s.evictionPercentage < 1 && full {
+		return SetResult{OverCapacity: true}
 	}
+	evict = evict && s.evictionPercentage > 0
 
+	var entriesEvicted int
 	if evict {
-		s.forceEvict()
+		entriesEvicted = s.forceEvict(float64(s.evictionPercentage) / 100)
+		// A single eviction might not free up enough of the budget if the
+		// entries vary in cost. We'll keep going until it does, or until
+		// there is nothing left that the eviction policy is able to remove.
+		for s.costFn != nil && len(s.entries) > 0 && s.exceedsMaxCost(key, cost) {
+			// The percentage could round down to zero entries for small shards.
+			percentile := max(float64(s.evictionPercentage)/100, 1/float64(len(s.entries)))
+			n := s.forceEvict(percentile)
+			if n == 0 {
+				break
+			}
+			entriesEvicted += n
+		}
 	}
 
 	now := s.clock.Now()
 	newEntry := &entry[T]{
 		key:             key,
-		value:           value,
-		expiresAt:       now.Add(s.ttl),
+		value:           s.store(value, isMissingRecord),
+		version:         version,
+		writtenAt:       now,
+		expiresAt:       now.Add(ttl),
+		ttl:             ttl,
 		isMissingRecord: isMissingRecord,
 	}
 
-	if s.refreshInBackground {
+	if s.refreshes(isMissingRecord) {
 		// If there is a difference between the min- and maxRefreshTime we'll use that to
 		// set a random padding so that the refreshes get spread out evenly over time.
 		var padding time.Duration
 		if s.minRefreshTime != s.maxRefreshTime {
 			padding = time.Duration(rand.Int64N(int64(s.maxRefreshTime - s.minRefreshTime)))
 		}
+		// The jitter is relative to the TTL of the entry. This makes entries that
+		// were written in the same burst become due for a refresh at different times.
+		if s.refreshJitter > 0 {
+			if maxJitter := int64(float64(ttl) * s.refreshJitter); maxJitter > 0 {
+				padding += time.Duration(rand.Int64N(maxJitter))
+			}
+		}
 		newEntry.refreshAt = now.Add(s.minRefreshTime + padding)
+		// With a soft TTL, the entry is stale and due for a
+		// refresh once the soft expiry has passed.
+		if s.softTTL > 0 {
+			newEntry.refreshAt = now.Add(s.softTTL + padding)
+		}
+		newEntry.refreshAt = now.Add(s.scaleRefreshDelay(newEntry.refreshAt.Sub(now)))
+		// With a refresh-ahead threshold, the entry becomes due for a refresh
+		// once it has entered the tail of its TTL rather than after a fixed time.
+		if s.refreshAheadThreshold > 0 {
+			newEntry.refreshAt = newEntry.expiresAt.Add(-time.Duration(float64(ttl)*s.refreshAheadThreshold) + padding)
+		}
 		newEntry.numOfRefreshRetries = 0
 	}
 
+	if previous, ok := s.entries[key]; ok {
+		s.cost -= previous.cost
+		if previous.isMissingRecord {
+			s.numMissingRecords--
+		}
+		// The tags are kept when the entry is overwritten, which
+		// ensures that refreshes don't remove it from the index.
+		newEntry.tags = previous.tags
+		// So is the access frequency, or else the keys that are read the
+		// most would be the first to be evicted by LFU after a refresh.
+		newEntry.accessFrequency.Store(previous.accessFrequency.Load())
+	}
+	newEntry.cost = cost
+	s.cost += cost
+
+	s.touch(newEntry)
 	s.entries[key] = newEntry
-	return evict
+
+	if isMissingRecord {
+		s.numMissingRecords++
+		if s.limitMissingRecords {
+			s.trackMissingRecord(newEntry)
+			if n := s.evictMissingRecords(s.maxMissingRecords); n > 0 {
+				entriesEvicted += n
+				s.reportMissingRecordsEvicted(n)
+			}
+		}
+	}
+	return SetResult{Written: true, OverCapacity: evict, EntriesEvicted: entriesEvicted}
 }
 
 // delete removes a key from the shard.
 func (s *shard[T]) delete(key string) {
 	s.Lock()
-	defer s.Unlock()
-	delete(s.entries, key)
+	defer s.unlock()
+	if e, ok := s.entries[s.transformKey(key)]; ok {
+		s.remove(e, EvictionReasonDeleted)
+	}
+}
+
+// getAndDelete removes the entry if it's live, and returns its value.
+func (s *shard[T]) getAndDelete(key string) (val T, exists, markedAsMissing bool) {
+	s.Lock()
+	defer s.unlock()
+	item, ok := s.entries[s.transformKey(key)]
+	if !ok || s.clock.Now().After(item.expiresAt) {
+		return val, false, false
+	}
+	if item.isMissingRecord {
+		return val, true, true
+	}
+	val = s.read(item)
+	s.remove(item, EvictionReasonDeleted)
+	return val, true, false
+}
+
+// deleteMany removes the keys from the shard and returns the number of entries that were removed.
+func (s *shard[T]) deleteMany(keys []string) int {
+	s.Lock()
+	defer s.unlock()
+	var deleted int
+	for _, key := range keys {
+		if e, ok := s.entries[s.transformKey(key)]; ok {
+			s.remove(e, EvictionReasonDeleted)
+			deleted++
+		}
+	}
+	return deleted
+}
+
+// deleteByPrefix removes every key in the shard that starts with the
+// prefix and returns the keys of the entries that were removed.
+func (s *shard[T]) deleteByPrefix(prefix string) []string {
+	s.Lock()
+	defer s.unlock()
+	var deleted []string
+	for _, e := range s.entries {
+		if strings.HasPrefix(e.key, prefix) {
+			s.remove(e, EvictionReasonDeleted)
+			deleted = append(deleted, e.key)
+		}
+	}
+	return deleted
+}
+
+// clear removes every entry from the shard.
+func (s *shard[T]) clear() {
+	s.Lock()
+	defer s.unlock()
+	n := len(s.entries)
+	if s.onEvict != nil {
+		for _, e := range s.entries {
+			s.evictions = append(s.evictions, eviction[T]{e.key, e.value, EvictionReasonCleared})
+		}
+	}
+	s.entries = make(map[string]*entry[T], s.initialCapacity())
+	s.cost = 0
+	s.numMissingRecords = 0
+	s.missingRecords = nil
+	s.tagIndex = nil
+	s.reportEntriesEvicted(n)
+}
+
+// forEach calls fn for every live entry in the shard while holding the read
+// lock. It returns false if fn stopped the iteration.
+func (s *shard[T]) forEach(fn func(key string, value T) bool) bool {
+	s.RLock()
+	defer s.RUnlock()
+	now := s.clock.Now()
+	for _, e := range s.entries {
+		if e.isMissingRecord || now.After(e.expiresAt) {
+			continue
+		}
+		if !fn(e.key, s.read(e)) {
+			return false
+		}
+	}
+	return true
 }
 
 // keys returns all non-expired keys in the shard.
@@ -185,11 +880,11 @@ func (s *shard[T]) keys() []string {
 	s.RLock()
 	defer s.RUnlock()
 	keys := make([]string, 0, len(s.entries))
-	for k, v := range s.entries {
+	for _, v := range s.entries {
 		if s.clock.Now().After(v.expiresAt) {
 			continue
 		}
-		keys = append(keys, k)
+		keys = append(keys, v.key)
 	}
 	return keys
 }
@@ -0,0 +1,151 @@
+package sturdyc
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// snapshotMagic identifies the output of client.Snapshot, and
+// snapshotVersion allows the format to evolve in a compatible way.
+const (
+	snapshotMagic   = "sturdyc"
+	snapshotVersion = 1
+)
+
+// snapshotRecord represents a single entry in a snapshot. The expiration
+// time is absolute so that the time the process was down is accounted for.
+type snapshotRecord[T any] struct {
+	Key             string    `json:"key"`
+	Value           T         `json:"value"`
+	ExpiresAt       time.Time `json:"expires_at"`
+	IsMissingRecord bool      `json:"is_missing_record"`
+}
+
+// restore writes a record of a snapshot to the shard. The key of the record
+// has already been transformed, which is why it's written as it is.
+func (s *shard[T]) restore(record snapshotRecord[T], ttl time.Duration) {
+	s.Lock()
+	defer s.unlock()
+	s.writeEntry(record.Key, record.Value, ttl, record.IsMissingRecord)
+}
+
+// snapshot returns a copy of the live entries in the shard.
+func (s *shard[T]) snapshot() []snapshotRecord[T] {
+	s.RLock()
+	defer s.RUnlock()
+	now := s.clock.Now()
+	records := make([]snapshotRecord[T], 0, len(s.entries))
+	for _, e := range s.entries {
+		if now.After(e.expiresAt) {
+			continue
+		}
+		records = append(records, snapshotRecord[T]{e.key, e.value, e.expiresAt, e.isMissingRecord})
+	}
+	return records
+}
+
+// Snapshot writes every entry that hasn't expired to the writer, using the
+// codec that the client has been configured with. Each shard is copied while
+// its lock is held, which makes the snapshot consistent per shard, and the
+// records are then encoded without blocking the cache. The output starts
+// with a version header, and can be read back with client.Restore.
+//
+// Parameters:
+//
+//	w - The writer that the snapshot is written to.
+//
+// Returns:
+//
+//	An error if one of the records couldn't be encoded or written.
+func (c *Client[T]) Snapshot(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	if _, err := bw.WriteString(snapshotMagic); err != nil {
+		return err
+	}
+	if err := bw.WriteByte(snapshotVersion); err != nil {
+		return err
+	}
+
+	lengthBuf := make([]byte, binary.MaxVarintLen64)
+	for _, shard := range c.shards {
+		for _, record := range shard.snapshot() {
+			bytes, err := c.codec.Marshal(record)
+			if err != nil {
+				return fmt.Errorf("sturdyc: error marshalling key %s: %w", record.Key, err)
+			}
+			n := binary.PutUvarint(lengthBuf, uint64(len(bytes)))
+			if _, err = bw.Write(lengthBuf[:n]); err != nil {
+				return err
+			}
+			if _, err = bw.Write(bytes); err != nil {
+				return err
+			}
+		}
+	}
+	return bw.Flush()
+}
+
+// Restore reads a snapshot that was written by client.Snapshot, and writes
+// its records to the cache. Each record keeps the expiration time that it
+// had when the snapshot was taken, which means that records that have
+// expired since then are skipped. Restoring a snapshot while the cache is in
+// use is safe, and the records overwrite any entries with the same keys. With
+// WithKeyTransform, the snapshot holds the transformed keys, and it can only
+// be restored by a client that uses the same transform.
+//
+// Parameters:
+//
+//	r - The reader that the snapshot is read from.
+//
+// Returns:
+//
+//	An error if the snapshot is invalid, or if one of the records couldn't be decoded.
+func (c *Client[T]) Restore(r io.Reader) error {
+	br := bufio.NewReader(r)
+	header := make([]byte, len(snapshotMagic)+1)
+	if _, err := io.ReadFull(br, header); err != nil {
+		return ErrInvalidSnapshot
+	}
+	if string(header[:len(snapshotMagic)]) != snapshotMagic || header[len(snapshotMagic)] != snapshotVersion {
+		return ErrInvalidSnapshot
+	}
+
+	for {
+		length, err := binary.ReadUvarint(br)
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return ErrInvalidSnapshot
+		}
+
+		bytes := make([]byte, length)
+		if _, err = io.ReadFull(br, bytes); err != nil {
+			return ErrInvalidSnapshot
+		}
+
+		var record snapshotRecord[T]
+		if err = c.codec.Unmarshal(bytes, &record); err != nil {
+			return fmt.Errorf("sturdyc: error unmarshalling snapshot record: %w", err)
+		}
+
+		ttl := record.ExpiresAt.Sub(c.clock.Now())
+		if ttl <= 0 {
+			continue
+		}
+		// The keys of a client that uses WithKeyTransform are stored
+		// transformed, and must not be passed through it a second time.
+		if c.keyTransform != nil {
+			c.shards[c.shardIndexOf(record.Key)].restore(record, ttl)
+			continue
+		}
+		if !c.acceptsKey(record.Key) {
+			continue
+		}
+		c.getShard(record.Key).setWithTTL(record.Key, record.Value, ttl, record.IsMissingRecord)
+	}
+}
@@ -0,0 +1,67 @@
+package sturdyc_test
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/creativecreature/sturdyc"
+)
+
+func TestSnapshotAndRestore(t *testing.T) {
+	t.Parallel()
+
+	clock := sturdyc.NewTestClock(time.Now())
+	source := sturdyc.New[int](100, 10, time.Hour, 5,
+		sturdyc.WithNoContinuousEvictions(),
+		sturdyc.WithClock(clock),
+		sturdyc.WithMissingRecordStorage(),
+	)
+	source.Set("1", 1)
+	source.SetWithTTL("2", 2, time.Minute)
+	source.SetWithTTL("expired", 3, -time.Second)
+	source.StoreMissingRecord("missing")
+
+	var buf bytes.Buffer
+	if err := source.Snapshot(&buf); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	// Let's pretend that the process was down for two minutes.
+	clock.Add(2 * time.Minute)
+	target := sturdyc.New[int](100, 10, time.Hour, 5,
+		sturdyc.WithNoContinuousEvictions(),
+		sturdyc.WithClock(clock),
+		sturdyc.WithMissingRecordStorage(),
+	)
+	if err := target.Restore(&buf); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if v, ok := target.Get("1"); !ok || v != 1 {
+		t.Errorf("expected key 1 to be restored, got %d %t", v, ok)
+	}
+	if ttl, _ := target.TTL("1"); ttl != time.Hour-2*time.Minute {
+		t.Errorf("expected key 1 to keep its remaining TTL, got %v", ttl)
+	}
+	if _, ok := target.Get("2"); ok {
+		t.Error("expected key 2 to be skipped as it expired while the process was down")
+	}
+	if target.Exists("expired") {
+		t.Error("expected the expired key not to be part of the snapshot")
+	}
+	if !target.ExistsAsMissing("missing") {
+		t.Error("expected the missing record to be restored")
+	}
+}
+
+func TestRestoreRejectsInvalidSnapshots(t *testing.T) {
+	t.Parallel()
+
+	c := sturdyc.New[int](100, 10, time.Hour, 5, sturdyc.WithNoContinuousEvictions())
+	if err := c.Restore(strings.NewReader("not a snapshot")); !errors.Is(err, sturdyc.ErrInvalidSnapshot) {
+		t.Errorf("expected ErrInvalidSnapshot, got %v", err)
+	}
+}
@@ -0,0 +1,115 @@
+package sturdyc
+
+import "sync/atomic"
+
+// Stats holds the statistics that the cache has gathered since it
+// was created, or since the last time that ResetStats was called.
+type Stats struct {
+	// Hits is the number of keys that resulted in a cache hit.
+	Hits int64 `json:"hits"`
+	// Misses is the number of keys that resulted in a cache miss.
+	Misses int64 `json:"misses"`
+	// Refreshes is the number of reads that scheduled a background refresh.
+	Refreshes int64 `json:"refreshes"`
+	// MissingRecords is the number of reads for keys that have been marked as missing.
+	MissingRecords int64 `json:"missing_records"`
+	// ForcedEvictions is the number of times a shard had to evict
+	// entries because it had reached its capacity.
+	ForcedEvictions int64 `json:"forced_evictions"`
+	// EntriesEvicted is the number of entries that have been evicted.
+	EntriesEvicted int64 `json:"entries_evicted"`
+	// Size is the current number of entries in the cache,
+	// excluding the entries of its namespaces.
+	Size int `json:"size"`
+	// HitRatio is the ratio of hits to the total number of reads.
+	HitRatio float64 `json:"hit_ratio"`
+}
+
+// counters are kept per shard so that the goroutines which are
+// reading from different shards don't contend for the same memory.
+type counters struct {
+	hits            atomic.Int64
+	misses          atomic.Int64
+	refreshes       atomic.Int64
+	missingRecords  atomic.Int64
+	forcedEvictions atomic.Int64
+	entriesEvicted  atomic.Int64
+}
+
+func (c *counters) reset() {
+	c.hits.Store(0)
+	c.misses.Store(0)
+	c.refreshes.Store(0)
+	c.missingRecords.Store(0)
+	c.forcedEvictions.Store(0)
+	c.entriesEvicted.Store(0)
+}
+
+// Stats returns the statistics that the cache has gathered. They are
+// available regardless of whether a MetricsRecorder has been configured.
+//
+// Returns:
+//
+//	The statistics of the cache.
+func (c *Client[T]) Stats() Stats {
+	var stats Stats
+	for _, shard := range c.shards {
+		stats.Hits += shard.counters.hits.Load()
+		stats.Misses += shard.counters.misses.Load()
+		stats.Refreshes += shard.counters.refreshes.Load()
+		stats.MissingRecords += shard.counters.missingRecords.Load()
+		stats.ForcedEvictions += shard.counters.forcedEvictions.Load()
+		stats.EntriesEvicted += shard.counters.entriesEvicted.Load()
+	}
+	stats.Size = c.Size()
+	if reads := stats.Hits + stats.Misses; reads > 0 {
+		stats.HitRatio = float64(stats.Hits) / float64(reads)
+	}
+	return stats
+}
+
+// ResetStats sets all of the counters that are returned by Stats to zero.
+// This is useful if you want to report the statistics at regular intervals.
+func (c *Client[T]) ResetStats() {
+	for _, shard := range c.shards {
+		shard.counters.reset()
+	}
+}
+
+// ShardStat holds the statistics of a single shard.
+type ShardStat struct {
+	// Index is the index of the shard.
+	Index int `json:"index"`
+	// Size is the current number of entries in the shard.
+	Size int `json:"size"`
+	// Capacity is the number of entries that the shard is able to hold.
+	Capacity int `json:"capacity"`
+	// Hits is the number of keys in the shard that resulted in a cache hit.
+	Hits int64 `json:"hits"`
+	// Misses is the number of keys in the shard that resulted in a cache miss.
+	Misses int64 `json:"misses"`
+	// EntriesEvicted is the number of entries that the shard has evicted.
+	EntriesEvicted int64 `json:"entries_evicted"`
+}
+
+// ShardStats returns the statistics of each shard. This can be used to
+// verify that the keys are evenly distributed, and to detect hot shards.
+// The counters are reset by ResetStats, just like the ones of Stats.
+//
+// Returns:
+//
+//	A slice with the statistics of each shard, ordered by index.
+func (c *Client[T]) ShardStats() []ShardStat {
+	stats := make([]ShardStat, len(c.shards))
+	for i, shard := range c.shards {
+		stats[i] = ShardStat{
+			Index:          i,
+			Size:           shard.size(),
+			Capacity:       shard.currentCapacity(),
+			Hits:           shard.counters.hits.Load(),
+			Misses:         shard.counters.misses.Load(),
+			EntriesEvicted: shard.counters.entriesEvicted.Load(),
+		}
+	}
+	return stats
+}
@@ -0,0 +1,115 @@
+package sturdyc
+
+import "slices"
+
+// setWithTags writes the value to the shard and replaces the tags of the
+// entry. The tags are only indexed if the value was written.
+func (s *shard[T]) setWithTags(key string, value T, tags []string) SetResult {
+	s.Lock()
+	defer s.unlock()
+	res := s.write(key, value, s.jitter(s.ttl), false)
+	if !res.Written {
+		return res
+	}
+
+	e := s.entries[s.transformKey(key)]
+	s.untag(e)
+	e.tags = slices.Clone(tags)
+	slices.Sort(e.tags)
+	e.tags = slices.Compact(e.tags)
+	if len(e.tags) > 0 && s.tagIndex == nil {
+		s.tagIndex = make(map[string]map[string]struct{})
+	}
+	for _, tag := range e.tags {
+		keys, ok := s.tagIndex[tag]
+		if !ok {
+			keys = make(map[string]struct{})
+			s.tagIndex[tag] = keys
+		}
+		keys[e.key] = struct{}{}
+	}
+	return res
+}
+
+// untag removes the key of the entry from the index of each of its tags. The
+// tags that are left without any keys are dropped, so that the index doesn't
+// grow with tags that are no longer in use. Should be called with a lock.
+func (s *shard[T]) untag(e *entry[T]) {
+	for _, tag := range e.tags {
+		keys := s.tagIndex[tag]
+		delete(keys, e.key)
+		if len(keys) == 0 {
+			delete(s.tagIndex, tag)
+		}
+	}
+	e.tags = nil
+}
+
+// invalidateTag removes every entry in the shard that has been tagged with
+// the tag, and returns the keys of the entries that were removed.
+func (s *shard[T]) invalidateTag(tag string) []string {
+	s.Lock()
+	defer s.unlock()
+	keys := s.tagIndex[tag]
+	deleted := make([]string, 0, len(keys))
+	for key := range keys {
+		if e, ok := s.entries[key]; ok {
+			s.remove(e, EvictionReasonDeleted)
+			deleted = append(deleted, key)
+		}
+	}
+	delete(s.tagIndex, tag)
+	return deleted
+}
+
+// SetWithTags writes a single value to the cache and associates it with the
+// tags, which allows it to be deleted together with every other entry that
+// shares one of them through client.InvalidateTag. The tags replace the ones
+// that the key had before, and they're kept if the entry is overwritten by a
+// write that doesn't specify any tags, such as a background refresh. The tags
+// are removed from the index as the entry is evicted or deleted.
+//
+// Parameters:
+//
+//	key - The key to be set.
+//	value - The value to be associated with the key.
+//	tags - The tags to associate the entry with.
+//
+// Returns:
+//
+//	A boolean indicating if the set operation triggered an eviction.
+func (c *Client[T]) SetWithTags(key string, value T, tags ...string) bool {
+	if !c.acceptsKey(key) {
+		return false
+	}
+	c.publishWrite(key, value)
+	shard := c.getShard(key)
+	res := shard.setWithTags(key, value, tags)
+	if res.Written {
+		c.bufferWrite(key, value)
+	}
+	return res.Written && res.OverCapacity
+}
+
+// InvalidateTag deletes every entry that has been tagged with the tag. Unlike
+// client.DeleteByPrefix, it doesn't have to scan the entries of the shards,
+// since each of them keeps an index of the keys that belong to the tag.
+//
+// Parameters:
+//
+//	tag - The tag of the entries to be deleted.
+//
+// Returns:
+//
+//	The number of entries that were deleted.
+func (c *Client[T]) InvalidateTag(tag string) int {
+	var deleted []string
+	for _, shard := range c.shards {
+		keys := shard.invalidateTag(tag)
+		c.discardWrites(keys...)
+		c.publishInvalidation(keys...)
+		deleted = append(deleted, keys...)
+	}
+	c.invalidateDistributed(deleted)
+	return len(deleted)
+}
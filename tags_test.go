@@ -0,0 +1,76 @@
+package sturdyc_test
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/creativecreature/sturdyc"
+)
+
+func TestInvalidateTagDeletesTheTaggedEntriesAcrossShards(t *testing.T) {
+	t.Parallel()
+
+	client := sturdyc.New[string](1000, 10, time.Hour, 5,
+		sturdyc.WithNoContinuousEvictions(),
+	)
+
+	for i := 0; i < 100; i++ {
+		tags := []string{"all"}
+		if i%2 == 0 {
+			tags = append(tags, "even")
+		}
+		client.SetWithTags(strconv.Itoa(i), "value", tags...)
+	}
+	client.Set("untagged", "value")
+
+	if n := client.InvalidateTag("even"); n != 50 {
+		t.Errorf("expected 50 entries to be invalidated, got %d", n)
+	}
+	if _, ok := client.Get("2"); ok {
+		t.Error("expected the entries that were tagged as even to be deleted")
+	}
+	if _, ok := client.Get("3"); !ok {
+		t.Error("expected the odd entries to remain in the cache")
+	}
+
+	if n := client.InvalidateTag("all"); n != 50 {
+		t.Errorf("expected the remaining 50 entries to be invalidated, got %d", n)
+	}
+	if client.Size() != 1 {
+		t.Errorf("expected only the untagged entry to remain, got %d entries", client.Size())
+	}
+}
+
+func TestTagsAreKeptConsistentWithTheEntries(t *testing.T) {
+	t.Parallel()
+
+	client := sturdyc.New[string](10, 1, time.Hour, 5,
+		sturdyc.WithNoContinuousEvictions(),
+	)
+
+	client.SetWithTags("1", "value", "a")
+	client.Delete("1")
+	// Writing the key again after it was deleted shouldn't bring back its old tag.
+	client.Set("1", "value")
+	if n := client.InvalidateTag("a"); n != 0 {
+		t.Errorf("expected the deleted entry to have been removed from the index, got %d", n)
+	}
+
+	// Overwriting the entry without tags keeps them, which allows it to be refreshed.
+	client.SetWithTags("2", "value", "b")
+	client.Set("2", "new value")
+	if n := client.InvalidateTag("b"); n != 1 {
+		t.Errorf("expected the tags to be kept when the entry is overwritten, got %d", n)
+	}
+
+	// Writing the entry with new tags replaces the old ones.
+	client.SetWithTags("3", "value", "c")
+	client.SetWithTags("3", "value", "d")
+	if n := client.InvalidateTag("c"); n != 0 {
+		t.Errorf("expected the old tags to be replaced, got %d", n)
+	}
+	if n := client.InvalidateTag("d"); n != 1 {
+		t.Errorf("expected the entry to be invalidated by its new tag, got %d", n)
+	}
+}
@@ -0,0 +1,68 @@
+package sturdyc
+
+import (
+	"context"
+	"fmt"
+)
+
+type fetchResult[V any] struct {
+	val V
+	err error
+}
+
+// callWithTimeout invokes the function with a context that is cancelled once
+// the fetch timeout has passed. The function runs in a goroutine of its own so
+// that the caller is released even if the function ignores its context.
+func callWithTimeout[V any](ctx context.Context, c *Config, fn func(ctx context.Context) (V, error)) (V, error) {
+	if c.fetchTimeout == 0 {
+		return fn(ctx)
+	}
+
+	ctx, cancel := c.timeoutContext(ctx)
+	defer cancel()
+
+	// The channel is buffered so that the goroutine is able to exit
+	// even if we've stopped waiting for it.
+	resultChan := make(chan fetchResult[V], 1)
+	go func() {
+		defer func() {
+			if err := recover(); err != nil {
+				resultChan <- fetchResult[V]{err: fmt.Errorf("sturdyc: panic recovered: %v", err)}
+			}
+		}()
+		val, err := fn(ctx)
+		resultChan <- fetchResult[V]{val: val, err: err}
+	}()
+
+	select {
+	case result := <-resultChan:
+		return result.val, result.err
+	case <-ctx.Done():
+		var zero V
+		return zero, context.Cause(ctx)
+	}
+}
+
+// timeoutContext returns a context that is cancelled with
+// context.DeadlineExceeded once the fetch timeout has passed on the clock of
+// the cache. The real clock gives the context a deadline, which allows the
+// fetch function to pass it on to the data source.
+func (c *Config) timeoutContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if _, ok := c.clock.(*RealClock); ok {
+		return context.WithTimeout(ctx, c.fetchTimeout)
+	}
+
+	ctx, cancel := context.WithCancelCause(ctx)
+	timer, stop := c.clock.NewTimer(c.fetchTimeout)
+	go func() {
+		select {
+		case <-timer:
+			cancel(context.DeadlineExceeded)
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, func() {
+		stop()
+		cancel(context.Canceled)
+	}
+}
@@ -0,0 +1,78 @@
+package sturdyc
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// warmChunkSize returns the number of IDs that client.Warm fetches with each
+// call to the fetchFn. It uses the batch size of the chunking or buffering
+// options, and fetches every ID at once if none of them are enabled.
+func (c *Client[T]) warmChunkSize(numIDs int) int {
+	if c.chunkFetches {
+		return c.fetchChunkSize
+	}
+	if c.bufferFetches {
+		return c.fetchBufferSize
+	}
+	if c.bufferRefreshes {
+		return c.bufferSize
+	}
+	return max(numIDs, 1)
+}
+
+// Warm populates the cache by fetching the ids from the underlying data
+// source. It's meant to be called at startup for a known set of IDs. Unlike
+// GetOrFetchBatch, it never reads from the cache, and it overwrites any
+// entries that already exist to make sure that the data is fresh. The IDs are
+// fetched in chunks of the batch size that was passed to WithBatchChunking,
+// WithFetchBuffering or WithRefreshCoalescing. A chunk that fails doesn't
+// abort the others, and the errors of every chunk are joined and returned once
+// all of them have been attempted. IDs that are missing from the response are stored as
+// missing records if the client has been configured to do so.
+//
+// Parameters:
+//
+//	ctx - The context to be used for the requests.
+//	ids - The list of IDs to be fetched.
+//	keyFn - Used to generate the cache key for each ID.
+//	fetchFn - Used to retrieve the data from the underlying data source.
+//
+// Returns:
+//
+//	The number of entries that were written to the cache, and the errors of the chunks that failed.
+func (c *Client[T]) Warm(ctx context.Context, ids []string, keyFn KeyFn, fetchFn BatchFetchFn[T]) (int, error) {
+	fetchFn = measuredBatchFetch(c.Config, fetchFn)
+	chunkSize := c.warmChunkSize(len(ids))
+	var populated int
+	var errs []error
+	for start := 0; start < len(ids); start += chunkSize {
+		if err := ctx.Err(); err != nil {
+			errs = append(errs, err)
+			break
+		}
+
+		chunk := ids[start:min(start+chunkSize, len(ids))]
+		response, err := callWithTimeout(ctx, c.Config, func(ctx context.Context) (map[string]T, error) {
+			return fetchFn(ctx, chunk)
+		})
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		if c.storeMissingRecords {
+			for _, id := range chunk {
+				if _, ok := response[id]; !ok {
+					c.StoreMissingRecord(keyFn(id))
+					populated++
+				}
+			}
+		}
+
+		c.setMany(response, keyFn, time.Duration(c.ttl.Load()), true)
+		populated += len(response)
+	}
+	return populated, errors.Join(errs...)
+}
@@ -0,0 +1,73 @@
+package sturdyc_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/creativecreature/sturdyc"
+)
+
+func TestWarmOverwritesTheExistingEntries(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	c := sturdyc.New[string](100, 2, time.Hour, 5, sturdyc.WithNoContinuousEvictions())
+	keyFn := c.BatchKeyFn("item")
+	c.Set(keyFn("1"), "stale")
+
+	fetchFn := func(_ context.Context, ids []string) (map[string]string, error) {
+		response := make(map[string]string, len(ids))
+		for _, id := range ids {
+			response[id] = "fresh" + id
+		}
+		return response, nil
+	}
+
+	populated, err := c.Warm(ctx, []string{"1", "2", "3"}, keyFn, fetchFn)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if populated != 3 {
+		t.Errorf("expected 3 entries to be populated, got %d", populated)
+	}
+	if v, _ := c.Get(keyFn("1")); v != "fresh1" {
+		t.Errorf("expected the existing entry to be overwritten, got %s", v)
+	}
+}
+
+func TestWarmFetchesInChunksAndAggregatesTheErrors(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	c := sturdyc.New[string](100, 2, time.Hour, 5,
+		sturdyc.WithNoContinuousEvictions(),
+		sturdyc.WithFetchBuffering(2, time.Second),
+	)
+
+	errUnavailable := errors.New("unavailable")
+	var chunks [][]string
+	fetchFn := func(_ context.Context, ids []string) (map[string]string, error) {
+		chunks = append(chunks, ids)
+		if ids[0] == "3" {
+			return nil, errUnavailable
+		}
+		response := make(map[string]string, len(ids))
+		for _, id := range ids {
+			response[id] = "value" + id
+		}
+		return response, nil
+	}
+
+	populated, err := c.Warm(ctx, []string{"1", "2", "3", "4", "5"}, c.BatchKeyFn("item"), fetchFn)
+	if !errors.Is(err, errUnavailable) {
+		t.Errorf("expected the error of the failed chunk, got %v", err)
+	}
+	if len(chunks) != 3 {
+		t.Errorf("expected the ids to be fetched in 3 chunks, got %v", chunks)
+	}
+	if populated != 3 {
+		t.Errorf("expected the chunks that succeeded to populate 3 entries, got %d", populated)
+	}
+}
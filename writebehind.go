@@ -0,0 +1,166 @@
+package sturdyc
+
+import (
+	"context"
+	"strings"
+	"sync"
+)
+
+// writeBehindShard holds the writes that are waiting to be flushed to the
+// distributed storage for a subset of the keys. The buffer is sharded so that
+// the goroutines which are writing different keys don't contend for one lock.
+type writeBehindShard[T any] struct {
+	sync.Mutex
+	pending map[string]T
+}
+
+// take returns the pending writes and resets the buffer. Should be called with the lock.
+func (s *writeBehindShard[T]) take() map[string]T {
+	records := s.pending
+	s.pending = make(map[string]T)
+	return records
+}
+
+type writeBehind[T any] struct {
+	batchSize int
+	shards    []*writeBehindShard[T]
+}
+
+func newWriteBehind[T any](batchSize, numShards int) *writeBehind[T] {
+	w := &writeBehind[T]{batchSize: batchSize, shards: make([]*writeBehindShard[T], numShards)}
+	for i := range w.shards {
+		w.shards[i] = &writeBehindShard[T]{pending: make(map[string]T)}
+	}
+	return w
+}
+
+// writeBehindShard returns the buffer that holds the pending write of the key.
+func (c *Client[T]) writeBehindShard(key string) *writeBehindShard[T] {
+	return c.writeBehind.shards[c.hashFn(key)%uint64(len(c.writeBehind.shards))]
+}
+
+// bufferWrite adds the write to the buffer of WithWriteBehind, and flushes the
+// buffer in the background once it holds a full batch. The last write of a
+// key wins if it's written several times before the buffer is flushed. It
+// should only be called once the value has been written to the cache.
+func (c *Client[T]) bufferWrite(key string, value T) {
+	if c.writeBehind == nil || c.readOnly.Load() {
+		return
+	}
+	s := c.writeBehindShard(key)
+	s.Lock()
+	s.pending[key] = value
+	if len(s.pending) < c.writeBehind.batchSize {
+		s.Unlock()
+		return
+	}
+	records := s.take()
+	s.Unlock()
+	c.safeGo(func() {
+		c.flushWrites(records)
+	})
+}
+
+// bufferRecords buffers the writes of the records.
+func (c *Client[T]) bufferRecords(records map[string]T) {
+	if c.writeBehind == nil {
+		return
+	}
+	for key, value := range records {
+		c.bufferWrite(key, value)
+	}
+}
+
+// discardWrites removes the pending writes of the keys, which ensures that
+// the keys that have been deleted aren't written back by the next flush.
+func (c *Client[T]) discardWrites(keys ...string) {
+	if c.writeBehind == nil {
+		return
+	}
+	for _, key := range keys {
+		s := c.writeBehindShard(key)
+		s.Lock()
+		delete(s.pending, key)
+		s.Unlock()
+	}
+}
+
+// discardWritesByPrefix removes the pending writes of every key that starts with the prefix.
+func (c *Client[T]) discardWritesByPrefix(prefix string) {
+	if c.writeBehind == nil {
+		return
+	}
+	for _, s := range c.writeBehind.shards {
+		s.Lock()
+		for key := range s.pending {
+			if strings.HasPrefix(key, prefix) {
+				delete(s.pending, key)
+			}
+		}
+		s.Unlock()
+	}
+}
+
+// discardAllWrites removes every pending write. It's used when the cache is cleared.
+func (c *Client[T]) discardAllWrites() {
+	if c.writeBehind == nil {
+		return
+	}
+	for _, s := range c.writeBehind.shards {
+		s.Lock()
+		s.take()
+		s.Unlock()
+	}
+}
+
+// flushWriteBehind writes every buffered write to the distributed storage.
+func (c *Client[T]) flushWriteBehind() {
+	for _, s := range c.writeBehind.shards {
+		s.Lock()
+		records := s.take()
+		s.Unlock()
+		c.flushWrites(records)
+	}
+}
+
+// flushWritesContinuously flushes the buffer every interval until the client
+// is closed. Close performs the final flush.
+func (c *Client[T]) flushWritesContinuously() {
+	c.safeGo(func() {
+		ticker, stop := c.clock.NewTicker(c.writeBehindInterval)
+		defer stop()
+		for {
+			select {
+			case <-c.done:
+				return
+			case <-ticker:
+				c.flushWriteBehind()
+			}
+		}
+	})
+}
+
+// flushWrites writes the records to the distributed storage in one batch.
+// The failures are passed to the handler of WithDistributedStorageErrorHandler.
+func (c *Client[T]) flushWrites(records map[string]T) {
+	if len(records) == 0 {
+		return
+	}
+	recordsToWrite := make(map[string][]byte, len(records))
+	keys := make([]string, 0, len(records))
+	for key, value := range records {
+		bytes, err := marshalRecord[T](value, key, c)
+		if err != nil {
+			continue
+		}
+		recordsToWrite[key] = bytes
+		keys = append(keys, key)
+	}
+	if len(keys) == 0 {
+		return
+	}
+	c.addToLookupFilter(keys...)
+	c.storageCall(context.Background(), distributedOpSet, keys, func(ctx context.Context) {
+		c.distributedSetBatch(ctx, recordsToWrite)
+	})
+}